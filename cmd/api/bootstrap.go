@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"keeper/internal/auth"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"log"
+)
+
+// bootstrapAdmin creates an admin employee with login credentials when the given
+// username does not exist yet. It does nothing if username or password is empty,
+// so that a fresh database can be accessed without pasting password hashes by hand.
+func bootstrapAdmin(ctx context.Context, store storage.Store, username, password string) error {
+	if username == "" || password == "" {
+		return nil
+	}
+
+	_, err := store.GetEmployeeCredentialByUsername(ctx, username)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// The employee and its credentials are created together, so a failure cannot leave an admin without a login
+	var id int
+	err = store.WithTx(ctx, func(tx storage.Store) error {
+		id, err = tx.CreateEmployee(ctx, &models.Employee{
+			Role:    models.RoleAdmin,
+			TIN:     "ADMIN-" + truncate(username, 10),
+			Name:    "Administrator",
+			Surname: "KEEPER",
+			Phone:   "-",
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.SetEmployeeCredential(ctx, &models.EmployeeCredential{
+			ID_Employee:  id,
+			Username:     username,
+			PasswordHash: hash,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Bootstrap admin %q created (employee #%d)", username, id)
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
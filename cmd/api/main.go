@@ -6,17 +6,36 @@ package main
 // @description API for the KEEPER Dealership Management System.
 // @host progetto-keeper.fly.dev
 // @BasePath /
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Type "Bearer" followed by a space and the access token.
 import (
+	"context"
+	"flag"
 	"keeper/internal/api"
+	"keeper/internal/auth"
+	"keeper/internal/migrate"
+	"keeper/internal/outbox"
 	"keeper/internal/storage"
 	"log"
 	"os"
+	"strconv"
+	"time"
+	_ "time/tzdata" // Time zones of dealerships, whether or not the image ships a zone database
 
 	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
 )
 
+// Usage:
+//
+//	api [-migrate]    start the server, applying pending migrations first with -migrate
+//	api migrate ...   manage the database schema, see migrateUsage
 func main() {
+	migrateOnStart := flag.Bool("migrate", false, "apply pending database migrations before starting the server")
+	flag.Parse()
+
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("Warning: .env file not found, using OS environment variables")
@@ -31,12 +50,97 @@ func main() {
 	if err != nil {
 		log.Fatal("failed to connect to the database: ", err)
 	}
-	// Initialize the validator
+	// Schema management subcommand
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(context.Background(), store.Db, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// Get the token signing secret from environment variables
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		log.Fatal("JWT_SECRET environment variable is not set")
+	}
+	// Bring the schema up to date when started with -migrate
+	if *migrateOnStart {
+		m, err := migrate.New(store.Db)
+		if err != nil {
+			log.Fatal("failed to load migrations: ", err)
+		}
+		if err := migrateUp(context.Background(), m); err != nil {
+			log.Fatal("failed to migrate the database: ", err)
+		}
+	}
+	// Every change made from here on is recorded in the audit log, and orders and appointments
+	// write their events to the outbox
+	audited := storage.NewAuditedStore(storage.NewOutboxStore(store))
+	// Create the first administrator account if requested
+	if err := bootstrapAdmin(context.Background(), audited, os.Getenv("ADMIN_USERNAME"), os.Getenv("ADMIN_PASSWORD")); err != nil {
+		log.Fatal("failed to bootstrap admin account: ", err)
+	}
+	// Initialize the validator and the token manager
 	validate := validator.New()
+	tokens := auth.NewTokenManager([]byte(jwtSecret))
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
-	server := api.NewAPIServer(":"+port, store, validate)
+	// Per-request deadline, e.g. "15s"; 0 disables it
+	var opts []api.Option
+	if raw := os.Getenv("REQUEST_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil {
+			log.Fatal("invalid REQUEST_TIMEOUT: ", err)
+		}
+		opts = append(opts, api.WithRequestTimeout(timeout))
+	}
+	if raw := os.Getenv("REQUIRE_IF_MATCH"); raw != "" {
+		required, err := strconv.ParseBool(raw)
+		if err != nil {
+			log.Fatal("invalid REQUIRE_IF_MATCH: ", err)
+		}
+		opts = append(opts, api.WithRequireIfMatch(required))
+	}
+	// Zone of the dealerships without a time_zone of their own, e.g. "Europe/Rome"
+	if raw := os.Getenv("DEFAULT_TIME_ZONE"); raw != "" {
+		loc, err := time.LoadLocation(raw)
+		if err != nil {
+			log.Fatal("invalid DEFAULT_TIME_ZONE: ", err)
+		}
+		opts = append(opts, api.WithTimeZone(loc))
+	}
+	if raw := os.Getenv("IDEMPOTENCY_TTL"); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil {
+			log.Fatal("invalid IDEMPOTENCY_TTL: ", err)
+		}
+		opts = append(opts, api.WithIdempotencyTTL(ttl))
+	}
+	// Deliver the outbox to the notifier service, e.g. http://notifier:5001/notify
+	if notifierURL := os.Getenv("NOTIFIER_URL"); notifierURL != "" {
+		var dispatcherOpts []outbox.Option
+		if raw := os.Getenv("NOTIFIER_MAX_ATTEMPTS"); raw != "" {
+			attempts, err := strconv.Atoi(raw)
+			if err != nil || attempts < 1 {
+				log.Fatal("invalid NOTIFIER_MAX_ATTEMPTS: ", raw)
+			}
+			dispatcherOpts = append(dispatcherOpts, outbox.WithMaxAttempts(attempts))
+		}
+		go outbox.NewDispatcher(store, notifierURL, dispatcherOpts...).Run(context.Background())
+	} else {
+		log.Println("Warning: NOTIFIER_URL is not set, outbox events are stored but not delivered")
+	}
+	// Deliver the events queued for the webhooks registered through /webhooks
+	var webhookOpts []outbox.Option
+	if raw := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); raw != "" {
+		attempts, err := strconv.Atoi(raw)
+		if err != nil || attempts < 1 {
+			log.Fatal("invalid WEBHOOK_MAX_ATTEMPTS: ", raw)
+		}
+		webhookOpts = append(webhookOpts, outbox.WithMaxAttempts(attempts))
+	}
+	go outbox.NewWebhookDispatcher(store, webhookOpts...).Run(context.Background())
+	server := api.NewAPIServer(":"+port, audited, validate, tokens, opts...)
 	server.Run()
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"keeper/internal/migrate"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `usage: api migrate <command>
+
+commands:
+  up            apply every pending migration
+  down [-n N]   revert the last N applied migrations (default 1)
+  status        list the migrations and when each was applied`
+
+// runMigrate implements the "migrate" subcommand
+func runMigrate(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", migrateUsage)
+	}
+	m, err := migrate.New(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx, m)
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("n", 1, "number of migrations to revert")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *steps < 1 {
+			return fmt.Errorf("-n must be at least 1")
+		}
+		reverted, err := m.Down(ctx, *steps)
+		for _, migration := range reverted {
+			log.Printf("reverted migration %d_%s", migration.Version, migration.Name)
+		}
+		if err == nil && len(reverted) == 0 {
+			log.Println("no migration to revert")
+		}
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, applied)
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+}
+
+// migrateUp applies the pending migrations and logs each of them
+func migrateUp(ctx context.Context, m *migrate.Migrator) error {
+	applied, err := m.Up(ctx)
+	for _, migration := range applied {
+		log.Printf("applied migration %d_%s", migration.Version, migration.Name)
+	}
+	if err == nil && len(applied) == 0 {
+		log.Println("database schema is up to date")
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+// Command schemacheck compares the models package with the schema of the database in
+// DATABASE_URL. It prints every mismatch and exits with status 1 if there is any, so it
+// can run in CI after the migrations.
+package main
+
+import (
+	"context"
+	"fmt"
+	"keeper/internal/schemacheck"
+	"keeper/internal/storage"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: .env file not found, using OS environment variables")
+	}
+	connString := os.Getenv("DATABASE_URL")
+	if connString == "" {
+		log.Fatal("DATABASE_URL environment variable is not set")
+	}
+	store, err := storage.NewPostgresStore(connString)
+	if err != nil {
+		log.Fatal("failed to connect to the database: ", err)
+	}
+
+	schema, err := schemacheck.Load(context.Background(), store.Db)
+	if err != nil {
+		log.Fatal("failed to read the database schema: ", err)
+	}
+	mismatches := schemacheck.Compare(schema, schemacheck.Models...)
+	for _, mismatch := range mismatches {
+		fmt.Println(mismatch)
+	}
+	if len(mismatches) > 0 {
+		fmt.Fprintf(os.Stderr, "%d mismatches between the models and the database\n", len(mismatches))
+		os.Exit(1)
+	}
+	fmt.Println("models match the database schema")
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"keeper/internal/storage"
+	"net/http"
+)
+
+// auditParams maps the short query parameters of GET /audit onto the fields of the audit log
+var auditParams = map[string]string{
+	"id":    "entity_id",
+	"actor": "id_employee",
+	"from":  "changed_at_from",
+	"to":    "changed_at_to",
+}
+
+// @Summary      Query the audit log
+// @Description  Lists the creates, updates and deletes made through the API, newest first, with the employee and request that made each change and the changed fields before and after. Admin only.
+// @Tags         Audit
+// @Security     BearerAuth
+// @Produce      json
+// @Param        entity     query     string  false  "Kind of record, e.g. car, client or appointment"
+// @Param        id         query     int     false  "ID of the record"
+// @Param        actor      query     int     false  "Employee who made the change"
+// @Param        action     query     string  false  "create, update or delete"
+// @Param        from       query     string  false  "Changes at or after this time (YYYY-MM-DD or RFC 3339)"
+// @Param        to         query     string  false  "Changes at or before this time (YYYY-MM-DD or RFC 3339)"
+// @Param        page       query     int     false  "Page number (1-based)"
+// @Param        page_size  query     int     false  "Page size (default 50, max 200)"
+// @Param        cursor     query     string  false  "Opaque cursor returned as next_cursor by a previous page"
+// @Success      200 {object}  ListResponse{data=[]models.AuditEntry}
+// @Failure      400 {object}  Problem  "Error: Invalid query parameter"
+// @Failure      401 {object}  Problem  "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem  "Error: Insufficient permissions"
+// @Failure      500 {object}  Problem  "Error: Internal server error"
+// @Router       /audit [get]
+func (s *APIServer) handleGetAudit(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	for param, field := range auditParams {
+		if raw, ok := values[param]; ok {
+			values.Del(param)
+			values[field] = raw
+		}
+	}
+	req := r.Clone(r.Context())
+	req.URL.RawQuery = values.Encode()
+
+	query, err := parseListQuery(req, storage.AuditFields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+	if len(query.Sort) == 0 {
+		query.Sort = []storage.Sort{{Field: "id_audit", Desc: true}}
+	}
+
+	page, err := s.store.ListAuditEntries(r.Context(), query)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newListResponse(page, query))
+}
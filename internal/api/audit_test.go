@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuditAPI(t *testing.T) {
+	server := newTestServer(t, storage.NewAuditedStore(storage.NewMemoryStore()))
+
+	send := func(method, url, body string, employeeID int, role models.Role) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		pair, err := server.tokens.IssuePair(employeeID, role)
+		if err != nil {
+			t.Fatalf("unable to issue test token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send(http.MethodPost, "/clients", `{"type": "private", "tin_vat": "RSSMRA80A01E506X", "name": "Mario"}`, 4, models.RoleAssistant)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("creating client: "+errStatusMismatch, rr.Code, http.StatusCreated)
+	}
+	var created map[string]int
+	json.NewDecoder(rr.Body).Decode(&created)
+	clientURL := fmt.Sprintf("/clients/%d", created["id"])
+	if rr := send(http.MethodPatch, clientURL, `{"tin_vat": "VRDLGU90B02E506Y"}`, 5, models.RoleSalesperson); rr.Code != http.StatusOK {
+		t.Fatalf("patching client: "+errStatusMismatch, rr.Code, http.StatusOK)
+	}
+
+	list := func(query string) ListResponse[models.AuditEntry] {
+		t.Helper()
+		rr := send(http.MethodGet, "/audit"+query, "", 1, models.RoleAdmin)
+		if rr.Code != http.StatusOK {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusOK)
+		}
+		var resp ListResponse[models.AuditEntry]
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding audit log: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("it lists changes newest first", func(t *testing.T) {
+		resp := list(fmt.Sprintf("?entity=client&id=%d", created["id"]))
+		if len(resp.Data) != 2 {
+			t.Fatalf("got %d entries, want 2", len(resp.Data))
+		}
+		update := resp.Data[0]
+		if update.Action != models.AuditUpdate || update.ID_Employee == nil || *update.ID_Employee != 5 {
+			t.Errorf("newest entry = %+v, want the update by employee 5", update)
+		}
+		if change := update.Diff["tin_vat"]; change.Before != "RSSMRA80A01E506X" || change.After != "VRDLGU90B02E506Y" {
+			t.Errorf("tin_vat change = %+v", change)
+		}
+		if update.RequestID == nil || *update.RequestID == "" {
+			t.Errorf("entry has no request ID")
+		}
+	})
+
+	t.Run("it filters by actor and time", func(t *testing.T) {
+		if resp := list("?actor=4"); len(resp.Data) != 1 || resp.Data[0].Action != models.AuditCreate {
+			t.Errorf("changes by employee 4 = %+v, want the create", resp.Data)
+		}
+		tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+		if resp := list("?from=" + tomorrow); len(resp.Data) != 0 {
+			t.Errorf("changes from tomorrow = %+v, want none", resp.Data)
+		}
+		if rr := send(http.MethodGet, "/audit?from=yesterday", "", 1, models.RoleAdmin); rr.Code != http.StatusBadRequest {
+			t.Errorf("invalid from: "+errStatusMismatch, rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("it is reserved to admins", func(t *testing.T) {
+		if rr := send(http.MethodGet, "/audit", "", 2, models.RoleManager); rr.Code != http.StatusForbidden {
+			t.Errorf(errStatusMismatch, rr.Code, http.StatusForbidden)
+		}
+	})
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"keeper/internal/auth"
+	"keeper/internal/models"
+	"net/http"
+)
+
+var (
+	errInvalidCredentials      = errors.New("invalid username or password")
+	errCurrentPasswordRequired = errors.New("current_password is required to change one's own credentials")
+	errWrongCurrentPassword    = errors.New("current password is wrong")
+)
+
+// LoginRequest is the payload accepted by POST /auth/login
+type LoginRequest struct {
+	Username string `json:"username" validate:"required,max=50"`
+	Password string `json:"password" validate:"required"`
+}
+
+// RefreshRequest is the payload accepted by POST /auth/refresh
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// CredentialsRequest is the payload accepted by PUT /employees/{id}/credentials
+type CredentialsRequest struct {
+	Username string `json:"username" validate:"required,max=50"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+	// CurrentPassword is required when employees change their own credentials, so that a stolen
+	// access token cannot be used to take the account over; admins setting them may omit it
+	CurrentPassword string `json:"current_password,omitempty" validate:"omitempty,max=72"`
+}
+
+// Authentication Handlers //
+
+// @Summary      Login
+// @Description  Authenticates an employee and returns a signed access/refresh token pair.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        credentials  body      LoginRequest       true  "Employee credentials"
+// @Success      200          {object}  auth.TokenPair
+// @Failure      400          {object}  Problem            "Error: Invalid request payload"
+// @Failure      401          {object}  Problem            "Error: Invalid username or password"
+// @Failure      500          {object}  Problem            "Error: Internal server error"
+// @Router       /auth/login [post]
+func (s *APIServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if !s.validateRequest(w, r, &req) {
+		return
+	}
+
+	credential, err := s.store.GetEmployeeCredentialByUsername(r.Context(), req.Username)
+	if err != nil {
+		if isNotFound(err) {
+			writeError(w, http.StatusUnauthorized, errInvalidCredentials)
+			logError(r, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		logError(r, err)
+		return
+	}
+
+	ok, err := auth.CheckPassword(credential.PasswordHash, req.Password)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		logError(r, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errInvalidCredentials)
+		logError(r, errInvalidCredentials)
+		return
+	}
+
+	s.issueTokens(w, r, credential.ID_Employee)
+}
+
+// @Summary      Refresh tokens
+// @Description  Exchanges a valid refresh token for a new access/refresh token pair.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        token  body      RefreshRequest     true  "Refresh token"
+// @Success      200    {object}  auth.TokenPair
+// @Failure      400    {object}  Problem            "Error: Invalid request payload"
+// @Failure      401    {object}  Problem            "Error: Invalid or expired refresh token"
+// @Failure      500    {object}  Problem            "Error: Internal server error"
+// @Router       /auth/refresh [post]
+func (s *APIServer) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if !s.validateRequest(w, r, &req) {
+		return
+	}
+
+	claims, err := s.tokens.Parse(req.RefreshToken, auth.TokenTypeRefresh)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		logError(r, err)
+		return
+	}
+
+	employeeID, err := claims.EmployeeID()
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		logError(r, err)
+		return
+	}
+
+	s.issueTokens(w, r, employeeID)
+}
+
+// @Summary      Current employee
+// @Description  Returns the employee record of the authenticated caller.
+// @Tags         Auth
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  models.Employee
+// @Failure      401  {object}  Problem           "Error: Missing or invalid token"
+// @Failure      500  {object}  Problem           "Error: Internal server error"
+// @Router       /auth/me [get]
+func (s *APIServer) handleMe(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	employee, err := s.store.GetEmployeeByID(r.Context(), principal.EmployeeID)
+	if err != nil {
+		if isNotFound(err) {
+			writeError(w, http.StatusUnauthorized, auth.ErrInvalidToken)
+			logError(r, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		logError(r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, employee)
+}
+
+// @Summary      Set Employee credentials
+// @Description  Sets the login username and password of an employee. Admins may set any employee's credentials, other employees only their own, confirming them with current_password.
+// @Tags         Employees
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id           path      int                 true  "Employee ID"
+// @Param        credentials  body      CredentialsRequest  true  "New credentials"
+// @Success      204 "No Content"
+// @Failure      400 {object}  Problem           "Error: Invalid ID or request payload, or current password missing"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions, or wrong current password"
+// @Failure      404 {object}  Problem           "Error: Employee not found"
+// @Failure      409 {object}  Problem           "Error: Username already in use"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /employees/{id}/credentials [put]
+func (s *APIServer) handleSetEmployeeCredentials(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	if principal.EmployeeID != id && !principal.HasRole(models.RoleAdmin) {
+		writeError(w, http.StatusForbidden, errForbidden)
+		logError(r, errForbidden)
+		return
+	}
+
+	var req CredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if !s.validateRequest(w, r, &req) {
+		return
+	}
+
+	if _, err := s.store.GetEmployeeByID(r.Context(), id); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if !principal.HasRole(models.RoleAdmin) && !s.checkCurrentPassword(w, r, id, req.CurrentPassword) {
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		logError(r, err)
+		return
+	}
+
+	credential := &models.EmployeeCredential{ID_Employee: id, Username: req.Username, PasswordHash: hash}
+	if err := s.store.SetEmployeeCredential(r.Context(), credential); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkCurrentPassword verifies the current password of an employee changing their own credentials.
+// It writes 400 Bad Request if it is missing, 403 Forbidden if it is wrong, and returns false.
+func (s *APIServer) checkCurrentPassword(w http.ResponseWriter, r *http.Request, employeeID int, password string) bool {
+	if password == "" {
+		writeError(w, http.StatusBadRequest, errCurrentPasswordRequired)
+		logError(r, errCurrentPasswordRequired)
+		return false
+	}
+
+	credential, err := s.store.GetEmployeeCredentialByEmployeeID(r.Context(), employeeID)
+	if err != nil && !isNotFound(err) {
+		writeError(w, http.StatusInternalServerError, err)
+		logError(r, err)
+		return false
+	}
+	ok := false
+	if credential != nil {
+		if ok, err = auth.CheckPassword(credential.PasswordHash, password); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			logError(r, err)
+			return false
+		}
+	}
+	if !ok {
+		writeError(w, http.StatusForbidden, errWrongCurrentPassword)
+		logError(r, errWrongCurrentPassword)
+		return false
+	}
+	return true
+}
+
+// issueTokens loads the employee's current role and writes a fresh token pair.
+// The role is always read from storage so that role changes take effect on the next refresh.
+func (s *APIServer) issueTokens(w http.ResponseWriter, r *http.Request, employeeID int) {
+	employee, err := s.store.GetEmployeeByID(r.Context(), employeeID)
+	if err != nil {
+		if isNotFound(err) {
+			writeError(w, http.StatusUnauthorized, errInvalidCredentials)
+			logError(r, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		logError(r, err)
+		return
+	}
+
+	pair, err := s.tokens.IssuePair(employee.ID_Employee, employee.Role)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		logError(r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, pair)
+}
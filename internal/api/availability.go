@@ -0,0 +1,181 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// slotStep is the granularity at which candidate start times are offered
+const slotStep = 15 * time.Minute
+
+// Slot is a time range, used both for free slots and for existing bookings
+type Slot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// AvailabilityResponse lists the free slots of an employee on a given day
+type AvailabilityResponse struct {
+	ID_Employee     int    `json:"id_employee"`
+	ID_Dealership   int    `json:"id_dealership"`
+	Date            string `json:"date"`
+	DurationMinutes int    `json:"duration_minutes"`
+	Slots           []Slot `json:"slots"`
+}
+
+// @Summary      Appointment availability
+// @Description  Returns the free slots of an employee at a dealership on a given day, within the opening hours of the dealership, in steps of 15 minutes. The day and the slots are in the time zone of the dealership. A closed day has no slots.
+// @Tags         Appointments
+// @Security     BearerAuth
+// @Produce      json
+// @Param        employee    query     int     true   "Employee ID"
+// @Param        dealership  query     int     true   "Dealership ID"
+// @Param        date        query     string  true   "Day (YYYY-MM-DD)"
+// @Param        duration    query     int     false  "Length of the wanted appointment in minutes (default 30)"
+// @Success      200  {object}  AvailabilityResponse
+// @Failure      400  {object}  Problem           "Error: Invalid query parameters"
+// @Failure      401  {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403  {object}  Problem           "Error: Insufficient permissions"
+// @Failure      500  {object}  Problem           "Error: Internal server error"
+// @Router       /appointments/availability [get]
+func (s *APIServer) handleGetAvailability(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	employeeID, err := strconv.Atoi(values.Get("employee"))
+	if err != nil {
+		err = errors.New("employee must be an employee ID")
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	dealershipID, err := strconv.Atoi(values.Get("dealership"))
+	if err != nil {
+		err = errors.New("dealership must be a dealership ID")
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	date := values.Get("date")
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		err = errors.New("date must be a day in the form YYYY-MM-DD")
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	minutes := models.DefaultAppointmentMinutes
+	if raw := values.Get("duration"); raw != "" {
+		minutes, err = strconv.Atoi(raw)
+		if err != nil || minutes < models.MinAppointmentMinutes || minutes > models.MaxAppointmentMinutes {
+			err = fmt.Errorf("duration must be between %d and %d minutes", models.MinAppointmentMinutes, models.MaxAppointmentMinutes)
+			writeError(w, http.StatusBadRequest, err)
+			logError(r, err)
+			return
+		}
+	}
+
+	if !s.authorizeDealerships(w, r, dealershipID) {
+		return
+	}
+
+	employments, err := s.store.ListEmployments(r.Context(), &storage.ListQuery{
+		Filters: []storage.Filter{
+			{Field: "id_employee", Op: storage.OpEq, Value: employeeID},
+			{Field: "id_dealership", Op: storage.OpEq, Value: dealershipID},
+			{Field: "active", Op: storage.OpEq, Value: true},
+		},
+		Limit: 1,
+	})
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	if employments.Total == 0 {
+		err := fmt.Errorf("employee %d does not work at dealership %d", employeeID, dealershipID)
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	// The day starts at midnight in the time zone of the dealership
+	loc, err := s.dealershipLocation(r.Context(), dealershipID)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	day, _ := time.ParseInLocation("2006-01-02", date, loc)
+
+	// Appointments of the previous evening can still run into the morning, so look back by the longest duration
+	appointments, err := s.store.ListAppointments(r.Context(), &storage.ListQuery{
+		Filters: []storage.Filter{
+			{Field: "id_employee", Op: storage.OpEq, Value: employeeID},
+			{Field: "date", Op: storage.OpGte, Value: day.Add(-models.MaxAppointmentMinutes * time.Minute)},
+			{Field: "date", Op: storage.OpLt, Value: day.AddDate(0, 0, 1)},
+		},
+	})
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	busy := make([]Slot, len(appointments.Items))
+	for i, a := range appointments.Items {
+		busy[i] = Slot{Start: a.Date, End: a.End()}
+	}
+
+	windows, err := s.dealershipWindows(r.Context(), dealershipID, day)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		logError(r, err)
+		return
+	}
+
+	slots := []Slot{}
+	for _, window := range windows {
+		slots = append(slots, freeSlots(window, busy, time.Duration(minutes)*time.Minute, slotStep, time.Now())...)
+	}
+
+	writeJSON(w, http.StatusOK, &AvailabilityResponse{
+		ID_Employee:     employeeID,
+		ID_Dealership:   dealershipID,
+		Date:            day.Format("2006-01-02"),
+		DurationMinutes: minutes,
+		Slots:           slots,
+	})
+}
+
+// freeSlots returns every slot of length duration inside window, starting on a multiple of step from the
+// window start and no earlier than notBefore, that overlaps none of the busy ranges
+func freeSlots(window Slot, busy []Slot, duration, step time.Duration, notBefore time.Time) []Slot {
+	slots := []Slot{}
+	for start := window.Start; !start.Add(duration).After(window.End); start = start.Add(step) {
+		if start.Before(notBefore) {
+			continue
+		}
+
+		candidate := Slot{Start: start, End: start.Add(duration)}
+		free := true
+		for _, b := range busy {
+			if candidate.overlaps(b) {
+				free = false
+				break
+			}
+		}
+		if free {
+			slots = append(slots, candidate)
+		}
+	}
+	return slots
+}
+
+// overlaps reports whether two half-open ranges [Start, End) intersect
+func (s Slot) overlaps(other Slot) bool {
+	return s.Start.Before(other.End) && other.Start.Before(s.End)
+}
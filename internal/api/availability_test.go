@@ -0,0 +1,41 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFreeSlots(t *testing.T) {
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+	window := Slot{Start: at(9, 0), End: at(11, 15)}
+
+	busy := []Slot{
+		{Start: at(9, 30), End: at(10, 0)},
+		{Start: at(10, 15), End: at(10, 45)},
+	}
+
+	got := freeSlots(window, busy, 30*time.Minute, 15*time.Minute, time.Time{})
+	want := []time.Time{at(9, 0), at(10, 45)}
+	if len(got) != len(want) {
+		t.Fatalf("got %d slots %v, want %d", len(got), got, len(want))
+	}
+	for i, slot := range got {
+		if !slot.Start.Equal(want[i]) || !slot.End.Equal(want[i].Add(30*time.Minute)) {
+			t.Errorf("slot %d: got %s-%s, want start %s", i, slot.Start, slot.End, want[i])
+		}
+	}
+
+	t.Run("not before", func(t *testing.T) {
+		got := freeSlots(window, nil, 30*time.Minute, 15*time.Minute, at(10, 20))
+		if len(got) != 2 || !got[0].Start.Equal(at(10, 30)) {
+			t.Errorf("got %v, want slots from 10:30", got)
+		}
+	})
+
+	t.Run("longer than the window", func(t *testing.T) {
+		if got := freeSlots(window, nil, 3*time.Hour, 15*time.Minute, time.Time{}); len(got) != 0 {
+			t.Errorf("got %v, want no slots", got)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"keeper/internal/storage"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	errIfMatchRequired = errors.New("send the ETag of the resource in the If-Match header to change it")
+	errInvalidIfMatch  = errors.New(`If-Match must be a single entity tag, e.g. "3", or *`)
+)
+
+// setETag sets the ETag header of a response to the version of the resource it carries
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// ifMatch returns the version that the If-Match header of a write expects the resource to be at,
+// or 0 when any version will do: the header is "*" or missing and not required by the server.
+// On failure it writes the error and returns false.
+func (s *APIServer) ifMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch {
+	case header == "" && s.requireIfMatch:
+		writeError(w, http.StatusPreconditionRequired, errIfMatchRequired)
+		logError(r, errIfMatchRequired)
+		return 0, false
+	case header == "", header == "*":
+		return 0, true
+	case strings.HasPrefix(header, "W/"):
+		// If-Match uses the strong comparison, which a weak entity tag never passes
+		err := fmt.Errorf("%w: weak entity tag %s never matches", storage.ErrVersionMismatch, header)
+		writeError(w, http.StatusPreconditionFailed, err)
+		logError(r, err)
+		return 0, false
+	}
+
+	unquoted, err := strconv.Unquote(header)
+	if err != nil || !strings.HasPrefix(header, `"`) {
+		writeError(w, http.StatusBadRequest, errInvalidIfMatch)
+		logError(r, errInvalidIfMatch)
+		return 0, false
+	}
+	version, err := strconv.Atoi(unquoted)
+	if err != nil || version < 1 {
+		// A well-formed tag the server never issued cannot match the current version
+		err := fmt.Errorf("%w: unknown entity tag %s", storage.ErrVersionMismatch, header)
+		writeError(w, http.StatusPreconditionFailed, err)
+		logError(r, err)
+		return 0, false
+	}
+	return version, true
+}
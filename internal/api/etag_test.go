@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"keeper/internal/auth"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestDealershipPreconditions(t *testing.T) {
+	store := storage.NewMemoryStore()
+	server := newTestServer(t, store)
+
+	id, err := store.CreateDealership(context.Background(), &models.Dealership{PostalCode: "73100", City: "Lecce", Address: "Via Roma 1", Phone: "0832"})
+	if err != nil {
+		t.Fatalf("unable to insert test dealership: %v", err)
+	}
+	url := fmt.Sprintf("/dealerships/%d", id)
+	body := `{"postalcode": "70121", "city": "Bari", "address": "Via Sparano 2", "phone": "080"}`
+
+	send := func(method, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		authorize(t, server, req, models.RoleAdmin)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send(http.MethodGet, "", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf(errStatusMismatch, rr.Code, http.StatusOK)
+	}
+	if etag := rr.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf(`ETag = %s, want "1"`, etag)
+	}
+
+	rr = send(http.MethodPut, `"1"`, body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PUT with the current ETag: "+errStatusMismatch, rr.Code, http.StatusOK)
+	}
+	if etag := rr.Header().Get("ETag"); etag != `"2"` {
+		t.Errorf(`ETag after PUT = %s, want "2"`, etag)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		ifMatch string
+		body    string
+		status  int
+		code    string
+	}{
+		{"a stale PUT", http.MethodPut, `"1"`, body, http.StatusPreconditionFailed, CodeVersionMismatch},
+		{"a stale PATCH", http.MethodPatch, `"1"`, `{"city": "Brindisi"}`, http.StatusPreconditionFailed, CodeVersionMismatch},
+		{"a stale DELETE", http.MethodDelete, `"1"`, "", http.StatusPreconditionFailed, CodeVersionMismatch},
+		{"a weak ETag", http.MethodDelete, `W/"2"`, "", http.StatusPreconditionFailed, CodeVersionMismatch},
+		{"an ETag the server never issued", http.MethodDelete, `"abc"`, "", http.StatusPreconditionFailed, CodeVersionMismatch},
+		{"an unquoted ETag", http.MethodDelete, `2`, "", http.StatusBadRequest, CodeBadRequest},
+		{"a list of ETags", http.MethodDelete, `"1", "2"`, "", http.StatusBadRequest, CodeBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run("it rejects "+tt.name, func(t *testing.T) {
+			rr := send(tt.method, tt.ifMatch, tt.body)
+			if rr.Code != tt.status {
+				t.Fatalf(errStatusMismatch, rr.Code, tt.status)
+			}
+			if p := decodeProblem(t, rr); p.Code != tt.code {
+				t.Errorf("code = %q, want %q", p.Code, tt.code)
+			}
+		})
+	}
+
+	if dealership, _ := store.GetDealershipByID(context.Background(), id); dealership.City != "Bari" || dealership.Version != 2 {
+		t.Errorf("a rejected write changed the dealership: %+v", dealership)
+	}
+
+	if rr := send(http.MethodPatch, "*", `{"city": "Brindisi"}`); rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"3"` {
+		t.Errorf(`PATCH with If-Match *: status %d, ETag %s; want 200 and "3"`, rr.Code, rr.Header().Get("ETag"))
+	}
+	if rr := send(http.MethodDelete, `"3"`, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("DELETE with the current ETag: "+errStatusMismatch, rr.Code, http.StatusNoContent)
+	}
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	store := storage.NewMemoryStore()
+	server := NewAPIServer(":0", store, validator.New(), auth.NewTokenManager([]byte(testJWTSecret)), WithRequireIfMatch(true))
+
+	id, err := store.CreateDealership(context.Background(), &models.Dealership{PostalCode: "73100", City: "Lecce", Address: "Via Roma 1", Phone: "0832"})
+	if err != nil {
+		t.Fatalf("unable to insert test dealership: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/dealerships/%d", id), nil)
+	authorize(t, server, req, models.RoleAdmin)
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusPreconditionRequired {
+		t.Fatalf(errStatusMismatch, rr.Code, http.StatusPreconditionRequired)
+	}
+	if p := decodeProblem(t, rr); p.Code != CodeIfMatchRequired {
+		t.Errorf("code = %q, want %q", p.Code, CodeIfMatchRequired)
+	}
+	if _, err := store.GetDealershipByID(context.Background(), id); err != nil {
+		t.Errorf("DELETE without If-Match removed the dealership: %v", err)
+	}
+}
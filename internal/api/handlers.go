@@ -2,16 +2,18 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"keeper/internal/auth"
 	"keeper/internal/models"
+	"keeper/internal/storage"
 	"net/http"
-	"strings"
-
-	"gorm.io/gorm"
+	"slices"
 )
 
-// Error constants
-const (
-	ErrCannotDeleteReferenced = "cannot delete: referenced by"
+var (
+	errStatusNotPatchable = errors.New("status cannot be patched, use POST /cars/{id}/status")
+	errWorkshopCarPatch   = errors.New("mechanics can only patch the km and condition of a car")
 )
 
 // @Summary      Health Check
@@ -29,12 +31,18 @@ func (s *APIServer) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 // @Summary      Create a new Dealership
 // @Description  Adds a new dealership to the system from the provided JSON payload.
 // @Tags         Dealerships
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        dealership  body      models.Dealership  true  "New Dealership Data"
+// @Param        Idempotency-Key  header  string  false  "Makes retries return the response of the first request"
 // @Success      201         {object}  map[string]int     "Returns the ID of the newly created dealership"
-// @Failure      400         {object}  map[string]string  "Error: Invalid request payload"
-// @Failure      500         {object}  map[string]string  "Error: Internal server error"
+// @Failure      400         {object}  Problem            "Error: Invalid request payload"
+// @Failure      401         {object}  Problem            "Error: Missing or invalid token"
+// @Failure      403         {object}  Problem            "Error: Insufficient permissions"
+// @Failure      409         {object}  Problem            "Error: A request with the same Idempotency-Key is in progress"
+// @Failure      422         {object}  Problem            "Error: Idempotency-Key reused with a different body"
+// @Failure      500         {object}  Problem            "Error: Internal server error"
 // @Router       /dealerships [post]
 func (s *APIServer) handleCreateDealership(w http.ResponseWriter, r *http.Request) {
 	var newDealership models.Dealership
@@ -48,10 +56,9 @@ func (s *APIServer) handleCreateDealership(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	newID, err := s.store.CreateDealership(&newDealership)
+	newID, err := s.store.CreateDealership(r.Context(), &newDealership)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+		writeStorageError(w, r, err)
 		return
 	}
 	writeJSON(w, http.StatusCreated, map[string]int{"id": newID})
@@ -60,31 +67,86 @@ func (s *APIServer) handleCreateDealership(w http.ResponseWriter, r *http.Reques
 // @Summary      List all Dealerships
 // @Description  Retrieves a list of all dealership branches.
 // @Tags         Dealerships
+// @Security     BearerAuth
 // @Produce      json
-// @Success      200  {array}   models.Dealership
-// @Failure      500  {object}  map[string]string "Error: Internal server error"
+// @Param        page       query     int     false  "Page number (1-based)"
+// @Param        page_size  query     int     false  "Page size (default 50, max 200)"
+// @Param        cursor     query     string  false  "Opaque cursor returned as next_cursor by a previous page"
+// @Param        sort       query     string  false  "Comma-separated sort fields, prefix with - for descending"
+// @Param        city       query     string  false  "Filter by city"
+// @Param        postalcode query     string  false  "Filter by postal code"
+// @Success      200  {object}  ListResponse{data=[]models.Dealership}
+// @Failure      400  {object}  Problem           "Error: Invalid query parameters"
+// @Failure      401  {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403  {object}  Problem           "Error: Insufficient permissions"
+// @Failure      500  {object}  Problem           "Error: Internal server error"
 // @Router       /dealerships [get]
 func (s *APIServer) handleGetDealerships(w http.ResponseWriter, r *http.Request) {
-	dealerships, err := s.store.GetDealerships()
+	query, err := parseListQuery(r, storage.DealershipFields)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	page, err := s.store.ListDealerships(r.Context(), query)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newListResponse(page, query))
+}
+
+// @Summary      Get a Dealership
+// @Description  Retrieves a single dealership by its ID.
+// @Tags         Dealerships
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Dealership ID"
+// @Success      200 {object}  models.Dealership
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Dealership not found"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /dealerships/{id} [get]
+func (s *APIServer) handleGetDealershipByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
 		logError(r, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, dealerships)
+	dealership, err := s.store.GetDealershipByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, dealership.Version)
+	writeJSON(w, http.StatusOK, dealership)
 }
 
 // @Summary      Update a Dealership
 // @Description  Updates an existing dealership's data by its ID.
 // @Tags         Dealerships
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        id          path      int                true  "Dealership ID"
+// @Param        If-Match    header    string             false "ETag of the version being changed"
 // @Param        dealership  body      models.Dealership  true  "Updated Dealership Data"
 // @Success      200         {object}  models.Dealership
-// @Failure      400         {object}  map[string]string "Error: Invalid ID or request payload"
-// @Failure      500         {object}  map[string]string "Error: Internal server error"
+// @Header       200         {string}  ETag  "Version of the resource"
+// @Failure      400         {object}  Problem           "Error: Invalid ID or request payload"
+// @Failure      401         {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403         {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404         {object}  Problem           "Error: Dealership not found"
+// @Failure      412         {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      428         {object}  Problem           "Error: If-Match required"
+// @Failure      500         {object}  Problem           "Error: Internal server error"
 // @Router       /dealerships/{id} [put]
 func (s *APIServer) handleUpdateDealership(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
@@ -94,6 +156,11 @@ func (s *APIServer) handleUpdateDealership(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
 	var updatedDealership models.Dealership
 	if err := json.NewDecoder(r.Body).Decode(&updatedDealership); err != nil {
 		writeError(w, http.StatusBadRequest, err)
@@ -105,22 +172,98 @@ func (s *APIServer) handleUpdateDealership(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err := s.store.UpdateDealership(id, &updatedDealership); err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	updatedDealership.Version = version
+	if err := s.store.UpdateDealership(r.Context(), id, &updatedDealership); err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
+	setETag(w, updatedDealership.Version)
 	writeJSON(w, http.StatusOK, updatedDealership)
 }
 
+// @Summary      Patch a Dealership
+// @Description  Partially updates a dealership by its ID. The body is a JSON merge patch (RFC 7396): members replace the stored values and null clears them. The result is validated like a full update.
+// @Tags         Dealerships
+// @Security     BearerAuth
+// @Accept       json,application/merge-patch+json
+// @Produce      json
+// @Param        id          path      int                true  "Dealership ID"
+// @Param        If-Match    header    string             false "ETag of the version being changed"
+// @Param        dealership  body      models.Dealership  true  "Fields to update (partial dealership data)"
+// @Success      200 {object}  models.Dealership
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID, request payload or read-only field"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Dealership not found"
+// @Failure      412 {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      415 {object}  Problem           "Error: Unsupported content type"
+// @Failure      428 {object}  Problem           "Error: If-Match required"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /dealerships/{id} [patch]
+func (s *APIServer) handlePatchDealership(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	patch, ok := readMergePatch(w, r)
+	if !ok {
+		return
+	}
+
+	dealership, err := s.store.GetDealershipByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if err := applyMergePatch(dealership, patch, dealershipPatchFields); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	// Without If-Match the write is still guarded by the version read above
+	if version != 0 {
+		dealership.Version = version
+	}
+
+	if !s.validateRequest(w, r, dealership) {
+		return
+	}
+
+	if err := s.store.UpdateDealership(r.Context(), id, dealership); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, dealership.Version)
+	writeJSON(w, http.StatusOK, dealership)
+}
+
 // @Summary      Delete a Dealership
 // @Description  Deletes a dealership by its ID.
 // @Tags         Dealerships
+// @Security     BearerAuth
 // @Produce      json
 // @Param        id  path      int  true  "Dealership ID"
+// @Param        If-Match  header  string  false  "ETag of the version being changed"
 // @Success      204 "No Content"
-// @Failure      400 {object}  map[string]string "Error: Invalid ID"
-// @Failure      500 {object}  map[string]string "Error: Internal server error"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Dealership not found"
+// @Failure      409 {object}  Problem           "Error: Dealership is still referenced by other records"
+// @Failure      412 {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      428 {object}  Problem           "Error: If-Match required"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
 // @Router       /dealerships/{id} [delete]
 func (s *APIServer) handleDeleteDealership(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
@@ -130,19 +273,13 @@ func (s *APIServer) handleDeleteDealership(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err := s.store.DeleteDealership(id); err != nil {
-		if strings.Contains(err.Error(), ErrCannotDeleteReferenced) {
-			writeError(w, http.StatusConflict, err)
-			logError(r, err)
-			return
-		}
-		if err == gorm.ErrRecordNotFound {
-			writeError(w, http.StatusNotFound, err)
-			logError(r, err)
-			return
-		}
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteDealership(r.Context(), id, version); err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -153,12 +290,18 @@ func (s *APIServer) handleDeleteDealership(w http.ResponseWriter, r *http.Reques
 // @Summary      Create Employee
 // @Description  Creates a new employee in the system.
 // @Tags         Employees
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        employee  body      models.Employee      true  "New Employee Data"
+// @Param        Idempotency-Key  header  string  false  "Makes retries return the response of the first request"
 // @Success      201       {object}  map[string]int       "Returns the ID of the newly created employee"
-// @Failure      400       {object}  map[string]string    "Error: Invalid request payload"
-// @Failure      500       {object}  map[string]string    "Error: Internal server error"
+// @Failure      400       {object}  Problem              "Error: Invalid request payload"
+// @Failure      401       {object}  Problem              "Error: Missing or invalid token"
+// @Failure      403       {object}  Problem              "Error: Insufficient permissions"
+// @Failure      409       {object}  Problem              "Error: TIN already in use, or a request with the same Idempotency-Key is in progress"
+// @Failure      422       {object}  Problem              "Error: Idempotency-Key reused with a different body"
+// @Failure      500       {object}  Problem              "Error: Internal server error"
 // @Router       /employees [post]
 func (s *APIServer) handleCreateEmployee(w http.ResponseWriter, r *http.Request) {
 	var newEmployee models.Employee
@@ -172,43 +315,116 @@ func (s *APIServer) handleCreateEmployee(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	newID, err := s.store.CreateEmployee(&newEmployee)
+	newID, err := s.store.CreateEmployee(r.Context(), &newEmployee)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+		writeStorageError(w, r, err)
 		return
 	}
 	writeJSON(w, http.StatusCreated, map[string]int{"id": newID})
 }
 
 // @Summary      List Employees
-// @Description  Retrieves a list of all employees in the system.
+// @Description  Retrieves a list of all employees in the system. Deleted employees are left out unless an admin sets include_deleted.
 // @Tags         Employees
+// @Security     BearerAuth
 // @Produce      json
-// @Success      200  {array}   models.Employee
-// @Failure      500  {object}  map[string]string "Error: Internal server error"
+// @Param        page       query     int     false  "Page number (1-based)"
+// @Param        page_size  query     int     false  "Page size (default 50, max 200)"
+// @Param        cursor     query     string  false  "Opaque cursor returned as next_cursor by a previous page"
+// @Param        sort       query     string  false  "Comma-separated sort fields, prefix with - for descending"
+// @Param        role       query     string  false  "Filter by role (comma-separated for several)"
+// @Param        surname    query     string  false  "Filter by surname"
+// @Param        include_deleted query     bool    false  "Also list deleted employees (admins only)"
+// @Success      200  {object}  ListResponse{data=[]models.Employee}
+// @Failure      400  {object}  Problem           "Error: Invalid query parameters"
+// @Failure      401  {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403  {object}  Problem           "Error: Insufficient permissions"
+// @Failure      500  {object}  Problem           "Error: Internal server error"
 // @Router       /employees [get]
 func (s *APIServer) handleGetEmployees(w http.ResponseWriter, r *http.Request) {
-	employees, err := s.store.GetEmployees()
+	query, err := parseListQuery(r, storage.EmployeeFields)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	include, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+	query.IncludeDeleted = include
+
+	page, err := s.store.ListEmployees(r.Context(), query)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newListResponse(page, query))
+}
+
+// @Summary      Get an Employee
+// @Description  Retrieves a single employee by its ID. Admins can read a deleted employee with include_deleted.
+// @Tags         Employees
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Employee ID"
+// @Param        include_deleted  query  bool  false  "Also find a deleted employee (admins only)"
+// @Success      200 {object}  models.Employee
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Employee not found"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /employees/{id} [get]
+func (s *APIServer) handleGetEmployeeByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
 		logError(r, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, employees)
+	include, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	var employee *models.Employee
+	if include {
+		employee, err = storage.GetIncludingDeleted(r.Context(), s.store.ListEmployees, "id_employee", id)
+	} else {
+		employee, err = s.store.GetEmployeeByID(r.Context(), id)
+	}
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, employee.Version)
+	writeJSON(w, http.StatusOK, employee)
 }
 
 // @Summary      Update Employee
 // @Description  Updates an existing employee's data by their ID.
 // @Tags         Employees
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        id        path      int              true  "Employee ID"
+// @Param        If-Match  header    string           false "ETag of the version being changed"
 // @Param        employee  body      models.Employee  true  "Updated Employee Data"
 // @Success      200       {object}  models.Employee
-// @Failure      400       {object}  map[string]string "Error: Invalid ID or request payload"
-// @Failure      500       {object}  map[string]string "Error: Internal server error"
+// @Header       200       {string}  ETag  "Version of the resource"
+// @Failure      400       {object}  Problem           "Error: Invalid ID or request payload"
+// @Failure      401       {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403       {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404       {object}  Problem           "Error: Employee not found"
+// @Failure      409       {object}  Problem           "Error: TIN already in use"
+// @Failure      412       {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      428       {object}  Problem           "Error: If-Match required"
+// @Failure      500       {object}  Problem           "Error: Internal server error"
 // @Router       /employees/{id} [put]
 func (s *APIServer) handleUpdateEmployee(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
@@ -218,6 +434,11 @@ func (s *APIServer) handleUpdateEmployee(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
 	var updatedEmployee models.Employee
 	if err := json.NewDecoder(r.Body).Decode(&updatedEmployee); err != nil {
 		writeError(w, http.StatusBadRequest, err)
@@ -229,22 +450,98 @@ func (s *APIServer) handleUpdateEmployee(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := s.store.UpdateEmployee(id, &updatedEmployee); err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	updatedEmployee.Version = version
+	if err := s.store.UpdateEmployee(r.Context(), id, &updatedEmployee); err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
+	setETag(w, updatedEmployee.Version)
 	writeJSON(w, http.StatusOK, updatedEmployee)
 }
 
+// @Summary      Patch an Employee
+// @Description  Partially updates an employee by its ID. The body is a JSON merge patch (RFC 7396): members replace the stored values and null clears them. The result is validated like a full update.
+// @Tags         Employees
+// @Security     BearerAuth
+// @Accept       json,application/merge-patch+json
+// @Produce      json
+// @Param        id        path      int              true  "Employee ID"
+// @Param        If-Match  header    string           false "ETag of the version being changed"
+// @Param        employee  body      models.Employee  true  "Fields to update (partial employee data)"
+// @Success      200 {object}  models.Employee
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID, request payload or read-only field"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Employee not found"
+// @Failure      409 {object}  Problem           "Error: TIN already in use"
+// @Failure      412 {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      415 {object}  Problem           "Error: Unsupported content type"
+// @Failure      428 {object}  Problem           "Error: If-Match required"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /employees/{id} [patch]
+func (s *APIServer) handlePatchEmployee(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	patch, ok := readMergePatch(w, r)
+	if !ok {
+		return
+	}
+
+	employee, err := s.store.GetEmployeeByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if err := applyMergePatch(employee, patch, employeePatchFields); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if version != 0 {
+		employee.Version = version
+	}
+
+	if !s.validateRequest(w, r, employee) {
+		return
+	}
+
+	if err := s.store.UpdateEmployee(r.Context(), id, employee); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, employee.Version)
+	writeJSON(w, http.StatusOK, employee)
+}
+
 // @Summary      Delete Employee
-// @Description  Deletes an employee by their ID.
+// @Description  Deletes an employee by their ID once their employments have ended. The record is kept, with its login disabled, and can be restored.
 // @Tags         Employees
+// @Security     BearerAuth
 // @Produce      json
 // @Param        id  path      int  true  "Employee ID"
+// @Param        If-Match  header  string  false  "ETag of the version being changed"
 // @Success      204 "No Content"
-// @Failure      400 {object}  map[string]string "Error: Invalid ID"
-// @Failure      500 {object}  map[string]string "Error: Internal server error"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Employee not found"
+// @Failure      409 {object}  Problem           "Error: Employee still works at a dealership"
+// @Failure      412 {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      428 {object}  Problem           "Error: If-Match required"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
 // @Router       /employees/{id} [delete]
 func (s *APIServer) handleDeleteEmployee(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
@@ -254,35 +551,67 @@ func (s *APIServer) handleDeleteEmployee(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := s.store.DeleteEmployee(id); err != nil {
-		if strings.Contains(err.Error(), ErrCannotDeleteReferenced) {
-			writeError(w, http.StatusConflict, err)
-			logError(r, err)
-			return
-		}
-		if err == gorm.ErrRecordNotFound {
-			writeError(w, http.StatusNotFound, err)
-			logError(r, err)
-			return
-		}
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteEmployee(r.Context(), id, version); err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// @Summary      Restore Employee
+// @Description  Restores a deleted employee. Fails if its unique values have since been taken by another record.
+// @Tags         Employees
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Employee ID"
+// @Success      200 {object}  models.Employee
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Employee not found"
+// @Failure      409 {object}  Problem           "Error: Employee is not deleted, or one of its unique values is in use"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /employees/{id}/restore [post]
+func (s *APIServer) handleRestoreEmployee(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	restored, err := s.store.RestoreEmployee(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, restored.Version)
+	writeJSON(w, http.StatusOK, restored)
+}
+
 // Employments Handlers //
 
 // @Summary      Create Employment
 // @Description  Assigns an employee to a dealership, creating a new employment record.
 // @Tags         Employment
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        employment  body      models.Employment    true  "New Employment Data"
+// @Param        Idempotency-Key  header  string  false  "Makes retries return the response of the first request"
 // @Success      201         {object}  map[string]int     "Returns the ID of the new employment record"
-// @Failure      400         {object}  map[string]string  "Error: Invalid request payload"
-// @Failure      500         {object}  map[string]string  "Error: Internal server error"
+// @Failure      400         {object}  Problem            "Error: Invalid request payload"
+// @Failure      401         {object}  Problem            "Error: Missing or invalid token"
+// @Failure      403         {object}  Problem            "Error: Insufficient permissions"
+// @Failure      409         {object}  Problem            "Error: A request with the same Idempotency-Key is in progress"
+// @Failure      422         {object}  Problem            "Error: Unknown employee or dealership, or Idempotency-Key reused with a different body"
+// @Failure      500         {object}  Problem            "Error: Internal server error"
 // @Router       /employments [post]
 func (s *APIServer) handleCreateEmployment(w http.ResponseWriter, r *http.Request) {
 	var newEmployment models.Employment
@@ -296,10 +625,9 @@ func (s *APIServer) handleCreateEmployment(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	newID, err := s.store.CreateEmployment(&newEmployment)
+	newID, err := s.store.CreateEmployment(r.Context(), &newEmployment)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+		writeStorageError(w, r, err)
 		return
 	}
 	writeJSON(w, http.StatusCreated, map[string]int{"id": newID})
@@ -308,31 +636,120 @@ func (s *APIServer) handleCreateEmployment(w http.ResponseWriter, r *http.Reques
 // @Summary      List Employments
 // @Description  Retrieves a list of all employment records.
 // @Tags         Employment
+// @Security     BearerAuth
 // @Produce      json
-// @Success      200  {array}   models.Employment
-// @Failure      500  {object}  map[string]string "Error: Internal server error"
+// @Param        page       query     int     false  "Page number (1-based)"
+// @Param        page_size  query     int     false  "Page size (default 50, max 200)"
+// @Param        cursor     query     string  false  "Opaque cursor returned as next_cursor by a previous page"
+// @Param        sort       query     string  false  "Comma-separated sort fields, prefix with - for descending"
+// @Param        id_employee query     int     false  "Filter by employee"
+// @Param        id_dealership query     int     false  "Filter by dealership"
+// @Param        active     query     bool    false  "Only current (true) or ended (false) employments"
+// @Param        startdate_from query     string  false  "Start date lower bound (YYYY-MM-DD)"
+// @Param        startdate_to query     string  false  "Start date upper bound (YYYY-MM-DD)"
+// @Param        include    query     string  false  "Related records to embed: employee,dealership"
+// @Success      200  {object}  ListResponse{data=[]EmploymentResource}
+// @Failure      400  {object}  Problem           "Error: Invalid query parameters"
+// @Failure      401  {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403  {object}  Problem           "Error: Insufficient permissions"
+// @Failure      500  {object}  Problem           "Error: Internal server error"
 // @Router       /employments [get]
 func (s *APIServer) handleGetEmployments(w http.ResponseWriter, r *http.Request) {
-	employments, err := s.store.GetEmployments()
+	query, err := parseListQuery(r, storage.EmploymentFields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	include, err := parseIncludes(r, includeEmployee, includeDealership)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	page, err := s.store.ListEmployments(r.Context(), query)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	resources, err := s.employmentResources(r.Context(), page.Items, include)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err)
 		logError(r, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, employments)
+	writeJSON(w, http.StatusOK, newListResponse(&storage.Page[*EmploymentResource]{Items: resources, Total: page.Total}, query))
+}
+
+// @Summary      Get an Employment
+// @Description  Retrieves a single employment by its ID.
+// @Tags         Employment
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Employment ID"
+// @Param        include  query  string  false  "Related records to embed: employee,dealership"
+// @Success      200 {object}  EmploymentResource
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Employment not found"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /employments/{id} [get]
+func (s *APIServer) handleGetEmploymentByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	include, err := parseIncludes(r, includeEmployee, includeDealership)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	employment, err := s.store.GetEmploymentByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	resources, err := s.employmentResources(r.Context(), []*models.Employment{employment}, include)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		logError(r, err)
+		return
+	}
+	setETag(w, employment.Version)
+	writeJSON(w, http.StatusOK, resources[0])
 }
 
 // @Summary      Update Employment
 // @Description  Updates an existing employment record by its ID (e.g., to set an end date).
 // @Tags         Employment
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        id          path      int                  true  "Employment ID"
+// @Param        If-Match    header    string               false "ETag of the version being changed"
 // @Param        employment  body      models.Employment    true  "Updated Employment Data"
 // @Success      200         {object}  models.Employment
-// @Failure      400         {object}  map[string]string "Error: Invalid ID or request payload"
-// @Failure      500         {object}  map[string]string "Error: Internal server error"
+// @Header       200         {string}  ETag  "Version of the resource"
+// @Failure      400         {object}  Problem           "Error: Invalid ID or request payload"
+// @Failure      401         {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403         {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404         {object}  Problem           "Error: Employment not found"
+// @Failure      412         {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      422         {object}  Problem           "Error: Unknown employee or dealership"
+// @Failure      428         {object}  Problem           "Error: If-Match required"
+// @Failure      500         {object}  Problem           "Error: Internal server error"
 // @Router       /employments/{id} [put]
 func (s *APIServer) handleUpdateEmployment(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
@@ -342,6 +759,11 @@ func (s *APIServer) handleUpdateEmployment(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
 	var updatedEmployment models.Employment
 	if err := json.NewDecoder(r.Body).Decode(&updatedEmployment); err != nil {
 		writeError(w, http.StatusBadRequest, err)
@@ -353,22 +775,97 @@ func (s *APIServer) handleUpdateEmployment(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err := s.store.UpdateEmployment(id, &updatedEmployment); err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	updatedEmployment.Version = version
+	if err := s.store.UpdateEmployment(r.Context(), id, &updatedEmployment); err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
+	setETag(w, updatedEmployment.Version)
 	writeJSON(w, http.StatusOK, updatedEmployment)
 }
 
+// @Summary      Patch an Employment
+// @Description  Partially updates an employment by its ID. The body is a JSON merge patch (RFC 7396): members replace the stored values and null clears them. The result is validated like a full update.
+// @Tags         Employment
+// @Security     BearerAuth
+// @Accept       json,application/merge-patch+json
+// @Produce      json
+// @Param        id          path      int                true  "Employment ID"
+// @Param        If-Match    header    string             false "ETag of the version being changed"
+// @Param        employment  body      models.Employment  true  "Fields to update (partial employment data)"
+// @Success      200 {object}  models.Employment
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID, request payload or read-only field"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Employment not found"
+// @Failure      412 {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      415 {object}  Problem           "Error: Unsupported content type"
+// @Failure      422 {object}  Problem           "Error: Unknown employee or dealership"
+// @Failure      428 {object}  Problem           "Error: If-Match required"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /employments/{id} [patch]
+func (s *APIServer) handlePatchEmployment(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	patch, ok := readMergePatch(w, r)
+	if !ok {
+		return
+	}
+
+	employment, err := s.store.GetEmploymentByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if err := applyMergePatch(employment, patch, employmentPatchFields); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if version != 0 {
+		employment.Version = version
+	}
+
+	if !s.validateRequest(w, r, employment) {
+		return
+	}
+
+	if err := s.store.UpdateEmployment(r.Context(), id, employment); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, employment.Version)
+	writeJSON(w, http.StatusOK, employment)
+}
+
 // @Summary      Delete Employment
 // @Description  Deletes an employment record by its ID.
 // @Tags         Employment
+// @Security     BearerAuth
 // @Produce      json
 // @Param        id  path      int  true  "Employment ID"
+// @Param        If-Match  header  string  false  "ETag of the version being changed"
 // @Success      204 "No Content"
-// @Failure      400 {object}  map[string]string "Error: Invalid ID"
-// @Failure      500 {object}  map[string]string "Error: Internal server error"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Employment not found"
+// @Failure      412 {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      428 {object}  Problem           "Error: If-Match required"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
 // @Router       /employments/{id} [delete]
 func (s *APIServer) handleDeleteEmployment(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
@@ -378,14 +875,13 @@ func (s *APIServer) handleDeleteEmployment(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err := s.store.DeleteEmployment(id); err != nil {
-		if err == gorm.ErrRecordNotFound {
-			writeError(w, http.StatusNotFound, err)
-			logError(r, err)
-			return
-		}
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteEmployment(r.Context(), id, version); err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -396,12 +892,18 @@ func (s *APIServer) handleDeleteEmployment(w http.ResponseWriter, r *http.Reques
 // @Summary      Create Client
 // @Description  Registers a new client (private or business) in the system.
 // @Tags         Clients
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        client  body      models.Client        true  "New Client Data"
+// @Param        Idempotency-Key  header  string  false  "Makes retries return the response of the first request"
 // @Success      201     {object}  map[string]int     "Returns the ID of the newly created client"
-// @Failure      400     {object}  map[string]string  "Error: Invalid request payload"
-// @Failure      500     {object}  map[string]string  "Error: Internal server error"
+// @Failure      400     {object}  Problem            "Error: Invalid request payload"
+// @Failure      401     {object}  Problem            "Error: Missing or invalid token"
+// @Failure      403     {object}  Problem            "Error: Insufficient permissions"
+// @Failure      409     {object}  Problem            "Error: TIN/VAT number or email already in use, or a request with the same Idempotency-Key is in progress"
+// @Failure      422     {object}  Problem            "Error: Idempotency-Key reused with a different body"
+// @Failure      500     {object}  Problem            "Error: Internal server error"
 // @Router       /clients [post]
 func (s *APIServer) handleCreateClient(w http.ResponseWriter, r *http.Request) {
 	var newClient models.Client
@@ -415,43 +917,117 @@ func (s *APIServer) handleCreateClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newID, err := s.store.CreateClient(&newClient)
+	newID, err := s.store.CreateClient(r.Context(), &newClient)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+		writeStorageError(w, r, err)
 		return
 	}
 	writeJSON(w, http.StatusCreated, map[string]int{"id": newID})
 }
 
 // @Summary      List Clients
-// @Description  Retrieves a list of all clients.
+// @Description  Retrieves a list of all clients. Deleted clients are left out unless an admin sets include_deleted.
 // @Tags         Clients
+// @Security     BearerAuth
 // @Produce      json
-// @Success      200  {array}   models.Client
-// @Failure      500  {object}  map[string]string "Error: Internal server error"
+// @Param        page       query     int     false  "Page number (1-based)"
+// @Param        page_size  query     int     false  "Page size (default 50, max 200)"
+// @Param        cursor     query     string  false  "Opaque cursor returned as next_cursor by a previous page"
+// @Param        sort       query     string  false  "Comma-separated sort fields, prefix with - for descending"
+// @Param        type       query     string  false  "Filter by client type (private, company)"
+// @Param        tin_vat    query     string  false  "Filter by TIN/VAT number"
+// @Param        email      query     string  false  "Filter by email"
+// @Param        include_deleted query     bool    false  "Also list deleted clients (admins only)"
+// @Success      200  {object}  ListResponse{data=[]models.Client}
+// @Failure      400  {object}  Problem           "Error: Invalid query parameters"
+// @Failure      401  {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403  {object}  Problem           "Error: Insufficient permissions"
+// @Failure      500  {object}  Problem           "Error: Internal server error"
 // @Router       /clients [get]
 func (s *APIServer) handleGetClients(w http.ResponseWriter, r *http.Request) {
-	clients, err := s.store.GetClients()
+	query, err := parseListQuery(r, storage.ClientFields)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
+		writeError(w, http.StatusBadRequest, err)
 		logError(r, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, clients)
-}
-
+	include, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+	query.IncludeDeleted = include
+
+	page, err := s.store.ListClients(r.Context(), query)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newListResponse(page, query))
+}
+
+// @Summary      Get a Client
+// @Description  Retrieves a single client by its ID. Admins can read a deleted client with include_deleted.
+// @Tags         Clients
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Client ID"
+// @Param        include_deleted  query  bool  false  "Also find a deleted client (admins only)"
+// @Success      200 {object}  models.Client
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Client not found"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /clients/{id} [get]
+func (s *APIServer) handleGetClientByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	include, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	var client *models.Client
+	if include {
+		client, err = storage.GetIncludingDeleted(r.Context(), s.store.ListClients, "id_client", id)
+	} else {
+		client, err = s.store.GetClientByID(r.Context(), id)
+	}
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, client.Version)
+	writeJSON(w, http.StatusOK, client)
+}
+
 // @Summary      Update Client
 // @Description  Updates an existing client's data by their ID.
 // @Tags         Clients
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        id      path      int              true  "Client ID"
+// @Param        If-Match  header  string           false "ETag of the version being changed"
 // @Param        client  body      models.Client    true  "Updated Client Data"
 // @Success      200     {object}  models.Client
-// @Failure      400     {object}  map[string]string "Error: Invalid ID or request payload"
-// @Failure      500     {object}  map[string]string "Error: Internal server error"
+// @Header       200     {string}  ETag  "Version of the resource"
+// @Failure      400     {object}  Problem           "Error: Invalid ID or request payload"
+// @Failure      401     {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403     {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404     {object}  Problem           "Error: Client not found"
+// @Failure      409     {object}  Problem           "Error: TIN/VAT number or email already in use"
+// @Failure      412     {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      428     {object}  Problem           "Error: If-Match required"
+// @Failure      500     {object}  Problem           "Error: Internal server error"
 // @Router       /clients/{id} [put]
 func (s *APIServer) handleUpdateClient(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
@@ -461,6 +1037,11 @@ func (s *APIServer) handleUpdateClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
 	var updatedClient models.Client
 	if err := json.NewDecoder(r.Body).Decode(&updatedClient); err != nil {
 		writeError(w, http.StatusBadRequest, err)
@@ -472,22 +1053,97 @@ func (s *APIServer) handleUpdateClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.store.UpdateClient(id, &updatedClient); err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	updatedClient.Version = version
+	if err := s.store.UpdateClient(r.Context(), id, &updatedClient); err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
+	setETag(w, updatedClient.Version)
 	writeJSON(w, http.StatusOK, updatedClient)
 }
 
+// @Summary      Patch a Client
+// @Description  Partially updates a client by its ID. The body is a JSON merge patch (RFC 7396): members replace the stored values and null clears them. The result is validated like a full update.
+// @Tags         Clients
+// @Security     BearerAuth
+// @Accept       json,application/merge-patch+json
+// @Produce      json
+// @Param        id      path      int            true  "Client ID"
+// @Param        If-Match  header  string         false "ETag of the version being changed"
+// @Param        client  body      models.Client  true  "Fields to update (partial client data)"
+// @Success      200 {object}  models.Client
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID, request payload or read-only field"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Client not found"
+// @Failure      409 {object}  Problem           "Error: TIN/VAT number or email already in use"
+// @Failure      412 {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      415 {object}  Problem           "Error: Unsupported content type"
+// @Failure      428 {object}  Problem           "Error: If-Match required"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /clients/{id} [patch]
+func (s *APIServer) handlePatchClient(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	patch, ok := readMergePatch(w, r)
+	if !ok {
+		return
+	}
+
+	client, err := s.store.GetClientByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if err := applyMergePatch(client, patch, clientPatchFields); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if version != 0 {
+		client.Version = version
+	}
+
+	if !s.validateRequest(w, r, client) {
+		return
+	}
+
+	if err := s.store.UpdateClient(r.Context(), id, client); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, client.Version)
+	writeJSON(w, http.StatusOK, client)
+}
+
 // @Summary      Delete Client
-// @Description  Deletes a client by their ID.
+// @Description  Deletes a client by their ID. The record is kept and can be restored.
 // @Tags         Clients
+// @Security     BearerAuth
 // @Produce      json
 // @Param        id  path      int  true  "Client ID"
+// @Param        If-Match  header  string  false  "ETag of the version being changed"
 // @Success      204 "No Content"
-// @Failure      400 {object}  map[string]string "Error: Invalid ID"
-// @Failure      500 {object}  map[string]string "Error: Internal server error"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Client not found"
+// @Failure      412 {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      428 {object}  Problem           "Error: If-Match required"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
 // @Router       /clients/{id} [delete]
 func (s *APIServer) handleDeleteClient(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
@@ -497,35 +1153,67 @@ func (s *APIServer) handleDeleteClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.store.DeleteClient(id); err != nil {
-		if strings.Contains(err.Error(), ErrCannotDeleteReferenced) {
-			writeError(w, http.StatusConflict, err)
-			logError(r, err)
-			return
-		}
-		if err == gorm.ErrRecordNotFound {
-			writeError(w, http.StatusNotFound, err)
-			logError(r, err)
-			return
-		}
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteClient(r.Context(), id, version); err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// @Summary      Restore Client
+// @Description  Restores a deleted client. Fails if its unique values have since been taken by another record.
+// @Tags         Clients
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Client ID"
+// @Success      200 {object}  models.Client
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Client not found"
+// @Failure      409 {object}  Problem           "Error: Client is not deleted, or one of its unique values is in use"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /clients/{id}/restore [post]
+func (s *APIServer) handleRestoreClient(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	restored, err := s.store.RestoreClient(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, restored.Version)
+	writeJSON(w, http.StatusOK, restored)
+}
+
 // Cars Handlers //
 
 // @Summary      Add a new Car
-// @Description  Adds a new car to the inventory.
+// @Description  Adds a new car to the inventory. The status defaults to in_stock and may only be in_stock, in_transit or in_reconditioning.
 // @Tags         Cars
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        car      body      models.CarPark       true  "New Car Data"
+// @Param        Idempotency-Key  header  string  false  "Makes retries return the response of the first request"
 // @Success      201      {object}  map[string]int     "Returns the ID of the newly created car"
-// @Failure      400      {object}  map[string]string  "Error: Invalid request payload"
-// @Failure      500      {object}  map[string]string  "Error: Internal server error"
+// @Failure      400      {object}  Problem            "Error: Invalid request payload"
+// @Failure      401      {object}  Problem            "Error: Missing or invalid token"
+// @Failure      403      {object}  Problem            "Error: Insufficient permissions"
+// @Failure      409      {object}  Problem            "Error: VIN or plate already in use, or a request with the same Idempotency-Key is in progress"
+// @Failure      422      {object}  Problem            "Error: Unknown dealership, or Idempotency-Key reused with a different body"
+// @Failure      500      {object}  Problem            "Error: Internal server error"
 // @Router       /cars [post]
 func (s *APIServer) handleCreateCar(w http.ResponseWriter, r *http.Request) {
 	var newCar models.CarPark
@@ -535,48 +1223,566 @@ func (s *APIServer) handleCreateCar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !s.validateRequest(w, r, &newCar) {
+	if !s.validateRequest(w, r, &newCar) {
+		return
+	}
+
+	if newCar.Status == "" {
+		newCar.Status = models.CarStatusInStock
+	}
+	if !newCar.Status.IsInitial() {
+		err := fmt.Errorf("a new car cannot be %s, use in_stock, in_transit or in_reconditioning", newCar.Status)
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if !s.authorizeDealerships(w, r, newCar.ID_Dealership) {
+		return
+	}
+
+	newID, err := s.store.CreateCar(r.Context(), &newCar)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]int{"id": newID})
+}
+
+// @Summary      List all Cars
+// @Description  Retrieves the cars in the car park. Employees other than managers and admins only see the stock of their own dealerships. Deleted cars are left out unless an admin sets include_deleted.
+// @Tags         Cars
+// @Security     BearerAuth
+// @Produce      json
+// @Param        page       query     int     false  "Page number (1-based)"
+// @Param        page_size  query     int     false  "Page size (default 50, max 200)"
+// @Param        cursor     query     string  false  "Opaque cursor returned as next_cursor by a previous page"
+// @Param        sort       query     string  false  "Comma-separated sort fields, prefix with - for descending"
+// @Param        brand      query     string  false  "Filter by brand"
+// @Param        model      query     string  false  "Filter by model"
+// @Param        condition  query     string  false  "Filter by condition (new, used)"
+// @Param        city       query     string  false  "Filter by dealership city"
+// @Param        id_dealership query     int     false  "Filter by dealership"
+// @Param        year_min   query     int     false  "Minimum registration year"
+// @Param        year_max   query     int     false  "Maximum registration year"
+// @Param        status     query     string  false  "Filter by lifecycle status (comma-separated for several)"
+// @Param        include_deleted query     bool    false  "Also list deleted cars (admins only)"
+// @Success      200  {object}  ListResponse{data=[]models.CarPark}
+// @Failure      400  {object}  Problem           "Error: Invalid query parameters"
+// @Failure      401  {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403  {object}  Problem           "Error: Insufficient permissions"
+// @Failure      500  {object}  Problem           "Error: Internal server error"
+// @Router       /cars [get]
+func (s *APIServer) handleGetCars(w http.ResponseWriter, r *http.Request) {
+	query, err := parseListQuery(r, storage.CarFields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	include, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+	query.IncludeDeleted = include
+
+	scope, ok := s.resolveScope(w, r)
+	if !ok {
+		return
+	}
+	query.Scope = scope
+
+	page, err := s.store.ListCars(r.Context(), query)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newListResponse(page, query))
+}
+
+// @Summary      Get a Car
+// @Description  Retrieves a single car by its ID. Admins can read a deleted car with include_deleted.
+// @Tags         Cars
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Car ID"
+// @Param        include_deleted  query  bool  false  "Also find a deleted car (admins only)"
+// @Success      200 {object}  models.CarPark
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Car not found"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /cars/{id} [get]
+func (s *APIServer) handleGetCarByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	include, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	var car *models.CarPark
+	if include {
+		car, err = storage.GetIncludingDeleted(r.Context(), s.store.ListCars, "id_car", id)
+	} else {
+		car, err = s.store.GetCarByID(r.Context(), id)
+	}
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if !s.authorizeDealerships(w, r, car.ID_Dealership) {
+		return
+	}
+	setETag(w, car.Version)
+	writeJSON(w, http.StatusOK, car)
+}
+
+// @Summary      Update a Car
+// @Description  Replaces all data of an existing car by its ID. The status is ignored, use POST /cars/{id}/status to change it.
+// @Tags         Cars
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int             true  "Car ID"
+// @Param        If-Match  header  string       false "ETag of the version being changed"
+// @Param        car  body      models.CarPark  true  "Updated Car Data"
+// @Success      200  {object}  models.CarPark
+// @Header       200  {string}  ETag  "Version of the resource"
+// @Failure      400  {object}  Problem           "Error: Invalid ID or request payload"
+// @Failure      401  {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403  {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404  {object}  Problem           "Error: Car not found"
+// @Failure      409  {object}  Problem           "Error: VIN or plate already in use, or VIN referenced by other records"
+// @Failure      412  {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      422  {object}  Problem           "Error: Unknown dealership"
+// @Failure      428  {object}  Problem           "Error: If-Match required"
+// @Failure      500  {object}  Problem           "Error: Internal server error"
+// @Router       /cars/{id} [put]
+func (s *APIServer) handleUpdateCar(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var updatedCar models.CarPark
+	if err := json.NewDecoder(r.Body).Decode(&updatedCar); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if !s.validateRequest(w, r, &updatedCar) {
+		return
+	}
+
+	existing, err := s.store.GetCarByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if !s.authorizeDealerships(w, r, existing.ID_Dealership, updatedCar.ID_Dealership) {
+		return
+	}
+
+	// The status only changes through its own endpoint, so it is never taken from the body
+	updatedCar.Status = existing.Status
+
+	updatedCar.Version = version
+	if err := s.store.UpdateCar(r.Context(), id, &updatedCar); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, updatedCar.Version)
+	writeJSON(w, http.StatusOK, updatedCar)
+}
+
+// @Summary      Patch a Car
+// @Description  Partially updates a car by its ID with a JSON merge patch (RFC 7396): members replace the stored values and null clears them. The result is validated like a full update. The status cannot be patched, use POST /cars/{id}/status. Mechanics can only patch km and condition.
+// @Tags         Cars
+// @Security     BearerAuth
+// @Accept       json,application/merge-patch+json
+// @Produce      json
+// @Param        id       path      int                        true  "Car ID"
+// @Param        If-Match header    string                     false "ETag of the version being changed"
+// @Param        updates  body      models.CarPark             true  "Fields to update (partial car data)"
+// @Success      200      {object}  models.CarPark
+// @Header       200      {string}  ETag  "Version of the resource"
+// @Failure      400      {object}  Problem                    "Error: Invalid ID, request payload or read-only field"
+// @Failure      401      {object}  Problem                    "Error: Missing or invalid token"
+// @Failure      403      {object}  Problem                    "Error: Insufficient permissions, or a field mechanics cannot patch"
+// @Failure      404      {object}  Problem                    "Error: Car not found"
+// @Failure      409      {object}  Problem                    "Error: VIN or plate already in use, or VIN referenced by other records"
+// @Failure      412      {object}  Problem                    "Error: The resource has changed since it was read"
+// @Failure      415      {object}  Problem                    "Error: Unsupported content type"
+// @Failure      422      {object}  Problem                    "Error: Unknown dealership"
+// @Failure      428      {object}  Problem                    "Error: If-Match required"
+// @Failure      500      {object}  Problem                    "Error: Internal server error"
+// @Router       /cars/{id} [patch]
+func (s *APIServer) handlePatchCar(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	patch, ok := readMergePatch(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := patch["status"]; ok {
+		writeError(w, http.StatusBadRequest, errStatusNotPatchable)
+		logError(r, errStatusNotPatchable)
+		return
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	if !principal.HasRole(officeRoles...) {
+		for field := range patch {
+			if slices.Contains(carPatchFields, field) && !slices.Contains(workshopCarPatchFields, field) {
+				writeError(w, http.StatusForbidden, errWorkshopCarPatch)
+				logError(r, errWorkshopCarPatch)
+				return
+			}
+		}
+	}
+
+	car, err := s.store.GetCarByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	currentDealership := car.ID_Dealership
+
+	if err := applyMergePatch(car, patch, carPatchFields); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if version != 0 {
+		car.Version = version
+	}
+
+	if !s.validateRequest(w, r, car) {
+		return
+	}
+
+	// A patch may also move the car to another dealership: both must be in scope
+	if !s.authorizeDealerships(w, r, currentDealership, car.ID_Dealership) {
+		return
+	}
+
+	if err := s.store.UpdateCar(r.Context(), id, car); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, car.Version)
+	writeJSON(w, http.StatusOK, car)
+}
+
+// CarStatusRequest is the payload accepted by POST /cars/{id}/status
+type CarStatusRequest struct {
+	Status models.CarStatus `json:"status" validate:"required,oneof=in_stock reserved sold in_reconditioning in_transit delivered written_off"`
+}
+
+// @Summary      Change Car status
+// @Description  Moves a car along its lifecycle. Allowed transitions: in_stock -> reserved, in_reconditioning, in_transit, written_off; in_transit and in_reconditioning -> in_stock, written_off; reserved -> in_stock, sold; sold -> delivered. Delivered and written_off are final.
+// @Tags         Cars
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id      path      int               true  "Car ID"
+// @Param        status  body      CarStatusRequest  true  "Target status"
+// @Success      200     {object}  models.CarPark
+// @Header       200     {string}  ETag  "Version of the resource"
+// @Failure      400     {object}  Problem           "Error: Invalid ID or request payload"
+// @Failure      401     {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403     {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404     {object}  Problem           "Error: Car not found"
+// @Failure      409     {object}  Problem           "Error: Transition not allowed, or the car is held by an active order"
+// @Failure      500     {object}  Problem           "Error: Internal server error"
+// @Router       /cars/{id}/status [post]
+func (s *APIServer) handleTransitionCarStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	var req CarStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if !s.validateRequest(w, r, &req) {
+		return
+	}
+
+	existing, err := s.store.GetCarByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if !s.authorizeDealerships(w, r, existing.ID_Dealership) {
+		return
+	}
+
+	car, err := s.store.TransitionCarStatus(r.Context(), id, req.Status)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, car.Version)
+	writeJSON(w, http.StatusOK, car)
+}
+
+// @Summary      Delete a Car
+// @Description  Deletes a car from the inventory by its ID. Reserved, sold and delivered cars cannot be deleted. The record is kept and can be restored.
+// @Tags         Cars
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Car ID"
+// @Param        If-Match  header  string  false  "ETag of the version being changed"
+// @Success      204 "No Content"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Car not found"
+// @Failure      409 {object}  Problem           "Error: Car status forbids deletion"
+// @Failure      412 {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      428 {object}  Problem           "Error: If-Match required"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /cars/{id} [delete]
+func (s *APIServer) handleDeleteCar(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	existing, err := s.store.GetCarByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if !s.authorizeDealerships(w, r, existing.ID_Dealership) {
+		return
+	}
+
+	if err := s.store.DeleteCar(r.Context(), id, version); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      Restore Car
+// @Description  Restores a deleted car. Fails if its unique values have since been taken by another record.
+// @Tags         Cars
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Car ID"
+// @Success      200 {object}  models.CarPark
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Car not found"
+// @Failure      409 {object}  Problem           "Error: Car is not deleted, or one of its unique values is in use"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /cars/{id}/restore [post]
+func (s *APIServer) handleRestoreCar(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	existing, err := storage.GetIncludingDeleted(r.Context(), s.store.ListCars, "id_car", id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if !s.authorizeDealerships(w, r, existing.ID_Dealership) {
+		return
+	}
+
+	restored, err := s.store.RestoreCar(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, restored.Version)
+	writeJSON(w, http.StatusOK, restored)
+}
+
+// Orders Handlers //
+
+// @Summary      Create a new Order
+// @Description  Creates a new pending sales order, linking a client, employee, and vehicle, and reserves the vehicle. Only in_stock cars of the order's dealership can be ordered.
+// @Tags         Orders
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        order  body      models.Order         true  "New Order Data"
+// @Param        Idempotency-Key  header  string  false  "Makes retries return the response of the first request"
+// @Success      201    {object}  map[string]int     "Returns the ID of the newly created order"
+// @Failure      400    {object}  Problem            "Error: Invalid request payload"
+// @Failure      401    {object}  Problem            "Error: Missing or invalid token"
+// @Failure      403    {object}  Problem            "Error: Insufficient permissions"
+// @Failure      409    {object}  Problem            "Error: Car is not available for a new order, or a request with the same Idempotency-Key is in progress"
+// @Failure      422    {object}  Problem            "Error: Unknown client, employee, dealership or vehicle, vehicle of another dealership, or Idempotency-Key reused with a different body"
+// @Failure      500    {object}  Problem            "Error: Internal server error"
+// @Router       /orders [post]
+func (s *APIServer) handleCreateOrder(w http.ResponseWriter, r *http.Request) {
+	var newOrder models.Order
+	if err := json.NewDecoder(r.Body).Decode(&newOrder); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	// Every order starts pending; later statuses are reached through updates
+	if newOrder.Status == "" {
+		newOrder.Status = models.OrderStatusPending
+	}
+	if newOrder.Status != models.OrderStatusPending {
+		err := fmt.Errorf("a new order must be pending, got %s", newOrder.Status)
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if !s.validateRequest(w, r, &newOrder) {
+		return
+	}
+
+	if !s.authorizeDealerships(w, r, newOrder.ID_Dealership) {
+		return
+	}
+
+	newID, err := s.store.CreateOrder(r.Context(), &newOrder, actorID(r))
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]int{"id": newID})
+}
+
+// @Summary      List all Orders
+// @Description  Retrieves the sales orders. Employees other than managers and admins only see the orders of their own dealerships.
+// @Tags         Orders
+// @Security     BearerAuth
+// @Produce      json
+// @Param        page       query     int     false  "Page number (1-based)"
+// @Param        page_size  query     int     false  "Page size (default 50, max 200)"
+// @Param        cursor     query     string  false  "Opaque cursor returned as next_cursor by a previous page"
+// @Param        sort       query     string  false  "Comma-separated sort fields, prefix with - for descending"
+// @Param        status     query     string  false  "Filter by status (comma-separated for several)"
+// @Param        id_client  query     int     false  "Filter by client"
+// @Param        id_employee query     int     false  "Filter by employee"
+// @Param        id_dealership query     int     false  "Filter by dealership"
+// @Param        last_update_from query     string  false  "Last update lower bound (YYYY-MM-DD or RFC 3339)"
+// @Param        last_update_to query     string  false  "Last update upper bound (YYYY-MM-DD or RFC 3339)"
+// @Param        include    query     string  false  "Related records to embed: client,employee,car,dealership"
+// @Success      200  {object}  ListResponse{data=[]OrderResource}
+// @Failure      400  {object}  Problem           "Error: Invalid query parameters"
+// @Failure      401  {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403  {object}  Problem           "Error: Insufficient permissions"
+// @Failure      500  {object}  Problem           "Error: Internal server error"
+// @Router       /orders [get]
+func (s *APIServer) handleGetOrders(w http.ResponseWriter, r *http.Request) {
+	query, err := parseListQuery(r, storage.OrderFields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	include, err := parseIncludes(r, includeClient, includeEmployee, includeCar, includeDealership)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	scope, ok := s.resolveScope(w, r)
+	if !ok {
 		return
 	}
+	query.Scope = scope
 
-	newID, err := s.store.CreateCar(&newCar)
+	page, err := s.store.ListOrders(r.Context(), query)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+		writeStorageError(w, r, err)
 		return
 	}
-	writeJSON(w, http.StatusCreated, map[string]int{"id": newID})
-}
 
-// @Summary      List all Cars
-// @Description  Retrieves a list of all cars in the car park.
-// @Tags         Cars
-// @Produce      json
-// @Success      200  {array}   models.CarPark
-// @Failure      500  {object}  map[string]string "Error: Internal server error"
-// @Router       /cars [get]
-func (s *APIServer) handleGetCars(w http.ResponseWriter, r *http.Request) {
-	cars, err := s.store.GetCars()
+	resources, err := s.orderResources(r.Context(), page.Items, include, scope)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err)
 		logError(r, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, cars)
+
+	writeJSON(w, http.StatusOK, newListResponse(&storage.Page[*OrderResource]{Items: resources, Total: page.Total}, query))
 }
 
-// @Summary      Patch a Car
-// @Description  Partially updates a car by its ID. Only provided fields will be modified.
-// @Tags         Cars
-// @Accept       json
+// @Summary      Get an Order
+// @Description  Retrieves a single order by its ID.
+// @Tags         Orders
+// @Security     BearerAuth
 // @Produce      json
-// @Param        id       path      int                        true  "Car ID"
-// @Param        updates  body      map[string]interface{}     true  "Fields to update (partial car data)"
-// @Success      200      {object}  map[string]string          "Returns update confirmation"
-// @Failure      400      {object}  map[string]string          "Error: Invalid ID or request payload"
-// @Failure      500      {object}  map[string]string          "Error: Internal server error"
-// @Router       /cars/{id} [patch]
-func (s *APIServer) handlePatchCar(w http.ResponseWriter, r *http.Request) {
+// @Param        id  path      int  true  "Order ID"
+// @Param        include  query  string  false  "Related records to embed: client,employee,car,dealership"
+// @Success      200 {object}  OrderResource
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Order not found"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /orders/{id} [get]
+func (s *APIServer) handleGetOrderByID(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
@@ -584,118 +1790,96 @@ func (s *APIServer) handlePatchCar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var updates map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+	include, err := parseIncludes(r, includeClient, includeEmployee, includeCar, includeDealership)
+	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		logError(r, err)
 		return
 	}
 
-	if err := s.store.PatchCar(id, updates); err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	order, err := s.store.GetOrderByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
-}
-
-// @Summary      Delete a Car
-// @Description  Deletes a car from the inventory by its ID.
-// @Tags         Cars
-// @Produce      json
-// @Param        id  path      int  true  "Car ID"
-// @Success      204 "No Content"
-// @Failure      400 {object}  map[string]string "Error: Invalid ID"
-// @Failure      500 {object}  map[string]string "Error: Internal server error"
-// @Router       /cars/{id} [delete]
-func (s *APIServer) handleDeleteCar(w http.ResponseWriter, r *http.Request) {
-	id, err := getIDFromURL(r)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, err)
-		logError(r, err)
+	scope, ok := s.authorizedScope(w, r, order.ID_Dealership)
+	if !ok {
 		return
 	}
 
-	if err := s.store.DeleteCar(id); err != nil {
-		if strings.Contains(err.Error(), "referenced by existing orders") || 
-		   strings.Contains(err.Error(), ErrCannotDeleteReferenced) {
-			writeError(w, http.StatusConflict, err)
-			logError(r, err)
-			return
-		}
-		if err == gorm.ErrRecordNotFound {
-			writeError(w, http.StatusNotFound, err)
-			logError(r, err)
-			return
-		}
+	resources, err := s.orderResources(r.Context(), []*models.Order{order}, include, scope)
+	if err != nil {
 		writeError(w, http.StatusInternalServerError, err)
 		logError(r, err)
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
+	setETag(w, order.Version)
+	writeJSON(w, http.StatusOK, resources[0])
 }
 
-// Orders Handlers //
-
-// @Summary      Create a new Order
-// @Description  Creates a new sales order, linking a client, employee, and vehicle.
+// @Summary      Order status history
+// @Description  Returns every status change of an order, oldest first, with the employee who made it and the optional reason.
 // @Tags         Orders
-// @Accept       json
+// @Security     BearerAuth
 // @Produce      json
-// @Param        order  body      models.Order         true  "New Order Data"
-// @Success      201    {object}  map[string]int     "Returns the ID of the newly created order"
-// @Failure      400    {object}  map[string]string  "Error: Invalid request payload"
-// @Failure      500    {object}  map[string]string  "Error: Internal server error"
-// @Router       /orders [post]
-func (s *APIServer) handleCreateOrder(w http.ResponseWriter, r *http.Request) {
-	var newOrder models.Order
-	if err := json.NewDecoder(r.Body).Decode(&newOrder); err != nil {
+// @Param        id  path      int  true  "Order ID"
+// @Success      200 {array}   models.OrderStatusChange
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Order not found"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /orders/{id}/history [get]
+func (s *APIServer) handleGetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		logError(r, err)
 		return
 	}
 
-	if !s.validateRequest(w, r, &newOrder) {
+	order, err := s.store.GetOrderByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
 
-	newID, err := s.store.CreateOrder(&newOrder)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	if !s.authorizeDealerships(w, r, order.ID_Dealership) {
 		return
 	}
-	writeJSON(w, http.StatusCreated, map[string]int{"id": newID})
-}
 
-// @Summary      List all Orders
-// @Description  Retrieves a list of all sales orders.
-// @Tags         Orders
-// @Produce      json
-// @Success      200  {array}   models.Order
-// @Failure      500  {object}  map[string]string "Error: Internal server error"
-// @Router       /orders [get]
-func (s *APIServer) handleGetOrders(w http.ResponseWriter, r *http.Request) {
-	orders, err := s.store.GetOrders()
+	history, err := s.store.ListOrderHistory(r.Context(), id)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+		writeStorageError(w, r, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, orders)
+	if history == nil {
+		history = []*models.OrderStatusChange{}
+	}
+	writeJSON(w, http.StatusOK, history)
 }
 
 // @Summary      Update an Order
-// @Description  Updates an existing order's data (e.g., status) by its ID.
+// @Description  Updates an existing order's data (e.g., status) by its ID. Status changes follow pending -> in_progress -> completed, or -> cancelled from either active status. Completing an order marks its car sold, cancelling it returns the car to stock. An optional status_reason is stored in the order history.
 // @Tags         Orders
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        id     path      int            true  "Order ID"
+// @Param        If-Match  header string         false "ETag of the version being changed"
 // @Param        order  body      models.Order   true  "Updated Order Data"
 // @Success      200    {object}  models.Order
-// @Failure      400    {object}  map[string]string "Error: Invalid ID or request payload"
-// @Failure      500    {object}  map[string]string "Error: Internal server error"
+// @Header       200    {string}  ETag  "Version of the resource"
+// @Failure      400    {object}  Problem           "Error: Invalid ID or request payload"
+// @Failure      401    {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403    {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404    {object}  Problem           "Error: Order not found"
+// @Failure      409    {object}  Problem           "Error: Status transition not allowed or car not available"
+// @Failure      412    {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      422    {object}  Problem           "Error: Unknown client, employee, dealership or vehicle, or vehicle of another dealership"
+// @Failure      428    {object}  Problem           "Error: If-Match required"
+// @Failure      500    {object}  Problem           "Error: Internal server error"
 // @Router       /orders/{id} [put]
 func (s *APIServer) handleUpdateOrder(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
@@ -705,6 +1889,11 @@ func (s *APIServer) handleUpdateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
 	var updatedOrder models.Order
 	if err := json.NewDecoder(r.Body).Decode(&updatedOrder); err != nil {
 		writeError(w, http.StatusBadRequest, err)
@@ -716,22 +1905,113 @@ func (s *APIServer) handleUpdateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.store.UpdateOrder(id, &updatedOrder); err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	existing, err := s.store.GetOrderByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if !s.authorizeDealerships(w, r, existing.ID_Dealership, updatedOrder.ID_Dealership) {
+		return
+	}
+
+	updatedOrder.Version = version
+	if err := s.store.UpdateOrder(r.Context(), id, &updatedOrder, actorID(r)); err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
+	setETag(w, updatedOrder.Version)
 	writeJSON(w, http.StatusOK, updatedOrder)
 }
 
+// @Summary      Patch an Order
+// @Description  Partially updates an order by its ID. The body is a JSON merge patch (RFC 7396): members replace the stored values and null clears them. The result is validated like a full update, including the status transition rules.
+// @Tags         Orders
+// @Security     BearerAuth
+// @Accept       json,application/merge-patch+json
+// @Produce      json
+// @Param        id     path      int           true  "Order ID"
+// @Param        If-Match  header string        false "ETag of the version being changed"
+// @Param        order  body      models.Order  true  "Fields to update (partial order data)"
+// @Success      200 {object}  models.Order
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID, request payload or read-only field"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Order not found"
+// @Failure      409 {object}  Problem           "Error: Status transition not allowed or car not available"
+// @Failure      412 {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      415 {object}  Problem           "Error: Unsupported content type"
+// @Failure      428 {object}  Problem           "Error: If-Match required"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /orders/{id} [patch]
+func (s *APIServer) handlePatchOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	patch, ok := readMergePatch(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := s.store.GetOrderByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	currentDealership := order.ID_Dealership
+
+	if err := applyMergePatch(order, patch, orderPatchFields); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if version != 0 {
+		order.Version = version
+	}
+
+	if !s.validateRequest(w, r, order) {
+		return
+	}
+
+	if !s.authorizeDealerships(w, r, currentDealership, order.ID_Dealership) {
+		return
+	}
+
+	if err := s.store.UpdateOrder(r.Context(), id, order, actorID(r)); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, order.Version)
+	writeJSON(w, http.StatusOK, order)
+}
+
 // @Summary      Delete an Order
-// @Description  Deletes a sales order by its ID.
+// @Description  Deletes a sales order by its ID. Deleting a pending or in-progress order returns its car to stock.
 // @Tags         Orders
+// @Security     BearerAuth
 // @Produce      json
 // @Param        id  path      int  true  "Order ID"
+// @Param        If-Match  header  string  false  "ETag of the version being changed"
 // @Success      204 "No Content"
-// @Failure      400 {object}  map[string]string "Error: Invalid ID"
-// @Failure      500 {object}  map[string]string "Error: Internal server error"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Order not found"
+// @Failure      409 {object}  Problem           "Error: Car cannot be returned to stock"
+// @Failure      412 {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      428 {object}  Problem           "Error: If-Match required"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
 // @Router       /orders/{id} [delete]
 func (s *APIServer) handleDeleteOrder(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
@@ -741,14 +2021,23 @@ func (s *APIServer) handleDeleteOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.store.DeleteOrder(id); err != nil {
-		if err == gorm.ErrRecordNotFound {
-			writeError(w, http.StatusNotFound, err)
-			logError(r, err)
-			return
-		}
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	existing, err := s.store.GetOrderByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if !s.authorizeDealerships(w, r, existing.ID_Dealership) {
+		return
+	}
+
+	if err := s.store.DeleteOrder(r.Context(), id, version); err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -757,14 +2046,20 @@ func (s *APIServer) handleDeleteOrder(w http.ResponseWriter, r *http.Request) {
 // Appointments Handlers //
 
 // @Summary      Create a new Appointment
-// @Description  Schedules a new appointment (e.g., test drive, consultation).
+// @Description  Schedules a new appointment (e.g., test drive, consultation). duration_minutes defaults to 30; the employee, and the vehicle when a vin is given, must be free for the whole slot, which must fall within the opening hours of the dealership.
 // @Tags         Appointments
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        appointment  body      models.Appointment   true  "New Appointment Data"
+// @Param        Idempotency-Key  header  string  false  "Makes retries return the response of the first request"
 // @Success      201          {object}  map[string]int     "Returns the ID of the newly created appointment"
-// @Failure      400          {object}  map[string]string  "Error: Invalid request payload"
-// @Failure      500          {object}  map[string]string  "Error: Internal server error"
+// @Failure      400          {object}  Problem            "Error: Invalid request payload"
+// @Failure      401          {object}  Problem            "Error: Missing or invalid token"
+// @Failure      403          {object}  Problem            "Error: Insufficient permissions"
+// @Failure      409          {object}  Problem            "Error: Employee or vehicle already booked in this slot, or a request with the same Idempotency-Key is in progress"
+// @Failure      422          {object}  Problem            "Error: Dealership closed at that time, or Idempotency-Key reused with a different body"
+// @Failure      500          {object}  Problem            "Error: Internal server error"
 // @Router       /appointments [post]
 func (s *APIServer) handleCreateAppointment(w http.ResponseWriter, r *http.Request) {
 	var newAppointment models.Appointment
@@ -778,42 +2073,151 @@ func (s *APIServer) handleCreateAppointment(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	newID, err := s.store.CreateAppointment(&newAppointment)
+	if !s.authorizeDealerships(w, r, newAppointment.ID_Dealership) {
+		return
+	}
+
+	if !s.checkOpeningHours(w, r, &newAppointment) {
+		return
+	}
+
+	newID, err := s.store.CreateAppointment(r.Context(), &newAppointment)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+		writeStorageError(w, r, err)
 		return
 	}
 	writeJSON(w, http.StatusCreated, map[string]int{"id": newID})
 }
 
 // @Summary      List all Appointments
-// @Description  Retrieves a list of all scheduled appointments.
+// @Description  Retrieves the scheduled appointments. Employees other than managers and admins only see the appointments of their own dealerships.
 // @Tags         Appointments
+// @Security     BearerAuth
 // @Produce      json
-// @Success      200  {array}   models.Appointment
-// @Failure      500  {object}  map[string]string "Error: Internal server error"
+// @Param        page       query     int     false  "Page number (1-based)"
+// @Param        page_size  query     int     false  "Page size (default 50, max 200)"
+// @Param        cursor     query     string  false  "Opaque cursor returned as next_cursor by a previous page"
+// @Param        sort       query     string  false  "Comma-separated sort fields, prefix with - for descending"
+// @Param        id_client  query     int     false  "Filter by client"
+// @Param        id_employee query     int     false  "Filter by employee"
+// @Param        id_dealership query     int     false  "Filter by dealership"
+// @Param        date_from  query     string  false  "Earliest appointment date (YYYY-MM-DD or RFC 3339)"
+// @Param        date_to    query     string  false  "Latest appointment date (YYYY-MM-DD or RFC 3339)"
+// @Param        include    query     string  false  "Related records to embed: client,employee,car,dealership"
+// @Success      200  {object}  ListResponse{data=[]AppointmentResource}
+// @Failure      400  {object}  Problem           "Error: Invalid query parameters"
+// @Failure      401  {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403  {object}  Problem           "Error: Insufficient permissions"
+// @Failure      500  {object}  Problem           "Error: Internal server error"
 // @Router       /appointments [get]
 func (s *APIServer) handleGetAppointments(w http.ResponseWriter, r *http.Request) {
-	appointments, err := s.store.GetAppointments()
+	query, err := parseListQuery(r, storage.AppointmentFields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	include, err := parseIncludes(r, includeClient, includeEmployee, includeCar, includeDealership)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	scope, ok := s.resolveScope(w, r)
+	if !ok {
+		return
+	}
+	query.Scope = scope
+
+	page, err := s.store.ListAppointments(r.Context(), query)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	resources, err := s.appointmentResources(r.Context(), page.Items, include, scope)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		logError(r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newListResponse(&storage.Page[*AppointmentResource]{Items: resources, Total: page.Total}, query))
+}
+
+// @Summary      Get an Appointment
+// @Description  Retrieves a single appointment by its ID.
+// @Tags         Appointments
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Appointment ID"
+// @Param        include  query  string  false  "Related records to embed: client,employee,car,dealership"
+// @Success      200 {object}  AppointmentResource
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Appointment not found"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /appointments/{id} [get]
+func (s *APIServer) handleGetAppointmentByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	include, err := parseIncludes(r, includeClient, includeEmployee, includeCar, includeDealership)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	appointment, err := s.store.GetAppointmentByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	scope, ok := s.authorizedScope(w, r, appointment.ID_Dealership)
+	if !ok {
+		return
+	}
+
+	resources, err := s.appointmentResources(r.Context(), []*models.Appointment{appointment}, include, scope)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err)
 		logError(r, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, appointments)
+	setETag(w, appointment.Version)
+	writeJSON(w, http.StatusOK, resources[0])
 }
 
 // @Summary      Update an Appointment
 // @Description  Updates an existing appointment by its ID (e.g., to reschedule).
 // @Tags         Appointments
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        id           path      int                  true  "Appointment ID"
+// @Param        If-Match     header    string               false "ETag of the version being changed"
 // @Param        appointment  body      models.Appointment   true  "Updated Appointment Data"
 // @Success      200          {object}  models.Appointment
-// @Failure      400          {object}  map[string]string "Error: Invalid ID or request payload"
-// @Failure      500          {object}  map[string]string "Error: Internal server error"
+// @Header       200          {string}  ETag  "Version of the resource"
+// @Failure      400          {object}  Problem           "Error: Invalid ID or request payload"
+// @Failure      401          {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403          {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404          {object}  Problem           "Error: Appointment not found"
+// @Failure      409          {object}  Problem           "Error: Employee or vehicle already booked in this slot"
+// @Failure      412          {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      422          {object}  Problem           "Error: Dealership closed at that time"
+// @Failure      428          {object}  Problem           "Error: If-Match required"
+// @Failure      500          {object}  Problem           "Error: Internal server error"
 // @Router       /appointments/{id} [put]
 func (s *APIServer) handleUpdateAppointment(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
@@ -823,6 +2227,11 @@ func (s *APIServer) handleUpdateAppointment(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
 	var updatedAppointment models.Appointment
 	if err := json.NewDecoder(r.Body).Decode(&updatedAppointment); err != nil {
 		writeError(w, http.StatusBadRequest, err)
@@ -834,22 +2243,121 @@ func (s *APIServer) handleUpdateAppointment(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if err := s.store.UpdateAppointment(id, &updatedAppointment); err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	existing, err := s.store.GetAppointmentByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if !s.authorizeDealerships(w, r, existing.ID_Dealership, updatedAppointment.ID_Dealership) {
+		return
+	}
+
+	if !s.checkOpeningHours(w, r, &updatedAppointment) {
+		return
+	}
+
+	updatedAppointment.Version = version
+	if err := s.store.UpdateAppointment(r.Context(), id, &updatedAppointment); err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
+	setETag(w, updatedAppointment.Version)
 	writeJSON(w, http.StatusOK, updatedAppointment)
 }
 
+// @Summary      Patch an Appointment
+// @Description  Partially updates an appointment by its ID. The body is a JSON merge patch (RFC 7396): members replace the stored values and null clears them. The result is validated like a full update.
+// @Tags         Appointments
+// @Security     BearerAuth
+// @Accept       json,application/merge-patch+json
+// @Produce      json
+// @Param        id           path      int                 true  "Appointment ID"
+// @Param        If-Match     header    string              false "ETag of the version being changed"
+// @Param        appointment  body      models.Appointment  true  "Fields to update (partial appointment data)"
+// @Success      200 {object}  models.Appointment
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem           "Error: Invalid ID, request payload or read-only field"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Appointment not found"
+// @Failure      409 {object}  Problem           "Error: Employee or vehicle already booked in this slot"
+// @Failure      412 {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      415 {object}  Problem           "Error: Unsupported content type"
+// @Failure      422 {object}  Problem           "Error: Dealership closed at that time"
+// @Failure      428 {object}  Problem           "Error: If-Match required"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /appointments/{id} [patch]
+func (s *APIServer) handlePatchAppointment(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	patch, ok := readMergePatch(w, r)
+	if !ok {
+		return
+	}
+
+	appointment, err := s.store.GetAppointmentByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	currentDealership := appointment.ID_Dealership
+
+	if err := applyMergePatch(appointment, patch, appointmentPatchFields); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if version != 0 {
+		appointment.Version = version
+	}
+
+	if !s.validateRequest(w, r, appointment) {
+		return
+	}
+
+	if !s.authorizeDealerships(w, r, currentDealership, appointment.ID_Dealership) {
+		return
+	}
+
+	if !s.checkOpeningHours(w, r, appointment) {
+		return
+	}
+
+	if err := s.store.UpdateAppointment(r.Context(), id, appointment); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, appointment.Version)
+	writeJSON(w, http.StatusOK, appointment)
+}
+
 // @Summary      Delete an Appointment
 // @Description  Cancels and deletes an appointment by its ID.
 // @Tags         Appointments
+// @Security     BearerAuth
 // @Produce      json
 // @Param        id  path      int  true  "Appointment ID"
+// @Param        If-Match  header  string  false  "ETag of the version being changed"
 // @Success      204 "No Content"
-// @Failure      400 {object}  map[string]string "Error: Invalid ID"
-// @Failure      500 {object}  map[string]string "Error: Internal server error"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Appointment not found"
+// @Failure      412 {object}  Problem           "Error: The resource has changed since it was read"
+// @Failure      428 {object}  Problem           "Error: If-Match required"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
 // @Router       /appointments/{id} [delete]
 func (s *APIServer) handleDeleteAppointment(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromURL(r)
@@ -859,14 +2367,23 @@ func (s *APIServer) handleDeleteAppointment(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if err := s.store.DeleteAppointment(id); err != nil {
-		if err == gorm.ErrRecordNotFound {
-			writeError(w, http.StatusNotFound, err)
-			logError(r, err)
-			return
-		}
-		writeError(w, http.StatusInternalServerError, err)
-		logError(r, err)
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	existing, err := s.store.GetAppointmentByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if !s.authorizeDealerships(w, r, existing.ID_Dealership) {
+		return
+	}
+
+	if err := s.store.DeleteAppointment(r.Context(), id, version); err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -1,11 +1,15 @@
 // Package api provides HTTP handlers and API server functionality for the KEEPER application.
-// This file contains integration tests for the API endpoints.
+// This file contains integration tests for the API endpoints. They run against an in-memory
+// store, or against Postgres when TEST_DATABASE_URL is set.
 package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"keeper/internal/auth"
+	"keeper/internal/migrate"
 	"keeper/internal/models"
 	"keeper/internal/storage"
 	"net/http"
@@ -19,29 +23,49 @@ import (
 // errStatusMismatch defines a standard error message format for status code mismatches in tests.
 const errStatusMismatch = "wrong status code: received %v, expected %v"
 
+// testJWTSecret is the token signing secret used by test servers.
+const testJWTSecret = "keeper-test-secret"
+
 // newTestServer creates a new APIServer instance for testing purposes.
 // It accepts a testing instance and a storage store, returning a configured server.
 func newTestServer(_ *testing.T, store storage.Store) *APIServer {
 	validate := validator.New()
-	return NewAPIServer(":0", store, validate)
+	tokens := auth.NewTokenManager([]byte(testJWTSecret))
+	return NewAPIServer(":0", store, validate, tokens)
+}
+
+// authorize adds a Bearer access token for the given role to the request.
+// The token is signed for a synthetic employee, which is enough for role checks.
+func authorize(t *testing.T, server *APIServer, req *http.Request, role models.Role) {
+	pair, err := server.tokens.IssuePair(1, role)
+	if err != nil {
+		t.Fatalf("unable to issue test token: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
 }
 
-// newTestDB establishes a connection to the test database and performs cleanup.
-// It reads the connection string from TEST_DATABASE_URL environment variable.
-// Returns a PostgresStore instance ready for testing.
-func newTestDB(t *testing.T) *storage.PostgresStore {
+// newTestDB returns an empty store for a test. If TEST_DATABASE_URL is set it connects to that
+// database and cleans it; otherwise it returns an in-memory store with the same semantics.
+func newTestDB(t *testing.T) storage.Store {
 	connString := os.Getenv("TEST_DATABASE_URL")
 	if connString == "" {
-		t.Skip("TEST_DATABASE_URL not set, skipping integration test")
+		return storage.NewMemoryStore()
 	}
 
 	store, err := storage.NewPostgresStore(connString)
 	if err != nil {
 		t.Fatalf("failed to connect to test database: %s", err)
 	}
+	m, err := migrate.New(store.Db)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %s", err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate test database: %s", err)
+	}
 
 	// Clean all tables and reset identity sequences to ensure test isolation
-	_, err = store.Db.Exec(`TRUNCATE TABLE dealership, employee, employment, car_park, client, appointment, "order" RESTART IDENTITY CASCADE;`)
+	_, err = store.Db.Exec(`TRUNCATE TABLE dealership, employee, employment, car_park, client, appointment, "order", idempotency_key, audit_log, outbox_event, webhook, webhook_delivery RESTART IDENTITY CASCADE;`)
 	if err != nil {
 		t.Fatalf("failed to clean test database: %s", err)
 	}
@@ -61,11 +85,18 @@ func TestCreateDealershipAPI(t *testing.T) {
 
 	t.Run("it creates a dealership and returns its ID", func(t *testing.T) {
 		// Prepare test payload with valid dealership data
-		payload := []byte(`{"postal_code":"73100","city":"Test City","address":"Test Address","phone":"5551234"}`)
+		payload := []byte(`{"postalcode":"73100","city":"Test City","address":"Test Address","phone":"5551234"}`)
 		reqBody := bytes.NewBuffer(payload)
 
 		// Send POST request to create dealership
-		resp, err := http.Post(testServer.URL+"/dealerships", "application/json", reqBody)
+		req, err := http.NewRequest("POST", testServer.URL+"/dealerships", reqBody)
+		if err != nil {
+			t.Fatalf("unable to create POST request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		authorize(t, server, req, models.RoleAdmin)
+
+		resp, err := testServer.Client().Do(req)
 		if err != nil {
 			t.Fatalf("failed to send request: %s", err)
 		}
@@ -99,13 +130,19 @@ func TestGetDealershipsAPI(t *testing.T) {
 	defer testServer.Close()
 
 	// Insert test data into the database
-	_, err := store.Db.Exec("INSERT INTO dealership (postalcode, city, address, phone) VALUES ('73100', 'Lecce Seed', 'Via Seed 1', '12345')")
+	_, err := store.CreateDealership(context.Background(), &models.Dealership{PostalCode: "73100", City: "Lecce Seed", Address: "Via Seed 1", Phone: "12345"})
 	if err != nil {
 		t.Fatalf("unable to insert test data: %v", err)
 	}
 
 	// Send GET request to retrieve dealerships
-	resp, err := http.Get(testServer.URL + "/dealerships")
+	req, err := http.NewRequest("GET", testServer.URL+"/dealerships", nil)
+	if err != nil {
+		t.Fatalf("unable to create GET request: %v", err)
+	}
+	authorize(t, server, req, models.RoleAssistant)
+
+	resp, err := testServer.Client().Do(req)
 	if err != nil {
 		t.Fatalf("error during request sending: %s", err)
 	}
@@ -116,11 +153,16 @@ func TestGetDealershipsAPI(t *testing.T) {
 		t.Errorf(errStatusMismatch, resp.StatusCode, http.StatusOK)
 	}
 	
-	// Parse response body and verify dealership data
-	var dealerships []*models.Dealership
-	if err := json.NewDecoder(resp.Body).Decode(&dealerships); err != nil {
+	// Parse response envelope and verify dealership data
+	var page ListResponse[*models.Dealership]
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
 		t.Fatalf("unable to decode JSON response: %s", err)
 	}
+	dealerships := page.Data
+
+	if page.Total != 1 {
+		t.Errorf("expected total 1, received %d", page.Total)
+	}
 
 	// Verify that exactly one dealership is returned
 	if len(dealerships) != 1 {
@@ -133,7 +175,7 @@ func TestGetDealershipsAPI(t *testing.T) {
 	}
 }
 
-// TestPatchVehicleAPI tests the PATCH /car/{id} endpoint.
+// TestPatchVehicleAPI tests the PATCH /cars/{id} endpoint.
 // Verifies that a vehicle's data can be partially updated successfully.
 func TestPatchVehicleAPI(t *testing.T) {
 	store := newTestDB(t)
@@ -142,26 +184,29 @@ func TestPatchVehicleAPI(t *testing.T) {
 	defer testServer.Close()
 
 	// Insert test dealership
-	var dealershipID int
-	err := store.Db.QueryRow("INSERT INTO dealership (postalcode, city, address, phone) VALUES ('00000', 'Test', 'Test', '123') RETURNING id_dealership").Scan(&dealershipID)
+	dealershipID, err := store.CreateDealership(context.Background(), &models.Dealership{PostalCode: "00000", City: "Test", Address: "Test", Phone: "123"})
 	if err != nil {
 		t.Fatalf("unable to insert test dealership: %v", err)
 	}
 
 	// Insert test vehicle associated with the dealership
-	var vehicleID int
-	err = store.Db.QueryRow("INSERT INTO car_park (vin, id_dealership, brand, model, \"year\", km) VALUES ('TESTVINUPDATE0001', $1, 'Fiat', 'Panda', 2020, 50000) RETURNING id_car", dealershipID).Scan(&vehicleID)
+	vin := "TESTVINUPDATE0001"
+	vehicleID, err := store.CreateCar(context.Background(), &models.CarPark{
+		VIN: &vin, ID_Dealership: dealershipID, Brand: "Fiat", Model: "Panda",
+		Condition: models.CondTypeUsed, Year: 2020, KM: "50000", Plate: "TE000ST",
+	})
 	if err != nil {
 		t.Fatalf("unable to insert test vehicle: %v", err)
 	}
 
 	// Prepare PATCH payload to update vehicle kilometers
-	payload := []byte(`{"km": 60000}`)
-	req, err := http.NewRequest("PATCH", fmt.Sprintf("%s/car/%d", testServer.URL, vehicleID), bytes.NewBuffer(payload))
+	payload := []byte(`{"km": "60000"}`)
+	req, err := http.NewRequest("PATCH", fmt.Sprintf("%s/cars/%d", testServer.URL, vehicleID), bytes.NewBuffer(payload))
 	if err != nil {
 		t.Fatalf("unable to create PATCH request: %v", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", mergePatchContentType)
+	authorize(t, server, req, models.RoleManager)
 	
 	// Send PATCH request to update vehicle
 	resp, err := testServer.Client().Do(req)
@@ -174,6 +219,15 @@ func TestPatchVehicleAPI(t *testing.T) {
 	if resp.StatusCode != http.StatusOK {
 		t.Errorf(errStatusMismatch, resp.StatusCode, http.StatusOK)
 	}
+
+	// Verify the response is the updated vehicle
+	var car models.CarPark
+	if err := json.NewDecoder(resp.Body).Decode(&car); err != nil {
+		t.Fatalf("unable to decode JSON response: %s", err)
+	}
+	if car.KM != "60000" || car.Brand != "Fiat" {
+		t.Errorf("wrong vehicle: received km '%s' and brand '%s', expected '60000' and 'Fiat'", car.KM, car.Brand)
+	}
 }
 
 // TestDeleteEmployeeAPI tests the DELETE /employees/{id} endpoint.
@@ -185,8 +239,7 @@ func TestDeleteEmployeeAPI(t *testing.T) {
 	defer testServer.Close()
 
 	// Insert test employee
-	var employeeID int
-	err := store.Db.QueryRow("INSERT INTO employee (tin, name, surname, role) VALUES ('TESTTINDELETE01', 'Marco', 'Verdi', 'salesperson') RETURNING id_employee").Scan(&employeeID)
+	employeeID, err := store.CreateEmployee(context.Background(), &models.Employee{TIN: "TESTTINDELETE01", Name: "Marco", Surname: "Verdi", Role: models.RoleSalesperson, Phone: "-"})
 	if err != nil {
 		t.Fatalf("unable to insert test employee: %v", err)
 	}
@@ -196,6 +249,7 @@ func TestDeleteEmployeeAPI(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unable to create DELETE request: %v", err)
 	}
+	authorize(t, server, req, models.RoleAdmin)
 	
 	// Send DELETE request
 	resp, err := testServer.Client().Do(req)
@@ -210,13 +264,62 @@ func TestDeleteEmployeeAPI(t *testing.T) {
 	}
 
 	// Verify employee was actually deleted from the database
-	var count int
-	err = store.Db.QueryRow("SELECT COUNT(*) FROM employee WHERE id_employee = $1", employeeID).Scan(&count)
-	if err != nil {
+	_, err = store.GetEmployeeByID(context.Background(), employeeID)
+	if err == nil {
+		t.Errorf("employee record still exists in DB, but should have been deleted")
+	} else if !isNotFound(err) {
 		t.Fatalf("error checking DB after deletion: %s", err)
 	}
+}
+// TestSetEmployeeCredentialsAPI tests the PUT /employees/{id}/credentials endpoint.
+// Verifies that employees confirm their own changes with the current password, and admins do not.
+func TestSetEmployeeCredentialsAPI(t *testing.T) {
+	store := newTestDB(t)
+	server := newTestServer(t, store)
 
-	if count != 0 {
-		t.Errorf("employee record still exists in DB, but should have been deleted")
+	// The test tokens are issued for employee 1
+	employeeID, err := store.CreateEmployee(context.Background(), &models.Employee{TIN: "TESTTINCREDS01", Name: "Marco", Surname: "Verdi", Role: models.RoleSalesperson, Phone: "-"})
+	if err != nil || employeeID != 1 {
+		t.Fatalf("CreateEmployee = %d, %v, want employee 1", employeeID, err)
+	}
+	hash, err := auth.HashPassword("old-password")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
 	}
-}
\ No newline at end of file
+	if err := store.SetEmployeeCredential(context.Background(), &models.EmployeeCredential{ID_Employee: employeeID, Username: "mverdi", PasswordHash: hash}); err != nil {
+		t.Fatalf("SetEmployeeCredential: %v", err)
+	}
+
+	put := func(role models.Role, body string) int {
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/employees/%d/credentials", employeeID), bytes.NewBufferString(body))
+		authorize(t, server, req, role)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	tests := []struct {
+		name string
+		role models.Role
+		body string
+		want int
+	}{
+		{"without the current password", models.RoleSalesperson, `{"username": "mverdi", "password": "new-password"}`, http.StatusBadRequest},
+		{"with a wrong current password", models.RoleSalesperson, `{"username": "mverdi", "password": "new-password", "current_password": "wrong-password"}`, http.StatusForbidden},
+		{"with the current password", models.RoleSalesperson, `{"username": "mverdi", "password": "new-password", "current_password": "old-password"}`, http.StatusNoContent},
+		{"as an admin", models.RoleAdmin, `{"username": "mverdi", "password": "admin-password"}`, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if code := put(tt.role, tt.body); code != tt.want {
+			t.Errorf("%s: "+errStatusMismatch, tt.name, code, tt.want)
+		}
+	}
+
+	credential, err := store.GetEmployeeCredentialByEmployeeID(context.Background(), employeeID)
+	if err != nil {
+		t.Fatalf("GetEmployeeCredentialByEmployeeID: %v", err)
+	}
+	if ok, _ := auth.CheckPassword(credential.PasswordHash, "admin-password"); !ok {
+		t.Errorf("the admin's password was not set")
+	}
+}
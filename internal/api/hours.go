@@ -0,0 +1,476 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"keeper/internal/models"
+	"net/http"
+	"time"
+)
+
+var (
+	errClosesBeforeOpens = errors.New("closes_at must be later than opens_at")
+	errEndBeforeStart    = errors.New("enddate must not be earlier than startdate")
+	errDealershipClosed  = errors.New("dealership is closed")
+)
+
+// defaultOpeningHours applies to dealerships that have not configured their own: Monday to Saturday, 09:00-18:00
+var defaultOpeningHours = func() []*models.OpeningHours {
+	hours := make([]*models.OpeningHours, 0, 6)
+	for weekday := 1; weekday <= 6; weekday++ {
+		hours = append(hours, &models.OpeningHours{Weekday: weekday, OpensAt: "09:00", ClosesAt: "18:00"})
+	}
+	return hours
+}()
+
+// openingWindows returns the ranges during which a dealership with the given hours and closures is open on day
+func openingWindows(hours []*models.OpeningHours, closures []*models.Closure, day time.Time) []Slot {
+	for _, c := range closures {
+		if c.Covers(day) {
+			return nil
+		}
+	}
+	if len(hours) == 0 {
+		hours = defaultOpeningHours
+	}
+
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	weekday := models.ISOWeekday(day.Weekday())
+
+	var windows []Slot
+	for _, h := range hours {
+		if h.Weekday != weekday {
+			continue
+		}
+		opens, err := clockOffset(h.OpensAt)
+		if err != nil {
+			continue
+		}
+		closes, err := clockOffset(h.ClosesAt)
+		if err != nil {
+			continue
+		}
+		windows = append(windows, Slot{Start: midnight.Add(opens), End: midnight.Add(closes)})
+	}
+	return windows
+}
+
+// clockOffset converts an HH:MM time of day into the duration since midnight
+func clockOffset(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// fitsWithin reports whether slot lies entirely inside one of windows
+func fitsWithin(windows []Slot, slot Slot) bool {
+	for _, w := range windows {
+		if !slot.Start.Before(w.Start) && !slot.End.After(w.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// dealershipLocation returns the time zone of a dealership, or the server default if it has none
+func (s *APIServer) dealershipLocation(ctx context.Context, dealershipID int) (*time.Location, error) {
+	dealership, err := s.store.GetDealershipByID(ctx, dealershipID)
+	if err != nil {
+		return nil, err
+	}
+	if dealership.TimeZone == nil {
+		return s.timeZone, nil
+	}
+	return time.LoadLocation(*dealership.TimeZone)
+}
+
+// dealershipWindows loads the schedule of a dealership and returns its opening windows on the day
+// that contains t in the dealership's time zone
+func (s *APIServer) dealershipWindows(ctx context.Context, dealershipID int, t time.Time) ([]Slot, error) {
+	loc, err := s.dealershipLocation(ctx, dealershipID)
+	if err != nil {
+		return nil, err
+	}
+	day := t.In(loc)
+
+	hours, err := s.store.ListOpeningHours(ctx, dealershipID)
+	if err != nil {
+		return nil, err
+	}
+	closures, err := s.store.ListClosures(ctx, dealershipID)
+	if err != nil {
+		return nil, err
+	}
+	return openingWindows(hours, closures, day), nil
+}
+
+// checkOpeningHours rejects with 422 an appointment that does not fall entirely within the opening hours of its
+// dealership, read in the dealership's time zone whatever the offset of the appointment date
+func (s *APIServer) checkOpeningHours(w http.ResponseWriter, r *http.Request, appointment *models.Appointment) bool {
+	windows, err := s.dealershipWindows(r.Context(), appointment.ID_Dealership, appointment.Date)
+	if isNotFound(err) {
+		// The store rejects the unknown dealership with 422
+		return true
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		logError(r, err)
+		return false
+	}
+
+	if !fitsWithin(windows, Slot{Start: appointment.Date, End: appointment.End()}) {
+		err := fmt.Errorf("%w: dealership %d is not open from %s to %s", errDealershipClosed,
+			appointment.ID_Dealership, appointment.Date.Format("2006-01-02 15:04"), appointment.End().Format("15:04"))
+		writeError(w, http.StatusUnprocessableEntity, err)
+		logError(r, err)
+		return false
+	}
+	return true
+}
+
+// requireDealership reads the {id} route parameter and checks that the dealership exists, answering 400 or 404 otherwise
+func (s *APIServer) requireDealership(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return 0, false
+	}
+
+	if _, err := s.store.GetDealershipByID(r.Context(), id); err != nil {
+		writeStorageError(w, r, err)
+		return 0, false
+	}
+	return id, true
+}
+
+// Opening Hours Handlers //
+
+// @Summary      List Dealership opening hours
+// @Description  Returns the weekly opening hours of a dealership (weekday 1 = Monday ... 7 = Sunday). An empty list means the default schedule applies: Monday to Saturday, 09:00-18:00.
+// @Tags         Dealerships
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Dealership ID"
+// @Success      200 {array}   models.OpeningHours
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Dealership not found"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /dealerships/{id}/hours [get]
+func (s *APIServer) handleGetOpeningHours(w http.ResponseWriter, r *http.Request) {
+	dealershipID, ok := s.requireDealership(w, r)
+	if !ok {
+		return
+	}
+
+	hours, err := s.store.ListOpeningHours(r.Context(), dealershipID)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hours)
+}
+
+// @Summary      Add Dealership opening hours
+// @Description  Adds an opening range on a weekday. A weekday may have several ranges, e.g. around a lunch break.
+// @Tags         Dealerships
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int                  true  "Dealership ID"
+// @Param        hours  body      models.OpeningHours  true  "Opening range"
+// @Param        Idempotency-Key  header  string  false  "Makes retries return the response of the first request"
+// @Success      201    {object}  map[string]int     "Returns the ID of the new opening range"
+// @Failure      400    {object}  Problem            "Error: Invalid ID or request payload"
+// @Failure      401    {object}  Problem            "Error: Missing or invalid token"
+// @Failure      403    {object}  Problem            "Error: Insufficient permissions"
+// @Failure      404    {object}  Problem            "Error: Dealership not found"
+// @Failure      409    {object}  Problem            "Error: A request with the same Idempotency-Key is in progress"
+// @Failure      422    {object}  Problem            "Error: Opening time not before closing time, or Idempotency-Key reused with a different body"
+// @Failure      500    {object}  Problem            "Error: Internal server error"
+// @Router       /dealerships/{id}/hours [post]
+func (s *APIServer) handleCreateOpeningHours(w http.ResponseWriter, r *http.Request) {
+	dealershipID, ok := s.requireDealership(w, r)
+	if !ok {
+		return
+	}
+
+	var hours models.OpeningHours
+	if !s.decodeOpeningHours(w, r, &hours) {
+		return
+	}
+	hours.ID_Dealership = dealershipID
+
+	newID, err := s.store.CreateOpeningHours(r.Context(), &hours)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]int{"id": newID})
+}
+
+// @Summary      Update Dealership opening hours
+// @Description  Replaces an opening range of a dealership.
+// @Tags         Dealerships
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int                  true  "Dealership ID"
+// @Param        hoursID  path      int                  true  "Opening range ID"
+// @Param        hours    body      models.OpeningHours  true  "Opening range"
+// @Success      200      {object}  models.OpeningHours
+// @Failure      400      {object}  Problem           "Error: Invalid ID or request payload"
+// @Failure      401      {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403      {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404      {object}  Problem           "Error: Dealership or opening range not found"
+// @Failure      422      {object}  Problem           "Error: Opening time not before closing time"
+// @Failure      500      {object}  Problem           "Error: Internal server error"
+// @Router       /dealerships/{id}/hours/{hoursID} [put]
+func (s *APIServer) handleUpdateOpeningHours(w http.ResponseWriter, r *http.Request) {
+	dealershipID, ok := s.requireDealership(w, r)
+	if !ok {
+		return
+	}
+
+	hoursID, err := getURLParamID(r, "hoursID")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	var hours models.OpeningHours
+	if !s.decodeOpeningHours(w, r, &hours) {
+		return
+	}
+
+	if err := s.store.UpdateOpeningHours(r.Context(), dealershipID, hoursID, &hours); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hours)
+}
+
+// @Summary      Delete Dealership opening hours
+// @Description  Removes an opening range of a dealership.
+// @Tags         Dealerships
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id       path      int  true  "Dealership ID"
+// @Param        hoursID  path      int  true  "Opening range ID"
+// @Success      204 "No Content"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Dealership or opening range not found"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /dealerships/{id}/hours/{hoursID} [delete]
+func (s *APIServer) handleDeleteOpeningHours(w http.ResponseWriter, r *http.Request) {
+	dealershipID, ok := s.requireDealership(w, r)
+	if !ok {
+		return
+	}
+
+	hoursID, err := getURLParamID(r, "hoursID")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if err := s.store.DeleteOpeningHours(r.Context(), dealershipID, hoursID); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeOpeningHours reads and validates an opening range from the request body
+func (s *APIServer) decodeOpeningHours(w http.ResponseWriter, r *http.Request, hours *models.OpeningHours) bool {
+	if err := json.NewDecoder(r.Body).Decode(hours); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return false
+	}
+
+	if !s.validateRequest(w, r, hours) {
+		return false
+	}
+
+	// HH:MM strings order like the times they represent
+	if hours.ClosesAt <= hours.OpensAt {
+		writeError(w, http.StatusBadRequest, errClosesBeforeOpens)
+		logError(r, errClosesBeforeOpens)
+		return false
+	}
+	return true
+}
+
+// Closure Handlers //
+
+// @Summary      List Dealership closures
+// @Description  Returns the holidays and other closures of a dealership, oldest first.
+// @Tags         Dealerships
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Dealership ID"
+// @Success      200 {array}   models.Closure
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Dealership not found"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /dealerships/{id}/closures [get]
+func (s *APIServer) handleGetClosures(w http.ResponseWriter, r *http.Request) {
+	dealershipID, ok := s.requireDealership(w, r)
+	if !ok {
+		return
+	}
+
+	closures, err := s.store.ListClosures(r.Context(), dealershipID)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, closures)
+}
+
+// @Summary      Add a Dealership closure
+// @Description  Closes a dealership from startdate to enddate inclusive (YYYY-MM-DD). No appointment can be booked on those days.
+// @Tags         Dealerships
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int             true  "Dealership ID"
+// @Param        closure  body      models.Closure  true  "Closure"
+// @Param        Idempotency-Key  header  string  false  "Makes retries return the response of the first request"
+// @Success      201      {object}  map[string]int     "Returns the ID of the new closure"
+// @Failure      400      {object}  Problem            "Error: Invalid ID or request payload"
+// @Failure      401      {object}  Problem            "Error: Missing or invalid token"
+// @Failure      403      {object}  Problem            "Error: Insufficient permissions"
+// @Failure      404      {object}  Problem            "Error: Dealership not found"
+// @Failure      409      {object}  Problem            "Error: A request with the same Idempotency-Key is in progress"
+// @Failure      422      {object}  Problem            "Error: Closure ends before it starts, or Idempotency-Key reused with a different body"
+// @Failure      500      {object}  Problem            "Error: Internal server error"
+// @Router       /dealerships/{id}/closures [post]
+func (s *APIServer) handleCreateClosure(w http.ResponseWriter, r *http.Request) {
+	dealershipID, ok := s.requireDealership(w, r)
+	if !ok {
+		return
+	}
+
+	var closure models.Closure
+	if !s.decodeClosure(w, r, &closure) {
+		return
+	}
+	closure.ID_Dealership = dealershipID
+
+	newID, err := s.store.CreateClosure(r.Context(), &closure)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]int{"id": newID})
+}
+
+// @Summary      Update a Dealership closure
+// @Description  Replaces a closure of a dealership.
+// @Tags         Dealerships
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id         path      int             true  "Dealership ID"
+// @Param        closureID  path      int             true  "Closure ID"
+// @Param        closure    body      models.Closure  true  "Closure"
+// @Success      200        {object}  models.Closure
+// @Failure      400        {object}  Problem           "Error: Invalid ID or request payload"
+// @Failure      401        {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403        {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404        {object}  Problem           "Error: Dealership or closure not found"
+// @Failure      422        {object}  Problem           "Error: Closure ends before it starts"
+// @Failure      500        {object}  Problem           "Error: Internal server error"
+// @Router       /dealerships/{id}/closures/{closureID} [put]
+func (s *APIServer) handleUpdateClosure(w http.ResponseWriter, r *http.Request) {
+	dealershipID, ok := s.requireDealership(w, r)
+	if !ok {
+		return
+	}
+
+	closureID, err := getURLParamID(r, "closureID")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	var closure models.Closure
+	if !s.decodeClosure(w, r, &closure) {
+		return
+	}
+
+	if err := s.store.UpdateClosure(r.Context(), dealershipID, closureID, &closure); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, closure)
+}
+
+// @Summary      Delete a Dealership closure
+// @Description  Removes a closure of a dealership.
+// @Tags         Dealerships
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id         path      int  true  "Dealership ID"
+// @Param        closureID  path      int  true  "Closure ID"
+// @Success      204 "No Content"
+// @Failure      400 {object}  Problem           "Error: Invalid ID"
+// @Failure      401 {object}  Problem           "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem           "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem           "Error: Dealership or closure not found"
+// @Failure      500 {object}  Problem           "Error: Internal server error"
+// @Router       /dealerships/{id}/closures/{closureID} [delete]
+func (s *APIServer) handleDeleteClosure(w http.ResponseWriter, r *http.Request) {
+	dealershipID, ok := s.requireDealership(w, r)
+	if !ok {
+		return
+	}
+
+	closureID, err := getURLParamID(r, "closureID")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if err := s.store.DeleteClosure(r.Context(), dealershipID, closureID); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeClosure reads and validates a closure from the request body
+func (s *APIServer) decodeClosure(w http.ResponseWriter, r *http.Request, closure *models.Closure) bool {
+	if err := json.NewDecoder(r.Body).Decode(closure); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return false
+	}
+
+	if !s.validateRequest(w, r, closure) {
+		return false
+	}
+
+	if closure.EndDate.Before(closure.StartDate) {
+		writeError(w, http.StatusBadRequest, errEndBeforeStart)
+		logError(r, errEndBeforeStart)
+		return false
+	}
+	return true
+}
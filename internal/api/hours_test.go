@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"keeper/internal/auth"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestOpeningWindows(t *testing.T) {
+	// 2025-03-14 is a Friday
+	friday := time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)
+	at := func(day time.Time, h, m int) time.Time {
+		return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute)
+	}
+
+	hours := []*models.OpeningHours{
+		{Weekday: 5, OpensAt: "09:00", ClosesAt: "13:00"},
+		{Weekday: 5, OpensAt: "14:30", ClosesAt: "19:00"},
+		{Weekday: 6, OpensAt: "09:00", ClosesAt: "12:00"},
+	}
+
+	t.Run("split day", func(t *testing.T) {
+		windows := openingWindows(hours, nil, friday)
+		if len(windows) != 2 {
+			t.Fatalf("got %d windows, want 2", len(windows))
+		}
+		if !fitsWithin(windows, Slot{Start: at(friday, 12, 30), End: at(friday, 13, 0)}) {
+			t.Errorf("12:30-13:00 should fit in the morning window")
+		}
+		if fitsWithin(windows, Slot{Start: at(friday, 12, 45), End: at(friday, 13, 15)}) {
+			t.Errorf("12:45-13:15 runs into the lunch break and should not fit")
+		}
+		if fitsWithin(windows, Slot{Start: at(friday, 3, 0), End: at(friday, 3, 30)}) {
+			t.Errorf("3am should not fit")
+		}
+	})
+
+	t.Run("closed weekday", func(t *testing.T) {
+		sunday := friday.AddDate(0, 0, 2)
+		if windows := openingWindows(hours, nil, sunday); len(windows) != 0 {
+			t.Errorf("got %v, want no windows on Sunday", windows)
+		}
+	})
+
+	t.Run("closure", func(t *testing.T) {
+		closures := []*models.Closure{{StartDate: friday.AddDate(0, 0, -1), EndDate: friday}}
+		if windows := openingWindows(hours, closures, at(friday, 10, 0)); len(windows) != 0 {
+			t.Errorf("got %v, want no windows during a closure", windows)
+		}
+		if windows := openingWindows(hours, closures, friday.AddDate(0, 0, 1)); len(windows) != 1 {
+			t.Errorf("got %v, want the Saturday window after the closure ends", windows)
+		}
+	})
+
+	t.Run("default schedule", func(t *testing.T) {
+		windows := openingWindows(nil, nil, friday)
+		if len(windows) != 1 || !windows[0].Start.Equal(at(friday, 9, 0)) || !windows[0].End.Equal(at(friday, 18, 0)) {
+			t.Errorf("got %v, want 09:00-18:00", windows)
+		}
+	})
+}
+
+func TestDealershipTimeZone(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	zone := "Europe/Rome"
+	lecce, err := store.CreateDealership(ctx, &models.Dealership{PostalCode: "73100", City: "Lecce", Address: "Via Roma 1", Phone: "0832", TimeZone: &zone})
+	if err != nil {
+		t.Fatalf("CreateDealership: %v", err)
+	}
+	bari, err := store.CreateDealership(ctx, &models.Dealership{PostalCode: "70121", City: "Bari", Address: "Via Sparano 1", Phone: "080"})
+	if err != nil {
+		t.Fatalf("CreateDealership: %v", err)
+	}
+	// 2025-03-14 is a Friday; Rome is one hour ahead of UTC
+	utc := func(day, h, m int) time.Time {
+		return time.Date(2025, 3, day, h, m, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		server     *APIServer
+		dealership int
+		slot       Slot
+		want       bool
+	}{
+		{"09:30 in Rome", newTestServer(t, store), lecce, Slot{Start: utc(14, 8, 30), End: utc(14, 9, 0)}, true},
+		{"18:30 in Rome", newTestServer(t, store), lecce, Slot{Start: utc(14, 17, 30), End: utc(14, 18, 0)}, false},
+		{"Saturday 00:30 in Rome", newTestServer(t, store), lecce, Slot{Start: utc(14, 23, 30), End: utc(15, 0, 0)}, false},
+		{"09:30 in UTC by default", newTestServer(t, store), bari, Slot{Start: utc(14, 9, 30), End: utc(14, 10, 0)}, true},
+		{"08:30 in UTC by default", newTestServer(t, store), bari, Slot{Start: utc(14, 8, 30), End: utc(14, 9, 0)}, false},
+		{"09:30 in the configured zone", NewAPIServer(":0", store, validator.New(), auth.NewTokenManager([]byte(testJWTSecret)), WithTimeZone(rome)), bari, Slot{Start: utc(14, 8, 30), End: utc(14, 9, 0)}, true},
+	}
+	for _, tt := range tests {
+		// The offset the timestamp is sent with does not matter
+		start := tt.slot.Start.In(time.FixedZone("UTC-5", -5*60*60))
+		windows, err := tt.server.dealershipWindows(ctx, tt.dealership, start)
+		if err != nil {
+			t.Fatalf("%s: dealershipWindows: %v", tt.name, err)
+		}
+		if got := fitsWithin(windows, tt.slot); got != tt.want {
+			t.Errorf("%s: fits = %v, want %v (windows %v)", tt.name, got, tt.want, windows)
+		}
+	}
+
+	t.Run("it rejects unknown zones", func(t *testing.T) {
+		server := newTestServer(t, store)
+		req := httptest.NewRequest(http.MethodPost, "/dealerships", strings.NewReader(`{"postalcode": "73100", "city": "Lecce", "address": "Via Roma 1", "phone": "0832", "time_zone": "Europe/Lecce"}`))
+		authorize(t, server, req, models.RoleAdmin)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf(errStatusMismatch, rr.Code, http.StatusBadRequest)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"keeper/internal/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader marks a response replayed from an earlier request with the same key
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+
+	// defaultIdempotencyTTL is how long a key is remembered unless overridden with WithIdempotencyTTL
+	defaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyCleanupInterval is how often Run deletes expired keys
+	idempotencyCleanupInterval = time.Hour
+)
+
+var (
+	errInvalidIdempotencyKey = fmt.Errorf("%s must be between 1 and %d characters long", idempotencyKeyHeader, maxIdempotencyKeyLength)
+	errIdempotencyKeyReused  = fmt.Errorf("%s has already been used with a different request body", idempotencyKeyHeader)
+	errIdempotencyKeyInUse   = fmt.Errorf("a request with this %s is still being processed, retry later", idempotencyKeyHeader)
+)
+
+// idempotent makes a create endpoint safe to retry. The first response to a request carrying an
+// Idempotency-Key header is stored under the key, the route and the caller, and a retry with the same
+// key and body gets that response back instead of creating the record again. A retry with another
+// body is rejected with 422, and one arriving while the first request is still running with 409.
+// Server errors are not stored, so a request that failed that way can be retried with the same key.
+// It must be mounted after authenticate.
+func (s *APIServer) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header, found := r.Header[idempotencyKeyHeader]
+		if !found {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(header) != 1 || header[0] == "" || len(header[0]) > maxIdempotencyKeyLength {
+			writeError(w, http.StatusBadRequest, errInvalidIdempotencyKey)
+			logError(r, errInvalidIdempotencyKey)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			logError(r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+
+		key := &models.IdempotencyKey{
+			Key:         header[0],
+			Route:       r.Method + " " + r.URL.Path,
+			ID_Employee: actorID(r),
+			RequestHash: hex.EncodeToString(hash[:]),
+		}
+		stored, err := s.store.ReserveIdempotencyKey(r.Context(), key, s.idempotencyTTL)
+		if err != nil {
+			writeStorageError(w, r, err)
+			return
+		}
+		if stored != nil {
+			replayIdempotencyKey(w, r, key, stored)
+			return
+		}
+
+		// The key must not stay reserved if the handler panics or the request fails
+		ctx := context.WithoutCancel(r.Context())
+		completed := false
+		defer func() {
+			if !completed {
+				if err := s.store.ReleaseIdempotencyKey(ctx, key); err != nil {
+					logError(r, err)
+				}
+			}
+		}()
+
+		var response bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&response)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 || status >= http.StatusInternalServerError {
+			return
+		}
+		contentType, responseBody := ww.Header().Get("Content-Type"), response.String()
+		key.StatusCode, key.ContentType, key.Body = &status, &contentType, &responseBody
+		if err := s.store.CompleteIdempotencyKey(ctx, key); err != nil {
+			logError(r, err)
+			return
+		}
+		completed = true
+	})
+}
+
+// replayIdempotencyKey answers a request whose key is already stored
+func replayIdempotencyKey(w http.ResponseWriter, r *http.Request, key, stored *models.IdempotencyKey) {
+	switch {
+	case stored.RequestHash != key.RequestHash:
+		writeError(w, http.StatusUnprocessableEntity, errIdempotencyKeyReused)
+		logError(r, errIdempotencyKeyReused)
+	case stored.StatusCode == nil:
+		writeError(w, http.StatusConflict, errIdempotencyKeyInUse)
+		logError(r, errIdempotencyKeyInUse)
+	default:
+		if stored.ContentType != nil && *stored.ContentType != "" {
+			w.Header().Set("Content-Type", *stored.ContentType)
+		}
+		w.Header().Set(idempotentReplayedHeader, "true")
+		w.WriteHeader(*stored.StatusCode)
+		if stored.Body != nil {
+			io.WriteString(w, *stored.Body)
+		}
+	}
+}
+
+// expireIdempotencyKeys deletes the expired idempotency keys every interval until ctx is done.
+// Expired keys are already ignored by lookups; this only reclaims their space.
+func (s *APIServer) expireIdempotencyKeys(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.store.DeleteExpiredIdempotencyKeys(ctx, s.idempotencyTTL)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("deleting expired idempotency keys: %v", err)
+			} else if deleted > 0 {
+				log.Printf("deleted %d expired idempotency keys", deleted)
+			}
+		}
+	}
+}
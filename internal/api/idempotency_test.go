@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	store := storage.NewMemoryStore()
+	server := newTestServer(t, store)
+
+	body := `{"postalcode": "73100", "city": "Lecce", "address": "Via Roma 1", "phone": "0832"}`
+	post := func(employeeID int, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/dealerships", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+		pair, err := server.tokens.IssuePair(employeeID, models.RoleAdmin)
+		if err != nil {
+			t.Fatalf("unable to issue test token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	countDealerships := func() int64 {
+		t.Helper()
+		page, err := store.ListDealerships(context.Background(), &storage.ListQuery{})
+		if err != nil {
+			t.Fatalf("ListDealerships: %v", err)
+		}
+		return page.Total
+	}
+
+	first := post(1, "a1b2c3", body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf(errStatusMismatch, first.Code, http.StatusCreated)
+	}
+
+	t.Run("it replays the first response", func(t *testing.T) {
+		rr := post(1, "a1b2c3", body)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusCreated)
+		}
+		if rr.Body.String() != first.Body.String() || rr.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("replayed %s %q, want %q", rr.Header().Get("Content-Type"), rr.Body, first.Body)
+		}
+		if rr.Header().Get(idempotentReplayedHeader) != "true" {
+			t.Errorf("replayed response has no %s header", idempotentReplayedHeader)
+		}
+		if n := countDealerships(); n != 1 {
+			t.Errorf("%d dealerships after a retry, want 1", n)
+		}
+	})
+
+	t.Run("it rejects the key with another body", func(t *testing.T) {
+		rr := post(1, "a1b2c3", strings.Replace(body, "Lecce", "Bari", 1))
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusUnprocessableEntity)
+		}
+		if p := decodeProblem(t, rr); p.Code != CodeIdempotencyReused {
+			t.Errorf("code = %q, want %q", p.Code, CodeIdempotencyReused)
+		}
+	})
+
+	t.Run("it scopes keys to the caller", func(t *testing.T) {
+		if rr := post(2, "a1b2c3", body); rr.Code != http.StatusCreated || rr.Header().Get(idempotentReplayedHeader) != "" {
+			t.Errorf("another employee's request: status %d, replayed %q; want a new record", rr.Code, rr.Header().Get(idempotentReplayedHeader))
+		}
+		if n := countDealerships(); n != 2 {
+			t.Errorf("%d dealerships, want 2", n)
+		}
+	})
+
+	t.Run("it rejects a retry while the key is in progress", func(t *testing.T) {
+		hash := sha256.Sum256([]byte(body))
+		key := &models.IdempotencyKey{Key: "in-flight", Route: "POST /dealerships", ID_Employee: 1, RequestHash: hex.EncodeToString(hash[:])}
+		if _, err := store.ReserveIdempotencyKey(context.Background(), key, time.Hour); err != nil {
+			t.Fatalf("ReserveIdempotencyKey: %v", err)
+		}
+		rr := post(1, "in-flight", body)
+		if rr.Code != http.StatusConflict {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusConflict)
+		}
+		if p := decodeProblem(t, rr); p.Code != CodeIdempotencyKeyInUse {
+			t.Errorf("code = %q, want %q", p.Code, CodeIdempotencyKeyInUse)
+		}
+	})
+
+	t.Run("it rejects an overlong key", func(t *testing.T) {
+		rr := post(1, strings.Repeat("k", maxIdempotencyKeyLength+1), body)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("it creates a record for each request without a key", func(t *testing.T) {
+		post(1, "", body)
+		if n := countDealerships(); n != 3 {
+			t.Errorf("%d dealerships, want 3", n)
+		}
+	})
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"net/http"
+	"strings"
+)
+
+// Relations that can be embedded with ?include=
+const (
+	includeClient     = "client"
+	includeEmployee   = "employee"
+	includeCar        = "car"
+	includeDealership = "dealership"
+)
+
+// includeSet is the set of relations requested with ?include=a,b
+type includeSet map[string]bool
+
+// OrderResource is an order with its optionally embedded related records
+type OrderResource struct {
+	*models.Order
+	Client     *models.Client     `json:"client,omitempty"`
+	Employee   *models.Employee   `json:"employee,omitempty"`
+	Car        *models.CarPark    `json:"car,omitempty"`
+	Dealership *models.Dealership `json:"dealership,omitempty"`
+}
+
+// AppointmentResource is an appointment with its optionally embedded related records
+type AppointmentResource struct {
+	*models.Appointment
+	Client     *models.Client     `json:"client,omitempty"`
+	Employee   *models.Employee   `json:"employee,omitempty"`
+	Car        *models.CarPark    `json:"car,omitempty"`
+	Dealership *models.Dealership `json:"dealership,omitempty"`
+}
+
+// EmploymentResource is an employment with its optionally embedded related records
+type EmploymentResource struct {
+	*models.Employment
+	Employee   *models.Employee   `json:"employee,omitempty"`
+	Dealership *models.Dealership `json:"dealership,omitempty"`
+}
+
+// parseIncludes reads the comma-separated include parameter, rejecting relations not in allowed
+func parseIncludes(r *http.Request, allowed ...string) (includeSet, error) {
+	set := includeSet{}
+	raw := r.URL.Query().Get("include")
+	if raw == "" {
+		return set, nil
+	}
+
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		valid := false
+		for _, a := range allowed {
+			if name == a {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("cannot include %q, allowed values: %s", name, strings.Join(allowed, ", "))
+		}
+		set[name] = true
+	}
+	return set, nil
+}
+
+// relatedRecords holds the records loaded for a batch of rows, indexed by key
+type relatedRecords struct {
+	clients     map[int]*models.Client
+	employees   map[int]*models.Employee
+	dealerships map[int]*models.Dealership
+	cars        map[string]*models.CarPark
+}
+
+// relatedKeys collects the foreign keys of a batch of rows
+type relatedKeys struct {
+	clientIDs     []int
+	employeeIDs   []int
+	dealershipIDs []int
+	vins          []string
+}
+
+// loadRelated fetches every requested relation with one query per relation, however many rows there are.
+// Branch-bound records (cars) are limited to scope, so those of other dealerships are left out.
+func (s *APIServer) loadRelated(ctx context.Context, include includeSet, keys relatedKeys, scope *storage.Scope) (*relatedRecords, error) {
+	related := &relatedRecords{}
+
+	if include[includeClient] && len(keys.clientIDs) > 0 {
+		page, err := s.store.ListClients(ctx, inQuery("id_client", keys.clientIDs))
+		if err != nil {
+			return nil, err
+		}
+		related.clients = indexBy(page.Items, func(c *models.Client) int { return c.ID_Client })
+	}
+
+	if include[includeEmployee] && len(keys.employeeIDs) > 0 {
+		page, err := s.store.ListEmployees(ctx, inQuery("id_employee", keys.employeeIDs))
+		if err != nil {
+			return nil, err
+		}
+		related.employees = indexBy(page.Items, func(e *models.Employee) int { return e.ID_Employee })
+	}
+
+	if include[includeDealership] && len(keys.dealershipIDs) > 0 {
+		page, err := s.store.ListDealerships(ctx, inQuery("id_dealership", keys.dealershipIDs))
+		if err != nil {
+			return nil, err
+		}
+		related.dealerships = indexBy(page.Items, func(d *models.Dealership) int { return d.ID_Dealership })
+	}
+
+	if include[includeCar] && len(keys.vins) > 0 {
+		query := inQuery("vin", keys.vins)
+		query.Scope = scope
+		page, err := s.store.ListCars(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		related.cars = map[string]*models.CarPark{}
+		for _, car := range page.Items {
+			// A deleted car frees its VIN, so prefer the live car that may have taken it over
+			if car.VIN != nil && (related.cars[*car.VIN] == nil || !car.DeletedAt.Valid) {
+				related.cars[*car.VIN] = car
+			}
+		}
+	}
+
+	return related, nil
+}
+
+// orderResources embeds the requested relations into a batch of orders
+func (s *APIServer) orderResources(ctx context.Context, orders []*models.Order, include includeSet, scope *storage.Scope) ([]*OrderResource, error) {
+	var keys relatedKeys
+	for _, o := range orders {
+		keys.clientIDs = append(keys.clientIDs, o.ID_Client)
+		keys.employeeIDs = append(keys.employeeIDs, o.ID_Employee)
+		keys.dealershipIDs = append(keys.dealershipIDs, o.ID_Dealership)
+		keys.vins = append(keys.vins, o.VIN)
+	}
+
+	related, err := s.loadRelated(ctx, include, keys, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]*OrderResource, len(orders))
+	for i, o := range orders {
+		resources[i] = &OrderResource{
+			Order:      o,
+			Client:     related.clients[o.ID_Client],
+			Employee:   related.employees[o.ID_Employee],
+			Car:        related.cars[o.VIN],
+			Dealership: related.dealerships[o.ID_Dealership],
+		}
+	}
+	return resources, nil
+}
+
+// appointmentResources embeds the requested relations into a batch of appointments
+func (s *APIServer) appointmentResources(ctx context.Context, appointments []*models.Appointment, include includeSet, scope *storage.Scope) ([]*AppointmentResource, error) {
+	var keys relatedKeys
+	for _, a := range appointments {
+		keys.clientIDs = append(keys.clientIDs, a.ID_Client)
+		keys.employeeIDs = append(keys.employeeIDs, a.ID_Employee)
+		keys.dealershipIDs = append(keys.dealershipIDs, a.ID_Dealership)
+		if a.VIN != nil {
+			keys.vins = append(keys.vins, *a.VIN)
+		}
+	}
+
+	related, err := s.loadRelated(ctx, include, keys, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]*AppointmentResource, len(appointments))
+	for i, a := range appointments {
+		resources[i] = &AppointmentResource{
+			Appointment: a,
+			Client:      related.clients[a.ID_Client],
+			Employee:    related.employees[a.ID_Employee],
+			Dealership:  related.dealerships[a.ID_Dealership],
+		}
+		if a.VIN != nil {
+			resources[i].Car = related.cars[*a.VIN]
+		}
+	}
+	return resources, nil
+}
+
+// employmentResources embeds the requested relations into a batch of employments
+func (s *APIServer) employmentResources(ctx context.Context, employments []*models.Employment, include includeSet) ([]*EmploymentResource, error) {
+	var keys relatedKeys
+	for _, e := range employments {
+		keys.employeeIDs = append(keys.employeeIDs, e.ID_Employee)
+		keys.dealershipIDs = append(keys.dealershipIDs, e.ID_Dealership)
+	}
+
+	// Employments embed no branch-bound records
+	related, err := s.loadRelated(ctx, include, keys, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]*EmploymentResource, len(employments))
+	for i, e := range employments {
+		resources[i] = &EmploymentResource{
+			Employment: e,
+			Employee:   related.employees[e.ID_Employee],
+			Dealership: related.dealerships[e.ID_Dealership],
+		}
+	}
+	return resources, nil
+}
+
+// inQuery builds an unpaginated ListQuery matching the distinct keys on field. It includes deleted
+// records, as an order or appointment keeps referring to the client, car or employee it was made with
+func inQuery[K comparable](field string, keys []K) *storage.ListQuery {
+	seen := make(map[K]bool, len(keys))
+	values := make([]any, 0, len(keys))
+	for _, k := range keys {
+		if !seen[k] {
+			seen[k] = true
+			values = append(values, k)
+		}
+	}
+	return &storage.ListQuery{Filters: []storage.Filter{{Field: field, Op: storage.OpIn, Value: values}}, IncludeDeleted: true}
+}
+
+// indexBy maps a slice of records by the key returned by keyFn
+func indexBy[T any](items []T, keyFn func(T) int) map[int]T {
+	index := make(map[int]T, len(items))
+	for _, item := range items {
+		index[keyFn(item)] = item
+	}
+	return index
+}
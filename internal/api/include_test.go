@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"keeper/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIncludeCarAPI(t *testing.T) {
+	ctx := context.Background()
+	store := newTestDB(t)
+	server := newTestServer(t, store)
+
+	dealership := func(city string) int {
+		id, err := store.CreateDealership(ctx, &models.Dealership{PostalCode: "73100", City: city, Address: "Via Roma 1", Phone: "0832"})
+		if err != nil {
+			t.Fatalf("CreateDealership: %v", err)
+		}
+		return id
+	}
+	lecce, bari := dealership("Lecce"), dealership("Bari")
+	// The test tokens are issued for employee 1, here a salesperson of Lecce
+	employeeID, err := store.CreateEmployee(ctx, &models.Employee{Role: models.RoleSalesperson, TIN: "TESTTININCL02", Name: "Marco", Surname: "Verdi", Phone: "-"})
+	if err != nil || employeeID != 1 {
+		t.Fatalf("CreateEmployee = %d, %v, want employee 1", employeeID, err)
+	}
+	if _, err := store.CreateEmployment(ctx, &models.Employment{ID_Employee: employeeID, ID_Dealership: lecce, StartDate: time.Now().AddDate(0, 0, -1)}); err != nil {
+		t.Fatalf("CreateEmployment: %v", err)
+	}
+	clientID, err := store.CreateClient(ctx, &models.Client{Type: models.ClientTypePrivate, TIN_VAT: "RSSMRA80A01E506X", Name: "Mario"})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	// Lecce services a car of its own and one kept by Bari
+	appointments := map[int]string{}
+	for i, dealershipID := range []int{lecce, bari} {
+		vin := fmt.Sprintf("ZFA3120000012345%d", i)
+		if _, err := store.CreateCar(ctx, &models.CarPark{VIN: &vin, ID_Dealership: dealershipID, Brand: "Fiat", Model: "Panda", Condition: models.CondTypeUsed, Year: 2020, KM: "50000", Plate: fmt.Sprintf("AB12%dCD", i)}); err != nil {
+			t.Fatalf("CreateCar: %v", err)
+		}
+		id, err := store.CreateAppointment(ctx, &models.Appointment{ID_Client: clientID, ID_Employee: employeeID, ID_Dealership: lecce, Date: time.Date(2030, 3, 14, 9+i, 0, 0, 0, time.UTC), DurationMinutes: 30, VIN: &vin, Reason: "Service"})
+		if err != nil {
+			t.Fatalf("CreateAppointment: %v", err)
+		}
+		appointments[id] = vin
+	}
+	lecceVIN := appointments[1]
+
+	get := func(url string, role models.Role) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		authorize(t, server, req, role)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: "+errStatusMismatch, url, rr.Code, http.StatusOK)
+		}
+		return rr
+	}
+	// wantCar checks the embedded car: only the one of the caller's dealership when scoped
+	wantCar := func(a *AppointmentResource, scoped bool) {
+		t.Helper()
+		want := appointments[a.ID_Appointment]
+		if scoped && want != lecceVIN {
+			if a.Car != nil {
+				t.Errorf("appointment %d embeds car %+v of another dealership", a.ID_Appointment, a.Car)
+			}
+			return
+		}
+		if a.Car == nil || a.Car.VIN == nil || *a.Car.VIN != want {
+			t.Errorf("appointment %d embeds car %+v, want VIN %s", a.ID_Appointment, a.Car, want)
+		}
+	}
+
+	t.Run("appointments embed their car", func(t *testing.T) {
+		var resp ListResponse[AppointmentResource]
+		if err := json.NewDecoder(get("/appointments?include=car", models.RoleManager).Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding appointments: %v", err)
+		}
+		if len(resp.Data) != 2 {
+			t.Fatalf("got %d appointments, want 2", len(resp.Data))
+		}
+		for i := range resp.Data {
+			wantCar(&resp.Data[i], false)
+		}
+	})
+
+	t.Run("embedded cars are limited to the caller's dealerships", func(t *testing.T) {
+		var resp ListResponse[AppointmentResource]
+		if err := json.NewDecoder(get("/appointments?include=car", models.RoleSalesperson).Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding appointments: %v", err)
+		}
+		if len(resp.Data) != 2 {
+			t.Fatalf("got %d appointments, want 2", len(resp.Data))
+		}
+		for i := range resp.Data {
+			wantCar(&resp.Data[i], true)
+		}
+
+		for id := range appointments {
+			var appointment AppointmentResource
+			if err := json.NewDecoder(get(fmt.Sprintf("/appointments/%d?include=car", id), models.RoleSalesperson).Body).Decode(&appointment); err != nil {
+				t.Fatalf("decoding appointment: %v", err)
+			}
+			wantCar(&appointment, true)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"keeper/internal/auth"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Authentication and authorization errors
+var (
+	errMissingToken = errors.New("missing or malformed Authorization header")
+	errForbidden    = errors.New("insufficient permissions for this resource")
+)
+
+// Role groups used by the per-route access policy in NewAPIServer
+var (
+	allRoles = []models.Role{
+		models.RoleAssistant, models.RoleSalesperson, models.RoleManager, models.RoleAdmin, models.RoleMechanic,
+	}
+	officeRoles     = []models.Role{models.RoleAssistant, models.RoleSalesperson, models.RoleManager, models.RoleAdmin}
+	salesRoles      = []models.Role{models.RoleSalesperson, models.RoleManager, models.RoleAdmin}
+	managementRoles = []models.Role{models.RoleManager, models.RoleAdmin}
+	adminRoles      = []models.Role{models.RoleAdmin}
+)
+
+// timeout attaches the configured deadline to the request context, so that storage calls still
+// running when it expires are cancelled instead of holding a connection. Streams are left open.
+func (s *APIServer) timeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.requestTimeout <= 0 || streamingPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), s.requestTimeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate verifies the Bearer access token and stores the principal in the request context.
+// Requests without a valid token are rejected with 401 Unauthorized.
+func (s *APIServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		token, found := strings.CutPrefix(header, "Bearer ")
+		if !found || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="keeper"`)
+			writeError(w, http.StatusUnauthorized, errMissingToken)
+			logError(r, errMissingToken)
+			return
+		}
+
+		claims, err := s.tokens.Parse(token, auth.TokenTypeAccess)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="keeper", error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, err)
+			logError(r, err)
+			return
+		}
+
+		employeeID, err := claims.EmployeeID()
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			logError(r, err)
+			return
+		}
+
+		principal := &auth.Principal{EmployeeID: employeeID, Role: claims.Role}
+		ctx := auth.WithPrincipal(r.Context(), principal)
+		// Changes made by the request are attributed to the caller in the audit log
+		ctx = storage.WithActor(ctx, storage.Actor{EmployeeID: employeeID, RequestID: middleware.GetReqID(ctx)})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireRoles allows the request through only if the authenticated principal holds one of roles.
+// It must be mounted after authenticate; otherwise every request is rejected with 401.
+func requireRoles(roles ...models.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.PrincipalFromContext(r.Context())
+			if !ok {
+				writeError(w, http.StatusUnauthorized, errMissingToken)
+				logError(r, errMissingToken)
+				return
+			}
+
+			if !principal.HasRole(roles...) {
+				writeError(w, http.StatusForbidden, errForbidden)
+				logError(r, errForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// actorID returns the employee ID of the authenticated caller, or 0 for unauthenticated requests
+func actorID(r *http.Request) int {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		return 0
+	}
+	return principal.EmployeeID
+}
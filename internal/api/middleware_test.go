@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"keeper/internal/auth"
+	"keeper/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// TestRoutePolicy verifies that authentication and role checks run before any handler,
+// so these cases never reach the (nil) store.
+func TestRoutePolicy(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		role       models.Role
+		wantStatus int
+	}{
+		{
+			name:       "missing token",
+			method:     "GET",
+			path:       "/cars",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "salesperson cannot delete dealerships",
+			method:     "DELETE",
+			path:       "/dealerships/1",
+			role:       models.RoleSalesperson,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "mechanic cannot read orders",
+			method:     "GET",
+			path:       "/orders",
+			role:       models.RoleMechanic,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "assistant cannot manage employments",
+			method:     "POST",
+			path:       "/employments",
+			role:       models.RoleAssistant,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.role != "" {
+				authorize(t, server, req, tc.role)
+			}
+
+			w := httptest.NewRecorder()
+			server.Router.ServeHTTP(w, req)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf(errStatusMismatch, w.Code, tc.wantStatus)
+			}
+		})
+	}
+
+	t.Run("invalid token signature", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/cars", nil)
+		req.Header.Set("Authorization", "Bearer not.a.token")
+
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf(errStatusMismatch, w.Code, http.StatusUnauthorized)
+		}
+	})
+}
+
+// TestRequestTimeout verifies that a storage call cut short by the request deadline or by
+// a cancelled request is reported as 504 or 503 rather than as an internal error.
+func TestRequestTimeout(t *testing.T) {
+	validate := validator.New()
+	tokens := auth.NewTokenManager([]byte(testJWTSecret))
+	server := NewAPIServer(":0", nil, validate, tokens, WithRequestTimeout(10*time.Millisecond))
+
+	// slowQuery stands in for a handler whose storage call honours the request context
+	slowQuery := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("query failed: %w", r.Context().Err()))
+		case <-time.After(time.Second):
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+
+	t.Run("deadline exceeded", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.timeout(slowQuery).ServeHTTP(w, httptest.NewRequest("GET", "/cars", nil))
+		if w.Code != http.StatusGatewayTimeout {
+			t.Errorf(errStatusMismatch, w.Code, http.StatusGatewayTimeout)
+		}
+	})
+
+	t.Run("client gone", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		w := httptest.NewRecorder()
+		server.timeout(slowQuery).ServeHTTP(w, httptest.NewRequest("GET", "/cars", nil).WithContext(ctx))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf(errStatusMismatch, w.Code, http.StatusServiceUnavailable)
+		}
+	})
+}
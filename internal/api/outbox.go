@@ -0,0 +1,73 @@
+package api
+
+import (
+	"keeper/internal/storage"
+	"net/http"
+)
+
+// @Summary      List outbox events
+// @Description  Lists the domain events written for the notifier, newest first, with their delivery state. Filter on status=dead to find the events the dispatcher gave up on. Admin only.
+// @Tags         Outbox
+// @Security     BearerAuth
+// @Produce      json
+// @Param        status      query     string  false  "pending, delivered or dead"
+// @Param        event_type  query     string  false  "e.g. order.created or appointment.cancelled"
+// @Param        entity      query     string  false  "order or appointment"
+// @Param        entity_id   query     int     false  "ID of the order or appointment"
+// @Param        page        query     int     false  "Page number (1-based)"
+// @Param        page_size   query     int     false  "Page size (default 50, max 200)"
+// @Param        cursor      query     string  false  "Opaque cursor returned as next_cursor by a previous page"
+// @Success      200 {object}  ListResponse{data=[]models.OutboxEvent}
+// @Failure      400 {object}  Problem  "Error: Invalid query parameter"
+// @Failure      401 {object}  Problem  "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem  "Error: Insufficient permissions"
+// @Failure      500 {object}  Problem  "Error: Internal server error"
+// @Router       /outbox [get]
+func (s *APIServer) handleGetOutbox(w http.ResponseWriter, r *http.Request) {
+	query, err := parseListQuery(r, storage.OutboxFields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+	if len(query.Sort) == 0 {
+		query.Sort = []storage.Sort{{Field: "id_event", Desc: true}}
+	}
+
+	page, err := s.store.ListOutboxEvents(r.Context(), query)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newListResponse(page, query))
+}
+
+// @Summary      Requeue a dead outbox event
+// @Description  Makes a dead-lettered event pending again with a fresh set of attempts, e.g. once the notifier is fixed. Admin only.
+// @Tags         Outbox
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Event ID"
+// @Success      200 {object}  models.OutboxEvent
+// @Failure      400 {object}  Problem  "Error: Invalid ID"
+// @Failure      401 {object}  Problem  "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem  "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem  "Error: Event not found"
+// @Failure      409 {object}  Problem  "Error: The event is not dead"
+// @Failure      500 {object}  Problem  "Error: Internal server error"
+// @Router       /outbox/{id}/requeue [post]
+func (s *APIServer) handleRequeueOutboxEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	event, err := s.store.RequeueOutboxEvent(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, event)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOutboxAPI(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	server := newTestServer(t, store)
+
+	send := func(method, url string, role models.Role) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		authorize(t, server, req, role)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var ids []int
+	for range 2 {
+		event := &models.OutboxEvent{EventType: models.EventAppointmentBooked, Entity: storage.AuditAppointment, EntityID: 3, Payload: models.EventPayload{}}
+		if err := store.CreateOutboxEvent(ctx, event); err != nil {
+			t.Fatalf("CreateOutboxEvent: %v", err)
+		}
+		ids = append(ids, event.ID_Event)
+	}
+	if err := store.DeadLetterOutboxEvent(ctx, ids[0], "notifier rejected the event with 400 Bad Request"); err != nil {
+		t.Fatalf("DeadLetterOutboxEvent: %v", err)
+	}
+
+	t.Run("it lists dead events", func(t *testing.T) {
+		rr := send(http.MethodGet, "/outbox?status=dead", models.RoleAdmin)
+		if rr.Code != http.StatusOK {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusOK)
+		}
+		var resp ListResponse[models.OutboxEvent]
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding outbox: %v", err)
+		}
+		if len(resp.Data) != 1 || resp.Data[0].ID_Event != ids[0] {
+			t.Errorf("dead events = %+v, want event %d", resp.Data, ids[0])
+		}
+	})
+
+	t.Run("it requeues dead events only", func(t *testing.T) {
+		rr := send(http.MethodPost, fmt.Sprintf("/outbox/%d/requeue", ids[0]), models.RoleAdmin)
+		if rr.Code != http.StatusOK {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusOK)
+		}
+		var event models.OutboxEvent
+		if err := json.NewDecoder(rr.Body).Decode(&event); err != nil {
+			t.Fatalf("decoding event: %v", err)
+		}
+		if event.Status != models.EventPending {
+			t.Errorf("requeued event is %s, want pending", event.Status)
+		}
+		if rr := send(http.MethodPost, fmt.Sprintf("/outbox/%d/requeue", ids[1]), models.RoleAdmin); rr.Code != http.StatusConflict {
+			t.Errorf("requeue of a pending event: "+errStatusMismatch, rr.Code, http.StatusConflict)
+		}
+	})
+
+	t.Run("it is reserved to admins", func(t *testing.T) {
+		if rr := send(http.MethodGet, "/outbox", models.RoleManager); rr.Code != http.StatusForbidden {
+			t.Errorf(errStatusMismatch, rr.Code, http.StatusForbidden)
+		}
+	})
+}
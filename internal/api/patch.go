@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// mergePatchContentType is the media type of RFC 7396 JSON merge patches
+const mergePatchContentType = "application/merge-patch+json"
+
+var (
+	errUnsupportedPatchType = fmt.Errorf("PATCH requests must be sent as %s or application/json", mergePatchContentType)
+	errPatchNotObject       = errors.New("a merge patch must be a JSON object")
+)
+
+// readOnlyFieldsError reports the members of a merge patch that the client may not change
+type readOnlyFieldsError struct {
+	Fields []string
+}
+
+func (e *readOnlyFieldsError) Error() string {
+	return "cannot change read-only fields: " + strings.Join(e.Fields, ", ")
+}
+
+// The fields each PATCH endpoint lets a client change. Identifiers, timestamps and values
+// with their own endpoint, such as the status of a car, are left out.
+var (
+	dealershipPatchFields  = []string{"postalcode", "city", "address", "phone", "time_zone"}
+	employeePatchFields    = []string{"role", "tin", "name", "surname", "phone"}
+	employmentPatchFields  = []string{"id_employee", "id_dealership", "startdate", "enddate"}
+	clientPatchFields      = []string{"type", "phone", "email", "tin_vat", "name", "surname", "companyname", "profession"}
+	carPatchFields         = []string{"vin", "id_dealership", "brand", "model", "condition", "year", "km", "plate"}
+	workshopCarPatchFields = []string{"condition", "km"} // The car fields mechanics may patch, which PUT does not let them
+	orderPatchFields       = []string{"status", "id_client", "id_employee", "vin", "id_dealership", "status_reason"}
+	appointmentPatchFields = []string{"id_client", "id_employee", "id_dealership", "date", "duration_minutes", "vin", "reason", "notes"}
+	webhookPatchFields     = []string{"url", "event_types", "description", "paused"}
+)
+
+// readMergePatch decodes the body of a PATCH request, which must be a JSON object sent as
+// application/merge-patch+json or application/json. On failure it writes the error and returns false.
+func readMergePatch(w http.ResponseWriter, r *http.Request) (map[string]any, bool) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchContentType && mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, errUnsupportedPatchType)
+		logError(r, errUnsupportedPatchType)
+		return nil, false
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	var body any
+	if err := decoder.Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return nil, false
+	}
+
+	patch, ok := body.(map[string]any)
+	if !ok {
+		writeError(w, http.StatusBadRequest, errPatchNotObject)
+		logError(r, errPatchNotObject)
+		return nil, false
+	}
+	return patch, true
+}
+
+// applyMergePatch applies patch to the struct pointed to by target following RFC 7396: members
+// replace the stored value and null removes it, which resets the field to its zero value.
+// Members not listed in writable are rejected with a *readOnlyFieldsError and target is left untouched.
+func applyMergePatch(target any, patch map[string]any, writable []string) error {
+	var readOnly []string
+	for field := range patch {
+		if !slices.Contains(writable, field) {
+			readOnly = append(readOnly, field)
+		}
+	}
+	if len(readOnly) > 0 {
+		sort.Strings(readOnly)
+		return &readOnlyFieldsError{Fields: readOnly}
+	}
+
+	current, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(current))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return err
+	}
+
+	merged, err := json.Marshal(mergePatch(document, patch))
+	if err != nil {
+		return err
+	}
+
+	// Decoding into a zero value rather than onto target is what lets null clear a field
+	patched := reflect.New(reflect.TypeOf(target).Elem())
+	if err := json.Unmarshal(merged, patched.Interface()); err != nil {
+		return err
+	}
+	reflect.ValueOf(target).Elem().Set(patched.Elem())
+	return nil
+}
+
+// mergePatch is the MergePatch function of RFC 7396
+func mergePatch(target, patch any) any {
+	members, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	document, ok := target.(map[string]any)
+	if !ok {
+		document = map[string]any{}
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(document, name)
+		} else {
+			document[name] = mergePatch(document[name], value)
+		}
+	}
+	return document
+}
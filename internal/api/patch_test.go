@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	phone, email := "0832 123456", "info@example.com"
+	client := &models.Client{ID_Client: 7, Type: models.ClientTypePrivate, TIN_VAT: "RSSMRA80A01E506X", Name: "Mario", Phone: &phone, Email: &email}
+
+	patch := map[string]any{"name": "Maria", "phone": nil}
+	if err := applyMergePatch(client, patch, clientPatchFields); err != nil {
+		t.Fatalf("applyMergePatch: %v", err)
+	}
+	if client.Name != "Maria" || client.Phone != nil {
+		t.Errorf("name = %q, phone = %v; want Maria and a cleared phone", client.Name, client.Phone)
+	}
+	if client.ID_Client != 7 || client.Email == nil || *client.Email != email || client.TIN_VAT != "RSSMRA80A01E506X" {
+		t.Errorf("fields missing from the patch changed: %+v", client)
+	}
+
+	err := applyMergePatch(client, map[string]any{"id_client": 8, "name": "Luigi", "created": "now"}, clientPatchFields)
+	readOnly, ok := err.(*readOnlyFieldsError)
+	if !ok {
+		t.Fatalf("patching read-only fields: got %v, want *readOnlyFieldsError", err)
+	}
+	if fmt.Sprint(readOnly.Fields) != "[created id_client]" {
+		t.Errorf("read-only fields = %v, want [created id_client]", readOnly.Fields)
+	}
+	if client.ID_Client != 7 || client.Name != "Maria" {
+		t.Errorf("a rejected patch modified the target: %+v", client)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// Cases from appendix A of RFC 7396
+	tests := []struct{ target, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		var target, patch any
+		json.Unmarshal([]byte(tt.target), &target)
+		json.Unmarshal([]byte(tt.patch), &patch)
+		got, _ := json.Marshal(mergePatch(target, patch))
+		if string(got) != tt.want {
+			t.Errorf("MergePatch(%s, %s) = %s, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestPatchCarAPI(t *testing.T) {
+	store := storage.NewMemoryStore()
+	server := newTestServer(t, store)
+
+	dealershipID, err := store.CreateDealership(context.Background(), &models.Dealership{PostalCode: "73100", City: "Lecce", Address: "Via Roma 1", Phone: "0832"})
+	if err != nil {
+		t.Fatalf("unable to insert test dealership: %v", err)
+	}
+	vin := "ZFA31200000123456"
+	carID, err := store.CreateCar(context.Background(), &models.CarPark{
+		VIN: &vin, ID_Dealership: dealershipID, Brand: "Fiat", Model: "Panda",
+		Condition: models.CondTypeUsed, Year: 2020, KM: "50000", Plate: "AB123CD",
+	})
+	if err != nil {
+		t.Fatalf("unable to insert test car: %v", err)
+	}
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/cars/%d", carID), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		authorize(t, server, req, models.RoleAdmin)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("it returns the updated car", func(t *testing.T) {
+		rr := patch(mergePatchContentType, `{"km": "61000", "vin": null}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusOK)
+		}
+		var car models.CarPark
+		if err := json.NewDecoder(rr.Body).Decode(&car); err != nil {
+			t.Fatalf("decoding car: %v", err)
+		}
+		if car.ID_Car != carID || car.KM != "61000" || car.VIN != nil || car.Brand != "Fiat" || car.Status != models.CarStatusInStock {
+			t.Errorf("patched car = %+v", car)
+		}
+	})
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        string
+		field       string
+	}{
+		{"read-only field", mergePatchContentType, `{"id_car": 99}`, http.StatusBadRequest, CodeReadOnlyField, "id_car"},
+		{"status", mergePatchContentType, `{"status": "sold"}`, http.StatusBadRequest, CodeStatusNotPatchable, ""},
+		{"invalid value", mergePatchContentType, `{"vin": "ABC"}`, http.StatusBadRequest, CodeValidationFailed, "vin"},
+		{"cleared required field", mergePatchContentType, `{"brand": null}`, http.StatusBadRequest, CodeValidationFailed, "brand"},
+		{"wrong type", "application/json", `{"km": 60000}`, http.StatusBadRequest, CodeMalformedJSON, "km"},
+		{"not an object", mergePatchContentType, `["km"]`, http.StatusBadRequest, CodeBadRequest, ""},
+		{"unsupported content type", "text/plain", `{"km": "1"}`, http.StatusUnsupportedMediaType, CodeUnsupportedMedia, ""},
+	}
+	for _, tt := range tests {
+		t.Run("it rejects "+tt.name, func(t *testing.T) {
+			rr := patch(tt.contentType, tt.body)
+			if rr.Code != tt.status {
+				t.Fatalf(errStatusMismatch, rr.Code, tt.status)
+			}
+			p := decodeProblem(t, rr)
+			if p.Code != tt.code {
+				t.Errorf("code = %q, want %q", p.Code, tt.code)
+			}
+			if tt.field != "" && (len(p.Errors) != 1 || p.Errors[0].Field != tt.field) {
+				t.Errorf("field errors = %+v, want one on %s", p.Errors, tt.field)
+			}
+		})
+	}
+
+	if car, _ := store.GetCarByID(context.Background(), carID); car.KM != "61000" || car.Brand != "Fiat" {
+		t.Errorf("a rejected patch changed the car: %+v", car)
+	}
+
+	t.Run("mechanics only patch the workshop fields", func(t *testing.T) {
+		// The test tokens are issued for employee 1, here a mechanic of the car's dealership
+		employeeID, err := store.CreateEmployee(context.Background(), &models.Employee{Role: models.RoleMechanic, TIN: "TESTTINMECH01", Name: "Gino", Surname: "Neri", Phone: "-"})
+		if err != nil || employeeID != 1 {
+			t.Fatalf("CreateEmployee = %d, %v, want employee 1", employeeID, err)
+		}
+		if _, err := store.CreateEmployment(context.Background(), &models.Employment{ID_Employee: employeeID, ID_Dealership: dealershipID, StartDate: time.Now().AddDate(0, 0, -1)}); err != nil {
+			t.Fatalf("CreateEmployment: %v", err)
+		}
+		send := func(body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/cars/%d", carID), bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", mergePatchContentType)
+			authorize(t, server, req, models.RoleMechanic)
+			rr := httptest.NewRecorder()
+			server.Router.ServeHTTP(rr, req)
+			return rr
+		}
+
+		if rr := send(`{"km": "62000"}`); rr.Code != http.StatusOK {
+			t.Errorf("patching km: "+errStatusMismatch, rr.Code, http.StatusOK)
+		}
+		if rr := send(`{"km": "63000", "vin": "ZFA31200000654321"}`); rr.Code != http.StatusForbidden {
+			t.Errorf("patching the VIN: "+errStatusMismatch, rr.Code, http.StatusForbidden)
+		}
+		if car, _ := store.GetCarByID(context.Background(), carID); car.KM != "62000" || car.VIN != nil {
+			t.Errorf("car after the mechanic's patches = %+v", car)
+		}
+	})
+}
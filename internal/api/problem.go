@@ -0,0 +1,286 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"keeper/internal/storage"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// problemContentType is the media type of RFC 7807 error responses
+const problemContentType = "application/problem+json"
+
+// Problem is the RFC 7807 body of every error response. Code is a stable, machine-readable
+// identifier of the error; clients should branch on it rather than on Detail, which is for humans.
+type Problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+	Code   string       `json:"code"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes why a single field of the request body was rejected.
+// Field is the JSON name of the field, Rule the validation rule it broke and Param its argument, if any.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// Stable error codes. Errors without a specific code fall back to the code of their status.
+const (
+	CodeBadRequest          = "bad_request"
+	CodeMalformedJSON       = "malformed_json"
+	CodeValidationFailed    = "validation_failed"
+	CodeInvalidCursor       = "invalid_cursor"
+	CodeStatusNotPatchable  = "status_not_patchable"
+	CodeReadOnlyField       = "read_only_field"
+	CodeUnauthorized        = "unauthorized"
+	CodeMissingToken        = "missing_token"
+	CodeInvalidCredentials  = "invalid_credentials"
+	CodeForbidden           = "forbidden"
+	CodeOutOfScope          = "out_of_scope"
+	CodeNotFound            = "not_found"
+	CodeVersionMismatch     = "version_mismatch"
+	CodeIfMatchRequired     = "if_match_required"
+	CodeIdempotencyKeyInUse = "idempotency_key_in_use"
+	CodeIdempotencyReused   = "idempotency_key_reused"
+	CodeConflict            = "conflict"
+	CodeStillReferenced     = "still_referenced"
+	CodeAlreadyExists       = "already_exists"
+	CodeInvalidTransition   = "invalid_transition"
+	CodeCarUnavailable      = "car_unavailable"
+	CodeCarElsewhere        = "car_in_other_dealership"
+	CodeNotDeleted          = "not_deleted"
+	CodeSlotTaken           = "slot_taken"
+	CodeUnsupportedMedia    = "unsupported_media_type"
+	CodeUnprocessable       = "unprocessable_entity"
+	CodeUnknownReference    = "unknown_reference"
+	CodeConstraintViolation = "constraint_violation"
+	CodeDealershipClosed    = "dealership_closed"
+	CodeInternal            = "internal_error"
+	CodeRequestCanceled     = "request_canceled"
+	CodeRequestTimeout      = "request_timeout"
+)
+
+// statusCodes is the fallback code of each status
+var statusCodes = map[int]string{
+	http.StatusBadRequest:           CodeBadRequest,
+	http.StatusUnauthorized:         CodeUnauthorized,
+	http.StatusForbidden:            CodeForbidden,
+	http.StatusNotFound:             CodeNotFound,
+	http.StatusConflict:             CodeConflict,
+	http.StatusPreconditionFailed:   CodeVersionMismatch,
+	http.StatusPreconditionRequired: CodeIfMatchRequired,
+	http.StatusUnsupportedMediaType: CodeUnsupportedMedia,
+	http.StatusUnprocessableEntity:  CodeUnprocessable,
+	http.StatusInternalServerError:  CodeInternal,
+	http.StatusServiceUnavailable:   CodeRequestCanceled,
+	http.StatusGatewayTimeout:       CodeRequestTimeout,
+}
+
+// sentinelCodes are the codes of the errors the API itself reports
+var sentinelCodes = map[error]string{
+	errMissingToken:              CodeMissingToken,
+	errInvalidCredentials:        CodeInvalidCredentials,
+	errForbidden:                 CodeForbidden,
+	errOutOfScope:                CodeOutOfScope,
+	errInvalidCursor:             CodeInvalidCursor,
+	errStatusNotPatchable:        CodeStatusNotPatchable,
+	errRequestTimeout:            CodeRequestTimeout,
+	errRequestCanceled:           CodeRequestCanceled,
+	errDealershipClosed:          CodeDealershipClosed,
+	errIfMatchRequired:           CodeIfMatchRequired,
+	errIdempotencyKeyInUse:       CodeIdempotencyKeyInUse,
+	errIdempotencyKeyReused:      CodeIdempotencyReused,
+	storage.ErrNotFound:          CodeNotFound,
+	storage.ErrInvalidTransition: CodeInvalidTransition,
+	storage.ErrCarUnavailable:    CodeCarUnavailable,
+	storage.ErrCarElsewhere:      CodeCarElsewhere,
+	storage.ErrSlotTaken:         CodeSlotTaken,
+	storage.ErrVersionMismatch:   CodeVersionMismatch,
+	storage.ErrNotDeleted:        CodeNotDeleted,
+}
+
+// crossFieldErrors are the checks comparing two fields that handlers perform after validateRequest
+var crossFieldErrors = map[error]FieldError{
+	errClosesBeforeOpens: {Field: "closes_at", Rule: "gtfield", Param: "opens_at", Message: "must be later than opens_at"},
+	errEndBeforeStart:    {Field: "enddate", Rule: "gtefield", Param: "startdate", Message: "must not be earlier than startdate"},
+}
+
+// errInternal replaces the message of server faults, which may contain SQL or driver details
+var errInternal = errors.New("an unexpected error occurred")
+
+// newProblem builds the Problem reported for err with the given status
+func newProblem(status int, err error) *Problem {
+	p := &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: err.Error(),
+		Code:   statusCodes[status],
+	}
+	if p.Code == "" {
+		p.Code = strings.ReplaceAll(strings.ToLower(p.Title), " ", "_")
+	}
+	if status >= http.StatusInternalServerError && !errors.Is(err, errRequestTimeout) && !errors.Is(err, errRequestCanceled) {
+		p.Detail = errInternal.Error()
+		return p
+	}
+
+	for sentinel, code := range sentinelCodes {
+		if errors.Is(err, sentinel) {
+			p.Code = code
+			return p
+		}
+	}
+	for sentinel, field := range crossFieldErrors {
+		if errors.Is(err, sentinel) {
+			p.Code = CodeValidationFailed
+			p.Errors = []FieldError{field}
+			return p
+		}
+	}
+
+	var (
+		validationErrs validator.ValidationErrors
+		syntaxErr      *json.SyntaxError
+		typeErr        *json.UnmarshalTypeError
+		referenced     *storage.ReferencedError
+		unique         *storage.UniqueViolationError
+		foreignKey     *storage.ForeignKeyViolationError
+		check          *storage.CheckViolationError
+		readOnly       *readOnlyFieldsError
+	)
+	switch {
+	case errors.As(err, &validationErrs):
+		p.Code = CodeValidationFailed
+		p.Detail = "the request body failed validation"
+		p.Errors = fieldErrors(validationErrs)
+	case errors.As(err, &readOnly):
+		p.Code = CodeReadOnlyField
+		for _, field := range readOnly.Fields {
+			p.Errors = append(p.Errors, FieldError{Field: field, Rule: "writable", Message: "cannot be changed"})
+		}
+	case errors.As(err, &typeErr):
+		p.Code = CodeMalformedJSON
+		p.Detail = "the request body has a field of the wrong type"
+		p.Errors = []FieldError{{Field: typeErr.Field, Rule: "type", Param: typeErr.Type.Kind().String(), Message: "must be a " + jsonKind(typeErr.Type)}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		p.Code = CodeMalformedJSON
+		p.Detail = "the request body is not valid JSON"
+	case errors.Is(err, io.EOF):
+		p.Code = CodeMalformedJSON
+		p.Detail = "the request body is empty"
+	case errors.As(err, &referenced):
+		p.Code = CodeStillReferenced
+	case errors.As(err, &unique):
+		p.Code = CodeAlreadyExists
+		if unique.Field != "" {
+			p.Errors = []FieldError{{Field: unique.Field, Rule: "unique", Message: "is already in use"}}
+		}
+	case errors.As(err, &foreignKey):
+		p.Code = CodeUnknownReference
+		if foreignKey.Field != "" {
+			message := "refers to a record that does not exist"
+			if foreignKey.Referenced != "" {
+				message = fmt.Sprintf("refers to a %s that does not exist", foreignKey.Referenced)
+			}
+			p.Errors = []FieldError{{Field: foreignKey.Field, Rule: "exists", Param: foreignKey.Referenced, Message: message}}
+		}
+	case errors.As(err, &check):
+		p.Code = CodeConstraintViolation
+		if check.Field != "" {
+			p.Errors = []FieldError{{Field: check.Field, Rule: "required", Message: "is required"}}
+		}
+	}
+	return p
+}
+
+// fieldErrors converts validator failures into FieldErrors named after the JSON fields of the request
+func fieldErrors(errs validator.ValidationErrors) []FieldError {
+	fields := make([]FieldError, len(errs))
+	for i, fe := range errs {
+		fields[i] = FieldError{
+			Field:   fieldPath(fe),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: ruleMessage(fe),
+		}
+	}
+	return fields
+}
+
+// fieldPath is the dotted JSON path of a failed field, without the name of the top-level struct
+func fieldPath(fe validator.FieldError) string {
+	if _, path, found := strings.Cut(fe.Namespace(), "."); found {
+		return path
+	}
+	return fe.Field()
+}
+
+// ruleMessage describes a failed validation rule in words, e.g. "must be at most 50 characters long"
+func ruleMessage(fe validator.FieldError) string {
+	unit := ""
+	switch fe.Kind() {
+	case reflect.String:
+		unit = " characters long"
+	case reflect.Slice:
+		unit = " items"
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "http_url":
+		return "must be an http or https URL"
+	case "alphanum":
+		return "must contain only letters and digits"
+	case "len":
+		return fmt.Sprintf("must be exactly %s%s", fe.Param(), unit)
+	case "min", "gte":
+		return fmt.Sprintf("must be at least %s%s", fe.Param(), unit)
+	case "max", "lte":
+		return fmt.Sprintf("must be at most %s%s", fe.Param(), unit)
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "datetime":
+		return "must match the layout " + fe.Param()
+	}
+	return fmt.Sprintf("failed the %s rule", fe.Tag())
+}
+
+// jsonKind names the JSON type a Go type is decoded from
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
+
+// jsonFieldName makes the validator report fields by their JSON name; fields excluded from JSON keep their Go name
+func jsonFieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
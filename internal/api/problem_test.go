@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// decodeProblem checks the media type of an error response and decodes its body
+func decodeProblem(t *testing.T, rr *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if ct := rr.Header().Get("Content-Type"); ct != problemContentType {
+		t.Fatalf("Content-Type = %q, want %q", ct, problemContentType)
+	}
+	var p Problem
+	if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+		t.Fatalf("decoding problem: %v", err)
+	}
+	if p.Status != rr.Code {
+		t.Errorf("problem status %d does not match response status %d", p.Status, rr.Code)
+	}
+	return p
+}
+
+func TestValidationProblem(t *testing.T) {
+	server := newTestServer(t, storage.NewMemoryStore())
+
+	body := []byte(`{"postalcode": "731000", "address": "Via Roma 1", "phone": "0832"}`)
+	req := httptest.NewRequest(http.MethodPost, "/dealerships", bytes.NewReader(body))
+	authorize(t, server, req, models.RoleAdmin)
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf(errStatusMismatch, rr.Code, http.StatusBadRequest)
+	}
+	p := decodeProblem(t, rr)
+	if p.Code != CodeValidationFailed {
+		t.Errorf("code = %q, want %q", p.Code, CodeValidationFailed)
+	}
+
+	want := map[string]FieldError{
+		"postalcode": {Field: "postalcode", Rule: "max", Param: "5", Message: "must be at most 5 characters long"},
+		"city":       {Field: "city", Rule: "required", Message: "is required"},
+	}
+	if len(p.Errors) != len(want) {
+		t.Fatalf("got field errors %+v, want %d", p.Errors, len(want))
+	}
+	for _, fe := range p.Errors {
+		if fe != want[fe.Field] {
+			t.Errorf("field error %+v, want %+v", fe, want[fe.Field])
+		}
+	}
+}
+
+func TestMalformedJSONProblem(t *testing.T) {
+	server := newTestServer(t, storage.NewMemoryStore())
+
+	body := []byte(`{"postalcode": 73100}`)
+	req := httptest.NewRequest(http.MethodPost, "/dealerships", bytes.NewReader(body))
+	authorize(t, server, req, models.RoleAdmin)
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+
+	p := decodeProblem(t, rr)
+	if p.Code != CodeMalformedJSON {
+		t.Errorf("code = %q, want %q", p.Code, CodeMalformedJSON)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Field != "postalcode" || p.Errors[0].Rule != "type" {
+		t.Errorf("field errors = %+v, want a type error on postalcode", p.Errors)
+	}
+}
+
+func TestStorageProblems(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		code   string
+		fields []FieldError
+	}{
+		{
+			name:   "unique violation",
+			err:    &storage.UniqueViolationError{Table: "car_park", Field: "plate"},
+			code:   CodeAlreadyExists,
+			fields: []FieldError{{Field: "plate", Rule: "unique", Message: "is already in use"}},
+		},
+		{
+			name:   "foreign key violation",
+			err:    &storage.ForeignKeyViolationError{Table: "car_park", Field: "id_dealership", Referenced: "dealership"},
+			code:   CodeUnknownReference,
+			fields: []FieldError{{Field: "id_dealership", Rule: "exists", Param: "dealership", Message: "refers to a dealership that does not exist"}},
+		},
+		{
+			name: "still referenced",
+			err:  &storage.ReferencedError{References: []storage.Reference{{Resource: "orders", Count: 1}}},
+			code: CodeStillReferenced,
+		},
+		{
+			name: "not found",
+			err:  storage.ErrNotFound,
+			code: CodeNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			writeStorageError(rr, req, tt.err)
+
+			p := decodeProblem(t, rr)
+			if p.Code != tt.code {
+				t.Errorf("code = %q, want %q", p.Code, tt.code)
+			}
+			if len(p.Errors) != len(tt.fields) {
+				t.Fatalf("field errors = %+v, want %+v", p.Errors, tt.fields)
+			}
+			for i := range tt.fields {
+				if p.Errors[i] != tt.fields[i] {
+					t.Errorf("field error %+v, want %+v", p.Errors[i], tt.fields[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"keeper/internal/auth"
+	"keeper/internal/storage"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pagination limits for list endpoints
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+var (
+	errInvalidCursor           = errors.New("invalid cursor")
+	errPageTooLarge            = errors.New("page is too large")
+	errInvalidIncludeDeleted   = errors.New("include_deleted must be true or false")
+	errIncludeDeletedForbidden = errors.New("only admins can include deleted records")
+)
+
+// ListResponse is the envelope returned by every list endpoint
+type ListResponse[T any] struct {
+	Data       []T    `json:"data"`
+	Total      int64  `json:"total"`
+	Page       int    `json:"page"`
+	PageSize   int    `json:"page_size"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// parseListQuery builds a storage.ListQuery from the query string of a list request.
+//
+// Supported parameters:
+//   - page (1-based) and page_size (alias: limit), or an opaque cursor from a previous response
+//   - sort: comma-separated field names, prefixed with "-" for descending order
+//   - <field>=value or <field>=a,b for equality / IN filters
+//   - <field>_min / <field>_max for numeric ranges, <field>_from / <field>_to for dates
+//
+// Parameters that do not match a field of the resource are ignored.
+func parseListQuery(r *http.Request, fields storage.FieldSet) (*storage.ListQuery, error) {
+	values := r.URL.Query()
+	query := &storage.ListQuery{Limit: defaultPageSize}
+
+	for _, name := range []string{"page_size", "limit"} {
+		if raw := values.Get(name); raw != "" {
+			size, err := strconv.Atoi(raw)
+			if err != nil || size < 1 {
+				return nil, fmt.Errorf("%s must be a positive integer", name)
+			}
+			query.Limit = min(size, maxPageSize)
+		}
+	}
+
+	if raw := values.Get("cursor"); raw != "" {
+		offset, err := decodeCursor(raw)
+		if err != nil {
+			return nil, err
+		}
+		query.Offset = offset
+	} else if raw := values.Get("page"); raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil || page < 1 {
+			return nil, errors.New("page must be a positive integer")
+		}
+		// Pages past the largest offset would overflow it into a negative one
+		if page > math.MaxInt/query.Limit {
+			return nil, errPageTooLarge
+		}
+		query.Offset = (page - 1) * query.Limit
+	}
+
+	if raw := values.Get("sort"); raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			part = strings.TrimSpace(part)
+			desc := strings.HasPrefix(part, "-")
+			name := strings.TrimPrefix(part, "-")
+			if field, ok := fields.Fields[name]; !ok || field.NoSort || field.Column == "" {
+				return nil, fmt.Errorf("cannot sort by %q", name)
+			}
+			query.Sort = append(query.Sort, storage.Sort{Field: name, Desc: desc})
+		}
+	}
+
+	for key, raws := range values {
+		raw := raws[0]
+		if raw == "" {
+			continue
+		}
+
+		filter, err := parseFilter(key, raw, fields)
+		if err != nil {
+			return nil, err
+		}
+		if filter != nil {
+			query.Filters = append(query.Filters, *filter)
+		}
+	}
+
+	return query, nil
+}
+
+// includeDeleted reads the include_deleted parameter of the endpoints reading employees, clients and cars,
+// which only admins may set. On failure it writes the error response and returns false.
+func includeDeleted(w http.ResponseWriter, r *http.Request) (include, ok bool) {
+	raw := r.URL.Query().Get("include_deleted")
+	if raw == "" {
+		return false, true
+	}
+	include, err := strconv.ParseBool(raw)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidIncludeDeleted)
+		logError(r, errInvalidIncludeDeleted)
+		return false, false
+	}
+	if principal, found := auth.PrincipalFromContext(r.Context()); include && (!found || !principal.HasRole(adminRoles...)) {
+		writeError(w, http.StatusForbidden, errIncludeDeletedForbidden)
+		logError(r, errIncludeDeletedForbidden)
+		return false, false
+	}
+	return include, true
+}
+
+// parseFilter maps a single query parameter onto a filter, or returns nil if it names no field
+func parseFilter(key, raw string, fields storage.FieldSet) (*storage.Filter, error) {
+	if field, ok := fields.Fields[key]; ok {
+		switch field.Kind {
+		case storage.KindString:
+			if parts := strings.Split(raw, ","); len(parts) > 1 && field.Predicate == "" {
+				values := make([]any, len(parts))
+				for i, part := range parts {
+					values[i] = strings.TrimSpace(part)
+				}
+				return &storage.Filter{Field: key, Op: storage.OpIn, Value: values}, nil
+			}
+			return &storage.Filter{Field: key, Op: storage.OpEq, Value: raw}, nil
+		case storage.KindInt:
+			parts := strings.Split(raw, ",")
+			values := make([]any, len(parts))
+			for i, part := range parts {
+				n, err := strconv.Atoi(strings.TrimSpace(part))
+				if err != nil {
+					return nil, fmt.Errorf("%s must be an integer", key)
+				}
+				values[i] = n
+			}
+			if len(values) > 1 {
+				return &storage.Filter{Field: key, Op: storage.OpIn, Value: values}, nil
+			}
+			return &storage.Filter{Field: key, Op: storage.OpEq, Value: values[0]}, nil
+		case storage.KindBool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be true or false", key)
+			}
+			return &storage.Filter{Field: key, Op: storage.OpEq, Value: b}, nil
+		default:
+			return nil, fmt.Errorf("%s can only be filtered with %s_from and %s_to", key, key, key)
+		}
+	}
+
+	suffixes := []struct {
+		suffix string
+		kind   storage.FieldKind
+		op     storage.Operator
+	}{
+		{"_min", storage.KindInt, storage.OpGte},
+		{"_max", storage.KindInt, storage.OpLte},
+		{"_from", storage.KindTime, storage.OpGte},
+		{"_to", storage.KindTime, storage.OpLte},
+	}
+
+	for _, sfx := range suffixes {
+		name, found := strings.CutSuffix(key, sfx.suffix)
+		if !found {
+			continue
+		}
+		field, ok := fields.Fields[name]
+		if !ok || field.Kind != sfx.kind || field.Predicate != "" {
+			continue
+		}
+
+		if sfx.kind == storage.KindInt {
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an integer", key)
+			}
+			return &storage.Filter{Field: name, Op: sfx.op, Value: n}, nil
+		}
+
+		t, dateOnly, err := parseTimeParam(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD) or an RFC 3339 timestamp", key)
+		}
+		// A date-only upper bound includes the whole day
+		if sfx.op == storage.OpLte && dateOnly {
+			return &storage.Filter{Field: name, Op: storage.OpLt, Value: t.AddDate(0, 0, 1)}, nil
+		}
+		return &storage.Filter{Field: name, Op: sfx.op, Value: t}, nil
+	}
+
+	return nil, nil
+}
+
+// parseTimeParam accepts either a date (2006-01-02) or an RFC 3339 timestamp
+func parseTimeParam(raw string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	return t, false, err
+}
+
+// newListResponse wraps a storage page in the list envelope, computing the next cursor
+func newListResponse[T any](page *storage.Page[T], query *storage.ListQuery) *ListResponse[T] {
+	resp := &ListResponse[T]{
+		Data:     page.Items,
+		Total:    page.Total,
+		Page:     query.Offset/query.Limit + 1,
+		PageSize: query.Limit,
+	}
+	if resp.Data == nil {
+		resp.Data = []T{}
+	}
+
+	if next := query.Offset + len(page.Items); int64(next) < page.Total && len(page.Items) > 0 {
+		resp.NextCursor = encodeCursor(next)
+	}
+	return resp
+}
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(raw), "o:"))
+	if err != nil || offset < 0 || !strings.HasPrefix(string(raw), "o:") {
+		return 0, errInvalidCursor
+	}
+	return offset, nil
+}
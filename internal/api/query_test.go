@@ -0,0 +1,136 @@
+package api
+
+import (
+	"errors"
+	"keeper/internal/storage"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// findFilter returns the filter on the given field, if any.
+func findFilter(q *storage.ListQuery, field string) *storage.Filter {
+	for i := range q.Filters {
+		if q.Filters[i].Field == field {
+			return &q.Filters[i]
+		}
+	}
+	return nil
+}
+
+// TestParseListQuery verifies pagination, sorting and filter parsing against the car field set.
+func TestParseListQuery(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		q, err := parseListQuery(httptest.NewRequest("GET", "/cars", nil), storage.CarFields)
+		if err != nil {
+			t.Fatalf("parseListQuery() error = %v", err)
+		}
+		if q.Limit != defaultPageSize || q.Offset != 0 || len(q.Filters) != 0 {
+			t.Errorf("unexpected defaults: %+v", q)
+		}
+	})
+
+	t.Run("showroom search", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/cars?city=Lecce&brand=Fiat&page=3&page_size=10&year_min=2018&condition=new,used&sort=-year,brand&include=x", nil)
+		q, err := parseListQuery(req, storage.CarFields)
+		if err != nil {
+			t.Fatalf("parseListQuery() error = %v", err)
+		}
+
+		if q.Offset != 20 || q.Limit != 10 {
+			t.Errorf("offset/limit = %d/%d, want 20/10", q.Offset, q.Limit)
+		}
+		if len(q.Filters) != 4 {
+			t.Errorf("expected 4 filters, got %d: %+v", len(q.Filters), q.Filters)
+		}
+		if f := findFilter(q, "year"); f == nil || f.Op != storage.OpGte || f.Value != 2018 {
+			t.Errorf("unexpected year filter: %+v", f)
+		}
+		if f := findFilter(q, "condition"); f == nil || f.Op != storage.OpIn {
+			t.Errorf("unexpected condition filter: %+v", f)
+		}
+		if len(q.Sort) != 2 || !q.Sort[0].Desc || q.Sort[1].Field != "brand" {
+			t.Errorf("unexpected sort: %+v", q.Sort)
+		}
+	})
+
+	t.Run("date-only upper bound includes the whole day", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/appointments?date_to=2025-01-31", nil)
+		q, err := parseListQuery(req, storage.AppointmentFields)
+		if err != nil {
+			t.Fatalf("parseListQuery() error = %v", err)
+		}
+		f := findFilter(q, "date")
+		if f == nil || f.Op != storage.OpLt || !f.Value.(time.Time).Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("unexpected date filter: %+v", f)
+		}
+	})
+
+	t.Run("cursor round trip", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/cars?cursor="+encodeCursor(150), nil)
+		q, err := parseListQuery(req, storage.CarFields)
+		if err != nil || q.Offset != 150 {
+			t.Errorf("parseListQuery() offset = %d, err = %v; want 150, nil", q.Offset, err)
+		}
+	})
+
+	errorCases := map[string]string{
+		"unknown sort field":   "/cars?sort=price",
+		"non-numeric year_min": "/cars?year_min=new",
+		"bad page":             "/cars?page=0",
+		"bad cursor":           "/cars?cursor=bm90LWFuLW9mZnNldA",
+		"non-numeric year":     "/cars?year=abc",
+		"unsortable predicate": "/cars?sort=city",
+	}
+	for name, target := range errorCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseListQuery(httptest.NewRequest("GET", target, nil), storage.CarFields); err == nil {
+				t.Errorf("parseListQuery(%q) expected an error", target)
+			}
+		})
+	}
+
+	t.Run("overflowing page", func(t *testing.T) {
+		_, err := parseListQuery(httptest.NewRequest("GET", "/cars?page=9223372036854775807", nil), storage.CarFields)
+		if !errors.Is(err, errPageTooLarge) {
+			t.Errorf("parseListQuery() error = %v, want %v", err, errPageTooLarge)
+		}
+	})
+}
+
+// TestNewListResponse verifies the envelope metadata and next cursor computation.
+func TestNewListResponse(t *testing.T) {
+	q := &storage.ListQuery{Offset: 10, Limit: 10}
+
+	resp := newListResponse(&storage.Page[int]{Items: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, Total: 25}, q)
+	if resp.Page != 2 || resp.NextCursor != encodeCursor(20) {
+		t.Errorf("unexpected envelope: %+v", resp)
+	}
+
+	last := newListResponse(&storage.Page[int]{Items: []int{1, 2, 3, 4, 5}, Total: 15}, q)
+	if last.NextCursor != "" {
+		t.Errorf("expected no next cursor on the last page, got %q", last.NextCursor)
+	}
+
+	empty := newListResponse(&storage.Page[int]{}, q)
+	if empty.Data == nil {
+		t.Errorf("expected an empty, non-nil data slice")
+	}
+}
+
+// TestParseIncludes verifies that only whitelisted relations can be embedded.
+func TestParseIncludes(t *testing.T) {
+	req := httptest.NewRequest("GET", "/orders?include=client,%20car", nil)
+	include, err := parseIncludes(req, includeClient, includeEmployee, includeCar, includeDealership)
+	if err != nil {
+		t.Fatalf("parseIncludes() error = %v", err)
+	}
+	if !include[includeClient] || !include[includeCar] || include[includeEmployee] {
+		t.Errorf("unexpected include set: %v", include)
+	}
+
+	req = httptest.NewRequest("GET", "/employments?include=car", nil)
+	if _, err := parseIncludes(req, includeEmployee, includeDealership); err == nil {
+		t.Errorf("parseIncludes() expected an error for a relation that is not allowed")
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"errors"
+	"keeper/internal/auth"
+	"keeper/internal/storage"
+	"net/http"
+)
+
+var errOutOfScope = errors.New("resource belongs to a dealership outside your assignment")
+
+// dealershipScope resolves the storage scope of the authenticated principal.
+// Managers and admins are unrestricted (nil scope); everyone else is limited to the
+// dealerships of their active employments, i.e. those without an end date.
+func (s *APIServer) dealershipScope(r *http.Request) (*storage.Scope, error) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		return nil, errMissingToken
+	}
+
+	if principal.HasRole(managementRoles...) {
+		return nil, nil
+	}
+
+	ids, err := s.store.GetActiveDealershipIDs(r.Context(), principal.EmployeeID)
+	if err != nil {
+		return nil, err
+	}
+	return &storage.Scope{DealershipIDs: ids}, nil
+}
+
+// resolveScope is dealershipScope for handlers: on failure it writes the error response and returns false
+func (s *APIServer) resolveScope(w http.ResponseWriter, r *http.Request) (*storage.Scope, bool) {
+	scope, err := s.dealershipScope(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		logError(r, err)
+		return nil, false
+	}
+	return scope, true
+}
+
+// authorizeDealerships checks that every given dealership is within the principal's scope.
+// It writes 403 Forbidden and returns false if any of them is not.
+func (s *APIServer) authorizeDealerships(w http.ResponseWriter, r *http.Request, dealershipIDs ...int) bool {
+	_, ok := s.authorizedScope(w, r, dealershipIDs...)
+	return ok
+}
+
+// authorizedScope is authorizeDealerships returning the principal's scope, for handlers that go on
+// to read other records of the caller's dealerships
+func (s *APIServer) authorizedScope(w http.ResponseWriter, r *http.Request, dealershipIDs ...int) (*storage.Scope, bool) {
+	scope, ok := s.resolveScope(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	for _, id := range dealershipIDs {
+		if !scope.Allows(id) {
+			writeError(w, http.StatusForbidden, errOutOfScope)
+			logError(r, errOutOfScope)
+			return nil, false
+		}
+	}
+	return scope, true
+}
@@ -2,10 +2,13 @@
 package api
 
 import (
+	"context"
 	_ "keeper/docs"
+	"keeper/internal/auth"
 	"keeper/internal/storage"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -18,21 +21,80 @@ type APIServer struct {
 	listenAddr string             // Server listen address
 	store      storage.Store      // Data storage interface
 	validate   *validator.Validate // Request validation instance
+	tokens     *auth.TokenManager  // Session token signer/verifier
 	Router     *chi.Mux          // HTTP router instance
+
+	requestTimeout time.Duration // Deadline of each request's context, 0 for none
+	requireIfMatch bool          // Reject writes without If-Match with 428 Precondition Required
+	idempotencyTTL time.Duration // How long the response to an Idempotency-Key is replayed
+	timeZone       *time.Location // Zone of the dealerships that have not set their own
+	events         *eventHub     // Car and order events for /events/stream
+}
+
+// defaultRequestTimeout bounds every request unless overridden with WithRequestTimeout
+const defaultRequestTimeout = 30 * time.Second
+
+// Option configures optional settings of the APIServer
+type Option func(*APIServer)
+
+// WithRequestTimeout sets the deadline of each request's context; queries still running when it
+// expires are cancelled and the client receives 504 Gateway Timeout. Zero disables the deadline.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(s *APIServer) {
+		s.requestTimeout = d
+	}
+}
+
+// WithRequireIfMatch makes If-Match mandatory on PUT, PATCH and DELETE of versioned resources,
+// so that no client can overwrite a change it has not seen
+func WithRequireIfMatch(required bool) Option {
+	return func(s *APIServer) {
+		s.requireIfMatch = required
+	}
+}
+
+// WithIdempotencyTTL sets how long the response stored for an Idempotency-Key is replayed to retries;
+// afterwards the key can be used again and is eventually deleted
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(s *APIServer) {
+		s.idempotencyTTL = ttl
+	}
+}
+
+// WithTimeZone sets the zone in which the opening hours and closures of dealerships without a
+// time_zone of their own are read; the default is UTC
+func WithTimeZone(loc *time.Location) Option {
+	return func(s *APIServer) {
+		s.timeZone = loc
+	}
 }
 
 // NewAPIServer creates a new API server instance with configured routes and middleware
-func NewAPIServer(listenAddr string, store storage.Store, validate *validator.Validate) *APIServer {
+func NewAPIServer(listenAddr string, store storage.Store, validate *validator.Validate, tokens *auth.TokenManager, opts ...Option) *APIServer {
 	server := &APIServer{
 		listenAddr: listenAddr,
 		store:      store,
 		validate:   validate, 
+		tokens:     tokens,
 		Router:     chi.NewRouter(),
+
+		requestTimeout: defaultRequestTimeout,
+		idempotencyTTL: defaultIdempotencyTTL,
+		timeZone:       time.UTC,
+		events:         newEventHub(store),
+	}
+	for _, opt := range opts {
+		opt(server)
 	}
 
+	// Report validation failures by the JSON names of the fields
+	server.validate.RegisterTagNameFunc(jsonFieldName)
+
 	// Configure middleware stack
+	server.Router.Use(middleware.RequestID) // Request ID, recorded in the logs and the audit log
 	server.Router.Use(middleware.Logger)    // Request logging
 	server.Router.Use(middleware.Recoverer) // Panic recovery
+	server.Router.Use(server.timeout)       // Per-request deadline
 
 	// Health check endpoint
 	server.Router.Get("/healthcheck", server.handleHealthCheck) // GET /healthcheck
@@ -40,60 +102,130 @@ func NewAPIServer(listenAddr string, store storage.Store, validate *validator.Va
 	// API documentation endpoint
 	server.Router.Get("/swagger/*", httpSwagger.WrapHandler)
 
-	// Dealership resource routes
-	server.Router.Route("/dealerships", func(r chi.Router) {
-		r.Post("/", server.handleCreateDealership)     // Create new dealership
-		r.Get("/", server.handleGetDealerships)        // List all dealerships
-		r.Put("/{id}", server.handleUpdateDealership)  // Update existing dealership
-		r.Delete("/{id}", server.handleDeleteDealership) // Delete dealership
+	// Authentication routes
+	server.Router.Route("/auth", func(r chi.Router) {
+		r.Post("/login", server.handleLogin)     // Exchange credentials for tokens
+		r.Post("/refresh", server.handleRefresh) // Exchange refresh token for new tokens
+		r.With(server.authenticate).Get("/me", server.handleMe) // Current employee
 	})
 
-	// Employee resource routes
-	server.Router.Route("/employees", func(r chi.Router) {
-		r.Post("/", server.handleCreateEmployee)     // Create new employee
-		r.Get("/", server.handleGetEmployees)         // List all employees
-		r.Put("/{id}", server.handleUpdateEmployee)  // Update existing employee
-		r.Delete("/{id}", server.handleDeleteEmployee) // Delete employee
-	})
+	// Every resource route below requires a valid access token
+	server.Router.Group(func(r chi.Router) {
+		r.Use(server.authenticate)
 
-	// Employment resource routes
-	server.Router.Route("/employments", func(r chi.Router) {
-		r.Post("/", server.handleCreateEmployment)     // Create new employment
-		r.Get("/", server.handleGetEmployments)        // List all employments
-		r.Put("/{id}", server.handleUpdateEmployment)  // Update existing employment
-		r.Delete("/{id}", server.handleDeleteEmployment) // Delete employment
-	})
+		// Dealership resource routes
+		r.Route("/dealerships", func(r chi.Router) {
+			r.With(requireRoles(managementRoles...), server.idempotent).Post("/", server.handleCreateDealership)       // Create new dealership
+			r.With(requireRoles(allRoles...)).Get("/", server.handleGetDealerships)                // List all dealerships
+			r.With(requireRoles(allRoles...)).Get("/{id}", server.handleGetDealershipByID)         // Get dealership by ID
+			r.With(requireRoles(managementRoles...)).Put("/{id}", server.handleUpdateDealership)    // Update existing dealership
+			r.With(requireRoles(managementRoles...)).Patch("/{id}", server.handlePatchDealership)   // Partially update dealership
+			r.With(requireRoles(managementRoles...)).Delete("/{id}", server.handleDeleteDealership) // Delete dealership
 
-	// Client resource routes
-	server.Router.Route("/clients", func(r chi.Router) {
-		r.Post("/", server.handleCreateClient)     // Create new client
-		r.Get("/", server.handleGetClients)        // List all clients
-		r.Put("/{id}", server.handleUpdateClient)  // Update existing client
-		r.Delete("/{id}", server.handleDeleteClient) // Delete client
-	})
+			// Opening hours and closures of a dealership
+			r.With(requireRoles(allRoles...)).Get("/{id}/hours", server.handleGetOpeningHours)
+			r.With(requireRoles(managementRoles...), server.idempotent).Post("/{id}/hours", server.handleCreateOpeningHours)
+			r.With(requireRoles(managementRoles...)).Put("/{id}/hours/{hoursID}", server.handleUpdateOpeningHours)
+			r.With(requireRoles(managementRoles...)).Delete("/{id}/hours/{hoursID}", server.handleDeleteOpeningHours)
+			r.With(requireRoles(allRoles...)).Get("/{id}/closures", server.handleGetClosures)
+			r.With(requireRoles(managementRoles...), server.idempotent).Post("/{id}/closures", server.handleCreateClosure)
+			r.With(requireRoles(managementRoles...)).Put("/{id}/closures/{closureID}", server.handleUpdateClosure)
+			r.With(requireRoles(managementRoles...)).Delete("/{id}/closures/{closureID}", server.handleDeleteClosure)
+		})
 
-	// Car resource routes
-	server.Router.Route("/cars", func(r chi.Router) {  
-		r.Post("/", server.handleCreateCar)      // Create new car
-		r.Get("/", server.handleGetCars)         // List all cars
-		r.Patch("/{id}", server.handlePatchCar) // Partially update car
-		r.Delete("/{id}", server.handleDeleteCar) // Delete car
-	})
+		// Employee resource routes
+		r.Route("/employees", func(r chi.Router) {
+			r.With(requireRoles(managementRoles...), server.idempotent).Post("/", server.handleCreateEmployee)    // Create new employee
+			r.With(requireRoles(allRoles...)).Get("/", server.handleGetEmployees)             // List all employees
+			r.With(requireRoles(allRoles...)).Get("/{id}", server.handleGetEmployeeByID)      // Get employee by ID
+			r.With(requireRoles(managementRoles...)).Put("/{id}", server.handleUpdateEmployee) // Update existing employee
+			r.With(requireRoles(managementRoles...)).Patch("/{id}", server.handlePatchEmployee) // Partially update employee
+			r.With(requireRoles(adminRoles...)).Delete("/{id}", server.handleDeleteEmployee)   // Delete employee
+			r.With(requireRoles(adminRoles...)).Post("/{id}/restore", server.handleRestoreEmployee) // Restore deleted employee
+			r.With(requireRoles(allRoles...)).Put("/{id}/credentials", server.handleSetEmployeeCredentials) // Set login credentials
+		})
 
-	// Order resource routes
-	server.Router.Route("/orders", func(r chi.Router) {
-		r.Post("/", server.handleCreateOrder)     // Create new order
-		r.Get("/", server.handleGetOrders)        // List all orders
-		r.Put("/{id}", server.handleUpdateOrder)  // Update existing order
-		r.Delete("/{id}", server.handleDeleteOrder) // Delete order
-	})
+		// Employment resource routes
+		r.Route("/employments", func(r chi.Router) {
+			r.Use(requireRoles(managementRoles...))
+			r.With(server.idempotent).Post("/", server.handleCreateEmployment)       // Create new employment
+			r.Get("/", server.handleGetEmployments)          // List all employments
+			r.Get("/{id}", server.handleGetEmploymentByID)   // Get employment by ID
+			r.Put("/{id}", server.handleUpdateEmployment)    // Update existing employment
+			r.Patch("/{id}", server.handlePatchEmployment)   // Partially update employment
+			r.Delete("/{id}", server.handleDeleteEmployment) // Delete employment
+		})
+
+		// Client resource routes
+		r.Route("/clients", func(r chi.Router) {
+			r.With(requireRoles(officeRoles...), server.idempotent).Post("/", server.handleCreateClient)         // Create new client
+			r.With(requireRoles(officeRoles...)).Get("/", server.handleGetClients)            // List all clients
+			r.With(requireRoles(officeRoles...)).Get("/{id}", server.handleGetClientByID)     // Get client by ID
+			r.With(requireRoles(officeRoles...)).Put("/{id}", server.handleUpdateClient)      // Update existing client
+			r.With(requireRoles(officeRoles...)).Patch("/{id}", server.handlePatchClient)     // Partially update client
+			r.With(requireRoles(managementRoles...)).Delete("/{id}", server.handleDeleteClient) // Delete client
+			r.With(requireRoles(managementRoles...)).Post("/{id}/restore", server.handleRestoreClient) // Restore deleted client
+		})
+
+		// Car resource routes
+		r.Route("/cars", func(r chi.Router) {
+			r.With(requireRoles(officeRoles...), server.idempotent).Post("/", server.handleCreateCar)           // Create new car
+			r.With(requireRoles(allRoles...)).Get("/", server.handleGetCars)                 // List all cars
+			r.With(requireRoles(allRoles...)).Get("/{id}", server.handleGetCarByID)          // Get car by ID
+			r.With(requireRoles(officeRoles...)).Put("/{id}", server.handleUpdateCar)        // Update existing car
+			r.With(requireRoles(allRoles...)).Patch("/{id}", server.handlePatchCar)          // Partially update car
+			r.With(requireRoles(allRoles...)).Post("/{id}/status", server.handleTransitionCarStatus) // Move car along its lifecycle
+			r.With(requireRoles(managementRoles...)).Delete("/{id}", server.handleDeleteCar) // Delete car
+			r.With(requireRoles(managementRoles...)).Post("/{id}/restore", server.handleRestoreCar) // Restore deleted car
+		})
+
+		// Order resource routes (mechanics have no access to sales orders)
+		r.Route("/orders", func(r chi.Router) {
+			r.With(requireRoles(salesRoles...), server.idempotent).Post("/", server.handleCreateOrder)            // Create new order
+			r.With(requireRoles(officeRoles...)).Get("/", server.handleGetOrders)              // List all orders
+			r.With(requireRoles(officeRoles...)).Get("/{id}", server.handleGetOrderByID)       // Get order by ID
+			r.With(requireRoles(officeRoles...)).Get("/{id}/history", server.handleGetOrderHistory) // Order status history
+			r.With(requireRoles(salesRoles...)).Put("/{id}", server.handleUpdateOrder)         // Update existing order
+			r.With(requireRoles(salesRoles...)).Patch("/{id}", server.handlePatchOrder)        // Partially update order
+			r.With(requireRoles(managementRoles...)).Delete("/{id}", server.handleDeleteOrder) // Delete order
+		})
+
+		// Appointment resource routes
+		r.Route("/appointments", func(r chi.Router) {
+			r.With(requireRoles(allRoles...), server.idempotent).Post("/", server.handleCreateAppointment)           // Create new appointment
+			r.With(requireRoles(allRoles...)).Get("/", server.handleGetAppointments)              // List all appointments
+			r.With(requireRoles(allRoles...)).Get("/availability", server.handleGetAvailability)  // Free slots of an employee
+			r.With(requireRoles(allRoles...)).Get("/{id}", server.handleGetAppointmentByID)       // Get appointment by ID
+			r.With(requireRoles(allRoles...)).Put("/{id}", server.handleUpdateAppointment)        // Update existing appointment
+			r.With(requireRoles(allRoles...)).Patch("/{id}", server.handlePatchAppointment)       // Partially update appointment
+			r.With(requireRoles(officeRoles...)).Delete("/{id}", server.handleDeleteAppointment) // Delete appointment
+		})
+
+		// Audit log of every change (admins only)
+		r.With(requireRoles(adminRoles...)).Get("/audit", server.handleGetAudit)
+
+		// Events waiting for or given up by the notifier dispatcher (admins only)
+		r.Route("/outbox", func(r chi.Router) {
+			r.Use(requireRoles(adminRoles...))
+			r.Get("/", server.handleGetOutbox)                       // List outbox events
+			r.Post("/{id}/requeue", server.handleRequeueOutboxEvent) // Retry a dead event
+		})
+
+		// Webhook subscriptions and their delivery history (admins only)
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(requireRoles(adminRoles...))
+			r.Post("/", server.handleCreateWebhook)                         // Create new webhook, not idempotent as the response holds the secret
+			r.Get("/", server.handleGetWebhooks)                            // List all webhooks
+			r.Get("/{id}", server.handleGetWebhookByID)                     // Get webhook by ID
+			r.Put("/{id}", server.handleUpdateWebhook)                      // Update existing webhook
+			r.Patch("/{id}", server.handlePatchWebhook)                     // Partially update webhook, e.g. pause it
+			r.Delete("/{id}", server.handleDeleteWebhook)                   // Delete webhook
+			r.Get("/{id}/deliveries", server.handleGetWebhookDeliveries)    // Delivery history
+			r.Post("/{id}/deliveries/{deliveryID}/redeliver", server.handleRedeliverWebhook) // Send an event again
+		})
 
-	// Appointment resource routes
-	server.Router.Route("/appointments", func(r chi.Router) {
-		r.Post("/", server.handleCreateAppointment)     // Create new appointment
-		r.Get("/", server.handleGetAppointments)         // List all appointments
-		r.Put("/{id}", server.handleUpdateAppointment)  // Update existing appointment
-		r.Delete("/{id}", server.handleDeleteAppointment) // Delete appointment
+		// Live car and order events for dashboards, as Server-Sent Events
+		r.With(requireRoles(allRoles...)).Get("/events/stream", server.handleEventStream)
 	})
 	
 	return server
@@ -102,11 +234,12 @@ func NewAPIServer(listenAddr string, store storage.Store, validate *validator.Va
 // Run starts the HTTP server on the configured address
 func (s *APIServer) Run() {
 	log.Println("JSON API server running on port", s.listenAddr)
+	go s.expireIdempotencyKeys(context.Background(), idempotencyCleanupInterval)
 	http.ListenAndServe(s.listenAddr, s.Router)
 }
 
 // validateRequest validates incoming request data using the validator instance
-// Returns true if validation passes, false otherwise (also writes error response)
+// Returns true if validation passes, false otherwise (also writes a problem response listing the failed fields)
 func (s *APIServer) validateRequest(w http.ResponseWriter, r *http.Request, data any) bool {
 	if err := s.validate.Struct(data); err != nil {
 		logError(r, err)
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSoftDeleteAPI(t *testing.T) {
+	server := newTestServer(t, storage.NewAuditedStore(storage.NewMemoryStore()))
+
+	send := func(method, url, body string, role models.Role) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		pair, err := server.tokens.IssuePair(1, role)
+		if err != nil {
+			t.Fatalf("unable to issue test token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send(http.MethodPost, "/clients", `{"type": "private", "tin_vat": "RSSMRA80A01E506X", "name": "Mario"}`, models.RoleAssistant)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("creating client: "+errStatusMismatch, rr.Code, http.StatusCreated)
+	}
+	var created map[string]int
+	json.NewDecoder(rr.Body).Decode(&created)
+	clientURL := fmt.Sprintf("/clients/%d", created["id"])
+	if rr := send(http.MethodDelete, clientURL, "", models.RoleManager); rr.Code != http.StatusNoContent {
+		t.Fatalf("deleting client: "+errStatusMismatch, rr.Code, http.StatusNoContent)
+	}
+
+	t.Run("deleted records are hidden", func(t *testing.T) {
+		if rr := send(http.MethodGet, clientURL, "", models.RoleManager); rr.Code != http.StatusNotFound {
+			t.Errorf(errStatusMismatch, rr.Code, http.StatusNotFound)
+		}
+		rr := send(http.MethodGet, "/clients", "", models.RoleManager)
+		var resp ListResponse[models.Client]
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding clients: %v", err)
+		}
+		if len(resp.Data) != 0 {
+			t.Errorf("got %d clients, want none", len(resp.Data))
+		}
+	})
+
+	t.Run("admins can include them", func(t *testing.T) {
+		rr := send(http.MethodGet, clientURL+"?include_deleted=true", "", models.RoleAdmin)
+		if rr.Code != http.StatusOK {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusOK)
+		}
+		var client models.Client
+		if err := json.NewDecoder(rr.Body).Decode(&client); err != nil {
+			t.Fatalf("decoding client: %v", err)
+		}
+		if !client.DeletedAt.Valid {
+			t.Errorf("client %+v is not marked deleted", client)
+		}
+
+		rr = send(http.MethodGet, "/clients?include_deleted=true", "", models.RoleAdmin)
+		var resp ListResponse[models.Client]
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding clients: %v", err)
+		}
+		if len(resp.Data) != 1 {
+			t.Errorf("got %d clients, want the deleted one", len(resp.Data))
+		}
+	})
+
+	t.Run("others cannot", func(t *testing.T) {
+		if rr := send(http.MethodGet, "/clients?include_deleted=true", "", models.RoleManager); rr.Code != http.StatusForbidden {
+			t.Errorf(errStatusMismatch, rr.Code, http.StatusForbidden)
+		}
+		if rr := send(http.MethodGet, "/clients?include_deleted=maybe", "", models.RoleAdmin); rr.Code != http.StatusBadRequest {
+			t.Errorf("invalid include_deleted: "+errStatusMismatch, rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("it restores them", func(t *testing.T) {
+		if rr := send(http.MethodPost, clientURL+"/restore", "", models.RoleSalesperson); rr.Code != http.StatusForbidden {
+			t.Errorf("restore by a salesperson: "+errStatusMismatch, rr.Code, http.StatusForbidden)
+		}
+		rr := send(http.MethodPost, clientURL+"/restore", "", models.RoleManager)
+		if rr.Code != http.StatusOK {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusOK)
+		}
+		if rr.Header().Get("ETag") == "" {
+			t.Errorf("restore response has no ETag")
+		}
+		if rr := send(http.MethodGet, clientURL, "", models.RoleManager); rr.Code != http.StatusOK {
+			t.Errorf("reading restored client: "+errStatusMismatch, rr.Code, http.StatusOK)
+		}
+		if rr := send(http.MethodPost, clientURL+"/restore", "", models.RoleManager); rr.Code != http.StatusConflict {
+			t.Errorf("restoring a live client: "+errStatusMismatch, rr.Code, http.StatusConflict)
+		}
+
+		rr = send(http.MethodGet, fmt.Sprintf("/audit?entity=client&id=%d", created["id"]), "", models.RoleAdmin)
+		var resp ListResponse[models.AuditEntry]
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding audit log: %v", err)
+		}
+		if len(resp.Data) == 0 || resp.Data[0].Action != models.AuditRestore {
+			t.Errorf("audit log = %+v, want the restore first", resp.Data)
+		}
+	})
+}
+
+func TestIncludeDeletedRelationsAPI(t *testing.T) {
+	ctx := context.Background()
+	store := newTestDB(t)
+	server := newTestServer(t, store)
+
+	dealershipID, err := store.CreateDealership(ctx, &models.Dealership{PostalCode: "73100", City: "Lecce", Address: "Via Roma 1", Phone: "0832"})
+	if err != nil {
+		t.Fatalf("CreateDealership: %v", err)
+	}
+	employeeID, err := store.CreateEmployee(ctx, &models.Employee{Role: models.RoleSalesperson, TIN: "TESTTININCL01", Name: "Marco", Surname: "Verdi", Phone: "-"})
+	if err != nil {
+		t.Fatalf("CreateEmployee: %v", err)
+	}
+	clientID, err := store.CreateClient(ctx, &models.Client{Type: models.ClientTypePrivate, TIN_VAT: "RSSMRA80A01E506X", Name: "Mario"})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	vin := "ZFA31200000123456"
+	if _, err := store.CreateCar(ctx, &models.CarPark{VIN: &vin, ID_Dealership: dealershipID, Brand: "Fiat", Model: "Panda", Condition: models.CondTypeNew, Year: 2024, KM: "0", Plate: "AB123CD"}); err != nil {
+		t.Fatalf("CreateCar: %v", err)
+	}
+	orderID, err := store.CreateOrder(ctx, &models.Order{ID_Client: clientID, ID_Employee: employeeID, VIN: vin, ID_Dealership: dealershipID}, 0)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if err := store.DeleteClient(ctx, clientID, 0); err != nil {
+		t.Fatalf("DeleteClient: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/orders/%d?include=client", orderID), nil)
+	authorize(t, server, req, models.RoleManager)
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf(errStatusMismatch, rr.Code, http.StatusOK)
+	}
+	var order OrderResource
+	if err := json.NewDecoder(rr.Body).Decode(&order); err != nil {
+		t.Fatalf("decoding order: %v", err)
+	}
+	if order.Client == nil || order.Client.ID_Client != clientID || !order.Client.DeletedAt.Valid {
+		t.Errorf("embedded client = %+v, want the deleted client %d", order.Client, clientID)
+	}
+}
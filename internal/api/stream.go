@@ -0,0 +1,411 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"keeper/internal/auth"
+	"keeper/internal/models"
+	"keeper/internal/outbox"
+	"keeper/internal/storage"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultEventPollInterval is how often the hub looks for new events unless overridden with WithEventPollInterval
+	defaultEventPollInterval = time.Second
+	// streamHeartbeat is how often an idle stream sends a comment, so that proxies keep it open
+	streamHeartbeat = 15 * time.Second
+	// streamBatchSize bounds the events read from the store at once
+	streamBatchSize = 500
+	// subscriberBuffer is how many events a stream may fall behind before it is closed
+	subscriberBuffer = 256
+)
+
+// The events sent on /events/stream; mechanics, who have no access to orders, only get those of cars
+var (
+	carEventTypes = []models.EventType{
+		models.EventCarCreated, models.EventCarUpdated, models.EventCarStatusChanged, models.EventCarDeleted, models.EventCarRestored,
+	}
+	orderEventTypes = []models.EventType{
+		models.EventOrderCreated, models.EventOrderStatusChanged, models.EventOrderCompleted, models.EventOrderCancelled,
+	}
+)
+
+var (
+	errInvalidLastEventID = errors.New("Last-Event-ID must be the id of an event")
+	errStreamEventType    = errors.New("event_type must list car or order events, e.g. car.status_changed,order.completed")
+	errStreamDealership   = errors.New("id_dealership must list dealership IDs")
+	errOrderEvents        = errors.New("order events are not available to your role")
+	errStreamUnsupported  = errors.New("streaming is not supported by this connection")
+)
+
+// streamingPaths are served without the request deadline, as they stay open for as long as the client listens
+var streamingPaths = map[string]bool{
+	"/events/stream": true,
+}
+
+// WithEventPollInterval sets how often new events are looked for on behalf of the open event streams
+func WithEventPollInterval(d time.Duration) Option {
+	return func(s *APIServer) {
+		s.events.interval = d
+	}
+}
+
+// eventHub polls the outbox for car and order events on behalf of every open event stream, so that
+// the store is queried once per interval however many clients listen. It only polls while someone
+// listens. Each stream gets the events on a buffered channel, which is closed if the stream falls too
+// far behind; the client then reconnects and catches up from the store with Last-Event-ID. Both only
+// read past the last ID sent. Event IDs are taken before their transactions commit, so a later event can
+// become visible first; the hub therefore never reads past the store's watermark, below which no event
+// can still appear, and the streams only catch up to where the hub started.
+type eventHub struct {
+	store    storage.Store
+	interval time.Duration
+
+	mu          sync.Mutex
+	subscribers map[chan *models.OutboxEvent]struct{}
+	last        int                // ID of the last event broadcast
+	stop        context.CancelFunc // Stops the polling, nil while nobody listens
+}
+
+func newEventHub(store storage.Store) *eventHub {
+	return &eventHub{
+		store:       store,
+		interval:    defaultEventPollInterval,
+		subscribers: map[chan *models.OutboxEvent]struct{}{},
+	}
+}
+
+// subscribe returns a channel receiving the events after the returned ID, starting the polling if needed
+func (h *eventHub) subscribe(ctx context.Context) (chan *models.OutboxEvent, int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stop == nil {
+		last, err := h.store.OutboxWatermark(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		h.last = last
+		pollCtx, stop := context.WithCancel(context.Background())
+		h.stop = stop
+		go h.poll(pollCtx)
+	}
+	events := make(chan *models.OutboxEvent, subscriberBuffer)
+	h.subscribers[events] = struct{}{}
+	return events, h.last, nil
+}
+
+// unsubscribe removes a subscriber, stopping the polling once nobody listens
+func (h *eventHub) unsubscribe(events chan *models.OutboxEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, events)
+	if len(h.subscribers) == 0 && h.stop != nil {
+		h.stop()
+		h.stop = nil
+	}
+}
+
+func (h *eventHub) poll(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// A full batch suggests more events are waiting
+		for h.fetch(ctx) == streamBatchSize {
+		}
+	}
+}
+
+// fetch broadcasts the events written since the last one and returns how many there were
+func (h *eventHub) fetch(ctx context.Context) int {
+	h.mu.Lock()
+	after := h.last
+	h.mu.Unlock()
+
+	watermark, err := h.store.OutboxWatermark(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("polling the event stream: %v", err)
+		}
+		return 0
+	}
+	if watermark <= after {
+		return 0
+	}
+	page, err := h.store.ListOutboxEvents(ctx, &storage.ListQuery{
+		Filters: []storage.Filter{
+			{Field: "id_event", Op: storage.OpGte, Value: after + 1},
+			{Field: "id_event", Op: storage.OpLte, Value: watermark},
+			{Field: "entity", Op: storage.OpIn, Value: []any{storage.AuditCar, storage.AuditOrder}},
+		},
+		Sort:  []storage.Sort{{Field: "id_event"}},
+		Limit: streamBatchSize,
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("polling the event stream: %v", err)
+		}
+		return 0
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Polling may have stopped, and restarted from a later event, while the store was queried
+	if ctx.Err() != nil {
+		return 0
+	}
+	for _, event := range page.Items {
+		h.last = event.ID_Event
+		for events := range h.subscribers {
+			select {
+			case events <- event:
+			default:
+				delete(h.subscribers, events)
+				close(events)
+			}
+		}
+	}
+	// Up to the watermark, the batch holds every car and order event there will ever be
+	if len(page.Items) < streamBatchSize {
+		h.last = watermark
+	}
+	return len(page.Items)
+}
+
+// streamFilter selects the events a stream sends
+type streamFilter struct {
+	types       []models.EventType
+	dealerships []int          // Empty for every dealership in scope
+	scope       *storage.Scope // Dealerships of the principal, nil if unrestricted
+}
+
+func (f *streamFilter) matches(event *models.OutboxEvent) bool {
+	if !slices.Contains(f.types, event.EventType) {
+		return false
+	}
+	if f.scope == nil && len(f.dealerships) == 0 {
+		return true
+	}
+	if event.ID_Dealership == nil {
+		return false
+	}
+	if len(f.dealerships) > 0 && !slices.Contains(f.dealerships, *event.ID_Dealership) {
+		return false
+	}
+	return f.scope.Allows(*event.ID_Dealership)
+}
+
+// query lists the matching events after one ID, up to another
+func (f *streamFilter) query(after, upTo int) *storage.ListQuery {
+	types := make([]any, len(f.types))
+	for i, eventType := range f.types {
+		types[i] = string(eventType)
+	}
+	filters := []storage.Filter{
+		{Field: "id_event", Op: storage.OpGte, Value: after + 1},
+		{Field: "id_event", Op: storage.OpLte, Value: upTo},
+		{Field: "event_type", Op: storage.OpIn, Value: types},
+	}
+	if len(f.dealerships) > 0 {
+		dealerships := make([]any, len(f.dealerships))
+		for i, id := range f.dealerships {
+			dealerships[i] = id
+		}
+		filters = append(filters, storage.Filter{Field: "id_dealership", Op: storage.OpIn, Value: dealerships})
+	}
+	return &storage.ListQuery{Filters: filters, Sort: []storage.Sort{{Field: "id_event"}}, Limit: streamBatchSize, Scope: f.scope}
+}
+
+// parseStreamFilter reads the event_type and id_dealership parameters of a stream request.
+// It writes the error response and returns false if they are invalid or not allowed.
+func (s *APIServer) parseStreamFilter(w http.ResponseWriter, r *http.Request) (*streamFilter, bool) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	allowed := carEventTypes
+	if principal.HasRole(officeRoles...) {
+		allowed = append(slices.Clone(carEventTypes), orderEventTypes...)
+	}
+
+	filter := &streamFilter{types: allowed}
+	if raw := r.URL.Query().Get("event_type"); raw != "" {
+		filter.types = nil
+		for _, name := range strings.Split(raw, ",") {
+			eventType := models.EventType(strings.TrimSpace(name))
+			switch {
+			case slices.Contains(allowed, eventType):
+				filter.types = append(filter.types, eventType)
+			case slices.Contains(orderEventTypes, eventType):
+				writeError(w, http.StatusForbidden, errOrderEvents)
+				logError(r, errOrderEvents)
+				return nil, false
+			default:
+				writeError(w, http.StatusBadRequest, errStreamEventType)
+				logError(r, errStreamEventType)
+				return nil, false
+			}
+		}
+	}
+
+	scope, ok := s.resolveScope(w, r)
+	if !ok {
+		return nil, false
+	}
+	filter.scope = scope
+	if raw := r.URL.Query().Get("id_dealership"); raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, errStreamDealership)
+				logError(r, errStreamDealership)
+				return nil, false
+			}
+			if !scope.Allows(id) {
+				writeError(w, http.StatusForbidden, errOutOfScope)
+				logError(r, errOutOfScope)
+				return nil, false
+			}
+			filter.dealerships = append(filter.dealerships, id)
+		}
+	}
+	return filter, true
+}
+
+// lastEventID is the ID of the last event the client received: the Last-Event-ID header that
+// EventSource sends when it reconnects, or the last_event_id parameter for the first connection.
+// It is -1 when the client has received nothing, and it only wants the events from now on.
+func lastEventID(r *http.Request) (int, error) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	if raw == "" {
+		return -1, nil
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id < 0 {
+		return 0, errInvalidLastEventID
+	}
+	return id, nil
+}
+
+// @Summary      Stream car and order events
+// @Description  Sends the car and order events as they are written, as Server-Sent Events: each has the event type as event, its ID as id and the notification of the outbox as data. The stream is restricted to the dealerships of the caller, and mechanics only get car events. A client that reconnects with the Last-Event-ID header, or last_event_id parameter, first gets the events it missed, from the persisted event sequence.
+// @Tags         Events
+// @Security     BearerAuth
+// @Produce      text/event-stream
+// @Param        event_type     query   string  false  "Comma-separated event types, e.g. car.status_changed,order.completed (default all car and order events)"
+// @Param        id_dealership  query   string  false  "Comma-separated dealership IDs"
+// @Param        last_event_id  query   int     false  "ID of the last event received; Last-Event-ID takes precedence"
+// @Param        Last-Event-ID  header  int     false  "ID of the last event received, sent by EventSource when it reconnects"
+// @Success      200 {object}  outbox.Notification  "One data line per event"
+// @Failure      400 {object}  Problem  "Error: Invalid event type, dealership or event ID"
+// @Failure      401 {object}  Problem  "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem  "Error: Dealership outside your assignment, or order events requested by a mechanic"
+// @Failure      500 {object}  Problem  "Error: Internal server error"
+// @Router       /events/stream [get]
+func (s *APIServer) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	last, err := lastEventID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	filter, ok := s.parseStreamFilter(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	events, position, err := s.events.subscribe(ctx)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	defer s.events.unsubscribe(events)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stops nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		logError(r, fmt.Errorf("%w: %v", errStreamUnsupported, err))
+		return
+	}
+
+	// The events missed since the last one received are read from the store, up to where the hub starts
+	if last < 0 {
+		last = position
+	}
+	for last < position {
+		page, err := s.store.ListOutboxEvents(ctx, filter.query(last, position))
+		if err != nil {
+			logError(r, err)
+			return
+		}
+		for _, event := range page.Items {
+			if err := writeStreamEvent(w, event); err != nil {
+				return
+			}
+		}
+		if len(page.Items) < streamBatchSize {
+			break
+		}
+		last = page.Items[len(page.Items)-1].ID_Event
+	}
+	last = position
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, open := <-events:
+			if !open {
+				// Too far behind: the client reconnects and catches up with Last-Event-ID
+				return
+			}
+			if event.ID_Event <= last || !filter.matches(event) {
+				continue
+			}
+			last = event.ID_Event
+			if err := writeStreamEvent(w, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeStreamEvent writes one event in the text/event-stream format
+func writeStreamEvent(w http.ResponseWriter, event *models.OutboxEvent) error {
+	data, err := json.Marshal(outbox.NewNotification(event))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID_Event, event.EventType, data)
+	return err
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"keeper/internal/auth"
+	"keeper/internal/models"
+	"keeper/internal/outbox"
+	"keeper/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// streamEvent is one event read from a text/event-stream
+type streamEvent struct {
+	id        int
+	eventType models.EventType
+	data      outbox.Notification
+}
+
+// openStream connects to /events/stream and returns the events it sends
+func openStream(t *testing.T, server *APIServer, url, query string, role models.Role, lastEventID string) <-chan streamEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/events/stream"+query, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	authorize(t, server, req, role)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("connecting to the stream: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		t.Fatalf(errStatusMismatch, resp.StatusCode, http.StatusOK)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", contentType)
+	}
+
+	events := make(chan streamEvent, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		var event streamEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			name, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch name {
+			case "id":
+				event.id, _ = strconv.Atoi(value)
+			case "event":
+				event.eventType = models.EventType(value)
+			case "data":
+				json.Unmarshal([]byte(value), &event.data)
+			case "":
+				if event.id != 0 {
+					events <- event
+				}
+				event = streamEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+// nextEvent waits for the next event of a stream
+func nextEvent(t *testing.T, events <-chan streamEvent) streamEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event within 2s")
+	}
+	return streamEvent{}
+}
+
+func TestEventStream(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	events := storage.NewOutboxStore(store)
+	// The streams must outlive the deadline of ordinary requests
+	server := NewAPIServer(":0", events, validator.New(), auth.NewTokenManager([]byte(testJWTSecret)),
+		WithEventPollInterval(10*time.Millisecond), WithRequestTimeout(50*time.Millisecond))
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	dealership := func(city string) int {
+		id, err := store.CreateDealership(ctx, &models.Dealership{PostalCode: "73100", City: city, Address: "Via Roma 1", Phone: "0832000000"})
+		if err != nil {
+			t.Fatalf("CreateDealership: %v", err)
+		}
+		return id
+	}
+	lecce, bari := dealership("Lecce"), dealership("Bari")
+	// The test tokens are issued for employee 1, here a salesperson of Lecce
+	employee, err := store.CreateEmployee(ctx, &models.Employee{Role: models.RoleSalesperson, TIN: "RSSMRA80A01E506X", Name: "Mario", Surname: "Rossi", Phone: "3330000000"})
+	if err != nil || employee != 1 {
+		t.Fatalf("CreateEmployee = %d, %v, want employee 1", employee, err)
+	}
+	if _, err := store.CreateEmployment(ctx, &models.Employment{ID_Employee: employee, ID_Dealership: lecce, StartDate: time.Now().AddDate(0, 0, -1)}); err != nil {
+		t.Fatalf("CreateEmployment: %v", err)
+	}
+
+	plates := 0
+	createCar := func(dealershipID int) int {
+		plates++
+		vin := "WVWZZZ1JZXW00000" + strconv.Itoa(plates)
+		id, err := events.CreateCar(ctx, &models.CarPark{VIN: &vin, ID_Dealership: dealershipID, Brand: "Fiat", Model: "Panda", Condition: models.CondTypeNew, Year: 2024, KM: "0", Plate: "AB12" + strconv.Itoa(plates) + "CD"})
+		if err != nil {
+			t.Fatalf("CreateCar: %v", err)
+		}
+		return id
+	}
+
+	var first streamEvent
+	t.Run("it sends changes as they happen", func(t *testing.T) {
+		stream := openStream(t, server, ts.URL, "", models.RoleManager, "")
+		carID := createCar(lecce)
+		first = nextEvent(t, stream)
+		if first.eventType != models.EventCarCreated || first.data.Type != models.EventCarCreated || first.data.EntityID != carID || first.data.ID != first.id {
+			t.Fatalf("event = %+v, want car.created of car %d", first, carID)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		carID = createCar(bari)
+		if event := nextEvent(t, stream); event.data.EntityID != carID || event.id <= first.id {
+			t.Errorf("event after the request timeout = %+v, want car.created of car %d", event, carID)
+		}
+	})
+
+	t.Run("it resumes after Last-Event-ID", func(t *testing.T) {
+		stream := openStream(t, server, ts.URL, "", models.RoleManager, strconv.Itoa(first.id))
+		if event := nextEvent(t, stream); event.id != first.id+1 {
+			t.Errorf("first event = %+v, want event %d", event, first.id+1)
+		}
+		stream = openStream(t, server, ts.URL, "?last_event_id=0", models.RoleManager, "")
+		if event := nextEvent(t, stream); event.id != first.id {
+			t.Errorf("first event from the start = %+v, want event %d", event, first.id)
+		}
+	})
+
+	t.Run("it filters by dealership and event type", func(t *testing.T) {
+		stream := openStream(t, server, ts.URL, "?event_type=car.deleted,car.created&id_dealership="+strconv.Itoa(bari), models.RoleManager, "")
+		createCar(lecce)
+		carID := createCar(bari)
+		if err := events.DeleteCar(ctx, carID, 0); err != nil {
+			t.Fatalf("DeleteCar: %v", err)
+		}
+		if event := nextEvent(t, stream); event.eventType != models.EventCarCreated || event.data.EntityID != carID {
+			t.Errorf("event = %+v, want car.created of car %d", event, carID)
+		}
+		if event := nextEvent(t, stream); event.eventType != models.EventCarDeleted || event.data.EntityID != carID {
+			t.Errorf("event = %+v, want car.deleted of car %d", event, carID)
+		}
+	})
+
+	t.Run("it is restricted to the dealerships of the caller", func(t *testing.T) {
+		stream := openStream(t, server, ts.URL, "", models.RoleSalesperson, "0")
+		carID := createCar(lecce)
+		for event := nextEvent(t, stream); event.data.EntityID != carID; event = nextEvent(t, stream) {
+			if event.data.Data["id_dealership"] != float64(lecce) {
+				t.Fatalf("event = %+v, want only cars of Lecce", event)
+			}
+		}
+	})
+
+	t.Run("it rejects invalid streams", func(t *testing.T) {
+		for _, tc := range []struct {
+			query       string
+			role        models.Role
+			lastEventID string
+			want        int
+		}{
+			{"?event_type=car.sold", models.RoleManager, "", http.StatusBadRequest},
+			{"?event_type=appointment.created", models.RoleManager, "", http.StatusBadRequest},
+			{"?id_dealership=Lecce", models.RoleManager, "", http.StatusBadRequest},
+			{"", models.RoleManager, "latest", http.StatusBadRequest},
+			{"?id_dealership=" + strconv.Itoa(bari), models.RoleSalesperson, "", http.StatusForbidden},
+			{"?event_type=order.created", models.RoleMechanic, "", http.StatusForbidden},
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/events/stream"+tc.query, nil)
+			authorize(t, server, req, tc.role)
+			if tc.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tc.lastEventID)
+			}
+			rr := httptest.NewRecorder()
+			server.Router.ServeHTTP(rr, req)
+			if rr.Code != tc.want {
+				t.Errorf("%s %s as %s: "+errStatusMismatch, tc.query, tc.lastEventID, tc.role, rr.Code, tc.want)
+			}
+		}
+	})
+}
+
+// TestEventStreamCommitOrder runs against Postgres when TEST_DATABASE_URL is set: a transaction that
+// takes an event ID and commits after a later one must not have its event skipped by the stream
+func TestEventStreamCommitOrder(t *testing.T) {
+	ctx := context.Background()
+	store := newTestDB(t)
+	server := NewAPIServer(":0", store, validator.New(), auth.NewTokenManager([]byte(testJWTSecret)), WithEventPollInterval(10*time.Millisecond))
+	ts := httptest.NewServer(server.Router)
+	t.Cleanup(ts.Close)
+	stream := openStream(t, server, ts.URL, "", models.RoleManager, "")
+
+	event := func(carID int) *models.OutboxEvent {
+		return &models.OutboxEvent{EventType: models.EventCarUpdated, Entity: storage.AuditCar, EntityID: carID, Payload: models.EventPayload{}}
+	}
+
+	// The first transaction writes its event, then stays open while a second one writes another
+	inserted, release := make(chan struct{}), make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		first <- store.WithTx(ctx, func(tx storage.Store) error {
+			if err := tx.CreateOutboxEvent(ctx, event(1)); err != nil {
+				return err
+			}
+			close(inserted)
+			<-release
+			return nil
+		})
+	}()
+	select {
+	case <-inserted:
+	case err := <-first:
+		t.Fatalf("first transaction: %v", err)
+	}
+	second := make(chan error, 1)
+	go func() {
+		second <- store.CreateOutboxEvent(ctx, event(2))
+	}()
+	// Meanwhile the stream polls several times
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	for _, done := range []chan error{first, second} {
+		if err := <-done; err != nil {
+			t.Fatalf("CreateOutboxEvent: %v", err)
+		}
+	}
+
+	for _, want := range []int{1, 2} {
+		if event := nextEvent(t, stream); event.data.EntityID != want {
+			t.Errorf("event = %+v, want the event of car %d", event, want)
+		}
+	}
+}
@@ -3,8 +3,10 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"keeper/internal/storage"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -15,6 +17,12 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+// Errors reported in place of storage failures caused by the request context
+var (
+	errRequestTimeout  = errors.New("request timed out")
+	errRequestCanceled = errors.New("request was cancelled before it could complete")
+)
+
 // writeJSON writes a JSON response with the given status code and data
 func writeJSON(w http.ResponseWriter, status int, v any) error {
 	w.Header().Set("Content-Type", "application/json")
@@ -22,9 +30,20 @@ func writeJSON(w http.ResponseWriter, status int, v any) error {
 	return json.NewEncoder(w).Encode(v)
 }
 
-// writeError writes an error response in JSON format
+// writeError writes an RFC 7807 problem response describing err (see newProblem)
 func writeError(w http.ResponseWriter, status int, err error) {
-	writeJSON(w, status, map[string]string{"error": err.Error()})
+	// A failure caused by the request context is not a server fault: report the deadline or cancellation instead
+	if status == http.StatusInternalServerError {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			status, err = http.StatusGatewayTimeout, errRequestTimeout
+		case errors.Is(err, context.Canceled):
+			status, err = http.StatusServiceUnavailable, errRequestCanceled
+		}
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(newProblem(status, err))
 }
 
 // logError logs HTTP request errors with method and path context
@@ -32,9 +51,50 @@ func logError(r *http.Request, err error) {
 	log.Printf("[%s %s] ERROR: %v", r.Method, r.URL.Path, err)
 }
 
+// isNotFound reports whether a storage error means the requested record does not exist
+func isNotFound(err error) bool {
+	return errors.Is(err, storage.ErrNotFound)
+}
+
+// storageErrorStatus maps an error returned by the store to the HTTP status reported to the client:
+// a missing record is 404, a conflict with the current state of the data 409 and a request the
+// schema rejects (unknown reference, failed check) 422. Anything else is a server fault.
+func storageErrorStatus(err error) int {
+	var (
+		referenced *storage.ReferencedError
+		unique     *storage.UniqueViolationError
+		foreignKey *storage.ForeignKeyViolationError
+		check      *storage.CheckViolationError
+	)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.As(err, &referenced), errors.As(err, &unique),
+		errors.Is(err, storage.ErrInvalidTransition), errors.Is(err, storage.ErrCarUnavailable), errors.Is(err, storage.ErrSlotTaken),
+		errors.Is(err, storage.ErrNotDeleted):
+		return http.StatusConflict
+	case errors.As(err, &foreignKey), errors.As(err, &check), errors.Is(err, storage.ErrCarElsewhere):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, storage.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusInternalServerError
+}
+
+// writeStorageError writes and logs an error returned by the store with the status of storageErrorStatus
+func writeStorageError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, storageErrorStatus(err), err)
+	logError(r, err)
+}
+
 // getIDFromURL extracts and validates an integer ID from the URL path parameter
 func getIDFromURL(r *http.Request) (int, error) {
-	idStr := chi.URLParam(r, "id")
+	return getURLParamID(r, "id")
+}
+
+// getURLParamID reads a numeric route parameter, e.g. the {hoursID} of a nested resource
+func getURLParamID(r *http.Request, name string) (int, error) {
+	idStr := chi.URLParam(r, name)
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		return 0, errors.New("invalid ID format")
@@ -105,13 +165,13 @@ func TestWriteError(t *testing.T) {
             name:       "bad request error",
             statusCode: 400,
             err:        errors.New("invalid input"),
-            expected:   `{"error":"invalid input"}`,
+            expected:   `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid input","code":"bad_request"}`,
         },
         {
             name:       "internal server error",
             statusCode: 500,
             err:        errors.New("database connection failed"),
-            expected:   `{"error":"database connection failed"}`,
+            expected:   `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"an unexpected error occurred","code":"internal_error"}`,
         },
     }
 
@@ -3,6 +3,9 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"keeper/internal/storage"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -70,4 +73,34 @@ func TestGetIDFromURL(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+// TestStorageErrorStatus checks that every error of the storage taxonomy maps to its HTTP status,
+// including when it is wrapped with additional context.
+func TestStorageErrorStatus(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"Not found", storage.ErrNotFound, http.StatusNotFound},
+		{"Wrapped not found", fmt.Errorf("loading car: %w", storage.ErrNotFound), http.StatusNotFound},
+		{"Referenced", &storage.ReferencedError{References: []storage.Reference{{Resource: "orders", Count: 2}}}, http.StatusConflict},
+		{"Unique violation", &storage.UniqueViolationError{Table: "car_park", Field: "vin"}, http.StatusConflict},
+		{"Invalid transition", fmt.Errorf("%w: sold to in_stock", storage.ErrInvalidTransition), http.StatusConflict},
+		{"Car unavailable", storage.ErrCarUnavailable, http.StatusConflict},
+		{"Car of another dealership", fmt.Errorf("%w: car of Bari", storage.ErrCarElsewhere), http.StatusUnprocessableEntity},
+		{"Slot taken", storage.ErrSlotTaken, http.StatusConflict},
+		{"Foreign key violation", &storage.ForeignKeyViolationError{Table: "order", Field: "id_client", Referenced: "client"}, http.StatusUnprocessableEntity},
+		{"Check violation", &storage.CheckViolationError{Table: "opening_hours", Constraint: "opening_hours_check"}, http.StatusUnprocessableEntity},
+		{"Unknown error", errors.New("connection reset"), http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := storageErrorStatus(tc.err); got != tc.want {
+				t.Errorf("storageErrorStatus(%v) = %d, want %d", tc.err, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+package api
+
+import (
+	"encoding/json"
+	"keeper/internal/models"
+	"keeper/internal/outbox"
+	"keeper/internal/storage"
+	"net/http"
+)
+
+// WebhookCreated is the response to the creation of a webhook, the only one that shows its secret
+type WebhookCreated struct {
+	ID     int    `json:"id"`
+	Secret string `json:"secret"` // Key of the HMAC-SHA256 signature in the X-Keeper-Signature header of every delivery
+}
+
+// @Summary      Create a webhook
+// @Description  Subscribes a URL to some types of domain event. Each event of those types written from then on is POSTed to the URL as JSON, signed in the X-Keeper-Signature header as t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">. The secret of the signature is generated by the server and returned once, in this response, which is why Idempotency-Key is not honoured here: a stored response would keep the secret. Admin only.
+// @Tags         Webhooks
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        webhook  body      models.Webhook  true  "URL, event types and optional description"
+// @Success      201 {object}  WebhookCreated
+// @Failure      400 {object}  Problem  "Error: Invalid request payload"
+// @Failure      401 {object}  Problem  "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem  "Error: Insufficient permissions"
+// @Failure      500 {object}  Problem  "Error: Internal server error"
+// @Router       /webhooks [post]
+func (s *APIServer) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var newWebhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&newWebhook); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if !s.validateRequest(w, r, &newWebhook) {
+		return
+	}
+
+	secret, err := outbox.NewSecret()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		logError(r, err)
+		return
+	}
+	newWebhook.Secret = secret
+
+	newID, err := s.store.CreateWebhook(r.Context(), &newWebhook)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, WebhookCreated{ID: newID, Secret: secret})
+}
+
+// @Summary      List webhooks
+// @Description  Lists the webhook subscriptions, without their secrets. Admin only.
+// @Tags         Webhooks
+// @Security     BearerAuth
+// @Produce      json
+// @Param        paused     query     bool    false  "Only paused (true) or active (false) webhooks"
+// @Param        page       query     int     false  "Page number (1-based)"
+// @Param        page_size  query     int     false  "Page size (default 50, max 200)"
+// @Param        cursor     query     string  false  "Opaque cursor returned as next_cursor by a previous page"
+// @Param        sort       query     string  false  "Comma-separated sort fields, prefix with - for descending"
+// @Success      200 {object}  ListResponse{data=[]models.Webhook}
+// @Failure      400 {object}  Problem  "Error: Invalid query parameter"
+// @Failure      401 {object}  Problem  "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem  "Error: Insufficient permissions"
+// @Failure      500 {object}  Problem  "Error: Internal server error"
+// @Router       /webhooks [get]
+func (s *APIServer) handleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	query, err := parseListQuery(r, storage.WebhookFields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	page, err := s.store.ListWebhooks(r.Context(), query)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newListResponse(page, query))
+}
+
+// @Summary      Get a webhook
+// @Description  Retrieves a webhook subscription by its ID, without its secret. Admin only.
+// @Tags         Webhooks
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path      int  true  "Webhook ID"
+// @Success      200 {object}  models.Webhook
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem  "Error: Invalid ID"
+// @Failure      401 {object}  Problem  "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem  "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem  "Error: Webhook not found"
+// @Failure      500 {object}  Problem  "Error: Internal server error"
+// @Router       /webhooks/{id} [get]
+func (s *APIServer) handleGetWebhookByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	webhook, err := s.store.GetWebhookByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, webhook.Version)
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+// @Summary      Update a webhook
+// @Description  Replaces the URL, event types, description and paused flag of a webhook; its secret is kept. Deliveries queued while a webhook is paused are sent once it is resumed. Admin only.
+// @Tags         Webhooks
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id        path      int             true  "Webhook ID"
+// @Param        If-Match  header    string          false "ETag of the version being changed"
+// @Param        webhook   body      models.Webhook  true  "Updated webhook"
+// @Success      200 {object}  models.Webhook
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem  "Error: Invalid ID or request payload"
+// @Failure      401 {object}  Problem  "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem  "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem  "Error: Webhook not found"
+// @Failure      412 {object}  Problem  "Error: The resource has changed since it was read"
+// @Failure      428 {object}  Problem  "Error: If-Match required"
+// @Failure      500 {object}  Problem  "Error: Internal server error"
+// @Router       /webhooks/{id} [put]
+func (s *APIServer) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var updatedWebhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&updatedWebhook); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if !s.validateRequest(w, r, &updatedWebhook) {
+		return
+	}
+
+	existing, err := s.store.GetWebhookByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	updatedWebhook.CreatedAt = existing.CreatedAt
+
+	updatedWebhook.Version = version
+	if err := s.store.UpdateWebhook(r.Context(), id, &updatedWebhook); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, updatedWebhook.Version)
+	writeJSON(w, http.StatusOK, updatedWebhook)
+}
+
+// @Summary      Patch a webhook
+// @Description  Partially updates a webhook by its ID, e.g. {"paused": true}. The body is a JSON merge patch (RFC 7396). Admin only.
+// @Tags         Webhooks
+// @Security     BearerAuth
+// @Accept       json,application/merge-patch+json
+// @Produce      json
+// @Param        id        path      int             true  "Webhook ID"
+// @Param        If-Match  header    string          false "ETag of the version being changed"
+// @Param        webhook   body      models.Webhook  true  "Fields to update (partial webhook)"
+// @Success      200 {object}  models.Webhook
+// @Header       200 {string}  ETag  "Version of the resource"
+// @Failure      400 {object}  Problem  "Error: Invalid ID, request payload or read-only field"
+// @Failure      401 {object}  Problem  "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem  "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem  "Error: Webhook not found"
+// @Failure      412 {object}  Problem  "Error: The resource has changed since it was read"
+// @Failure      415 {object}  Problem  "Error: Unsupported content type"
+// @Failure      428 {object}  Problem  "Error: If-Match required"
+// @Failure      500 {object}  Problem  "Error: Internal server error"
+// @Router       /webhooks/{id} [patch]
+func (s *APIServer) handlePatchWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	patch, ok := readMergePatch(w, r)
+	if !ok {
+		return
+	}
+
+	webhook, err := s.store.GetWebhookByID(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	if err := applyMergePatch(webhook, patch, webhookPatchFields); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	if version != 0 {
+		webhook.Version = version
+	}
+
+	if !s.validateRequest(w, r, webhook) {
+		return
+	}
+
+	if err := s.store.UpdateWebhook(r.Context(), id, webhook); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	setETag(w, webhook.Version)
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+// @Summary      Delete a webhook
+// @Description  Deletes a webhook subscription with its delivery history. Admin only.
+// @Tags         Webhooks
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id        path    int     true  "Webhook ID"
+// @Param        If-Match  header  string  false "ETag of the version being changed"
+// @Success      204 "No Content"
+// @Failure      400 {object}  Problem  "Error: Invalid ID"
+// @Failure      401 {object}  Problem  "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem  "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem  "Error: Webhook not found"
+// @Failure      412 {object}  Problem  "Error: The resource has changed since it was read"
+// @Failure      428 {object}  Problem  "Error: If-Match required"
+// @Failure      500 {object}  Problem  "Error: Internal server error"
+// @Router       /webhooks/{id} [delete]
+func (s *APIServer) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	version, ok := s.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteWebhook(r.Context(), id, version); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      List the deliveries of a webhook
+// @Description  Lists the deliveries of a webhook, newest first, with the outcome of their last attempt: status, attempts, HTTP status of the response and error. Admin only.
+// @Tags         Webhooks
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id          path      int     true   "Webhook ID"
+// @Param        status      query     string  false  "pending, delivered or dead"
+// @Param        event_type  query     string  false  "e.g. car.created or order.completed"
+// @Param        id_event    query     int     false  "ID of the outbox event"
+// @Param        page        query     int     false  "Page number (1-based)"
+// @Param        page_size   query     int     false  "Page size (default 50, max 200)"
+// @Param        cursor      query     string  false  "Opaque cursor returned as next_cursor by a previous page"
+// @Success      200 {object}  ListResponse{data=[]models.WebhookDelivery}
+// @Failure      400 {object}  Problem  "Error: Invalid ID or query parameter"
+// @Failure      401 {object}  Problem  "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem  "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem  "Error: Webhook not found"
+// @Failure      500 {object}  Problem  "Error: Internal server error"
+// @Router       /webhooks/{id}/deliveries [get]
+func (s *APIServer) handleGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	query, err := parseListQuery(r, storage.WebhookDeliveryFields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+	query.Filters = append(query.Filters, storage.Filter{Field: "id_webhook", Op: storage.OpEq, Value: id})
+	if len(query.Sort) == 0 {
+		query.Sort = []storage.Sort{{Field: "id_delivery", Desc: true}}
+	}
+
+	if _, err := s.store.GetWebhookByID(r.Context(), id); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	page, err := s.store.ListWebhookDeliveries(r.Context(), query)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newListResponse(page, query))
+}
+
+// @Summary      Redeliver a webhook event
+// @Description  Queues the event of a delivery for the webhook again, whatever became of that delivery, e.g. once the receiver is fixed. The new delivery is sent with a fresh set of attempts and keeps its own history. Admin only.
+// @Tags         Webhooks
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id          path      int  true  "Webhook ID"
+// @Param        deliveryID  path      int  true  "Delivery ID"
+// @Success      201 {object}  models.WebhookDelivery
+// @Failure      400 {object}  Problem  "Error: Invalid ID"
+// @Failure      401 {object}  Problem  "Error: Missing or invalid token"
+// @Failure      403 {object}  Problem  "Error: Insufficient permissions"
+// @Failure      404 {object}  Problem  "Error: Delivery not found for this webhook"
+// @Failure      500 {object}  Problem  "Error: Internal server error"
+// @Router       /webhooks/{id}/deliveries/{deliveryID}/redeliver [post]
+func (s *APIServer) handleRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+	deliveryID, err := getURLParamID(r, "deliveryID")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		logError(r, err)
+		return
+	}
+
+	delivery, err := s.store.RedeliverWebhookDelivery(r.Context(), id, deliveryID)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, delivery)
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"keeper/internal/models"
+	"keeper/internal/outbox"
+	"keeper/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhooksAPI(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	events := storage.NewOutboxStore(store)
+	server := newTestServer(t, events)
+
+	send := func(method, url, body string, role models.Role) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		authorize(t, server, req, role)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The receiver records whether each request was signed with the secret of the webhook
+	var mu sync.Mutex
+	var secret string
+	var verified []error
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		verified = append(verified, outbox.VerifySignature(secret, r.Header.Get(outbox.SignatureHeader), body, time.Minute, time.Now()))
+	}))
+	defer receiver.Close()
+
+	rr := send(http.MethodPost, "/webhooks", fmt.Sprintf(`{"url": %q, "event_types": ["car.created"]}`, receiver.URL), models.RoleAdmin)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf(errStatusMismatch, rr.Code, http.StatusCreated)
+	}
+	var created WebhookCreated
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatalf("decoding webhook: %v", err)
+	}
+	if !strings.HasPrefix(created.Secret, "whsec_") {
+		t.Fatalf("secret = %q", created.Secret)
+	}
+	secret = created.Secret
+	webhookURL := fmt.Sprintf("/webhooks/%d", created.ID)
+
+	t.Run("it validates subscriptions", func(t *testing.T) {
+		for _, body := range []string{
+			`{"url": "https://example.com/hook", "event_types": ["car.sold"]}`,
+			`{"url": "https://example.com/hook", "event_types": []}`,
+			`{"url": "ftp://example.com/hook", "event_types": ["car.created"]}`,
+		} {
+			if rr := send(http.MethodPost, "/webhooks", body, models.RoleAdmin); rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: "+errStatusMismatch, body, rr.Code, http.StatusBadRequest)
+			}
+		}
+	})
+
+	t.Run("it does not store the response with the secret", func(t *testing.T) {
+		body := fmt.Sprintf(`{"url": %q, "event_types": ["car.deleted"]}`, receiver.URL)
+		var secrets []string
+		for range 2 {
+			req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Idempotency-Key", "webhook-secret")
+			authorize(t, server, req, models.RoleAdmin)
+			rr := httptest.NewRecorder()
+			server.Router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusCreated || rr.Header().Get("Idempotent-Replayed") != "" {
+				t.Fatalf("create with Idempotency-Key: "+errStatusMismatch+", replayed %q", rr.Code, http.StatusCreated, rr.Header().Get("Idempotent-Replayed"))
+			}
+			var created WebhookCreated
+			if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+				t.Fatalf("decoding webhook: %v", err)
+			}
+			secrets = append(secrets, created.Secret)
+			if rr := send(http.MethodDelete, fmt.Sprintf("/webhooks/%d", created.ID), "", models.RoleAdmin); rr.Code != http.StatusNoContent {
+				t.Fatalf(errStatusMismatch, rr.Code, http.StatusNoContent)
+			}
+		}
+		if secrets[0] == secrets[1] {
+			t.Errorf("the second request replayed the secret of the first")
+		}
+	})
+
+	t.Run("it never shows the secret again", func(t *testing.T) {
+		rr := send(http.MethodGet, webhookURL, "", models.RoleAdmin)
+		if rr.Code != http.StatusOK {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusOK)
+		}
+		if strings.Contains(rr.Body.String(), created.Secret) {
+			t.Errorf("GET returned the secret: %s", rr.Body)
+		}
+	})
+
+	t.Run("it delivers signed events and records them", func(t *testing.T) {
+		dealershipID, err := store.CreateDealership(ctx, &models.Dealership{PostalCode: "73100", City: "Lecce", Address: "Via Roma 1", Phone: "0832000000"})
+		if err != nil {
+			t.Fatalf("CreateDealership: %v", err)
+		}
+		vin := "WVWZZZ1JZXW000001"
+		if _, err := events.CreateCar(ctx, &models.CarPark{VIN: &vin, ID_Dealership: dealershipID, Brand: "Fiat", Model: "Panda", Condition: models.CondTypeNew, Year: 2024, KM: "0", Plate: "AB123CD"}); err != nil {
+			t.Fatalf("CreateCar: %v", err)
+		}
+		dispatcher := outbox.NewWebhookDispatcher(store)
+		if claimed, err := dispatcher.DispatchOnce(ctx); err != nil || claimed != 1 {
+			t.Fatalf("DispatchOnce = %d, %v, want 1 delivery", claimed, err)
+		}
+		if len(verified) != 1 || verified[0] != nil {
+			t.Fatalf("receiver verified %v, want one valid signature", verified)
+		}
+
+		rr := send(http.MethodGet, webhookURL+"/deliveries", "", models.RoleAdmin)
+		if rr.Code != http.StatusOK {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusOK)
+		}
+		var history ListResponse[models.WebhookDelivery]
+		if err := json.NewDecoder(rr.Body).Decode(&history); err != nil {
+			t.Fatalf("decoding deliveries: %v", err)
+		}
+		if len(history.Data) != 1 || history.Data[0].Status != models.EventDelivered || history.Data[0].EventType != models.EventCarCreated {
+			t.Fatalf("deliveries = %+v, want the delivered car.created", history.Data)
+		}
+
+		rr = send(http.MethodPost, fmt.Sprintf("%s/deliveries/%d/redeliver", webhookURL, history.Data[0].ID_Delivery), "", models.RoleAdmin)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("redeliver: "+errStatusMismatch, rr.Code, http.StatusCreated)
+		}
+		if claimed, err := dispatcher.DispatchOnce(ctx); err != nil || claimed != 1 {
+			t.Fatalf("DispatchOnce after redeliver = %d, %v, want 1 delivery", claimed, err)
+		}
+		if len(verified) != 2 || verified[1] != nil {
+			t.Errorf("receiver verified %v, want a second valid signature", verified)
+		}
+		if rr := send(http.MethodPost, webhookURL+"/deliveries/4242/redeliver", "", models.RoleAdmin); rr.Code != http.StatusNotFound {
+			t.Errorf("redeliver of an unknown delivery: "+errStatusMismatch, rr.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("it pauses webhooks", func(t *testing.T) {
+		rr := send(http.MethodPatch, webhookURL, `{"paused": true}`, models.RoleAdmin)
+		if rr.Code != http.StatusOK {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusOK)
+		}
+		var webhook models.Webhook
+		if err := json.NewDecoder(rr.Body).Decode(&webhook); err != nil {
+			t.Fatalf("decoding webhook: %v", err)
+		}
+		if !webhook.Paused || webhook.URL != receiver.URL {
+			t.Errorf("patched webhook = %+v", webhook)
+		}
+		if rr := send(http.MethodPatch, webhookURL, `{"secret": "guessed"}`, models.RoleAdmin); rr.Code != http.StatusBadRequest {
+			t.Errorf("patching the secret: "+errStatusMismatch, rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("it is reserved to admins", func(t *testing.T) {
+		if rr := send(http.MethodGet, "/webhooks", "", models.RoleManager); rr.Code != http.StatusForbidden {
+			t.Errorf(errStatusMismatch, rr.Code, http.StatusForbidden)
+		}
+	})
+
+	t.Run("it deletes webhooks", func(t *testing.T) {
+		if rr := send(http.MethodDelete, webhookURL, "", models.RoleAdmin); rr.Code != http.StatusNoContent {
+			t.Fatalf(errStatusMismatch, rr.Code, http.StatusNoContent)
+		}
+		if rr := send(http.MethodGet, webhookURL+"/deliveries", "", models.RoleAdmin); rr.Code != http.StatusNotFound {
+			t.Errorf("deliveries of a deleted webhook: "+errStatusMismatch, rr.Code, http.StatusNotFound)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"keeper/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPasswordHashing verifies that a hashed password matches only the original input.
+func TestPasswordHashing(t *testing.T) {
+	hash, err := HashPassword("s3cret-password")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+
+	ok, err := CheckPassword(hash, "s3cret-password")
+	if err != nil || !ok {
+		t.Errorf("CheckPassword() with correct password = %v, %v; want true, nil", ok, err)
+	}
+
+	ok, err = CheckPassword(hash, "wrong-password")
+	if err != nil || ok {
+		t.Errorf("CheckPassword() with wrong password = %v, %v; want false, nil", ok, err)
+	}
+
+	if _, err := CheckPassword("not-a-hash", "x"); err != ErrMalformedHash {
+		t.Errorf("CheckPassword() with malformed hash error = %v, want %v", err, ErrMalformedHash)
+	}
+}
+
+// TestTokenManager covers issuing, parsing, tampering, expiry and token type checks.
+func TestTokenManager(t *testing.T) {
+	manager := NewTokenManager([]byte("test-secret"))
+
+	pair, err := manager.IssuePair(42, models.RoleManager)
+	if err != nil {
+		t.Fatalf("IssuePair() error = %v", err)
+	}
+
+	t.Run("valid access token", func(t *testing.T) {
+		claims, err := manager.Parse(pair.AccessToken, TokenTypeAccess)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		id, _ := claims.EmployeeID()
+		if id != 42 || claims.Role != models.RoleManager {
+			t.Errorf("unexpected claims: %+v", claims)
+		}
+	})
+
+	t.Run("refresh token used as access token", func(t *testing.T) {
+		if _, err := manager.Parse(pair.RefreshToken, TokenTypeAccess); err != ErrWrongType {
+			t.Errorf("Parse() error = %v, want %v", err, ErrWrongType)
+		}
+	})
+
+	t.Run("tampered payload", func(t *testing.T) {
+		parts := strings.Split(pair.AccessToken, ".")
+		parts[1] = parts[1] + "x"
+		if _, err := manager.Parse(strings.Join(parts, "."), TokenTypeAccess); err != ErrInvalidToken {
+			t.Errorf("Parse() error = %v, want %v", err, ErrInvalidToken)
+		}
+	})
+
+	t.Run("different secret", func(t *testing.T) {
+		other := NewTokenManager([]byte("other-secret"))
+		if _, err := other.Parse(pair.AccessToken, TokenTypeAccess); err != ErrInvalidToken {
+			t.Errorf("Parse() error = %v, want %v", err, ErrInvalidToken)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		manager.now = func() time.Time { return time.Now().Add(manager.AccessTTL + time.Minute) }
+		defer func() { manager.now = time.Now }()
+
+		if _, err := manager.Parse(pair.AccessToken, TokenTypeAccess); err != ErrExpiredToken {
+			t.Errorf("Parse() error = %v, want %v", err, ErrExpiredToken)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+// Package auth provides password hashing, signed session tokens and the
+// authenticated principal used by the KEEPER API.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	hashScheme     = "pbkdf2-sha256"
+	hashIterations = 210000
+	saltLength     = 16
+	keyLength      = 32
+)
+
+// ErrMalformedHash is returned when a stored password hash cannot be parsed
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// HashPassword derives a salted PBKDF2-SHA256 hash suitable for storage.
+// The result has the form "pbkdf2-sha256$<iterations>$<salt>$<key>".
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := pbkdf2.Key([]byte(password), salt, hashIterations, keyLength, sha256.New)
+
+	return fmt.Sprintf("%s$%d$%s$%s",
+		hashScheme,
+		hashIterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// CheckPassword reports whether password matches the stored hash
+func CheckPassword(hash, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != hashScheme {
+		return false, ErrMalformedHash
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+
+	key := pbkdf2.Key([]byte(password), salt, iterations, len(expected), sha256.New)
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"context"
+	"keeper/internal/models"
+)
+
+// Principal is the authenticated employee behind a request
+type Principal struct {
+	EmployeeID int
+	Role       models.Role
+}
+
+// HasRole reports whether the principal holds one of the given roles
+func (p *Principal) HasRole(roles ...models.Role) bool {
+	for _, role := range roles {
+		if p.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored in ctx, if any
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
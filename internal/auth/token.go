@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"keeper/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TokenType distinguishes short-lived access tokens from refresh tokens
+type TokenType string
+
+const (
+	TokenTypeAccess  TokenType = "access"
+	TokenTypeRefresh TokenType = "refresh"
+)
+
+// Default token lifetimes
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 7 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+	ErrWrongType    = errors.New("wrong token type")
+)
+
+// jwtHeader is the fixed, pre-encoded header of every token we sign (HS256)
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims is the payload carried by KEEPER session tokens
+type Claims struct {
+	Subject   string      `json:"sub"`
+	Role      models.Role `json:"role"`
+	Type      TokenType   `json:"typ"`
+	IssuedAt  int64       `json:"iat"`
+	ExpiresAt int64       `json:"exp"`
+}
+
+// EmployeeID returns the employee ID stored in the subject claim
+func (c *Claims) EmployeeID() (int, error) {
+	id, err := strconv.Atoi(c.Subject)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	return id, nil
+}
+
+// TokenPair is the result of a successful login or refresh
+type TokenPair struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	TokenType    string    `json:"token_type"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// TokenManager signs and verifies HS256 JSON Web Tokens
+type TokenManager struct {
+	secret     []byte
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	now        func() time.Time
+}
+
+// NewTokenManager creates a token manager using the given HMAC secret and default lifetimes
+func NewTokenManager(secret []byte) *TokenManager {
+	return &TokenManager{
+		secret:     secret,
+		AccessTTL:  DefaultAccessTTL,
+		RefreshTTL: DefaultRefreshTTL,
+		now:        time.Now,
+	}
+}
+
+// IssuePair creates a new access/refresh token pair for an employee
+func (m *TokenManager) IssuePair(employeeID int, role models.Role) (*TokenPair, error) {
+	access, expiresAt, err := m.issue(employeeID, role, TokenTypeAccess, m.AccessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, _, err := m.issue(employeeID, role, TokenTypeRefresh, m.RefreshTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// Parse verifies the signature, expiry and type of a token and returns its claims
+func (m *TokenManager) Parse(token string, expected TokenType) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(signature, m.sign(parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if m.now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+	if claims.Type != expected {
+		return nil, ErrWrongType
+	}
+
+	return &claims, nil
+}
+
+func (m *TokenManager) issue(employeeID int, role models.Role, typ TokenType, ttl time.Duration) (string, time.Time, error) {
+	now := m.now()
+	expiresAt := now.Add(ttl)
+
+	payload, err := json.Marshal(Claims{
+		Subject:   strconv.Itoa(employeeID),
+		Role:      role,
+		Type:      typ,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(m.sign(unsigned)), expiresAt, nil
+}
+
+func (m *TokenManager) sign(data string) []byte {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,119 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_second.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+		"0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"0001_first.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+		"0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Version != 2 {
+		t.Fatalf("Load returned %+v, want versions 1 and 2 in order", migrations)
+	}
+	if migrations[0].Name != "first" || migrations[0].Up != "CREATE TABLE a ();" || migrations[0].Down != "DROP TABLE a;" {
+		t.Errorf("first migration = %+v", migrations[0])
+	}
+}
+
+func TestLoadRejectsInvalidSets(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing down": {
+			"0001_first.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"bad name": {
+			"first.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"two names for one version": {
+			"0001_first.up.sql":   {Data: []byte("SELECT 1;")},
+			"0001_other.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Load(fsys); err == nil {
+				t.Error("Load accepted an invalid set of migrations")
+			}
+		})
+	}
+}
+
+// TestEmbedded checks that the migrations shipped in the binary load and are numbered without gaps
+func TestEmbedded(t *testing.T) {
+	m, err := New(nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for i, migration := range m.Migrations() {
+		if migration.Version != i+1 {
+			t.Errorf("migration %d_%s, want version %d", migration.Version, migration.Name, i+1)
+		}
+		if strings.TrimSpace(migration.Down) == "" {
+			t.Errorf("migration %d_%s has an empty down file", migration.Version, migration.Name)
+		}
+	}
+}
+
+// TestMigrator runs every migration up, down and up again against the database in TEST_DATABASE_URL.
+// The database must be dedicated to tests: reverting the migrations drops all application tables.
+func TestMigrator(t *testing.T) {
+	connString := os.Getenv("TEST_DATABASE_URL")
+	if connString == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping integration test")
+	}
+	db, err := sql.Open("pgx", connString)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	m, err := New(db)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	total := len(m.Migrations())
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if applied, err := m.Up(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("second Up applied %d migrations (err %v), want none", len(applied), err)
+	}
+
+	reverted, err := m.Down(ctx, total)
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if len(reverted) != total {
+		t.Errorf("Down reverted %d migrations, want %d", len(reverted), total)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			t.Errorf("migration %d still applied after Down", status.Version)
+		}
+	}
+
+	if applied, err := m.Up(ctx); err != nil || len(applied) != total {
+		t.Fatalf("Up after Down applied %d migrations (err %v), want %d", len(applied), err, total)
+	}
+}
@@ -0,0 +1,18 @@
+-- The btree_gist extension is left installed, other database objects may rely on it
+
+DROP TABLE IF EXISTS appointment;
+DROP TABLE IF EXISTS order_status_history;
+DROP TABLE IF EXISTS "order";
+DROP TYPE IF EXISTS status_enum;
+DROP TABLE IF EXISTS car_park;
+DROP TYPE IF EXISTS car_status_enum;
+DROP TYPE IF EXISTS condition_enum;
+DROP TABLE IF EXISTS employment;
+DROP TABLE IF EXISTS employee_credential;
+DROP TABLE IF EXISTS employee;
+DROP TYPE IF EXISTS role_enum;
+DROP TABLE IF EXISTS dealership_closure;
+DROP TABLE IF EXISTS opening_hours;
+DROP TABLE IF EXISTS dealership;
+DROP TABLE IF EXISTS "client";
+DROP TYPE IF EXISTS client_type_enum;
@@ -1,3 +1,5 @@
+-- Initial schema: every table of the application as of the introduction of versioned migrations
+
 create type client_type_enum as enum ('private', 'company');
 
 CREATE Table "client" (
@@ -20,6 +22,26 @@ CREATE Table dealership (
     phone VARCHAR(20) NOT NULL
 );
 
+create table opening_hours (
+    id_hours SERIAL PRIMARY KEY,
+    id_dealership INT NOT NULL,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 1 AND 7),
+    opens_at TIME NOT NULL,
+    closes_at TIME NOT NULL,
+    CHECK (opens_at < closes_at),
+    FOREIGN KEY (id_dealership) REFERENCES dealership(id_dealership) ON DELETE CASCADE
+);
+
+create table dealership_closure (
+    id_closure SERIAL PRIMARY KEY,
+    id_dealership INT NOT NULL,
+    startdate DATE NOT NULL,
+    enddate DATE NOT NULL,
+    reason VARCHAR(100),
+    CHECK (startdate <= enddate),
+    FOREIGN KEY (id_dealership) REFERENCES dealership(id_dealership) ON DELETE CASCADE
+);
+
 create type role_enum as enum ('manager', 'mechanic', 'salesperson', 'assistant', 'admin');
 
 CREATE Table employee (
@@ -31,6 +53,14 @@ CREATE Table employee (
     phone VARCHAR(20) NOT NULL
 );
 
+CREATE Table employee_credential (
+    id_employee INT PRIMARY KEY,
+    username VARCHAR(50) UNIQUE NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    last_update TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (id_employee) REFERENCES employee(id_employee) ON DELETE CASCADE
+);
+
 CREATE Table employment (
     id_employment SERIAL PRIMARY KEY,
     id_employee INT NOT NULL,
@@ -43,6 +73,8 @@ CREATE Table employment (
 
 create type condition_enum as enum ('new', 'used');
 
+create type car_status_enum as enum ('in_stock', 'reserved', 'sold', 'in_reconditioning', 'in_transit', 'delivered', 'written_off');
+
 create table car_park (
     id_car SERIAL PRIMARY KEY,
     vin VARCHAR(17) UNIQUE,
@@ -53,6 +85,7 @@ create table car_park (
     "year" INT NOT NULL CHECK ("year" > 1900 AND "year" <= (EXTRACT(YEAR FROM CURRENT_DATE) + 1)),
     km VARCHAR(7) NOT NULL DEFAULT '0',
     plate VARCHAR(10) UNIQUE NOT NULL,
+    status car_status_enum NOT NULL DEFAULT 'in_stock',
     FOREIGN KEY (id_dealership) REFERENCES dealership(id_dealership) ON DELETE RESTRICT
 );
 
@@ -72,15 +105,44 @@ create table "order" (
     FOREIGN KEY (id_dealership) REFERENCES dealership(id_dealership) ON DELETE RESTRICT
 );
 
+create table order_status_history (
+    id_change SERIAL PRIMARY KEY,
+    id_order INT NOT NULL,
+    from_status status_enum,
+    to_status status_enum NOT NULL,
+    id_employee INT,
+    reason VARCHAR(255),
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (id_order) REFERENCES "order"(id_order) ON DELETE CASCADE,
+    FOREIGN KEY (id_employee) REFERENCES employee(id_employee) ON DELETE SET NULL
+);
+
+create index idx_order_status_history_order on order_status_history (id_order, changed_at);
+
+-- btree_gist lets the exclusion constraints below combine equality on ids with range overlap
+create extension if not exists btree_gist;
+
 create table appointment (
     id_appointment SERIAL PRIMARY KEY,
     id_client INT NOT NULL,
     id_employee INT NOT NULL,
     id_dealership INT NOT NULL,
     "date" TIMESTAMP NOT NULL,
+    duration_minutes INT NOT NULL DEFAULT 30 CHECK (duration_minutes BETWEEN 5 AND 480),
+    vin VARCHAR(17),
     reason VARCHAR(100) NOT NULL,
     notes TEXT,
     FOREIGN KEY (id_client) REFERENCES client(id_client) ON DELETE RESTRICT,
     FOREIGN KEY (id_employee) REFERENCES employee(id_employee) ON DELETE RESTRICT,
-    FOREIGN KEY (id_dealership) REFERENCES dealership(id_dealership) ON DELETE RESTRICT
+    FOREIGN KEY (id_dealership) REFERENCES dealership(id_dealership) ON DELETE RESTRICT,
+    FOREIGN KEY (vin) REFERENCES car_park(vin) ON DELETE RESTRICT,
+    -- An employee, and a vehicle when one is given, can only be in one appointment at a time
+    CONSTRAINT appointment_employee_no_overlap EXCLUDE USING gist (
+        id_employee WITH =,
+        tsrange("date", "date" + duration_minutes * interval '1 minute') WITH &&
+    ),
+    CONSTRAINT appointment_vehicle_no_overlap EXCLUDE USING gist (
+        vin WITH =,
+        tsrange("date", "date" + duration_minutes * interval '1 minute') WITH &&
+    ) WHERE (vin IS NOT NULL)
 );
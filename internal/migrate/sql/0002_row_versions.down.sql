@@ -0,0 +1,17 @@
+DROP TRIGGER IF EXISTS appointment_version ON appointment;
+DROP TRIGGER IF EXISTS order_version ON "order";
+DROP TRIGGER IF EXISTS car_park_version ON car_park;
+DROP TRIGGER IF EXISTS client_version ON "client";
+DROP TRIGGER IF EXISTS employment_version ON employment;
+DROP TRIGGER IF EXISTS employee_version ON employee;
+DROP TRIGGER IF EXISTS dealership_version ON dealership;
+
+ALTER TABLE appointment DROP COLUMN IF EXISTS version;
+ALTER TABLE "order" DROP COLUMN IF EXISTS version;
+ALTER TABLE car_park DROP COLUMN IF EXISTS version;
+ALTER TABLE "client" DROP COLUMN IF EXISTS version;
+ALTER TABLE employment DROP COLUMN IF EXISTS version;
+ALTER TABLE employee DROP COLUMN IF EXISTS version;
+ALTER TABLE dealership DROP COLUMN IF EXISTS version;
+
+DROP FUNCTION IF EXISTS bump_version();
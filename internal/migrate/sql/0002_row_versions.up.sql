@@ -0,0 +1,25 @@
+-- Row versions for optimistic concurrency: every update of a resource bumps its version, which the
+-- API exposes as the ETag and checks against If-Match
+
+CREATE FUNCTION bump_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE dealership ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE employee ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE employment ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE "client" ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE car_park ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE "order" ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE appointment ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+CREATE TRIGGER dealership_version BEFORE UPDATE ON dealership FOR EACH ROW EXECUTE FUNCTION bump_version();
+CREATE TRIGGER employee_version BEFORE UPDATE ON employee FOR EACH ROW EXECUTE FUNCTION bump_version();
+CREATE TRIGGER employment_version BEFORE UPDATE ON employment FOR EACH ROW EXECUTE FUNCTION bump_version();
+CREATE TRIGGER client_version BEFORE UPDATE ON "client" FOR EACH ROW EXECUTE FUNCTION bump_version();
+CREATE TRIGGER car_park_version BEFORE UPDATE ON car_park FOR EACH ROW EXECUTE FUNCTION bump_version();
+CREATE TRIGGER order_version BEFORE UPDATE ON "order" FOR EACH ROW EXECUTE FUNCTION bump_version();
+CREATE TRIGGER appointment_version BEFORE UPDATE ON appointment FOR EACH ROW EXECUTE FUNCTION bump_version();
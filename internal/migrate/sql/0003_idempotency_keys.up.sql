@@ -0,0 +1,15 @@
+-- Responses of POST requests sent with an Idempotency-Key header, replayed when the client retries.
+-- status_code is NULL while the first request is still being processed.
+CREATE TABLE idempotency_key (
+    idempotency_key VARCHAR(255) NOT NULL,
+    route VARCHAR(255) NOT NULL,
+    id_employee INT NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status_code INT,
+    content_type VARCHAR(255),
+    body TEXT,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (idempotency_key, route, id_employee)
+);
+
+CREATE INDEX idx_idempotency_key_created ON idempotency_key (created);
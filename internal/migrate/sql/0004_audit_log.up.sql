@@ -0,0 +1,17 @@
+-- Every create, update and delete made through the API, with the employee and request that made it
+-- and the changed fields before and after. Entries outlive the records and employees they mention,
+-- so there are no foreign keys.
+CREATE TABLE audit_log (
+    id_audit BIGSERIAL PRIMARY KEY,
+    entity VARCHAR(30) NOT NULL,
+    entity_id INT NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('create', 'update', 'delete')),
+    id_employee INT,
+    request_id VARCHAR(100),
+    diff JSONB NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_log_entity ON audit_log (entity, entity_id, changed_at);
+CREATE INDEX idx_audit_log_employee ON audit_log (id_employee, changed_at);
+CREATE INDEX idx_audit_log_changed_at ON audit_log (changed_at);
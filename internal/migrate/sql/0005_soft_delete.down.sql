@@ -0,0 +1,39 @@
+-- Rows deleted since the migration are removed for good, as their unique values may have been reused
+DELETE FROM audit_log WHERE action = 'restore';
+ALTER TABLE audit_log DROP CONSTRAINT audit_log_action_check;
+ALTER TABLE audit_log ADD CONSTRAINT audit_log_action_check CHECK (action IN ('create', 'update', 'delete'));
+
+DROP TRIGGER IF EXISTS car_park_vin_references ON car_park;
+DROP TRIGGER IF EXISTS employee_credential_employee_live ON employee_credential;
+DROP TRIGGER IF EXISTS employment_employee_live ON employment;
+DROP TRIGGER IF EXISTS appointment_employee_live ON appointment;
+DROP TRIGGER IF EXISTS appointment_client_live ON appointment;
+DROP TRIGGER IF EXISTS appointment_vin_live ON appointment;
+DROP TRIGGER IF EXISTS order_employee_live ON "order";
+DROP TRIGGER IF EXISTS order_client_live ON "order";
+DROP TRIGGER IF EXISTS order_vin_live ON "order";
+DROP FUNCTION IF EXISTS check_vin_references();
+DROP FUNCTION IF EXISTS check_not_deleted();
+
+DELETE FROM "client" WHERE deleted_at IS NOT NULL;
+DELETE FROM car_park WHERE deleted_at IS NOT NULL;
+DELETE FROM employee WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS car_park_vin_key;
+DROP INDEX IF EXISTS car_park_plate_key;
+DROP INDEX IF EXISTS employee_tin_key;
+DROP INDEX IF EXISTS client_tin_vat_key;
+DROP INDEX IF EXISTS client_email_key;
+
+ALTER TABLE car_park ADD CONSTRAINT car_park_vin_key UNIQUE (vin);
+ALTER TABLE car_park ADD CONSTRAINT car_park_plate_key UNIQUE (plate);
+ALTER TABLE employee ADD CONSTRAINT employee_tin_key UNIQUE (tin);
+ALTER TABLE "client" ADD CONSTRAINT client_tin_vat_key UNIQUE (tin_vat);
+ALTER TABLE "client" ADD CONSTRAINT client_email_key UNIQUE (email);
+
+ALTER TABLE appointment ADD CONSTRAINT appointment_vin_fkey FOREIGN KEY (vin) REFERENCES car_park(vin) ON DELETE RESTRICT;
+ALTER TABLE "order" ADD CONSTRAINT order_vin_fkey FOREIGN KEY (vin) REFERENCES car_park(vin) ON DELETE RESTRICT;
+
+ALTER TABLE employee DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE car_park DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE "client" DROP COLUMN IF EXISTS deleted_at;
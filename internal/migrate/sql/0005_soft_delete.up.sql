@@ -0,0 +1,88 @@
+-- Soft delete for clients, cars and employees: a deleted row keeps its id and stays referenced by the
+-- orders, appointments and history that mention it, but drops out of every read and no longer holds
+-- its unique values, which a new record may then reuse.
+
+ALTER TABLE "client" ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE car_park ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE employee ADD COLUMN deleted_at TIMESTAMP;
+
+ALTER TABLE "client" DROP CONSTRAINT client_email_key;
+ALTER TABLE "client" DROP CONSTRAINT client_tin_vat_key;
+ALTER TABLE employee DROP CONSTRAINT employee_tin_key;
+ALTER TABLE car_park DROP CONSTRAINT car_park_plate_key;
+
+-- A foreign key needs a unique constraint over every row, so the VIN references become triggers
+ALTER TABLE "order" DROP CONSTRAINT order_vin_fkey;
+ALTER TABLE appointment DROP CONSTRAINT appointment_vin_fkey;
+ALTER TABLE car_park DROP CONSTRAINT car_park_vin_key;
+
+CREATE UNIQUE INDEX client_email_key ON "client" (email) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX client_tin_vat_key ON "client" (tin_vat) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX employee_tin_key ON employee (tin) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX car_park_plate_key ON car_park (plate) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX car_park_vin_key ON car_park (vin) WHERE deleted_at IS NULL;
+
+-- check_not_deleted keeps new references away from deleted rows. TG_ARGV holds the referencing column
+-- and the referenced table, whose key has the same name; an unchanged value is not checked again.
+-- The error is the one a foreign key raises, and for the VIN it stands in for the dropped foreign key.
+CREATE FUNCTION check_not_deleted() RETURNS trigger AS $$
+DECLARE
+    col TEXT := TG_ARGV[0];
+    referenced TEXT := TG_ARGV[1];
+    new_value TEXT := to_jsonb(NEW) ->> col;
+    missing BOOLEAN;
+BEGIN
+    IF new_value IS NULL OR (TG_OP = 'UPDATE' AND new_value = to_jsonb(OLD) ->> col) THEN
+        RETURN NEW;
+    END IF;
+    EXECUTE format('SELECT NOT EXISTS (SELECT 1 FROM %I WHERE %I::text = $1 AND deleted_at IS NULL)', referenced, col)
+        INTO missing USING new_value;
+    IF missing THEN
+        RAISE EXCEPTION 'insert or update on table "%" violates foreign key constraint "%_%_fkey"', TG_TABLE_NAME, TG_TABLE_NAME, col
+            USING ERRCODE = 'foreign_key_violation',
+                  DETAIL = format('Key (%s)=(%s) is not present in table "%s".', col, new_value, referenced),
+                  TABLE = TG_TABLE_NAME,
+                  CONSTRAINT = format('%s_%s_fkey', TG_TABLE_NAME, col);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER order_vin_live BEFORE INSERT OR UPDATE ON "order" FOR EACH ROW EXECUTE FUNCTION check_not_deleted('vin', 'car_park');
+CREATE TRIGGER order_client_live BEFORE INSERT OR UPDATE ON "order" FOR EACH ROW EXECUTE FUNCTION check_not_deleted('id_client', 'client');
+CREATE TRIGGER order_employee_live BEFORE INSERT OR UPDATE ON "order" FOR EACH ROW EXECUTE FUNCTION check_not_deleted('id_employee', 'employee');
+CREATE TRIGGER appointment_vin_live BEFORE INSERT OR UPDATE ON appointment FOR EACH ROW EXECUTE FUNCTION check_not_deleted('vin', 'car_park');
+CREATE TRIGGER appointment_client_live BEFORE INSERT OR UPDATE ON appointment FOR EACH ROW EXECUTE FUNCTION check_not_deleted('id_client', 'client');
+CREATE TRIGGER appointment_employee_live BEFORE INSERT OR UPDATE ON appointment FOR EACH ROW EXECUTE FUNCTION check_not_deleted('id_employee', 'employee');
+CREATE TRIGGER employment_employee_live BEFORE INSERT OR UPDATE ON employment FOR EACH ROW EXECUTE FUNCTION check_not_deleted('id_employee', 'employee');
+CREATE TRIGGER employee_credential_employee_live BEFORE INSERT OR UPDATE ON employee_credential FOR EACH ROW EXECUTE FUNCTION check_not_deleted('id_employee', 'employee');
+
+-- check_vin_references keeps the VIN of a car from changing while orders or appointments refer to it,
+-- as the dropped foreign keys did
+CREATE FUNCTION check_vin_references() RETURNS trigger AS $$
+DECLARE
+    referencing TEXT;
+BEGIN
+    IF OLD.vin IS NULL OR NEW.vin IS NOT DISTINCT FROM OLD.vin THEN
+        RETURN NEW;
+    END IF;
+    IF EXISTS (SELECT 1 FROM "order" WHERE vin = OLD.vin) THEN
+        referencing := 'order';
+    ELSIF EXISTS (SELECT 1 FROM appointment WHERE vin = OLD.vin) THEN
+        referencing := 'appointment';
+    ELSE
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'update on table "car_park" violates foreign key constraint "%_vin_fkey" on table "%"', referencing, referencing
+        USING ERRCODE = 'foreign_key_violation',
+              DETAIL = format('Key (vin)=(%s) is still referenced from table "%s".', OLD.vin, referencing),
+              TABLE = 'car_park',
+              CONSTRAINT = referencing || '_vin_fkey';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER car_park_vin_references BEFORE UPDATE ON car_park FOR EACH ROW EXECUTE FUNCTION check_vin_references();
+
+-- Restoring a deleted record is logged as its own action
+ALTER TABLE audit_log DROP CONSTRAINT audit_log_action_check;
+ALTER TABLE audit_log ADD CONSTRAINT audit_log_action_check CHECK (action IN ('create', 'update', 'delete', 'restore'));
@@ -0,0 +1,20 @@
+-- Domain events written in the same transaction as the change they describe, and delivered to the
+-- notifier by the dispatcher afterwards. An event that keeps failing is dead-lettered and stays in
+-- the table until an admin requeues it.
+CREATE TABLE outbox_event (
+    id_event BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    entity VARCHAR(30) NOT NULL,
+    entity_id INT NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP
+);
+
+-- The dispatcher only ever looks for pending events that are due
+CREATE INDEX idx_outbox_event_due ON outbox_event (next_attempt_at, id_event) WHERE status = 'pending';
+CREATE INDEX idx_outbox_event_entity ON outbox_event (entity, entity_id);
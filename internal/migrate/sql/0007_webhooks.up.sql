@@ -0,0 +1,32 @@
+-- Subscriptions of external systems to the domain events of the outbox. Each event is queued for
+-- every subscription to its type in the transaction that writes it, and delivered by the webhook
+-- dispatcher; the deliveries are kept as the history of the subscription.
+CREATE TABLE webhook (
+    id_webhook SERIAL PRIMARY KEY,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(100) NOT NULL,
+    event_types JSONB NOT NULL CHECK (jsonb_typeof(event_types) = 'array'),
+    description VARCHAR(255),
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    version INT NOT NULL DEFAULT 1
+);
+
+CREATE TRIGGER webhook_version BEFORE UPDATE ON webhook FOR EACH ROW EXECUTE FUNCTION bump_version();
+
+CREATE TABLE webhook_delivery (
+    id_delivery BIGSERIAL PRIMARY KEY,
+    id_webhook INT NOT NULL REFERENCES webhook (id_webhook) ON DELETE CASCADE,
+    id_event BIGINT NOT NULL REFERENCES outbox_event (id_event) ON DELETE CASCADE,
+    event_type VARCHAR(50) NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    response_status INT,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX idx_webhook_delivery_due ON webhook_delivery (next_attempt_at, id_delivery) WHERE status = 'pending';
+CREATE INDEX idx_webhook_delivery_webhook ON webhook_delivery (id_webhook, id_delivery);
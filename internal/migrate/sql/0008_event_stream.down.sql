@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_outbox_event_dealership;
+ALTER TABLE outbox_event DROP COLUMN IF EXISTS id_dealership;
@@ -0,0 +1,8 @@
+-- The dealership of the record each event describes, so that the event stream can be filtered and
+-- restricted to an employee's dealerships like the records themselves. id_event is the sequence
+-- clients resume the stream from.
+ALTER TABLE outbox_event ADD COLUMN id_dealership INT;
+
+UPDATE outbox_event SET id_dealership = (payload->>'id_dealership')::int WHERE payload ? 'id_dealership';
+
+CREATE INDEX idx_outbox_event_dealership ON outbox_event (id_dealership, id_event);
@@ -0,0 +1 @@
+ALTER TABLE dealership DROP COLUMN IF EXISTS time_zone;
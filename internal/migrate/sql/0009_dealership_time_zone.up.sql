@@ -0,0 +1,3 @@
+-- The IANA time zone of each dealership, e.g. 'Europe/Rome', in which its opening hours and closures
+-- are read. NULL falls back to the server's DEFAULT_TIME_ZONE.
+ALTER TABLE dealership ADD COLUMN time_zone VARCHAR(64);
@@ -0,0 +1,6 @@
+-- The transaction ID horizon of each event: every transaction that could have taken an earlier event ID
+-- has a smaller transaction ID. The event stream only reads up to the newest event whose horizon is below
+-- every transaction still open, so no event with a smaller ID can commit after it has been read.
+-- Existing events were committed long ago.
+ALTER TABLE outbox_event ADD COLUMN horizon BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE outbox_event ALTER COLUMN horizon DROP DEFAULT;
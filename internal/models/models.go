@@ -1,8 +1,13 @@
 package models
 
 import (
+	"database/sql/driver"
 	"encoding/json"
+	"fmt"
+	"slices"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Dealership struct {
@@ -11,6 +16,75 @@ type Dealership struct {
 	City          string `json:"city" gorm:"column:city;not null" validate:"required,max=30"`
 	Address       string `json:"address" gorm:"column:address;not null" validate:"required,max=100"`
 	Phone         string `json:"phone" gorm:"column:phone;not null" validate:"required,max=20"`
+	// TimeZone is the IANA name of the zone opening hours and closures are read in; nil uses the server default
+	TimeZone *string `json:"time_zone,omitempty" gorm:"column:time_zone" validate:"omitempty,max=64,timezone"`
+	Version  int     `json:"version" gorm:"column:version;not null;default:1"`
+}
+
+// OpeningHours is one range during which a dealership is open on a weekday.
+// A weekday may have several ranges (e.g. around a lunch break); times are HH:MM.
+type OpeningHours struct {
+	ID_Hours      int    `json:"id_hours" gorm:"primaryKey;autoIncrement"`
+	ID_Dealership int    `json:"id_dealership" gorm:"column:id_dealership;not null"`
+	Weekday       int    `json:"weekday" gorm:"column:weekday;not null" validate:"required,min=1,max=7"` // ISO 8601: 1 = Monday, 7 = Sunday
+	OpensAt       string `json:"opens_at" gorm:"column:opens_at;not null" validate:"required,datetime=15:04"`
+	ClosesAt      string `json:"closes_at" gorm:"column:closes_at;not null" validate:"required,datetime=15:04"`
+}
+
+// ISOWeekday converts a time.Weekday (Sunday = 0) to the ISO numbering used by OpeningHours
+func ISOWeekday(d time.Weekday) int {
+	if d == time.Sunday {
+		return 7
+	}
+	return int(d)
+}
+
+// Closure is a holiday or other exceptional closure of a dealership, from StartDate to EndDate inclusive
+type Closure struct {
+	ID_Closure    int       `json:"id_closure" gorm:"primaryKey;autoIncrement"`
+	ID_Dealership int       `json:"id_dealership" gorm:"column:id_dealership;not null"`
+	StartDate     time.Time `json:"startdate" gorm:"column:startdate;not null" validate:"required"`
+	EndDate       time.Time `json:"enddate" gorm:"column:enddate;not null" validate:"required"`
+	Reason        *string   `json:"reason,omitempty" gorm:"column:reason" validate:"omitempty,max=100"`
+}
+
+func (c *Closure) UnmarshalJSON(data []byte) error {
+	type Alias Closure
+	aux := &struct {
+		StartDate string `json:"startdate"`
+		EndDate   string `json:"enddate"`
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if aux.StartDate != "" {
+		startDate, err := parseDate(aux.StartDate)
+		if err != nil {
+			return err
+		}
+		c.StartDate = startDate
+	}
+
+	if aux.EndDate != "" {
+		endDate, err := parseDate(aux.EndDate)
+		if err != nil {
+			return err
+		}
+		c.EndDate = endDate
+	}
+
+	return nil
+}
+
+// Covers reports whether the closure includes the calendar day of t
+func (c *Closure) Covers(t time.Time) bool {
+	day := t.Format("2006-01-02")
+	return day >= c.StartDate.Format("2006-01-02") && day <= c.EndDate.Format("2006-01-02")
 }
 
 type Role string
@@ -23,12 +97,21 @@ const (
 )
 
 type Employee struct {
-	ID_Employee int    `json:"id_employee" gorm:"primaryKey;autoIncrement"`
-	Role        Role   `json:"role" gorm:"column:role;not null;default:assistant" validate:"required,oneof=assistant salesperson manager admin mechanic"`
-	TIN         string `json:"tin" gorm:"column:tin;unique;not null" validate:"required,max=16"`
-	Name        string `json:"name" gorm:"column:name;not null" validate:"required,max=50"`
-	Surname     string `json:"surname" gorm:"column:surname;not null" validate:"required,max=50"`
-	Phone       string `json:"phone" gorm:"column:phone;not null" validate:"required,max=20"`
+	ID_Employee int            `json:"id_employee" gorm:"primaryKey;autoIncrement"`
+	Role        Role           `json:"role" gorm:"column:role;not null;default:assistant" validate:"required,oneof=assistant salesperson manager admin mechanic"`
+	TIN         string         `json:"tin" gorm:"column:tin;unique;not null" validate:"required,max=16"`
+	Name        string         `json:"name" gorm:"column:name;not null" validate:"required,max=50"`
+	Surname     string         `json:"surname" gorm:"column:surname;not null" validate:"required,max=50"`
+	Phone       string         `json:"phone" gorm:"column:phone;not null" validate:"required,max=20"`
+	Version     int            `json:"version" gorm:"column:version;not null;default:1"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at" gorm:"column:deleted_at" swaggertype:"string" format:"date-time"`
+}
+
+type EmployeeCredential struct {
+	ID_Employee  int       `json:"id_employee" gorm:"primaryKey"`
+	Username     string    `json:"username" gorm:"column:username;unique;not null" validate:"required,max=50"`
+	PasswordHash string    `json:"-" gorm:"column:password_hash;not null"`
+	LastUpdate   time.Time `json:"last_update" gorm:"column:last_update;not null;default:CURRENT_TIMESTAMP"`
 }
 
 type Employment struct {
@@ -37,6 +120,7 @@ type Employment struct {
 	ID_Dealership int        `json:"id_dealership" gorm:"column:id_dealership;not null" validate:"required"`
 	StartDate     time.Time  `json:"startdate" gorm:"column:startdate;not null" validate:"required"`
 	EndDate       *time.Time `json:"enddate,omitempty" gorm:"column:enddate"`
+	Version       int        `json:"version" gorm:"column:version;not null;default:1"`
 }
 
 func (e *Employment) UnmarshalJSON(data []byte) error {
@@ -53,14 +137,18 @@ func (e *Employment) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	startDate, err := time.Parse("2006-01-02", aux.StartDate)
-	if err != nil {
-		return err
+	// A missing start date is left untouched so that partial updates keep the stored value;
+	// the validator's "required" rule rejects it on create and full update.
+	if aux.StartDate != "" {
+		startDate, err := parseDate(aux.StartDate)
+		if err != nil {
+			return err
+		}
+		e.StartDate = startDate
 	}
-	e.StartDate = startDate
 
 	if aux.EndDate != nil {
-		endDate, err := time.Parse("2006-01-02", *aux.EndDate)
+		endDate, err := parseDate(*aux.EndDate)
 		if err != nil {
 			return err
 		}
@@ -70,6 +158,15 @@ func (e *Employment) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// parseDate accepts a plain date (2006-01-02) or the RFC 3339 timestamp the API returns,
+// so that a record read from the API can be sent back unchanged.
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 type ClientType string
 const (
 	ClientTypePrivate ClientType = "private"
@@ -77,15 +174,17 @@ const (
 )
 
 type Client struct {
-	ID_Client   int         `json:"id_client" gorm:"primaryKey;autoIncrement"`
-	Type        ClientType  `json:"type" gorm:"column:type;not null" validate:"required,oneof=private company"`
-	Phone       *string     `json:"phone,omitempty" gorm:"column:phone" validate:"omitempty,max=20"`
-	Email       *string     `json:"email,omitempty" gorm:"column:email;unique" validate:"omitempty,email,max=50"`
-	TIN_VAT     string      `json:"tin_vat" gorm:"column:tin_vat;unique;not null" validate:"required,max=16"`
-	Name        string      `json:"name" gorm:"column:name;not null" validate:"required,max=50"`
-	Surname     *string     `json:"surname,omitempty" gorm:"column:surname" validate:"omitempty,max=50"`
-	CompanyName *string     `json:"companyname,omitempty" gorm:"column:companyname" validate:"omitempty,max=100"`
-	Profession  *string     `json:"profession,omitempty" gorm:"column:profession" validate:"omitempty,max=50"`
+	ID_Client   int            `json:"id_client" gorm:"primaryKey;autoIncrement"`
+	Type        ClientType     `json:"type" gorm:"column:type;not null" validate:"required,oneof=private company"`
+	Phone       *string        `json:"phone,omitempty" gorm:"column:phone" validate:"omitempty,max=20"`
+	Email       *string        `json:"email,omitempty" gorm:"column:email;unique" validate:"omitempty,email,max=50"`
+	TIN_VAT     string         `json:"tin_vat" gorm:"column:tin_vat;unique;not null" validate:"required,max=16"`
+	Name        string         `json:"name" gorm:"column:name;not null" validate:"required,max=50"`
+	Surname     *string        `json:"surname,omitempty" gorm:"column:surname" validate:"omitempty,max=50"`
+	CompanyName *string        `json:"companyname,omitempty" gorm:"column:companyname" validate:"omitempty,max=100"`
+	Profession  *string        `json:"profession,omitempty" gorm:"column:profession" validate:"omitempty,max=50"`
+	Version     int            `json:"version" gorm:"column:version;not null;default:1"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at" gorm:"column:deleted_at" swaggertype:"string" format:"date-time"`
 }
 
 type CondType string
@@ -94,16 +193,62 @@ const (
 	CondTypeUsed CondType = "used"
 )
 
+type CarStatus string
+const (
+	CarStatusInStock        CarStatus = "in_stock"
+	CarStatusReserved       CarStatus = "reserved"
+	CarStatusSold           CarStatus = "sold"
+	CarStatusReconditioning CarStatus = "in_reconditioning"
+	CarStatusInTransit      CarStatus = "in_transit"
+	CarStatusDelivered      CarStatus = "delivered"
+	CarStatusWrittenOff     CarStatus = "written_off"
+)
+
+// carStatusTransitions is the lifecycle graph of a vehicle: the statuses reachable from each status
+var carStatusTransitions = map[CarStatus][]CarStatus{
+	CarStatusInStock:        {CarStatusReserved, CarStatusReconditioning, CarStatusInTransit, CarStatusWrittenOff},
+	CarStatusInTransit:      {CarStatusInStock, CarStatusWrittenOff},
+	CarStatusReconditioning: {CarStatusInStock, CarStatusWrittenOff},
+	CarStatusReserved:       {CarStatusInStock, CarStatusSold},
+	CarStatusSold:           {CarStatusDelivered},
+	CarStatusDelivered:      {},
+	CarStatusWrittenOff:     {},
+}
+
+// CanTransitionTo reports whether the lifecycle graph allows moving from s to next
+func (s CarStatus) CanTransitionTo(next CarStatus) bool {
+	for _, allowed := range carStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsInitial reports whether a car may enter the car park with this status
+func (s CarStatus) IsInitial() bool {
+	return s == CarStatusInStock || s == CarStatusInTransit || s == CarStatusReconditioning
+}
+
+// IsDeletable reports whether a car with this status may be removed from the car park.
+// Reserved, sold and delivered cars are part of the sales history and must be kept.
+func (s CarStatus) IsDeletable() bool {
+	return s != CarStatusReserved && s != CarStatusSold && s != CarStatusDelivered
+}
+
 type CarPark struct {
-	ID_Car        int      `json:"id_car" gorm:"primaryKey;autoIncrement"`
-	VIN           *string  `json:"vin,omitempty" gorm:"column:vin;unique" validate:"omitempty,alphanum,len=17"`
-	ID_Dealership int      `json:"id_dealership" gorm:"column:id_dealership;not null" validate:"required"`
-	Brand         string   `json:"brand" gorm:"column:brand;not null" validate:"required,max=30"`
-	Model         string   `json:"model" gorm:"column:model;not null" validate:"required,max=30"`
-	Condition     CondType `json:"condition" gorm:"column:condition;not null;default:new" validate:"required,oneof=new used"`
-	Year          int      `json:"year" gorm:"column:year;not null" validate:"required,min=1901"`
-	KM            string   `json:"km" gorm:"column:km;not null;default:'0'" validate:"required,max=7"`
-	Plate         string   `json:"plate" gorm:"column:plate;unique;not null" validate:"required,max=10"`
+	ID_Car        int            `json:"id_car" gorm:"primaryKey;autoIncrement"`
+	VIN           *string        `json:"vin,omitempty" gorm:"column:vin;unique" validate:"omitempty,alphanum,len=17"`
+	ID_Dealership int            `json:"id_dealership" gorm:"column:id_dealership;not null" validate:"required"`
+	Brand         string         `json:"brand" gorm:"column:brand;not null" validate:"required,max=30"`
+	Model         string         `json:"model" gorm:"column:model;not null" validate:"required,max=30"`
+	Condition     CondType       `json:"condition" gorm:"column:condition;not null;default:new" validate:"required,oneof=new used"`
+	Year          int            `json:"year" gorm:"column:year;not null" validate:"required,min=1901"`
+	KM            string         `json:"km" gorm:"column:km;not null;default:'0'" validate:"required,max=7"`
+	Plate         string         `json:"plate" gorm:"column:plate;unique;not null" validate:"required,max=10"`
+	Status        CarStatus      `json:"status" gorm:"column:status;not null;default:in_stock" validate:"omitempty,oneof=in_stock reserved sold in_reconditioning in_transit delivered written_off"`
+	Version       int            `json:"version" gorm:"column:version;not null;default:1"`
+	DeletedAt     gorm.DeletedAt `json:"deleted_at" gorm:"column:deleted_at" swaggertype:"string" format:"date-time"`
 }
 
 type OrderStatus string
@@ -114,6 +259,29 @@ const (
 	OrderStatusInProgress OrderStatus = "in_progress"
 )
 
+// orderStatusTransitions is the order state machine: the statuses reachable from each status
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:    {OrderStatusInProgress, OrderStatusCancelled},
+	OrderStatusInProgress: {OrderStatusCompleted, OrderStatusCancelled},
+	OrderStatusCompleted:  {},
+	OrderStatusCancelled:  {},
+}
+
+// CanTransitionTo reports whether the order state machine allows moving from s to next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether an order in this status holds a reservation on its car
+func (s OrderStatus) IsActive() bool {
+	return s == OrderStatusPending || s == OrderStatusInProgress
+}
+
 type Order struct {
 	ID_Order      int         `json:"id_order" gorm:"primaryKey;autoIncrement"`
 	Status        OrderStatus `json:"status" gorm:"column:status;not null;default:pending" validate:"required,oneof=pending completed cancelled in_progress"`
@@ -122,21 +290,267 @@ type Order struct {
 	VIN           string      `json:"vin" gorm:"column:vin;not null" validate:"required,alphanum,len=17"`
 	ID_Dealership int         `json:"id_dealership" gorm:"column:id_dealership;not null" validate:"required"`
 	LastUpdate    time.Time   `json:"last_update" gorm:"column:last_update;not null;default:CURRENT_TIMESTAMP"`
+	Version       int         `json:"version" gorm:"column:version;not null;default:1"`
+	// StatusReason is an optional note stored in the order history when the status changes
+	StatusReason *string `json:"status_reason,omitempty" gorm:"-" validate:"omitempty,max=255"`
 }
 
+// OrderStatusChange is one entry of an order's status history.
+// FromStatus is nil for the entry written when the order is created.
+type OrderStatusChange struct {
+	ID_Change   int          `json:"id_change" gorm:"primaryKey;autoIncrement"`
+	ID_Order    int          `json:"id_order" gorm:"column:id_order;not null"`
+	FromStatus  *OrderStatus `json:"from_status" gorm:"column:from_status"`
+	ToStatus    OrderStatus  `json:"to_status" gorm:"column:to_status;not null"`
+	ID_Employee *int         `json:"id_employee" gorm:"column:id_employee"`
+	Reason      *string      `json:"reason,omitempty" gorm:"column:reason"`
+	ChangedAt   time.Time    `json:"changed_at" gorm:"column:changed_at;not null;default:CURRENT_TIMESTAMP"`
+}
+
+// Bounds of an appointment's length, in minutes
+const (
+	DefaultAppointmentMinutes = 30
+	MinAppointmentMinutes     = 5
+	MaxAppointmentMinutes     = 480
+)
+
 type Appointment struct {
-	ID_Appointment int       `json:"id_appointment" gorm:"primaryKey;autoIncrement"`
-	ID_Client      int       `json:"id_client" gorm:"column:id_client;not null" validate:"required"`
-	ID_Employee    int       `json:"id_employee" gorm:"column:id_employee;not null" validate:"required"`
-	ID_Dealership  int       `json:"id_dealership" gorm:"column:id_dealership;not null" validate:"required"`
-	Date           time.Time `json:"date" gorm:"column:date;not null" validate:"required"`
-	Reason         string    `json:"reason" gorm:"column:reason;not null" validate:"required,max=100"`
-	Notes          *string   `json:"notes,omitempty" gorm:"column:notes"`
+	ID_Appointment  int       `json:"id_appointment" gorm:"primaryKey;autoIncrement"`
+	ID_Client       int       `json:"id_client" gorm:"column:id_client;not null" validate:"required"`
+	ID_Employee     int       `json:"id_employee" gorm:"column:id_employee;not null" validate:"required"`
+	ID_Dealership   int       `json:"id_dealership" gorm:"column:id_dealership;not null" validate:"required"`
+	Date            time.Time `json:"date" gorm:"column:date;not null" validate:"required"`
+	DurationMinutes int       `json:"duration_minutes" gorm:"column:duration_minutes;not null;default:30" validate:"omitempty,min=5,max=480"`
+	VIN             *string   `json:"vin,omitempty" gorm:"column:vin" validate:"omitempty,alphanum,len=17"`
+	Reason          string    `json:"reason" gorm:"column:reason;not null" validate:"required,max=100"`
+	Notes           *string   `json:"notes,omitempty" gorm:"column:notes"`
+	Version         int       `json:"version" gorm:"column:version;not null;default:1"`
+}
+
+// End returns the time at which the appointment finishes
+func (a *Appointment) End() time.Time {
+	minutes := a.DurationMinutes
+	if minutes == 0 {
+		minutes = DefaultAppointmentMinutes
+	}
+	return a.Date.Add(time.Duration(minutes) * time.Minute)
+}
+
+// AuditAction is the kind of change recorded by an audit entry
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+)
+
+// AuditEntry records one create, update or delete of a record. ID_Employee is the employee who
+// made the change, nil for changes made by the system, and RequestID the HTTP request it came from.
+type AuditEntry struct {
+	ID_Audit    int         `json:"id_audit" gorm:"primaryKey;autoIncrement"`
+	Entity      string      `json:"entity" gorm:"column:entity;not null"`
+	EntityID    int         `json:"entity_id" gorm:"column:entity_id;not null"`
+	Action      AuditAction `json:"action" gorm:"column:action;not null"`
+	ID_Employee *int        `json:"id_employee" gorm:"column:id_employee"`
+	RequestID   *string     `json:"request_id,omitempty" gorm:"column:request_id"`
+	Diff        AuditDiff   `json:"diff" gorm:"column:diff;not null"`
+	ChangedAt   time.Time   `json:"changed_at" gorm:"column:changed_at;not null;default:CURRENT_TIMESTAMP"`
+}
+
+// AuditDiff maps the JSON name of each field a change touched to its values before and after.
+// A create has no before values and a delete no after values.
+type AuditDiff map[string]AuditChange
+
+// AuditChange is the value of a field before and after a change
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// Value stores the diff as JSONB
+func (d AuditDiff) Value() (driver.Value, error) {
+	return json.Marshal(d)
+}
+
+// Scan reads the diff from a JSONB column
+func (d *AuditDiff) Scan(src any) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, d)
+	case string:
+		return json.Unmarshal([]byte(src), d)
+	default:
+		return fmt.Errorf("cannot scan %T into AuditDiff", src)
+	}
+}
+
+// EventType names a domain event, as "<entity>.<what happened>"
+type EventType string
+
+const (
+	EventOrderCreated           EventType = "order.created"
+	EventOrderStatusChanged     EventType = "order.status_changed"
+	EventOrderCompleted         EventType = "order.completed" // Written along with order.status_changed
+	EventOrderCancelled         EventType = "order.cancelled" // Written along with order.status_changed
+	EventAppointmentBooked      EventType = "appointment.booked"
+	EventAppointmentRescheduled EventType = "appointment.rescheduled"
+	EventAppointmentCancelled   EventType = "appointment.cancelled"
+	EventCarCreated             EventType = "car.created"
+	EventCarUpdated             EventType = "car.updated"
+	EventCarStatusChanged       EventType = "car.status_changed"
+	EventCarDeleted             EventType = "car.deleted"
+	EventCarRestored            EventType = "car.restored"
+)
+
+// EventStatus is the delivery state of an outbox event
+type EventStatus string
+
+const (
+	EventPending   EventStatus = "pending"
+	EventDelivered EventStatus = "delivered"
+	EventDead      EventStatus = "dead" // Gave up after too many failed attempts
+)
+
+// OutboxEvent is a domain event stored in the same transaction as the change it describes,
+// waiting to be delivered to the notifier. Payload holds the record as the API returns it,
+// plus whatever the event adds, e.g. the previous status of an order. ID_Dealership is the
+// dealership of that record, and ID_Event the position of the event in the event stream.
+type OutboxEvent struct {
+	ID_Event      int          `json:"id_event" gorm:"primaryKey;autoIncrement"`
+	EventType     EventType    `json:"event_type" gorm:"column:event_type;not null"`
+	Entity        string       `json:"entity" gorm:"column:entity;not null"`
+	EntityID      int          `json:"entity_id" gorm:"column:entity_id;not null"`
+	ID_Dealership *int         `json:"id_dealership,omitempty" gorm:"column:id_dealership"`
+	Payload       EventPayload `json:"payload" gorm:"column:payload;not null"`
+	Status        EventStatus  `json:"status" gorm:"column:status;not null;default:pending"`
+	Attempts      int          `json:"attempts" gorm:"column:attempts;not null;default:0"`
+	NextAttemptAt time.Time    `json:"next_attempt_at" gorm:"column:next_attempt_at;not null;default:CURRENT_TIMESTAMP"`
+	LastError     *string      `json:"last_error,omitempty" gorm:"column:last_error"`
+	CreatedAt     time.Time    `json:"created_at" gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`
+	DeliveredAt   *time.Time   `json:"delivered_at,omitempty" gorm:"column:delivered_at"`
+	// Horizon is the first transaction ID not yet assigned when the event took its ID, see OutboxWatermark
+	Horizon int64 `json:"-" gorm:"column:horizon;not null"`
+}
+
+// EventPayload is the JSON object carried by an event
+type EventPayload map[string]any
+
+// Value stores the payload as JSONB
+func (p EventPayload) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+// Scan reads the payload from a JSONB column
+func (p *EventPayload) Scan(src any) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, p)
+	case string:
+		return json.Unmarshal([]byte(src), p)
+	default:
+		return fmt.Errorf("cannot scan %T into EventPayload", src)
+	}
+}
+
+// Webhook is the subscription of an external system to some types of domain event, which are POSTed
+// to URL signed with Secret. Secret is generated by the server and never serialized; deliveries to
+// a paused webhook are queued until it is resumed.
+type Webhook struct {
+	ID_Webhook  int        `json:"id_webhook" gorm:"primaryKey;autoIncrement"`
+	URL         string     `json:"url" gorm:"column:url;not null" validate:"required,http_url,max=2048"`
+	Secret      string     `json:"-" gorm:"column:secret;not null"`
+	EventTypes  EventTypes `json:"event_types" gorm:"column:event_types;not null" validate:"required,min=1,dive,oneof=order.created order.status_changed order.completed order.cancelled appointment.booked appointment.rescheduled appointment.cancelled car.created car.updated car.status_changed car.deleted car.restored"`
+	Description *string    `json:"description,omitempty" gorm:"column:description" validate:"omitempty,max=255"`
+	Paused      bool       `json:"paused" gorm:"column:paused;not null;default:false"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`
+	Version     int        `json:"version" gorm:"column:version;not null;default:1"`
+}
+
+// Subscribes reports whether the webhook receives events of the given type
+func (w *Webhook) Subscribes(eventType EventType) bool {
+	return slices.Contains(w.EventTypes, eventType)
+}
+
+// EventTypes is a list of event types, stored as a JSONB array
+type EventTypes []EventType
+
+// Value stores the list as JSONB
+func (t EventTypes) Value() (driver.Value, error) {
+	return json.Marshal(t)
+}
+
+// Scan reads the list from a JSONB column
+func (t *EventTypes) Scan(src any) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, t)
+	case string:
+		return json.Unmarshal([]byte(src), t)
+	default:
+		return fmt.Errorf("cannot scan %T into EventTypes", src)
+	}
+}
+
+// WebhookDelivery is one event queued for one webhook. ResponseStatus is the HTTP status of the last
+// attempt, nil if none got a response. Redelivering an event queues a new delivery, so each one
+// keeps the outcome of its own attempts.
+type WebhookDelivery struct {
+	ID_Delivery    int         `json:"id_delivery" gorm:"primaryKey;autoIncrement"`
+	ID_Webhook     int         `json:"id_webhook" gorm:"column:id_webhook;not null"`
+	ID_Event       int         `json:"id_event" gorm:"column:id_event;not null"`
+	EventType      EventType   `json:"event_type" gorm:"column:event_type;not null"`
+	Status         EventStatus `json:"status" gorm:"column:status;not null;default:pending"`
+	Attempts       int         `json:"attempts" gorm:"column:attempts;not null;default:0"`
+	NextAttemptAt  time.Time   `json:"next_attempt_at" gorm:"column:next_attempt_at;not null;default:CURRENT_TIMESTAMP"`
+	ResponseStatus *int        `json:"response_status,omitempty" gorm:"column:response_status"`
+	LastError      *string     `json:"last_error,omitempty" gorm:"column:last_error"`
+	CreatedAt      time.Time   `json:"created_at" gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`
+	DeliveredAt    *time.Time  `json:"delivered_at,omitempty" gorm:"column:delivered_at"`
+}
+
+// IdempotencyKey is the response stored for a POST request sent with an Idempotency-Key header.
+// A key is scoped to the route and the employee that used it; StatusCode is nil while the first
+// request is still being processed.
+type IdempotencyKey struct {
+	Key         string    `gorm:"column:idempotency_key;primaryKey"`
+	Route       string    `gorm:"column:route;primaryKey"`
+	ID_Employee int       `gorm:"column:id_employee;primaryKey"`
+	RequestHash string    `gorm:"column:request_hash;not null"`
+	StatusCode  *int      `gorm:"column:status_code"`
+	ContentType *string   `gorm:"column:content_type"`
+	Body        *string   `gorm:"column:body"`
+	Created     time.Time `gorm:"column:created;not null;default:CURRENT_TIMESTAMP"`
 }
 
 func (Employee) TableName() string {
 	return "employee"
 }
+func (EmployeeCredential) TableName() string {
+	return "employee_credential"
+}
+func (OpeningHours) TableName() string {
+	return "opening_hours"
+}
+func (Closure) TableName() string {
+	return "dealership_closure"
+}
+func (IdempotencyKey) TableName() string {
+	return "idempotency_key"
+}
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
+func (OutboxEvent) TableName() string {
+	return "outbox_event"
+}
+func (Webhook) TableName() string {
+	return "webhook"
+}
+func (WebhookDelivery) TableName() string {
+	return "webhook_delivery"
+}
 func (Employment) TableName() string {
 	return "employment"
 }
@@ -149,6 +563,9 @@ func (CarPark) TableName() string {
 func (Order) TableName() string {
 	return "order"
 }
+func (OrderStatusChange) TableName() string {
+	return "order_status_history"
+}
 func (Appointment) TableName() string {
 	return "appointment"
 }
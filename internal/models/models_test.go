@@ -0,0 +1,61 @@
+package models
+
+import "testing"
+
+func TestCarStatusTransitions(t *testing.T) {
+	testCases := []struct {
+		from, to CarStatus
+		want     bool
+	}{
+		{CarStatusInStock, CarStatusReserved, true},
+		{CarStatusInStock, CarStatusSold, false},
+		{CarStatusReserved, CarStatusSold, true},
+		{CarStatusReserved, CarStatusInStock, true},
+		{CarStatusSold, CarStatusDelivered, true},
+		{CarStatusSold, CarStatusInStock, false},
+		{CarStatusInTransit, CarStatusInStock, true},
+		{CarStatusReconditioning, CarStatusReserved, false},
+		{CarStatusDelivered, CarStatusInStock, false},
+		{CarStatusWrittenOff, CarStatusInStock, false},
+		{CarStatusInStock, CarStatusInStock, false},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.from.CanTransitionTo(tc.to); got != tc.want {
+			t.Errorf("%s -> %s: got %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
+
+func TestCarStatusGuards(t *testing.T) {
+	for _, status := range []CarStatus{CarStatusReserved, CarStatusSold, CarStatusDelivered} {
+		if status.IsDeletable() {
+			t.Errorf("%s car should not be deletable", status)
+		}
+	}
+	if !CarStatusInStock.IsDeletable() {
+		t.Errorf("in_stock car should be deletable")
+	}
+}
+
+func TestOrderStatusTransitions(t *testing.T) {
+	testCases := []struct {
+		from, to OrderStatus
+		want     bool
+	}{
+		{OrderStatusPending, OrderStatusInProgress, true},
+		{OrderStatusPending, OrderStatusCancelled, true},
+		{OrderStatusPending, OrderStatusCompleted, false},
+		{OrderStatusInProgress, OrderStatusCompleted, true},
+		{OrderStatusInProgress, OrderStatusCancelled, true},
+		{OrderStatusInProgress, OrderStatusPending, false},
+		{OrderStatusCompleted, OrderStatusCancelled, false},
+		{OrderStatusCancelled, OrderStatusPending, false},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.from.CanTransitionTo(tc.to); got != tc.want {
+			t.Errorf("%s -> %s: got %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Package outbox delivers the domain events stored by storage.OutboxStore: Dispatcher sends every event
+// to the notifier service and WebhookDispatcher sends the deliveries queued for webhooks, signed.
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultBatchSize    = 50
+	defaultPollInterval = 2 * time.Second
+	defaultMaxAttempts  = 10
+	defaultBaseDelay    = 5 * time.Second
+	defaultMaxDelay     = 30 * time.Minute
+	defaultTimeout      = 10 * time.Second
+
+	// EventIDHeader carries the ID of the event, so that the receiver can drop the duplicates
+	// that at-least-once delivery produces when a response is lost
+	EventIDHeader = "X-Keeper-Event-ID"
+)
+
+// Notification is the body POSTed to the notifier for each event
+type Notification struct {
+	ID         int              `json:"id"`
+	Type       models.EventType `json:"type"`
+	Entity     string           `json:"entity"`
+	EntityID   int              `json:"entity_id"`
+	OccurredAt time.Time        `json:"occurred_at"`
+	Data       map[string]any   `json:"data"`
+}
+
+// Dispatcher polls the outbox and POSTs each due event to the notifier as a Notification.
+// A 2xx response delivers the event. Network errors, timeouts, 5xx, 408 and 429 are retried with
+// exponential backoff until MaxAttempts, and any other response dead-letters the event at once, as
+// sending it again cannot succeed. Several dispatchers can share an outbox: each event is claimed
+// by one at a time. Events are delivered at least once and, when retried, not necessarily in order.
+type Dispatcher struct {
+	settings
+	store storage.Store
+	url   string
+}
+
+// settings are the delivery settings shared by both dispatchers
+type settings struct {
+	client *http.Client
+
+	batchSize    int
+	pollInterval time.Duration
+	maxAttempts  int
+	baseDelay    time.Duration // Delay before the first retry, doubled for each further one
+	maxDelay     time.Duration
+}
+
+// Option configures optional settings of a dispatcher
+type Option func(*settings)
+
+// WithHTTPClient sets the client used to call the receiver; its Timeout bounds each delivery
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *settings) {
+		s.client = client
+	}
+}
+
+// WithPollInterval sets how long the dispatcher waits before looking for new events once the outbox is drained
+func WithPollInterval(interval time.Duration) Option {
+	return func(s *settings) {
+		s.pollInterval = interval
+	}
+}
+
+// WithMaxAttempts sets how many failed deliveries dead-letter an event
+func WithMaxAttempts(attempts int) Option {
+	return func(s *settings) {
+		s.maxAttempts = attempts
+	}
+}
+
+// WithBackoff sets the delay before the first retry and the longest delay between two attempts
+func WithBackoff(base, max time.Duration) Option {
+	return func(s *settings) {
+		s.baseDelay = base
+		s.maxDelay = max
+	}
+}
+
+func newSettings(opts []Option) settings {
+	s := settings{
+		client: &http.Client{Timeout: defaultTimeout},
+
+		batchSize:    defaultBatchSize,
+		pollInterval: defaultPollInterval,
+		maxAttempts:  defaultMaxAttempts,
+		baseDelay:    defaultBaseDelay,
+		maxDelay:     defaultMaxDelay,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// NewDispatcher returns a dispatcher delivering the events of store to the notifier at url
+func NewDispatcher(store storage.Store, url string, opts ...Option) *Dispatcher {
+	return &Dispatcher{settings: newSettings(opts), store: store, url: url}
+}
+
+// Run delivers events until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	log.Println("delivering outbox events to", d.url)
+	d.run(ctx, "outbox events", d.DispatchOnce)
+}
+
+// run calls dispatchOnce until ctx is done, pausing whenever a batch is not full
+func (s *settings) run(ctx context.Context, what string, dispatchOnce func(ctx context.Context) (int, error)) {
+	for {
+		claimed, err := dispatchOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("dispatching %s: %v", what, err)
+		}
+		// A full batch suggests more events are waiting
+		if err == nil && claimed == s.batchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.pollInterval):
+		}
+	}
+}
+
+// lease is how long a claimed batch is hidden from other dispatchers: until it has certainly been dealt with
+func (s *settings) lease() time.Duration {
+	return s.client.Timeout*time.Duration(s.batchSize) + time.Minute
+}
+
+// DispatchOnce claims one batch of due events, delivers them and returns how many there were
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	events, err := d.store.ClaimOutboxEvents(ctx, d.batchSize, d.lease())
+	if err != nil {
+		return 0, err
+	}
+	for _, event := range events {
+		if err := d.dispatch(ctx, event); err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+// dispatch delivers one event and records the outcome
+func (d *Dispatcher) dispatch(ctx context.Context, event *models.OutboxEvent) error {
+	body, err := json.Marshal(NewNotification(event))
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set(EventIDHeader, strconv.Itoa(event.ID_Event))
+	_, err = d.post(ctx, "notifier", d.url, header, body)
+
+	var permanent *permanentError
+	switch {
+	case err == nil:
+		return d.store.MarkOutboxEventDelivered(ctx, event.ID_Event)
+	case ctx.Err() != nil:
+		// Shutting down: the lease expires and another attempt is made later
+		return ctx.Err()
+	case errors.As(err, &permanent) || event.Attempts >= d.maxAttempts:
+		log.Printf("dead-lettering %s event %d after %d attempts: %v", event.EventType, event.ID_Event, event.Attempts, err)
+		return d.store.DeadLetterOutboxEvent(ctx, event.ID_Event, err.Error())
+	default:
+		return d.store.RetryOutboxEvent(ctx, event.ID_Event, err.Error(), d.retryDelay(event.Attempts))
+	}
+}
+
+// NewNotification returns the Notification of an event, which is also the data of the event stream
+func NewNotification(event *models.OutboxEvent) Notification {
+	return Notification{
+		ID:         event.ID_Event,
+		Type:       event.EventType,
+		Entity:     event.Entity,
+		EntityID:   event.EntityID,
+		OccurredAt: event.CreatedAt,
+		Data:       event.Payload,
+	}
+}
+
+// retryDelay is the wait after the given number of failed attempts: baseDelay doubled for each, up to maxDelay
+func (s *settings) retryDelay(attempts int) time.Duration {
+	delay := s.baseDelay
+	for i := 1; i < attempts && delay < s.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, s.maxDelay)
+}
+
+// permanentError is a response that the same request will get again
+type permanentError struct {
+	receiver string
+	status   int
+}
+
+func (e *permanentError) Error() string {
+	return fmt.Sprintf("%s rejected the event with %d %s", e.receiver, e.status, http.StatusText(e.status))
+}
+
+// post sends body as JSON with the given headers and returns the status of the response, 0 if there
+// was none. The error is nil for a 2xx response, a *permanentError for a response not worth retrying,
+// and any other error for a failure that may not happen again.
+func (s *settings) post(ctx context.Context, receiver, url string, header http.Header, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) // Lets the connection be reused
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, nil
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return resp.StatusCode, fmt.Errorf("%s responded %s", receiver, resp.Status)
+	default:
+		return resp.StatusCode, &permanentError{receiver: receiver, status: resp.StatusCode}
+	}
+}
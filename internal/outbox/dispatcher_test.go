@@ -0,0 +1,167 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// notifier is a test receiver answering each request with the next of its statuses,
+// repeating the last one, and recording what it received
+type notifier struct {
+	mu       sync.Mutex
+	statuses []int
+	received []Notification
+	ids      []string
+}
+
+func (n *notifier) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var notification Notification
+	json.NewDecoder(r.Body).Decode(&notification)
+	n.received = append(n.received, notification)
+	n.ids = append(n.ids, r.Header.Get(EventIDHeader))
+
+	status := n.statuses[0]
+	if len(n.statuses) > 1 {
+		n.statuses = n.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newEvent(t *testing.T, store storage.Store) *models.OutboxEvent {
+	t.Helper()
+	event := &models.OutboxEvent{EventType: models.EventOrderCreated, Entity: storage.AuditOrder, EntityID: 7, Payload: models.EventPayload{"status": "pending"}}
+	if err := store.CreateOutboxEvent(context.Background(), event); err != nil {
+		t.Fatalf("CreateOutboxEvent: %v", err)
+	}
+	return event
+}
+
+func eventStatus(t *testing.T, store storage.Store, id int) *models.OutboxEvent {
+	t.Helper()
+	page, err := store.ListOutboxEvents(context.Background(), &storage.ListQuery{
+		Filters: []storage.Filter{{Field: "id_event", Op: storage.OpEq, Value: id}},
+	})
+	if err != nil || len(page.Items) != 1 {
+		t.Fatalf("ListOutboxEvents: %v, %v", page, err)
+	}
+	return page.Items[0]
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+	newDispatcher := func(n *notifier, opts ...Option) (*Dispatcher, storage.Store) {
+		server := httptest.NewServer(n)
+		t.Cleanup(server.Close)
+		store := storage.NewMemoryStore()
+		// No backoff, so that retried events are due again straight away
+		opts = append([]Option{WithBackoff(0, 0)}, opts...)
+		return NewDispatcher(store, server.URL, opts...), store
+	}
+
+	t.Run("it delivers events", func(t *testing.T) {
+		n := &notifier{statuses: []int{http.StatusOK}}
+		d, store := newDispatcher(n)
+		event := newEvent(t, store)
+
+		if claimed, err := d.DispatchOnce(ctx); err != nil || claimed != 1 {
+			t.Fatalf("DispatchOnce = %d, %v, want 1 event", claimed, err)
+		}
+		if got := eventStatus(t, store, event.ID_Event); got.Status != models.EventDelivered || got.DeliveredAt == nil {
+			t.Errorf("event after delivery = %+v", got)
+		}
+		if len(n.received) != 1 {
+			t.Fatalf("notifier received %d requests, want 1", len(n.received))
+		}
+		if got := n.received[0]; got.ID != event.ID_Event || got.Type != models.EventOrderCreated || got.EntityID != 7 || got.Data["status"] != "pending" {
+			t.Errorf("notification = %+v", got)
+		}
+		if n.ids[0] != strconv.Itoa(event.ID_Event) {
+			t.Errorf("%s = %q, want %d", EventIDHeader, n.ids[0], event.ID_Event)
+		}
+		if claimed, err := d.DispatchOnce(ctx); err != nil || claimed != 0 {
+			t.Errorf("DispatchOnce after delivery = %d, %v, want nothing to do", claimed, err)
+		}
+	})
+
+	t.Run("it retries server errors", func(t *testing.T) {
+		n := &notifier{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}}
+		d, store := newDispatcher(n)
+		event := newEvent(t, store)
+
+		for i := 0; i < 3; i++ {
+			if _, err := d.DispatchOnce(ctx); err != nil {
+				t.Fatalf("DispatchOnce: %v", err)
+			}
+		}
+		if got := eventStatus(t, store, event.ID_Event); got.Status != models.EventDelivered || got.Attempts != 3 {
+			t.Errorf("event after two failures = %+v, want delivered on the third attempt", got)
+		}
+	})
+
+	t.Run("it dead-letters after too many attempts", func(t *testing.T) {
+		n := &notifier{statuses: []int{http.StatusInternalServerError}}
+		d, store := newDispatcher(n, WithMaxAttempts(2))
+		event := newEvent(t, store)
+
+		for i := 0; i < 3; i++ {
+			if _, err := d.DispatchOnce(ctx); err != nil {
+				t.Fatalf("DispatchOnce: %v", err)
+			}
+		}
+		got := eventStatus(t, store, event.ID_Event)
+		if got.Status != models.EventDead || got.Attempts != 2 || got.LastError == nil {
+			t.Errorf("event = %+v, want dead after 2 attempts", got)
+		}
+		if len(n.received) != 2 {
+			t.Errorf("notifier received %d requests, want 2", len(n.received))
+		}
+	})
+
+	t.Run("it dead-letters rejected events at once", func(t *testing.T) {
+		n := &notifier{statuses: []int{http.StatusBadRequest}}
+		d, store := newDispatcher(n)
+		event := newEvent(t, store)
+
+		if _, err := d.DispatchOnce(ctx); err != nil {
+			t.Fatalf("DispatchOnce: %v", err)
+		}
+		if got := eventStatus(t, store, event.ID_Event); got.Status != models.EventDead || got.Attempts != 1 {
+			t.Errorf("event = %+v, want dead after 1 attempt", got)
+		}
+	})
+
+	t.Run("it retries unreachable notifiers", func(t *testing.T) {
+		store := storage.NewMemoryStore()
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		d := NewDispatcher(store, server.URL, WithBackoff(time.Minute, time.Hour))
+		event := newEvent(t, store)
+
+		if _, err := d.DispatchOnce(ctx); err != nil {
+			t.Fatalf("DispatchOnce: %v", err)
+		}
+		got := eventStatus(t, store, event.ID_Event)
+		if got.Status != models.EventPending || got.LastError == nil || !got.NextAttemptAt.After(time.Now().Add(30*time.Second)) {
+			t.Errorf("event = %+v, want pending until the backoff expires", got)
+		}
+	})
+}
+
+func TestRetryDelay(t *testing.T) {
+	d := NewDispatcher(nil, "", WithBackoff(time.Second, 10*time.Second))
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 50: 10 * time.Second} {
+		if got := d.retryDelay(attempts); got != want {
+			t.Errorf("retryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
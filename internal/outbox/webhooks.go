@@ -0,0 +1,178 @@
+package outbox
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// EventTypeHeader carries the type of the event, so that receivers can route it without parsing the body
+	EventTypeHeader = "X-Keeper-Event-Type"
+	// DeliveryIDHeader carries the ID of the delivery, which names the attempt in the delivery history
+	DeliveryIDHeader = "X-Keeper-Delivery-ID"
+	// SignatureHeader carries "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>" keyed with the secret>"
+	SignatureHeader = "X-Keeper-Signature"
+
+	secretPrefix = "whsec_"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredSignature = errors.New("webhook signature timestamp is outside the tolerance")
+)
+
+// NewSecret returns a random webhook secret
+func NewSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return secretPrefix + hex.EncodeToString(key), nil
+}
+
+// Sign returns the SignatureHeader value of body sent at time t
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac(secret, timestamp, body)))
+}
+
+// VerifySignature checks the SignatureHeader value of a received body, which receivers should do before
+// trusting it. A signature made more than tolerance away from now is rejected, so that a captured request
+// cannot be replayed later on.
+func VerifySignature(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			timestamp = value
+		case "v1":
+			if signature, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	expected := mac(secret, timestamp, body)
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+				return ErrExpiredSignature
+			}
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func mac(secret, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// WebhookDispatcher POSTs the deliveries queued for webhooks, each as the Notification of its event
+// signed with the secret of its webhook. Responses are handled like those of the notifier, and the
+// outcome of each attempt is recorded on the delivery.
+type WebhookDispatcher struct {
+	settings
+	store storage.Store
+}
+
+// NewWebhookDispatcher returns a dispatcher delivering the webhook deliveries of store
+func NewWebhookDispatcher(store storage.Store, opts ...Option) *WebhookDispatcher {
+	return &WebhookDispatcher{settings: newSettings(opts), store: store}
+}
+
+// Run delivers webhooks until ctx is done
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	log.Println("delivering webhooks")
+	d.run(ctx, "webhooks", d.DispatchOnce)
+}
+
+// DispatchOnce claims one batch of due deliveries, sends them and returns how many there were
+func (d *WebhookDispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	deliveries, err := d.store.ClaimWebhookDeliveries(ctx, d.batchSize, d.lease())
+	if err != nil {
+		return 0, err
+	}
+	for _, delivery := range deliveries {
+		if err := d.dispatch(ctx, delivery); err != nil {
+			return len(deliveries), err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// dispatch sends one delivery and records the outcome. A delivery whose webhook or event has been
+// deleted since the claim is not sent, so that it does not hold up the rest of the batch.
+func (d *WebhookDispatcher) dispatch(ctx context.Context, delivery *models.WebhookDelivery) error {
+	webhook, err := d.store.GetWebhookByID(ctx, delivery.ID_Webhook)
+	if errors.Is(err, storage.ErrNotFound) {
+		// Deleted since the claim, along with its deliveries
+		log.Printf("skipping webhook delivery %d: webhook %d was deleted", delivery.ID_Delivery, delivery.ID_Webhook)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	event, err := d.store.GetOutboxEventByID(ctx, delivery.ID_Event)
+	if errors.Is(err, storage.ErrNotFound) {
+		err = d.store.DeadLetterWebhookDelivery(ctx, delivery.ID_Delivery, nil, fmt.Sprintf("event %d no longer exists", delivery.ID_Event))
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(NewNotification(event))
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set(EventIDHeader, strconv.Itoa(event.ID_Event))
+	header.Set(EventTypeHeader, string(event.EventType))
+	header.Set(DeliveryIDHeader, strconv.Itoa(delivery.ID_Delivery))
+	header.Set(SignatureHeader, Sign(webhook.Secret, time.Now(), body))
+	status, err := d.post(ctx, "webhook", webhook.URL, header, body)
+
+	var response *int
+	if status != 0 {
+		response = &status
+	}
+	var permanent *permanentError
+	switch {
+	case err == nil:
+		return d.store.MarkWebhookDeliveryDelivered(ctx, delivery.ID_Delivery, status)
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case errors.As(err, &permanent) || delivery.Attempts >= d.maxAttempts:
+		log.Printf("giving up webhook delivery %d to %s after %d attempts: %v", delivery.ID_Delivery, webhook.URL, delivery.Attempts, err)
+		return d.store.DeadLetterWebhookDelivery(ctx, delivery.ID_Delivery, response, err.Error())
+	default:
+		return d.store.RetryWebhookDelivery(ctx, delivery.ID_Delivery, response, err.Error(), d.retryDelay(delivery.Attempts))
+	}
+}
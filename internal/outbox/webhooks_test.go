@@ -0,0 +1,237 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a test webhook endpoint that verifies signatures, answering 401 to bad ones and
+// otherwise with the next of its statuses, repeating the last one
+type receiver struct {
+	secret string
+
+	mu       sync.Mutex
+	statuses []int
+	headers  []http.Header
+	verified []error
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	err := VerifySignature(rc.secret, r.Header.Get(SignatureHeader), body, 5*time.Minute, time.Now())
+	rc.headers = append(rc.headers, r.Header)
+	rc.verified = append(rc.verified, err)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	status := rc.statuses[0]
+	if len(rc.statuses) > 1 {
+		rc.statuses = rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newWebhook(t *testing.T, store storage.Store, url, secret string, types ...models.EventType) int {
+	t.Helper()
+	id, err := store.CreateWebhook(context.Background(), &models.Webhook{URL: url, Secret: secret, EventTypes: types})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	return id
+}
+
+func deliveries(t *testing.T, store storage.Store, webhookID int) []*models.WebhookDelivery {
+	t.Helper()
+	page, err := store.ListWebhookDeliveries(context.Background(), &storage.ListQuery{
+		Filters: []storage.Filter{{Field: "id_webhook", Op: storage.OpEq, Value: webhookID}},
+	})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	return page.Items
+}
+
+// deletingStore deletes a webhook right after deliveries are claimed, as an admin could
+type deletingStore struct {
+	storage.Store
+	webhookID int
+}
+
+func (s *deletingStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	claimed, err := s.Store.ClaimWebhookDeliveries(ctx, limit, lease)
+	if err != nil {
+		return nil, err
+	}
+	return claimed, s.DeleteWebhook(ctx, s.webhookID, 0)
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	ctx := context.Background()
+	setup := func(rc *receiver, opts ...Option) (*WebhookDispatcher, storage.Store, int) {
+		server := httptest.NewServer(rc)
+		t.Cleanup(server.Close)
+		store := storage.NewMemoryStore()
+		id := newWebhook(t, store, server.URL, rc.secret, models.EventOrderCreated)
+		opts = append([]Option{WithBackoff(0, 0)}, opts...)
+		return NewWebhookDispatcher(store, opts...), store, id
+	}
+
+	t.Run("it delivers signed events", func(t *testing.T) {
+		rc := &receiver{secret: "whsec_test", statuses: []int{http.StatusNoContent}}
+		d, store, webhookID := setup(rc)
+		event := newEvent(t, store)
+
+		if claimed, err := d.DispatchOnce(ctx); err != nil || claimed != 1 {
+			t.Fatalf("DispatchOnce = %d, %v, want 1 delivery", claimed, err)
+		}
+		if len(rc.verified) != 1 || rc.verified[0] != nil {
+			t.Fatalf("receiver verified %v, want one valid signature", rc.verified)
+		}
+		header := rc.headers[0]
+		if header.Get(EventIDHeader) != strconv.Itoa(event.ID_Event) || header.Get(EventTypeHeader) != string(models.EventOrderCreated) {
+			t.Errorf("headers = %v", header)
+		}
+		got := deliveries(t, store, webhookID)
+		if len(got) != 1 || got[0].Status != models.EventDelivered || got[0].ResponseStatus == nil || *got[0].ResponseStatus != http.StatusNoContent {
+			t.Fatalf("deliveries = %+v, want one delivered with 204", got)
+		}
+		if header.Get(DeliveryIDHeader) != strconv.Itoa(got[0].ID_Delivery) {
+			t.Errorf("%s = %q, want %d", DeliveryIDHeader, header.Get(DeliveryIDHeader), got[0].ID_Delivery)
+		}
+	})
+
+	t.Run("it only queues subscribed events", func(t *testing.T) {
+		rc := &receiver{secret: "whsec_test", statuses: []int{http.StatusOK}}
+		d, store, webhookID := setup(rc)
+		event := &models.OutboxEvent{EventType: models.EventAppointmentBooked, Entity: storage.AuditAppointment, EntityID: 1, Payload: models.EventPayload{}}
+		if err := store.CreateOutboxEvent(ctx, event); err != nil {
+			t.Fatalf("CreateOutboxEvent: %v", err)
+		}
+		if claimed, err := d.DispatchOnce(ctx); err != nil || claimed != 0 {
+			t.Errorf("DispatchOnce = %d, %v, want nothing to deliver", claimed, err)
+		}
+		if got := deliveries(t, store, webhookID); len(got) != 0 {
+			t.Errorf("deliveries = %+v, want none", got)
+		}
+	})
+
+	t.Run("it retries with the response status", func(t *testing.T) {
+		rc := &receiver{secret: "whsec_test", statuses: []int{http.StatusBadGateway, http.StatusOK}}
+		d, store, webhookID := setup(rc)
+		newEvent(t, store)
+
+		for range 2 {
+			if _, err := d.DispatchOnce(ctx); err != nil {
+				t.Fatalf("DispatchOnce: %v", err)
+			}
+		}
+		got := deliveries(t, store, webhookID)
+		if len(got) != 1 || got[0].Status != models.EventDelivered || got[0].Attempts != 2 || *got[0].ResponseStatus != http.StatusOK {
+			t.Errorf("deliveries = %+v, want delivered on the second attempt", got)
+		}
+	})
+
+	t.Run("it gives up on rejected deliveries", func(t *testing.T) {
+		rc := &receiver{secret: "whsec_test", statuses: []int{http.StatusOK}}
+		d, store, webhookID := setup(rc)
+		// The receiver expects another secret, so it rejects the signature
+		rc.secret = "whsec_rotated"
+		newEvent(t, store)
+
+		if _, err := d.DispatchOnce(ctx); err != nil {
+			t.Fatalf("DispatchOnce: %v", err)
+		}
+		got := deliveries(t, store, webhookID)
+		if len(got) != 1 || got[0].Status != models.EventDead || *got[0].ResponseStatus != http.StatusUnauthorized || got[0].LastError == nil {
+			t.Errorf("deliveries = %+v, want dead after a 401", got)
+		}
+	})
+
+	t.Run("it holds deliveries of paused webhooks", func(t *testing.T) {
+		rc := &receiver{secret: "whsec_test", statuses: []int{http.StatusOK}}
+		d, store, webhookID := setup(rc)
+		webhook, _ := store.GetWebhookByID(ctx, webhookID)
+		webhook.Paused = true
+		if err := store.UpdateWebhook(ctx, webhookID, webhook); err != nil {
+			t.Fatalf("UpdateWebhook: %v", err)
+		}
+		newEvent(t, store)
+
+		if claimed, err := d.DispatchOnce(ctx); err != nil || claimed != 0 {
+			t.Fatalf("DispatchOnce while paused = %d, %v, want nothing", claimed, err)
+		}
+		webhook, _ = store.GetWebhookByID(ctx, webhookID)
+		webhook.Paused = false
+		if err := store.UpdateWebhook(ctx, webhookID, webhook); err != nil {
+			t.Fatalf("UpdateWebhook: %v", err)
+		}
+		if claimed, err := d.DispatchOnce(ctx); err != nil || claimed != 1 {
+			t.Errorf("DispatchOnce once resumed = %d, %v, want the held delivery", claimed, err)
+		}
+	})
+
+	t.Run("it skips deliveries of webhooks deleted after the claim", func(t *testing.T) {
+		rc := &receiver{secret: "whsec_test", statuses: []int{http.StatusOK}}
+		_, store, deletedID := setup(rc)
+		server := httptest.NewServer(rc)
+		t.Cleanup(server.Close)
+		webhookID := newWebhook(t, store, server.URL, rc.secret, models.EventOrderCreated)
+		newEvent(t, store)
+
+		d := NewWebhookDispatcher(&deletingStore{Store: store, webhookID: deletedID}, WithBackoff(0, 0))
+		if claimed, err := d.DispatchOnce(ctx); err != nil || claimed != 2 {
+			t.Fatalf("DispatchOnce = %d, %v, want 2 deliveries and no error", claimed, err)
+		}
+		if got := deliveries(t, store, webhookID); len(got) != 1 || got[0].Status != models.EventDelivered {
+			t.Errorf("deliveries of the remaining webhook = %+v, want it delivered in the same batch", got)
+		}
+		if len(rc.verified) != 1 {
+			t.Errorf("receiver got %d requests, want only the remaining webhook's", len(rc.verified))
+		}
+	})
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	signedAt := time.Unix(1700000000, 0)
+	header := Sign("whsec_test", signedAt, body)
+
+	if !strings.HasPrefix(header, "t=1700000000,v1=") {
+		t.Fatalf("Sign = %q", header)
+	}
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+		want   error
+	}{
+		{"valid", "whsec_test", header, body, signedAt.Add(time.Minute), nil},
+		{"other secret", "whsec_other", header, body, signedAt, ErrInvalidSignature},
+		{"tampered body", "whsec_test", header, []byte(`{"id":2}`), signedAt, ErrInvalidSignature},
+		{"replayed", "whsec_test", header, body, signedAt.Add(time.Hour), ErrExpiredSignature},
+		{"malformed", "whsec_test", "v1=abc", body, signedAt, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifySignature(tt.secret, tt.header, tt.body, 5*time.Minute, tt.now); !errors.Is(err, tt.want) {
+				t.Errorf("VerifySignature = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package schemacheck
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Load reads the tables, columns, enums and single-column unique keys of the current schema
+func Load(ctx context.Context, db *sql.DB) (Schema, error) {
+	enums := map[string][]string{}
+	rows, err := db.QueryContext(ctx, `
+		SELECT t.typname, e.enumlabel
+		FROM pg_type t
+		JOIN pg_enum e ON e.enumtypid = t.oid
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		WHERE n.nspname = current_schema()
+		ORDER BY t.typname, e.enumsortorder`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var typeName, label string
+		if err := rows.Scan(&typeName, &label); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		enums[typeName] = append(enums[typeName], label)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	schema := Schema{}
+	rows, err = db.QueryContext(ctx, `
+		SELECT c.table_name, c.column_name, c.data_type, COALESCE(c.character_maximum_length, 0),
+		       c.is_nullable = 'YES', c.udt_name
+		FROM information_schema.columns c
+		JOIN information_schema.tables t
+		  ON t.table_schema = c.table_schema AND t.table_name = c.table_name AND t.table_type = 'BASE TABLE'
+		WHERE c.table_schema = current_schema()`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var tableName, udtName string
+		var column Column
+		if err := rows.Scan(&tableName, &column.Name, &column.DataType, &column.MaxLength, &column.Nullable, &udtName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		column.Enum = enums[udtName]
+		if schema[tableName] == nil {
+			schema[tableName] = Table{}
+		}
+		schema[tableName][column.Name] = column
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// information_schema only lists unique constraints, so unique indexes are read from pg_index;
+	// partial indexes count too, as they enforce uniqueness over the rows they cover
+	rows, err = db.QueryContext(ctx, `
+		SELECT tbl.relname, a.attname
+		FROM pg_index i
+		JOIN pg_class tbl ON tbl.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = tbl.relnamespace
+		JOIN pg_attribute a ON a.attrelid = tbl.oid AND a.attnum = i.indkey[0]
+		WHERE n.nspname = current_schema() AND i.indisunique AND NOT i.indisprimary AND i.indnatts = 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tableName, columnName string
+		if err := rows.Scan(&tableName, &columnName); err != nil {
+			return nil, err
+		}
+		if column, ok := schema[tableName][columnName]; ok {
+			column.Unique = true
+			schema[tableName][columnName] = column
+		}
+	}
+	return schema, rows.Err()
+}
@@ -0,0 +1,251 @@
+// Package schemacheck compares the tables described by the models package with the schema of a
+// live Postgres database, so that gorm tags and validation limits cannot silently drift from the
+// migrations.
+package schemacheck
+
+import (
+	"fmt"
+	"keeper/internal/models"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Models are the structs checked by default, one per table
+var Models = []any{
+	models.Dealership{},
+	models.OpeningHours{},
+	models.Closure{},
+	models.Employee{},
+	models.EmployeeCredential{},
+	models.Employment{},
+	models.Client{},
+	models.CarPark{},
+	models.Order{},
+	models.OrderStatusChange{},
+	models.Appointment{},
+	models.IdempotencyKey{},
+	models.AuditEntry{},
+	models.OutboxEvent{},
+	models.Webhook{},
+	models.WebhookDelivery{},
+}
+
+// Column is a column as the database reports it
+type Column struct {
+	Name      string
+	DataType  string // information_schema data_type, e.g. "character varying" or "USER-DEFINED"
+	MaxLength int    // character_maximum_length, 0 when the type has none
+	Nullable  bool
+	Unique    bool     // covered on its own by a unique constraint or index other than the primary key
+	Enum      []string // labels of an enum column
+}
+
+// Table maps column names to columns
+type Table map[string]Column
+
+// Schema maps table names to tables
+type Schema map[string]Table
+
+// Mismatch is one difference between a model and the database
+type Mismatch struct {
+	Table   string
+	Column  string // empty for a missing table
+	Problem string
+}
+
+func (m Mismatch) String() string {
+	if m.Column == "" {
+		return fmt.Sprintf("%s: %s", m.Table, m.Problem)
+	}
+	return fmt.Sprintf("%s.%s: %s", m.Table, m.Column, m.Problem)
+}
+
+// field is what a model declares about one column
+type field struct {
+	goName    string
+	column    string
+	kind      reflect.Type
+	notNull   bool
+	unique    bool
+	maxLength int      // from the validate tag, 0 if unbounded
+	enum      []string // from the validate tag, nil if unrestricted
+}
+
+// compatibleTypes lists the column types each kind of Go value can be stored in
+var compatibleTypes = map[reflect.Kind][]string{
+	reflect.String: {"character varying", "character", "text", "time without time zone", "USER-DEFINED"},
+	reflect.Int:    {"integer", "smallint", "bigint"},
+	reflect.Int64:  {"bigint"},
+	reflect.Bool:   {"boolean"},
+	reflect.Map:    {"jsonb", "json"},
+	reflect.Slice:  {"jsonb", "json"},
+}
+
+var timeTypes = []string{"timestamp without time zone", "timestamp with time zone", "date"}
+
+// timeKinds are the Go types stored in timeTypes; gorm.DeletedAt is the nullable time of soft-deleted rows
+var timeKinds = []reflect.Type{reflect.TypeOf(time.Time{}), reflect.TypeOf(gorm.DeletedAt{})}
+
+// Compare checks the given models against schema and returns the mismatches sorted by table and column
+func Compare(schema Schema, models ...any) []Mismatch {
+	var mismatches []Mismatch
+	for _, model := range models {
+		tableName := tableName(model)
+		table, ok := schema[tableName]
+		if !ok {
+			mismatches = append(mismatches, Mismatch{Table: tableName, Problem: "table does not exist"})
+			continue
+		}
+
+		declared := map[string]bool{}
+		for _, f := range modelFields(model) {
+			declared[f.column] = true
+			column, ok := table[f.column]
+			if !ok {
+				mismatches = append(mismatches, Mismatch{tableName, f.column, fmt.Sprintf("column of field %s does not exist", f.goName)})
+				continue
+			}
+			for _, problem := range compareColumn(f, column) {
+				mismatches = append(mismatches, Mismatch{tableName, f.column, problem})
+			}
+		}
+		for name := range table {
+			if !declared[name] {
+				mismatches = append(mismatches, Mismatch{tableName, name, "column is not mapped by the model"})
+			}
+		}
+	}
+
+	sort.SliceStable(mismatches, func(i, j int) bool {
+		if mismatches[i].Table != mismatches[j].Table {
+			return mismatches[i].Table < mismatches[j].Table
+		}
+		return mismatches[i].Column < mismatches[j].Column
+	})
+	return mismatches
+}
+
+// compareColumn lists the differences between a model field and its column
+func compareColumn(f field, column Column) []string {
+	var problems []string
+
+	types := compatibleTypes[f.kind.Kind()]
+	if slices.Contains(timeKinds, f.kind) {
+		types = timeTypes
+	}
+	if !contains(types, column.DataType) {
+		problems = append(problems, fmt.Sprintf("type %s cannot hold a Go %s", column.DataType, f.kind))
+	}
+
+	if f.notNull && column.Nullable {
+		problems = append(problems, "model declares NOT NULL, column is nullable")
+	} else if !f.notNull && !column.Nullable {
+		problems = append(problems, "column is NOT NULL, model does not declare it")
+	}
+
+	if f.unique && !column.Unique {
+		problems = append(problems, "model declares unique, column has no unique constraint")
+	} else if !f.unique && column.Unique {
+		problems = append(problems, "column is unique, model does not declare it")
+	}
+
+	if f.maxLength > 0 && column.MaxLength > 0 && f.maxLength != column.MaxLength {
+		problems = append(problems, fmt.Sprintf("validation allows %d characters, column holds %d", f.maxLength, column.MaxLength))
+	} else if f.maxLength > 0 && column.MaxLength == 0 && column.DataType == "character varying" {
+		problems = append(problems, fmt.Sprintf("validation allows %d characters, column is unbounded", f.maxLength))
+	}
+
+	if f.enum != nil {
+		if column.DataType != "USER-DEFINED" {
+			problems = append(problems, fmt.Sprintf("validation restricts values to %v, column is not an enum", f.enum))
+		} else if !sameSet(f.enum, column.Enum) {
+			problems = append(problems, fmt.Sprintf("validation allows %v, enum has %v", sorted(f.enum), sorted(column.Enum)))
+		}
+	}
+	return problems
+}
+
+// modelFields reads the columns a model maps, following the gorm naming used by the storage package
+func modelFields(model any) []field {
+	t := reflect.TypeOf(model)
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		gormTag := sf.Tag.Get("gorm")
+		if gormTag == "-" || !sf.IsExported() {
+			continue
+		}
+
+		f := field{goName: sf.Name, column: strings.ToLower(sf.Name), kind: sf.Type}
+		if f.kind.Kind() == reflect.Pointer {
+			f.kind = f.kind.Elem()
+		}
+		for _, part := range strings.Split(gormTag, ";") {
+			switch {
+			case strings.HasPrefix(part, "column:"):
+				f.column = strings.TrimPrefix(part, "column:")
+			case part == "not null", part == "primaryKey":
+				f.notNull = true
+			case part == "unique":
+				f.unique = true
+			}
+		}
+		for _, rule := range strings.Split(sf.Tag.Get("validate"), ",") {
+			name, param, _ := strings.Cut(rule, "=")
+			if name == "dive" {
+				break // The rules that follow apply to the elements of a slice
+			}
+			switch name {
+			case "max", "len":
+				if f.kind.Kind() == reflect.String {
+					f.maxLength, _ = strconv.Atoi(param)
+				}
+			case "oneof":
+				f.enum = strings.Fields(param)
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// tableName is the table of a model, from its TableName method
+func tableName(model any) string {
+	if named, ok := model.(interface{ TableName() string }); ok {
+		return named.TableName()
+	}
+	return strings.ToLower(reflect.TypeOf(model).Name())
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, v := range a {
+		if !contains(b, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func sorted(values []string) []string {
+	out := append([]string(nil), values...)
+	sort.Strings(out)
+	return out
+}
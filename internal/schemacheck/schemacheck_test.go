@@ -0,0 +1,104 @@
+package schemacheck
+
+import (
+	"context"
+	"keeper/internal/migrate"
+	"keeper/internal/storage"
+	"os"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type widget struct {
+	ID      int            `gorm:"primaryKey;autoIncrement"`
+	Code    string         `gorm:"column:code;unique;not null" validate:"required,max=10"`
+	Kind    string         `gorm:"column:kind;not null" validate:"required,oneof=small large"`
+	Note    *string        `gorm:"column:note"`
+	Tags    []string       `gorm:"column:tags;not null" validate:"required,dive,oneof=new used,max=4"`
+	Removed gorm.DeletedAt `gorm:"column:removed"`
+	Hidden  string         `gorm:"-"`
+}
+
+func (widget) TableName() string {
+	return "widget"
+}
+
+// matchingWidget is the table the widget model describes
+func matchingWidget() Table {
+	return Table{
+		"id":      {Name: "id", DataType: "integer"},
+		"code":    {Name: "code", DataType: "character varying", MaxLength: 10, Unique: true},
+		"kind":    {Name: "kind", DataType: "USER-DEFINED", Enum: []string{"large", "small"}},
+		"note":    {Name: "note", DataType: "text", Nullable: true},
+		"tags":    {Name: "tags", DataType: "jsonb"},
+		"removed": {Name: "removed", DataType: "timestamp without time zone", Nullable: true},
+	}
+}
+
+func TestCompareMatching(t *testing.T) {
+	if mismatches := Compare(Schema{"widget": matchingWidget()}, widget{}); len(mismatches) != 0 {
+		t.Errorf("Compare reported %v for a matching table", mismatches)
+	}
+}
+
+func TestCompareMismatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(Table)
+		column string
+	}{
+		{"length", func(tb Table) { c := tb["code"]; c.MaxLength = 20; tb["code"] = c }, "code"},
+		{"nullability", func(tb Table) { c := tb["code"]; c.Nullable = true; tb["code"] = c }, "code"},
+		{"uniqueness", func(tb Table) { c := tb["code"]; c.Unique = false; tb["code"] = c }, "code"},
+		{"type", func(tb Table) { c := tb["id"]; c.DataType = "text"; tb["id"] = c }, "id"},
+		{"enum labels", func(tb Table) { c := tb["kind"]; c.Enum = []string{"small", "medium", "large"}; tb["kind"] = c }, "kind"},
+		{"missing column", func(tb Table) { delete(tb, "note") }, "note"},
+		{"unmapped column", func(tb Table) { tb["extra"] = Column{Name: "extra", DataType: "text", Nullable: true} }, "extra"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := matchingWidget()
+			tt.change(table)
+			mismatches := Compare(Schema{"widget": table}, widget{})
+			if len(mismatches) != 1 || mismatches[0].Column != tt.column {
+				t.Errorf("Compare = %v, want one mismatch on %s", mismatches, tt.column)
+			}
+		})
+	}
+
+	if mismatches := Compare(Schema{}, widget{}); len(mismatches) != 1 || mismatches[0].Column != "" {
+		t.Errorf("Compare without the table = %v, want one table mismatch", mismatches)
+	}
+}
+
+// TestMigratedSchema checks the models against a database migrated to the latest version,
+// so that a migration or model change that introduces drift fails the build
+func TestMigratedSchema(t *testing.T) {
+	connString := os.Getenv("TEST_DATABASE_URL")
+	if connString == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping integration test")
+	}
+	store, err := storage.NewPostgresStore(connString)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %s", err)
+	}
+
+	ctx := context.Background()
+	m, err := migrate.New(store.Db)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %s", err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("failed to migrate test database: %s", err)
+	}
+
+	schema, err := Load(ctx, store.Db)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for _, mismatch := range Compare(schema, Models...) {
+		t.Error(mismatch)
+	}
+}
@@ -0,0 +1,503 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"keeper/internal/models"
+	"reflect"
+)
+
+// Entity names used in the audit log
+const (
+	AuditDealership   = "dealership"
+	AuditOpeningHours = "opening_hours"
+	AuditClosure      = "closure"
+	AuditEmployee     = "employee"
+	AuditCredential   = "credential"
+	AuditEmployment   = "employment"
+	AuditClient       = "client"
+	AuditCar          = "car"
+	AuditOrder        = "order"
+	AuditAppointment  = "appointment"
+	AuditWebhook      = "webhook"
+)
+
+// Actor is who makes the changes recorded in the audit log
+type Actor struct {
+	EmployeeID int    // 0 for changes made by the system, e.g. the admin bootstrapped at startup
+	RequestID  string // ID of the HTTP request, empty outside of one
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose changes AuditedStore attributes to actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or the zero Actor
+func ActorFromContext(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// AuditedStore wraps a Store and records every create, update, delete and restore made through it in the
+// audit log, in the same transaction as the change. Each entry holds the fields that changed, read
+// back from the store before and after the change, and the Actor of the context.
+// Changes a store makes on its own, such as the car status driven by an order or the rows removed by
+// ON DELETE CASCADE, are part of the entry of the call that caused them and are not logged separately.
+type AuditedStore struct {
+	Store
+}
+
+// NewAuditedStore returns store with audit logging
+func NewAuditedStore(store Store) *AuditedStore {
+	return &AuditedStore{Store: store}
+}
+
+func (a *AuditedStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return a.Store.WithTx(ctx, func(tx Store) error {
+		return fn(&AuditedStore{Store: tx})
+	})
+}
+
+// snapshot reads the current state of the record with the given ID
+type snapshot func(tx Store, id int) (any, error)
+
+// record runs change in a transaction and logs it. change returns the ID of the record it changed;
+// read is called before the change unless it creates the record and after it unless it deletes it.
+func (a *AuditedStore) record(ctx context.Context, entity string, action models.AuditAction, id int, read snapshot, change func(tx Store) (int, error)) (int, error) {
+	err := a.Store.WithTx(ctx, func(tx Store) error {
+		var before, after any
+		var err error
+		if action != models.AuditCreate {
+			if before, err = read(tx, id); err != nil {
+				return err
+			}
+		}
+		if id, err = change(tx); err != nil {
+			return err
+		}
+		if action != models.AuditDelete {
+			if after, err = read(tx, id); err != nil {
+				return err
+			}
+		}
+		return logChange(ctx, tx, entity, id, action, before, after)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// logChange appends an entry for the change of a record from before to after
+func logChange(ctx context.Context, tx Store, entity string, id int, action models.AuditAction, before, after any) error {
+	diff, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+	entry := &models.AuditEntry{Entity: entity, EntityID: id, Action: action, Diff: diff}
+	actor := ActorFromContext(ctx)
+	if actor.EmployeeID != 0 {
+		entry.ID_Employee = &actor.EmployeeID
+	}
+	if actor.RequestID != "" {
+		entry.RequestID = &actor.RequestID
+	}
+	return tx.CreateAuditEntry(ctx, entry)
+}
+
+// auditDiff compares the JSON representations of two records, either of which may be nil,
+// and returns the fields whose values differ
+func auditDiff(before, after any) (models.AuditDiff, error) {
+	old, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	current, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := models.AuditDiff{}
+	for name, value := range old {
+		if !reflect.DeepEqual(value, current[name]) {
+			diff[name] = models.AuditChange{Before: value, After: current[name]}
+		}
+	}
+	for name, value := range current {
+		if _, ok := old[name]; !ok && value != nil {
+			diff[name] = models.AuditChange{After: value}
+		}
+	}
+	return diff, nil
+}
+
+// jsonFields decodes the JSON object of a record into its members
+func jsonFields(record any) (map[string]any, error) {
+	fields := map[string]any{}
+	if record == nil {
+		return fields, nil
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	return fields, json.Unmarshal(data, &fields)
+}
+
+//-----Dealership Methods-----
+
+func readDealership(ctx context.Context) snapshot {
+	return func(tx Store, id int) (any, error) { return tx.GetDealershipByID(ctx, id) }
+}
+
+func (a *AuditedStore) CreateDealership(ctx context.Context, dealership *models.Dealership) (int, error) {
+	return a.record(ctx, AuditDealership, models.AuditCreate, 0, readDealership(ctx), func(tx Store) (int, error) {
+		return tx.CreateDealership(ctx, dealership)
+	})
+}
+
+func (a *AuditedStore) UpdateDealership(ctx context.Context, id int, dealership *models.Dealership) error {
+	_, err := a.record(ctx, AuditDealership, models.AuditUpdate, id, readDealership(ctx), func(tx Store) (int, error) {
+		return id, tx.UpdateDealership(ctx, id, dealership)
+	})
+	return err
+}
+
+func (a *AuditedStore) DeleteDealership(ctx context.Context, id, version int) error {
+	_, err := a.record(ctx, AuditDealership, models.AuditDelete, id, readDealership(ctx), func(tx Store) (int, error) {
+		return id, tx.DeleteDealership(ctx, id, version)
+	})
+	return err
+}
+
+//-----Opening Hours & Closure Methods-----
+
+// Hours and closures have no getter of their own and are looked up in the list of their dealership
+
+func readOpeningHours(ctx context.Context, dealershipID int) snapshot {
+	return func(tx Store, id int) (any, error) {
+		hours, err := tx.ListOpeningHours(ctx, dealershipID)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range hours {
+			if h.ID_Hours == id {
+				return h, nil
+			}
+		}
+		return nil, ErrNotFound
+	}
+}
+
+func (a *AuditedStore) CreateOpeningHours(ctx context.Context, hours *models.OpeningHours) (int, error) {
+	return a.record(ctx, AuditOpeningHours, models.AuditCreate, 0, readOpeningHours(ctx, hours.ID_Dealership), func(tx Store) (int, error) {
+		return tx.CreateOpeningHours(ctx, hours)
+	})
+}
+
+func (a *AuditedStore) UpdateOpeningHours(ctx context.Context, dealershipID, id int, hours *models.OpeningHours) error {
+	_, err := a.record(ctx, AuditOpeningHours, models.AuditUpdate, id, readOpeningHours(ctx, dealershipID), func(tx Store) (int, error) {
+		return id, tx.UpdateOpeningHours(ctx, dealershipID, id, hours)
+	})
+	return err
+}
+
+func (a *AuditedStore) DeleteOpeningHours(ctx context.Context, dealershipID, id int) error {
+	_, err := a.record(ctx, AuditOpeningHours, models.AuditDelete, id, readOpeningHours(ctx, dealershipID), func(tx Store) (int, error) {
+		return id, tx.DeleteOpeningHours(ctx, dealershipID, id)
+	})
+	return err
+}
+
+func readClosure(ctx context.Context, dealershipID int) snapshot {
+	return func(tx Store, id int) (any, error) {
+		closures, err := tx.ListClosures(ctx, dealershipID)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range closures {
+			if c.ID_Closure == id {
+				return c, nil
+			}
+		}
+		return nil, ErrNotFound
+	}
+}
+
+func (a *AuditedStore) CreateClosure(ctx context.Context, closure *models.Closure) (int, error) {
+	return a.record(ctx, AuditClosure, models.AuditCreate, 0, readClosure(ctx, closure.ID_Dealership), func(tx Store) (int, error) {
+		return tx.CreateClosure(ctx, closure)
+	})
+}
+
+func (a *AuditedStore) UpdateClosure(ctx context.Context, dealershipID, id int, closure *models.Closure) error {
+	_, err := a.record(ctx, AuditClosure, models.AuditUpdate, id, readClosure(ctx, dealershipID), func(tx Store) (int, error) {
+		return id, tx.UpdateClosure(ctx, dealershipID, id, closure)
+	})
+	return err
+}
+
+func (a *AuditedStore) DeleteClosure(ctx context.Context, dealershipID, id int) error {
+	_, err := a.record(ctx, AuditClosure, models.AuditDelete, id, readClosure(ctx, dealershipID), func(tx Store) (int, error) {
+		return id, tx.DeleteClosure(ctx, dealershipID, id)
+	})
+	return err
+}
+
+//-----Employee Methods-----
+
+func readEmployee(ctx context.Context) snapshot {
+	return func(tx Store, id int) (any, error) { return tx.GetEmployeeByID(ctx, id) }
+}
+
+func (a *AuditedStore) CreateEmployee(ctx context.Context, employee *models.Employee) (int, error) {
+	return a.record(ctx, AuditEmployee, models.AuditCreate, 0, readEmployee(ctx), func(tx Store) (int, error) {
+		return tx.CreateEmployee(ctx, employee)
+	})
+}
+
+func (a *AuditedStore) UpdateEmployee(ctx context.Context, id int, employee *models.Employee) error {
+	_, err := a.record(ctx, AuditEmployee, models.AuditUpdate, id, readEmployee(ctx), func(tx Store) (int, error) {
+		return id, tx.UpdateEmployee(ctx, id, employee)
+	})
+	return err
+}
+
+func (a *AuditedStore) DeleteEmployee(ctx context.Context, id, version int) error {
+	_, err := a.record(ctx, AuditEmployee, models.AuditDelete, id, readEmployee(ctx), func(tx Store) (int, error) {
+		return id, tx.DeleteEmployee(ctx, id, version)
+	})
+	return err
+}
+
+func (a *AuditedStore) RestoreEmployee(ctx context.Context, id int) (*models.Employee, error) {
+	var employee *models.Employee
+	read := func(tx Store, id int) (any, error) {
+		return GetIncludingDeleted(ctx, tx.ListEmployees, "id_employee", id)
+	}
+	_, err := a.record(ctx, AuditEmployee, models.AuditRestore, id, read, func(tx Store) (int, error) {
+		var err error
+		employee, err = tx.RestoreEmployee(ctx, id)
+		return id, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return employee, nil
+}
+
+//-----Credential Methods-----
+
+// SetEmployeeCredential logs the new username only: the password hash is never serialized
+func (a *AuditedStore) SetEmployeeCredential(ctx context.Context, credential *models.EmployeeCredential) error {
+	return a.Store.WithTx(ctx, func(tx Store) error {
+		if err := tx.SetEmployeeCredential(ctx, credential); err != nil {
+			return err
+		}
+		return logChange(ctx, tx, AuditCredential, credential.ID_Employee, models.AuditUpdate, nil, map[string]any{"username": credential.Username})
+	})
+}
+
+//-----Employment Methods-----
+
+func readEmployment(ctx context.Context) snapshot {
+	return func(tx Store, id int) (any, error) { return tx.GetEmploymentByID(ctx, id) }
+}
+
+func (a *AuditedStore) CreateEmployment(ctx context.Context, employment *models.Employment) (int, error) {
+	return a.record(ctx, AuditEmployment, models.AuditCreate, 0, readEmployment(ctx), func(tx Store) (int, error) {
+		return tx.CreateEmployment(ctx, employment)
+	})
+}
+
+func (a *AuditedStore) UpdateEmployment(ctx context.Context, id int, employment *models.Employment) error {
+	_, err := a.record(ctx, AuditEmployment, models.AuditUpdate, id, readEmployment(ctx), func(tx Store) (int, error) {
+		return id, tx.UpdateEmployment(ctx, id, employment)
+	})
+	return err
+}
+
+func (a *AuditedStore) DeleteEmployment(ctx context.Context, id, version int) error {
+	_, err := a.record(ctx, AuditEmployment, models.AuditDelete, id, readEmployment(ctx), func(tx Store) (int, error) {
+		return id, tx.DeleteEmployment(ctx, id, version)
+	})
+	return err
+}
+
+//-----Client Methods-----
+
+func readClient(ctx context.Context) snapshot {
+	return func(tx Store, id int) (any, error) { return tx.GetClientByID(ctx, id) }
+}
+
+func (a *AuditedStore) CreateClient(ctx context.Context, client *models.Client) (int, error) {
+	return a.record(ctx, AuditClient, models.AuditCreate, 0, readClient(ctx), func(tx Store) (int, error) {
+		return tx.CreateClient(ctx, client)
+	})
+}
+
+func (a *AuditedStore) UpdateClient(ctx context.Context, id int, client *models.Client) error {
+	_, err := a.record(ctx, AuditClient, models.AuditUpdate, id, readClient(ctx), func(tx Store) (int, error) {
+		return id, tx.UpdateClient(ctx, id, client)
+	})
+	return err
+}
+
+func (a *AuditedStore) DeleteClient(ctx context.Context, id, version int) error {
+	_, err := a.record(ctx, AuditClient, models.AuditDelete, id, readClient(ctx), func(tx Store) (int, error) {
+		return id, tx.DeleteClient(ctx, id, version)
+	})
+	return err
+}
+
+func (a *AuditedStore) RestoreClient(ctx context.Context, id int) (*models.Client, error) {
+	var client *models.Client
+	read := func(tx Store, id int) (any, error) {
+		return GetIncludingDeleted(ctx, tx.ListClients, "id_client", id)
+	}
+	_, err := a.record(ctx, AuditClient, models.AuditRestore, id, read, func(tx Store) (int, error) {
+		var err error
+		client, err = tx.RestoreClient(ctx, id)
+		return id, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+//-----CarPark Methods-----
+
+func readCar(ctx context.Context) snapshot {
+	return func(tx Store, id int) (any, error) { return tx.GetCarByID(ctx, id) }
+}
+
+func (a *AuditedStore) CreateCar(ctx context.Context, car *models.CarPark) (int, error) {
+	return a.record(ctx, AuditCar, models.AuditCreate, 0, readCar(ctx), func(tx Store) (int, error) {
+		return tx.CreateCar(ctx, car)
+	})
+}
+
+func (a *AuditedStore) UpdateCar(ctx context.Context, id int, car *models.CarPark) error {
+	_, err := a.record(ctx, AuditCar, models.AuditUpdate, id, readCar(ctx), func(tx Store) (int, error) {
+		return id, tx.UpdateCar(ctx, id, car)
+	})
+	return err
+}
+
+func (a *AuditedStore) TransitionCarStatus(ctx context.Context, id int, status models.CarStatus) (*models.CarPark, error) {
+	var car *models.CarPark
+	_, err := a.record(ctx, AuditCar, models.AuditUpdate, id, readCar(ctx), func(tx Store) (int, error) {
+		var err error
+		car, err = tx.TransitionCarStatus(ctx, id, status)
+		return id, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return car, nil
+}
+
+func (a *AuditedStore) DeleteCar(ctx context.Context, id, version int) error {
+	_, err := a.record(ctx, AuditCar, models.AuditDelete, id, readCar(ctx), func(tx Store) (int, error) {
+		return id, tx.DeleteCar(ctx, id, version)
+	})
+	return err
+}
+
+func (a *AuditedStore) RestoreCar(ctx context.Context, id int) (*models.CarPark, error) {
+	var car *models.CarPark
+	read := func(tx Store, id int) (any, error) {
+		return GetIncludingDeleted(ctx, tx.ListCars, "id_car", id)
+	}
+	_, err := a.record(ctx, AuditCar, models.AuditRestore, id, read, func(tx Store) (int, error) {
+		var err error
+		car, err = tx.RestoreCar(ctx, id)
+		return id, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return car, nil
+}
+
+//-----Order Methods-----
+
+func readOrder(ctx context.Context) snapshot {
+	return func(tx Store, id int) (any, error) { return tx.GetOrderByID(ctx, id) }
+}
+
+func (a *AuditedStore) CreateOrder(ctx context.Context, order *models.Order, actorID int) (int, error) {
+	return a.record(ctx, AuditOrder, models.AuditCreate, 0, readOrder(ctx), func(tx Store) (int, error) {
+		return tx.CreateOrder(ctx, order, actorID)
+	})
+}
+
+func (a *AuditedStore) UpdateOrder(ctx context.Context, id int, order *models.Order, actorID int) error {
+	_, err := a.record(ctx, AuditOrder, models.AuditUpdate, id, readOrder(ctx), func(tx Store) (int, error) {
+		return id, tx.UpdateOrder(ctx, id, order, actorID)
+	})
+	return err
+}
+
+func (a *AuditedStore) DeleteOrder(ctx context.Context, id, version int) error {
+	_, err := a.record(ctx, AuditOrder, models.AuditDelete, id, readOrder(ctx), func(tx Store) (int, error) {
+		return id, tx.DeleteOrder(ctx, id, version)
+	})
+	return err
+}
+
+//-----Appointment Methods-----
+
+func readAppointment(ctx context.Context) snapshot {
+	return func(tx Store, id int) (any, error) { return tx.GetAppointmentByID(ctx, id) }
+}
+
+func (a *AuditedStore) CreateAppointment(ctx context.Context, appointment *models.Appointment) (int, error) {
+	return a.record(ctx, AuditAppointment, models.AuditCreate, 0, readAppointment(ctx), func(tx Store) (int, error) {
+		return tx.CreateAppointment(ctx, appointment)
+	})
+}
+
+func (a *AuditedStore) UpdateAppointment(ctx context.Context, id int, appointment *models.Appointment) error {
+	_, err := a.record(ctx, AuditAppointment, models.AuditUpdate, id, readAppointment(ctx), func(tx Store) (int, error) {
+		return id, tx.UpdateAppointment(ctx, id, appointment)
+	})
+	return err
+}
+
+func (a *AuditedStore) DeleteAppointment(ctx context.Context, id, version int) error {
+	_, err := a.record(ctx, AuditAppointment, models.AuditDelete, id, readAppointment(ctx), func(tx Store) (int, error) {
+		return id, tx.DeleteAppointment(ctx, id, version)
+	})
+	return err
+}
+
+//-----Webhook Methods-----
+
+func readWebhook(ctx context.Context) snapshot {
+	return func(tx Store, id int) (any, error) { return tx.GetWebhookByID(ctx, id) }
+}
+
+func (a *AuditedStore) CreateWebhook(ctx context.Context, webhook *models.Webhook) (int, error) {
+	return a.record(ctx, AuditWebhook, models.AuditCreate, 0, readWebhook(ctx), func(tx Store) (int, error) {
+		return tx.CreateWebhook(ctx, webhook)
+	})
+}
+
+func (a *AuditedStore) UpdateWebhook(ctx context.Context, id int, webhook *models.Webhook) error {
+	_, err := a.record(ctx, AuditWebhook, models.AuditUpdate, id, readWebhook(ctx), func(tx Store) (int, error) {
+		return id, tx.UpdateWebhook(ctx, id, webhook)
+	})
+	return err
+}
+
+func (a *AuditedStore) DeleteWebhook(ctx context.Context, id, version int) error {
+	_, err := a.record(ctx, AuditWebhook, models.AuditDelete, id, readWebhook(ctx), func(tx Store) (int, error) {
+		return id, tx.DeleteWebhook(ctx, id, version)
+	})
+	return err
+}
@@ -0,0 +1,69 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	store := storage.NewAuditedStore(storage.NewMemoryStore())
+	ctx := storage.WithActor(context.Background(), storage.Actor{EmployeeID: 7, RequestID: "host/abc-000001"})
+
+	dealershipID, err := store.CreateDealership(ctx, &models.Dealership{PostalCode: "73100", City: "Lecce", Address: "Via Roma 1", Phone: "0832"})
+	if err != nil {
+		t.Fatalf("CreateDealership: %v", err)
+	}
+	vin := "ZFA31200000123456"
+	car := &models.CarPark{VIN: &vin, ID_Dealership: dealershipID, Brand: "Fiat", Model: "Panda", Condition: models.CondTypeUsed, Year: 2020, KM: "50000", Plate: "AB123CD"}
+	carID, err := store.CreateCar(ctx, car)
+	if err != nil {
+		t.Fatalf("CreateCar: %v", err)
+	}
+	car.KM = "61000"
+	if err := store.UpdateCar(ctx, carID, car); err != nil {
+		t.Fatalf("UpdateCar: %v", err)
+	}
+	stale := *car
+	stale.Version = 1
+	if err := store.UpdateCar(ctx, carID, &stale); !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Fatalf("UpdateCar at a stale version: got %v, want ErrVersionMismatch", err)
+	}
+	if err := store.DeleteCar(ctx, carID, 0); err != nil {
+		t.Fatalf("DeleteCar: %v", err)
+	}
+
+	page, err := store.ListAuditEntries(context.Background(), &storage.ListQuery{
+		Filters: []storage.Filter{{Field: "entity", Op: storage.OpEq, Value: storage.AuditCar}},
+	})
+	if err != nil {
+		t.Fatalf("ListAuditEntries: %v", err)
+	}
+	// The failed update rolled back with its entry
+	if len(page.Items) != 3 {
+		t.Fatalf("got %d entries for the car, want 3: %+v", len(page.Items), page.Items)
+	}
+	created, updated, deleted := page.Items[0], page.Items[1], page.Items[2]
+
+	for i, want := range []models.AuditAction{models.AuditCreate, models.AuditUpdate, models.AuditDelete} {
+		entry := page.Items[i]
+		if entry.Action != want || entry.EntityID != carID {
+			t.Errorf("entry %d is %s of car %d, want %s of car %d", i, entry.Action, entry.EntityID, want, carID)
+		}
+		if entry.ID_Employee == nil || *entry.ID_Employee != 7 || entry.RequestID == nil || *entry.RequestID != "host/abc-000001" {
+			t.Errorf("entry %d has actor %v and request %v", i, entry.ID_Employee, entry.RequestID)
+		}
+	}
+
+	if change := created.Diff["km"]; change.Before != nil || change.After != "50000" {
+		t.Errorf("create diff of km = %+v", change)
+	}
+	if len(updated.Diff) != 2 || updated.Diff["km"] != (models.AuditChange{Before: "50000", After: "61000"}) {
+		t.Errorf("update diff = %+v, want km and version", updated.Diff)
+	}
+	if change := deleted.Diff["plate"]; change.Before != "AB123CD" || change.After != nil {
+		t.Errorf("delete diff of plate = %+v", change)
+	}
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"keeper/internal/models"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Every Store implementation reports failures with the errors below, so callers can tell them apart
+// with errors.Is and errors.As instead of inspecting messages or driver-specific errors.
+
+var (
+	// ErrNotFound is returned when the record to read, update or delete does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrInvalidTransition is returned when a status change is not allowed by the lifecycle graph
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrCarUnavailable is returned when the status of a car forbids the requested operation
+	ErrCarUnavailable = errors.New("car is not available")
+	// ErrCarElsewhere is returned when an order refers to a car of another dealership than its own
+	ErrCarElsewhere = errors.New("car belongs to another dealership")
+	// ErrSlotTaken is returned when an appointment overlaps another one of the same employee or vehicle
+	ErrSlotTaken = errors.New("appointment slot is already taken")
+	// ErrVersionMismatch is returned when a write expects a version of the record that is no longer current
+	ErrVersionMismatch = errors.New("record has been modified since it was read")
+	// ErrNotDeleted is returned when restoring a record that has not been deleted
+	ErrNotDeleted = errors.New("record is not deleted")
+)
+
+// checkVersion fails with ErrVersionMismatch unless a record is at the expected version; 0 expects any version
+func checkVersion(stored, expected int) error {
+	if expected != 0 && stored != expected {
+		return fmt.Errorf("%w: expected version %d, current version is %d", ErrVersionMismatch, expected, stored)
+	}
+	return nil
+}
+
+// ReferencedError is returned when a record cannot be deleted, or its key changed, because other records refer to it
+type ReferencedError struct {
+	References []Reference
+}
+
+// Reference is a kind of record that refers to the one being deleted; Count is 0 when unknown
+type Reference struct {
+	Resource string
+	Count    int64
+}
+
+func (e *ReferencedError) Error() string {
+	parts := make([]string, len(e.References))
+	for i, ref := range e.References {
+		if ref.Count > 0 {
+			parts[i] = fmt.Sprintf("referenced by %d %s records", ref.Count, ref.Resource)
+		} else {
+			parts[i] = fmt.Sprintf("referenced by %s records", ref.Resource)
+		}
+	}
+	return "cannot delete: " + strings.Join(parts, ", ")
+}
+
+// UniqueViolationError is returned when a write would duplicate the value of a unique field
+type UniqueViolationError struct {
+	Table string
+	Field string // Column whose value is already taken, if known
+}
+
+func (e *UniqueViolationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s already exists", e.Table)
+	}
+	return fmt.Sprintf("%s with this %s already exists", e.Table, e.Field)
+}
+
+// ForeignKeyViolationError is returned when a write refers to a record that does not exist
+type ForeignKeyViolationError struct {
+	Table      string
+	Field      string // Referencing column, if known
+	Referenced string // Referenced table, if known
+}
+
+func (e *ForeignKeyViolationError) Error() string {
+	if e.Referenced == "" {
+		return fmt.Sprintf("%s: %s refers to a record that does not exist", e.Table, e.Field)
+	}
+	return fmt.Sprintf("%s: %s refers to a %s that does not exist", e.Table, e.Field, e.Referenced)
+}
+
+// CheckViolationError is returned when a write breaks a check or not-null constraint of the schema
+type CheckViolationError struct {
+	Table      string
+	Field      string // Column of a not-null violation, if known
+	Constraint string
+}
+
+func (e *CheckViolationError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("%s: %s violates %s", e.Table, e.Field, e.Constraint)
+	}
+	return fmt.Sprintf("%s violates %s", e.Table, e.Constraint)
+}
+
+// SQLSTATE codes translated by translateError
+const (
+	pgNotNullViolation    = "23502"
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+	pgCheckViolation      = "23514"
+)
+
+// Patterns of the DETAIL field of Postgres constraint errors, e.g. Key (tin)=(X) already exists.
+var (
+	detailKey        = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+	detailNotPresent = regexp.MustCompile(`is not present in table "([^"]+)"`)
+	detailReferenced = regexp.MustCompile(`is still referenced from table "([^"]+)"`)
+)
+
+// translateError maps the errors of GORM, database/sql and Postgres onto the errors above.
+// Errors that are already translated, or have no counterpart, are returned unchanged.
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	field := ""
+	if m := detailKey.FindStringSubmatch(pgErr.Detail); m != nil {
+		field = m[1]
+	}
+
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		return &UniqueViolationError{Table: pgErr.TableName, Field: field}
+	case pgForeignKeyViolation:
+		if m := detailReferenced.FindStringSubmatch(pgErr.Detail); m != nil {
+			return &ReferencedError{References: []Reference{{Resource: m[1]}}}
+		}
+		fk := &ForeignKeyViolationError{Table: pgErr.TableName, Field: field}
+		if m := detailNotPresent.FindStringSubmatch(pgErr.Detail); m != nil {
+			fk.Referenced = m[1]
+		}
+		return fk
+	case pgCheckViolation:
+		return &CheckViolationError{Table: pgErr.TableName, Constraint: pgErr.ConstraintName}
+	case pgNotNullViolation:
+		return &CheckViolationError{Table: pgErr.TableName, Field: pgErr.ColumnName, Constraint: "not null"}
+	}
+	return err
+}
+
+// Exclusion constraints that keep appointments from overlapping (see internal/migrate/sql)
+const (
+	constraintEmployeeOverlap = "appointment_employee_no_overlap"
+	constraintVehicleOverlap  = "appointment_vehicle_no_overlap"
+)
+
+// pgExclusionViolation is the SQLSTATE raised when an EXCLUDE constraint rejects a row
+const pgExclusionViolation = "23P01"
+
+// translateAppointmentError maps an overlap rejected by Postgres onto ErrSlotTaken.
+// Checking in the database rather than with a prior SELECT keeps concurrent bookings from both succeeding.
+func translateAppointmentError(err error, appointment *models.Appointment) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != pgExclusionViolation {
+		return translateError(err)
+	}
+
+	switch pgErr.ConstraintName {
+	case constraintEmployeeOverlap, constraintVehicleOverlap:
+		return slotTakenError(pgErr.ConstraintName, appointment)
+	}
+	return fmt.Errorf("%w: %s", ErrSlotTaken, pgErr.Message)
+}
+
+// slotTakenError describes which overlap constraint rejected an appointment
+func slotTakenError(constraint string, appointment *models.Appointment) error {
+	if constraint == constraintVehicleOverlap {
+		return fmt.Errorf("%w: vehicle %s is already booked between %s and %s",
+			ErrSlotTaken, *appointment.VIN, appointment.Date.Format("15:04"), appointment.End().Format("15:04"))
+	}
+	return fmt.Errorf("%w: employee %d already has an appointment between %s and %s",
+		ErrSlotTaken, appointment.ID_Employee, appointment.Date.Format("15:04"), appointment.End().Format("15:04"))
+}
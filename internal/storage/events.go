@@ -0,0 +1,332 @@
+package storage
+
+import (
+	"context"
+	"keeper/internal/models"
+)
+
+// OutboxStore wraps a Store and writes the domain events of cars, orders and appointments to the
+// outbox, in the same transaction as the change: an event is stored if and only if its change commits,
+// and dispatchers deliver it afterwards. Entities are named as in the audit log. The cars that orders
+// reserve, sell and release get a car.status_changed event of their own, naming the order.
+type OutboxStore struct {
+	Store
+}
+
+// NewOutboxStore returns store with domain events
+func NewOutboxStore(store Store) *OutboxStore {
+	return &OutboxStore{Store: store}
+}
+
+func (o *OutboxStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return o.Store.WithTx(ctx, func(tx Store) error {
+		return fn(&OutboxStore{Store: tx})
+	})
+}
+
+// emit runs change in a transaction and stores the events it returns
+func (o *OutboxStore) emit(ctx context.Context, change func(tx Store) ([]*models.OutboxEvent, error)) error {
+	return o.Store.WithTx(ctx, func(tx Store) error {
+		events, err := change(tx)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := tx.CreateOutboxEvent(ctx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// newEvent builds an event whose payload is the JSON object of record with extra members added.
+// The event belongs to the dealership of the record, if it has one.
+func newEvent(eventType models.EventType, entity string, id int, record any, extra map[string]any) (*models.OutboxEvent, error) {
+	payload, err := jsonFields(record)
+	if err != nil {
+		return nil, err
+	}
+	event := &models.OutboxEvent{EventType: eventType, Entity: entity, EntityID: id}
+	if dealership, ok := payload["id_dealership"].(float64); ok {
+		dealershipID := int(dealership)
+		event.ID_Dealership = &dealershipID
+	}
+	for name, value := range extra {
+		payload[name] = value
+	}
+	event.Payload = payload
+	return event, nil
+}
+
+//-----CarPark Methods-----
+
+func (o *OutboxStore) CreateCar(ctx context.Context, car *models.CarPark) (int, error) {
+	var id int
+	err := o.emit(ctx, func(tx Store) ([]*models.OutboxEvent, error) {
+		var err error
+		if id, err = tx.CreateCar(ctx, car); err != nil {
+			return nil, err
+		}
+		created, err := tx.GetCarByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		event, err := newEvent(models.EventCarCreated, AuditCar, id, created, nil)
+		return []*models.OutboxEvent{event}, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (o *OutboxStore) UpdateCar(ctx context.Context, id int, car *models.CarPark) error {
+	return o.emit(ctx, func(tx Store) ([]*models.OutboxEvent, error) {
+		if err := tx.UpdateCar(ctx, id, car); err != nil {
+			return nil, err
+		}
+		updated, err := tx.GetCarByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		event, err := newEvent(models.EventCarUpdated, AuditCar, id, updated, nil)
+		return []*models.OutboxEvent{event}, err
+	})
+}
+
+func (o *OutboxStore) TransitionCarStatus(ctx context.Context, id int, status models.CarStatus) (*models.CarPark, error) {
+	var car *models.CarPark
+	err := o.emit(ctx, func(tx Store) ([]*models.OutboxEvent, error) {
+		before, err := tx.GetCarByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if car, err = tx.TransitionCarStatus(ctx, id, status); err != nil {
+			return nil, err
+		}
+		extra := map[string]any{"previous_status": before.Status}
+		event, err := newEvent(models.EventCarStatusChanged, AuditCar, id, car, extra)
+		return []*models.OutboxEvent{event}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return car, nil
+}
+
+// DeleteCar soft-deletes the car; the event carries it as it was
+func (o *OutboxStore) DeleteCar(ctx context.Context, id, version int) error {
+	return o.emit(ctx, func(tx Store) ([]*models.OutboxEvent, error) {
+		deleted, err := tx.GetCarByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.DeleteCar(ctx, id, version); err != nil {
+			return nil, err
+		}
+		event, err := newEvent(models.EventCarDeleted, AuditCar, id, deleted, nil)
+		return []*models.OutboxEvent{event}, err
+	})
+}
+
+func (o *OutboxStore) RestoreCar(ctx context.Context, id int) (*models.CarPark, error) {
+	var car *models.CarPark
+	err := o.emit(ctx, func(tx Store) ([]*models.OutboxEvent, error) {
+		var err error
+		if car, err = tx.RestoreCar(ctx, id); err != nil {
+			return nil, err
+		}
+		event, err := newEvent(models.EventCarRestored, AuditCar, id, car, nil)
+		return []*models.OutboxEvent{event}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return car, nil
+}
+
+// carsByVIN returns the cars with the given VINs, ordered by ID
+func carsByVIN(ctx context.Context, tx Store, vins ...string) ([]*models.CarPark, error) {
+	values := make([]any, len(vins))
+	for i, vin := range vins {
+		values[i] = vin
+	}
+	page, err := tx.ListCars(ctx, &ListQuery{Filters: []Filter{{Field: "vin", Op: OpIn, Value: values}}})
+	if err != nil {
+		return nil, err
+	}
+	return page.Items, nil
+}
+
+// carMoves returns a car.status_changed event for each of the cars, read before an order changed,
+// whose status the order has changed since
+func carMoves(ctx context.Context, tx Store, before []*models.CarPark, orderID int) ([]*models.OutboxEvent, error) {
+	var events []*models.OutboxEvent
+	for _, car := range before {
+		after, err := tx.GetCarByID(ctx, car.ID_Car)
+		if err != nil {
+			return nil, err
+		}
+		if after.Status == car.Status {
+			continue
+		}
+		extra := map[string]any{"previous_status": car.Status, "id_order": orderID}
+		event, err := newEvent(models.EventCarStatusChanged, AuditCar, car.ID_Car, after, extra)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+//-----Order Methods-----
+
+func (o *OutboxStore) CreateOrder(ctx context.Context, order *models.Order, actorID int) (int, error) {
+	var id int
+	err := o.emit(ctx, func(tx Store) ([]*models.OutboxEvent, error) {
+		cars, err := carsByVIN(ctx, tx, order.VIN)
+		if err != nil {
+			return nil, err
+		}
+		if id, err = tx.CreateOrder(ctx, order, actorID); err != nil {
+			return nil, err
+		}
+		created, err := tx.GetOrderByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		event, err := newEvent(models.EventOrderCreated, AuditOrder, id, created, nil)
+		if err != nil {
+			return nil, err
+		}
+		moved, err := carMoves(ctx, tx, cars, id)
+		return append([]*models.OutboxEvent{event}, moved...), err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// UpdateOrder emits an event when the status changes, followed by order.completed or order.cancelled
+// when the order reaches either, and by the status changes of the cars it moves
+func (o *OutboxStore) UpdateOrder(ctx context.Context, id int, order *models.Order, actorID int) error {
+	return o.emit(ctx, func(tx Store) ([]*models.OutboxEvent, error) {
+		before, err := tx.GetOrderByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		cars, err := carsByVIN(ctx, tx, before.VIN, order.VIN)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.UpdateOrder(ctx, id, order, actorID); err != nil {
+			return nil, err
+		}
+		after, err := tx.GetOrderByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		var events []*models.OutboxEvent
+		if after.Status != before.Status {
+			extra := map[string]any{"previous_status": before.Status}
+			if order.StatusReason != nil {
+				extra["status_reason"] = *order.StatusReason
+			}
+			types := []models.EventType{models.EventOrderStatusChanged}
+			switch after.Status {
+			case models.OrderStatusCompleted:
+				types = append(types, models.EventOrderCompleted)
+			case models.OrderStatusCancelled:
+				types = append(types, models.EventOrderCancelled)
+			}
+			for _, eventType := range types {
+				event, err := newEvent(eventType, AuditOrder, id, after, extra)
+				if err != nil {
+					return nil, err
+				}
+				events = append(events, event)
+			}
+		}
+		moved, err := carMoves(ctx, tx, cars, id)
+		return append(events, moved...), err
+	})
+}
+
+// DeleteOrder emits no event of its own, only the release of its car
+func (o *OutboxStore) DeleteOrder(ctx context.Context, id, version int) error {
+	return o.emit(ctx, func(tx Store) ([]*models.OutboxEvent, error) {
+		order, err := tx.GetOrderByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		cars, err := carsByVIN(ctx, tx, order.VIN)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.DeleteOrder(ctx, id, version); err != nil {
+			return nil, err
+		}
+		return carMoves(ctx, tx, cars, id)
+	})
+}
+
+//-----Appointment Methods-----
+
+func (o *OutboxStore) CreateAppointment(ctx context.Context, appointment *models.Appointment) (int, error) {
+	var id int
+	err := o.emit(ctx, func(tx Store) ([]*models.OutboxEvent, error) {
+		var err error
+		if id, err = tx.CreateAppointment(ctx, appointment); err != nil {
+			return nil, err
+		}
+		booked, err := tx.GetAppointmentByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		event, err := newEvent(models.EventAppointmentBooked, AuditAppointment, id, booked, nil)
+		return []*models.OutboxEvent{event}, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// UpdateAppointment emits an event only when the appointment moves or changes length
+func (o *OutboxStore) UpdateAppointment(ctx context.Context, id int, appointment *models.Appointment) error {
+	return o.emit(ctx, func(tx Store) ([]*models.OutboxEvent, error) {
+		before, err := tx.GetAppointmentByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.UpdateAppointment(ctx, id, appointment); err != nil {
+			return nil, err
+		}
+		after, err := tx.GetAppointmentByID(ctx, id)
+		if err != nil || (after.Date.Equal(before.Date) && after.End().Equal(before.End())) {
+			return nil, err
+		}
+		extra := map[string]any{"previous_date": before.Date, "previous_duration_minutes": before.DurationMinutes}
+		event, err := newEvent(models.EventAppointmentRescheduled, AuditAppointment, id, after, extra)
+		return []*models.OutboxEvent{event}, err
+	})
+}
+
+// DeleteAppointment cancels the appointment; the event carries it as it was
+func (o *OutboxStore) DeleteAppointment(ctx context.Context, id, version int) error {
+	return o.emit(ctx, func(tx Store) ([]*models.OutboxEvent, error) {
+		cancelled, err := tx.GetAppointmentByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.DeleteAppointment(ctx, id, version); err != nil {
+			return nil, err
+		}
+		event, err := newEvent(models.EventAppointmentCancelled, AuditAppointment, id, cancelled, nil)
+		return []*models.OutboxEvent{event}, err
+	})
+}
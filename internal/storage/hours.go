@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"keeper/internal/models"
+)
+
+// Opening hours and closures are dealership sub-resources and, like dealerships, use database/sql.
+// Updates and deletes match on both the record and its dealership, so an ID from another branch is not found.
+
+func (s *PostgresStore) ListOpeningHours(ctx context.Context, dealershipID int) ([]*models.OpeningHours, error) {
+	query := `SELECT id_hours, id_dealership, weekday, to_char(opens_at, 'HH24:MI'), to_char(closes_at, 'HH24:MI')
+			  FROM opening_hours
+			  WHERE id_dealership = $1
+			  ORDER BY weekday, opens_at`
+
+	rows, err := s.conn().QueryContext(ctx, query, dealershipID)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	hours := []*models.OpeningHours{}
+	for rows.Next() {
+		h := &models.OpeningHours{}
+		if err := rows.Scan(&h.ID_Hours, &h.ID_Dealership, &h.Weekday, &h.OpensAt, &h.ClosesAt); err != nil {
+			return nil, translateError(err)
+		}
+		hours = append(hours, h)
+	}
+	return hours, translateError(rows.Err())
+}
+
+func (s *PostgresStore) CreateOpeningHours(ctx context.Context, hours *models.OpeningHours) (int, error) {
+	query := `INSERT INTO opening_hours (id_dealership, weekday, opens_at, closes_at)
+			  VALUES ($1, $2, $3, $4)
+			  RETURNING id_hours`
+
+	var newID int
+	err := s.conn().QueryRowContext(ctx, query, hours.ID_Dealership, hours.Weekday, hours.OpensAt, hours.ClosesAt).Scan(&newID)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	hours.ID_Hours = newID
+	return newID, nil
+}
+
+func (s *PostgresStore) UpdateOpeningHours(ctx context.Context, dealershipID, id int, hours *models.OpeningHours) error {
+	query := `UPDATE opening_hours
+			  SET weekday = $1, opens_at = $2, closes_at = $3
+			  WHERE id_hours = $4 AND id_dealership = $5`
+
+	result, err := s.conn().ExecContext(ctx, query, hours.Weekday, hours.OpensAt, hours.ClosesAt, id, dealershipID)
+	if err != nil {
+		return translateError(err)
+	}
+	hours.ID_Hours = id
+	hours.ID_Dealership = dealershipID
+	return translateError(checkRowsAffected(result))
+}
+
+func (s *PostgresStore) DeleteOpeningHours(ctx context.Context, dealershipID, id int) error {
+	query := `DELETE FROM opening_hours WHERE id_hours = $1 AND id_dealership = $2`
+	result, err := s.conn().ExecContext(ctx, query, id, dealershipID)
+	if err != nil {
+		return translateError(err)
+	}
+	return translateError(checkRowsAffected(result))
+}
+
+func (s *PostgresStore) ListClosures(ctx context.Context, dealershipID int) ([]*models.Closure, error) {
+	query := `SELECT id_closure, id_dealership, startdate, enddate, reason
+			  FROM dealership_closure
+			  WHERE id_dealership = $1
+			  ORDER BY startdate`
+
+	rows, err := s.conn().QueryContext(ctx, query, dealershipID)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	closures := []*models.Closure{}
+	for rows.Next() {
+		c := &models.Closure{}
+		if err := rows.Scan(&c.ID_Closure, &c.ID_Dealership, &c.StartDate, &c.EndDate, &c.Reason); err != nil {
+			return nil, translateError(err)
+		}
+		closures = append(closures, c)
+	}
+	return closures, translateError(rows.Err())
+}
+
+func (s *PostgresStore) CreateClosure(ctx context.Context, closure *models.Closure) (int, error) {
+	query := `INSERT INTO dealership_closure (id_dealership, startdate, enddate, reason)
+			  VALUES ($1, $2, $3, $4)
+			  RETURNING id_closure`
+
+	var newID int
+	err := s.conn().QueryRowContext(ctx, query, closure.ID_Dealership, closure.StartDate, closure.EndDate, closure.Reason).Scan(&newID)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	closure.ID_Closure = newID
+	return newID, nil
+}
+
+func (s *PostgresStore) UpdateClosure(ctx context.Context, dealershipID, id int, closure *models.Closure) error {
+	query := `UPDATE dealership_closure
+			  SET startdate = $1, enddate = $2, reason = $3
+			  WHERE id_closure = $4 AND id_dealership = $5`
+
+	result, err := s.conn().ExecContext(ctx, query, closure.StartDate, closure.EndDate, closure.Reason, id, dealershipID)
+	if err != nil {
+		return translateError(err)
+	}
+	closure.ID_Closure = id
+	closure.ID_Dealership = dealershipID
+	return translateError(checkRowsAffected(result))
+}
+
+func (s *PostgresStore) DeleteClosure(ctx context.Context, dealershipID, id int) error {
+	query := `DELETE FROM dealership_closure WHERE id_closure = $1 AND id_dealership = $2`
+	result, err := s.conn().ExecContext(ctx, query, id, dealershipID)
+	if err != nil {
+		return translateError(err)
+	}
+	return translateError(checkRowsAffected(result))
+}
+
+// checkRowsAffected is the database/sql counterpart of checkResult
+func checkRowsAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return translateError(err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"keeper/internal/models"
+	"time"
+)
+
+// Idempotency keys use database/sql: reserving a key is a single upsert, which GORM cannot express
+// with the conditional DO UPDATE that takes over expired keys. Ages are computed with the database
+// clock, the same that fills the created column.
+
+func (s *PostgresStore) ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey, ttl time.Duration) (*models.IdempotencyKey, error) {
+	reserve := `INSERT INTO idempotency_key AS k (idempotency_key, route, id_employee, request_hash)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (idempotency_key, route, id_employee) DO UPDATE
+				SET request_hash = EXCLUDED.request_hash, status_code = NULL, content_type = NULL, body = NULL, created = CURRENT_TIMESTAMP
+				WHERE k.created < CURRENT_TIMESTAMP - $5::float8 * INTERVAL '1 second'
+				RETURNING created`
+	lookup := `SELECT request_hash, status_code, content_type, body, created
+			   FROM idempotency_key
+			   WHERE idempotency_key = $1 AND route = $2 AND id_employee = $3`
+
+	// A key released between the two statements is reserved on the next attempt
+	for {
+		err := s.conn().QueryRowContext(ctx, reserve, key.Key, key.Route, key.ID_Employee, key.RequestHash, ttl.Seconds()).Scan(&key.Created)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, translateError(err)
+		}
+
+		stored := &models.IdempotencyKey{Key: key.Key, Route: key.Route, ID_Employee: key.ID_Employee}
+		err = s.conn().QueryRowContext(ctx, lookup, key.Key, key.Route, key.ID_Employee).
+			Scan(&stored.RequestHash, &stored.StatusCode, &stored.ContentType, &stored.Body, &stored.Created)
+		if err == nil {
+			return stored, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, translateError(err)
+		}
+	}
+}
+
+func (s *PostgresStore) CompleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	query := `UPDATE idempotency_key
+			  SET status_code = $4, content_type = $5, body = $6
+			  WHERE idempotency_key = $1 AND route = $2 AND id_employee = $3`
+
+	result, err := s.conn().ExecContext(ctx, query, key.Key, key.Route, key.ID_Employee, key.StatusCode, key.ContentType, key.Body)
+	if err != nil {
+		return translateError(err)
+	}
+	return translateError(checkRowsAffected(result))
+}
+
+func (s *PostgresStore) ReleaseIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	query := `DELETE FROM idempotency_key
+			  WHERE idempotency_key = $1 AND route = $2 AND id_employee = $3 AND status_code IS NULL`
+
+	_, err := s.conn().ExecContext(ctx, query, key.Key, key.Route, key.ID_Employee)
+	return translateError(err)
+}
+
+func (s *PostgresStore) DeleteExpiredIdempotencyKeys(ctx context.Context, ttl time.Duration) (int64, error) {
+	query := `DELETE FROM idempotency_key WHERE created < CURRENT_TIMESTAMP - $1::float8 * INTERVAL '1 second'`
+
+	result, err := s.conn().ExecContext(ctx, query, ttl.Seconds())
+	if err != nil {
+		return 0, translateError(err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted, translateError(err)
+}
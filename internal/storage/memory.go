@@ -0,0 +1,1790 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"keeper/internal/models"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoryStore is a thread-safe Store that keeps every table in memory. It enforces the same
+// unique keys, foreign keys (including ON DELETE RESTRICT/CASCADE), check constraints and
+// not-found errors as PostgresStore, so the API can be exercised without a database.
+// Data is lost when the process exits.
+type MemoryStore struct {
+	mu   *sync.RWMutex
+	data *memoryData
+	inTx bool // Set on the copies handed out by WithTx, which already hold the lock
+}
+
+// memoryData holds one map per table, keyed by primary key
+type memoryData struct {
+	seq          map[string]int // Last ID issued per table
+	dealerships  map[int]models.Dealership
+	hours        map[int]models.OpeningHours
+	closures     map[int]models.Closure
+	employees    map[int]models.Employee
+	credentials  map[int]models.EmployeeCredential // Keyed by employee ID
+	employments  map[int]models.Employment
+	clients      map[int]models.Client
+	cars         map[int]models.CarPark
+	orders       map[int]models.Order
+	history      map[int]models.OrderStatusChange
+	appointments map[int]models.Appointment
+	audit        map[int]models.AuditEntry
+	outbox       map[int]models.OutboxEvent
+	webhooks     map[int]models.Webhook
+	deliveries   map[int]models.WebhookDelivery
+	idempotency  map[idempotencyID]models.IdempotencyKey
+}
+
+// idempotencyID is the primary key of an idempotency key
+type idempotencyID struct {
+	key        string
+	route      string
+	employeeID int
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mu: &sync.RWMutex{},
+		data: &memoryData{
+			seq:          map[string]int{},
+			dealerships:  map[int]models.Dealership{},
+			hours:        map[int]models.OpeningHours{},
+			closures:     map[int]models.Closure{},
+			employees:    map[int]models.Employee{},
+			credentials:  map[int]models.EmployeeCredential{},
+			employments:  map[int]models.Employment{},
+			clients:      map[int]models.Client{},
+			cars:         map[int]models.CarPark{},
+			orders:       map[int]models.Order{},
+			history:      map[int]models.OrderStatusChange{},
+			appointments: map[int]models.Appointment{},
+			audit:        map[int]models.AuditEntry{},
+			outbox:       map[int]models.OutboxEvent{},
+			webhooks:     map[int]models.Webhook{},
+			deliveries:   map[int]models.WebhookDelivery{},
+			idempotency:  map[idempotencyID]models.IdempotencyKey{},
+		},
+	}
+}
+
+// clone copies every table, so that a failed write can be discarded as a whole
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		seq:          maps.Clone(d.seq),
+		dealerships:  maps.Clone(d.dealerships),
+		hours:        maps.Clone(d.hours),
+		closures:     maps.Clone(d.closures),
+		employees:    maps.Clone(d.employees),
+		credentials:  maps.Clone(d.credentials),
+		employments:  maps.Clone(d.employments),
+		clients:      maps.Clone(d.clients),
+		cars:         maps.Clone(d.cars),
+		orders:       maps.Clone(d.orders),
+		history:      maps.Clone(d.history),
+		appointments: maps.Clone(d.appointments),
+		audit:        maps.Clone(d.audit),
+		outbox:       maps.Clone(d.outbox),
+		webhooks:     maps.Clone(d.webhooks),
+		deliveries:   maps.Clone(d.deliveries),
+		idempotency:  maps.Clone(d.idempotency),
+	}
+}
+
+// nextID issues the next serial ID of a table
+func (d *memoryData) nextID(table string) int {
+	d.seq[table]++
+	return d.seq[table]
+}
+
+// read runs fn under the read lock
+func (m *MemoryStore) read(ctx context.Context, fn func(d *memoryData) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !m.inTx {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+	}
+	return fn(m.data)
+}
+
+// write runs fn under the write lock on a copy of the data, which replaces the data only if fn
+// succeeds. Like a statement or transaction in Postgres, a failed write changes nothing.
+func (m *MemoryStore) write(ctx context.Context, fn func(d *memoryData) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !m.inTx {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+	}
+	next := m.data.clone()
+	if err := fn(next); err != nil {
+		return err
+	}
+	*m.data = *next
+	return nil
+}
+
+// WithTx runs fn with exclusive access to the store; its changes are discarded if fn returns an error.
+// fn must only use tx: calling the outer store from inside fn deadlocks.
+func (m *MemoryStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return m.write(ctx, func(d *memoryData) error {
+		return fn(&MemoryStore{mu: m.mu, data: d, inTx: true})
+	})
+}
+
+// softDelete marks a record deleted now, as GORM does for models with a DeletedAt field
+func softDelete(deletedAt *gorm.DeletedAt) {
+	*deletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+}
+
+// Constraint errors, as translateError reports them for PostgresStore
+
+func uniqueViolation(table, column string) error {
+	return &UniqueViolationError{Table: table, Field: column}
+}
+
+// referencedTables maps each foreign key column to the table it refers to
+var referencedTables = map[string]string{
+	"id_dealership": "dealership",
+	"id_employee":   "employee",
+	"id_client":     "client",
+	"vin":           "car_park",
+}
+
+func foreignKeyViolation(table, column string) error {
+	return &ForeignKeyViolationError{Table: table, Field: column, Referenced: referencedTables[column]}
+}
+
+func checkViolation(table, constraint string) error {
+	return &CheckViolationError{Table: table, Constraint: constraint}
+}
+
+// referencedError builds the *ReferencedError of checkDependencies from (name, count) pairs
+func referencedError(counts ...any) error {
+	var references []Reference
+	for i := 0; i+1 < len(counts); i += 2 {
+		if n := counts[i+1].(int); n > 0 {
+			references = append(references, Reference{Resource: counts[i].(string), Count: int64(n)})
+		}
+	}
+	if len(references) > 0 {
+		sort.Slice(references, func(i, j int) bool { return references[i].Resource < references[j].Resource })
+		return &ReferencedError{References: references}
+	}
+	return nil
+}
+
+// count returns the number of rows of a table matching pred
+func count[T any](rows map[int]T, pred func(T) bool) int {
+	n := 0
+	for _, row := range rows {
+		if pred(row) {
+			n++
+		}
+	}
+	return n
+}
+
+//-----Dealership Methods-----
+
+func (m *MemoryStore) CreateDealership(ctx context.Context, dealership *models.Dealership) (int, error) {
+	var newID int
+	err := m.write(ctx, func(d *memoryData) error {
+		newID = d.nextID("dealership")
+		dealership.Version = 1
+		row := *dealership
+		row.ID_Dealership = newID
+		d.dealerships[newID] = row
+		return nil
+	})
+	return newID, err
+}
+
+func (m *MemoryStore) ListDealerships(ctx context.Context, query *ListQuery) (page *Page[*models.Dealership], err error) {
+	err = m.read(ctx, func(d *memoryData) error {
+		page, err = listMemory(d.dealerships, query, DealershipFields, nil)
+		return err
+	})
+	return page, err
+}
+
+func (m *MemoryStore) GetDealershipByID(ctx context.Context, id int) (*models.Dealership, error) {
+	var dealership models.Dealership
+	err := m.read(ctx, func(d *memoryData) error {
+		row, ok := d.dealerships[id]
+		if !ok {
+			return ErrNotFound
+		}
+		dealership = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dealership, nil
+}
+
+func (m *MemoryStore) UpdateDealership(ctx context.Context, id int, dealership *models.Dealership) error {
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.dealerships[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, dealership.Version); err != nil {
+			return err
+		}
+		dealership.ID_Dealership = id
+		dealership.Version = current.Version + 1
+		d.dealerships[id] = *dealership
+		return nil
+	})
+}
+
+func (m *MemoryStore) DeleteDealership(ctx context.Context, id, version int) error {
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.dealerships[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, version); err != nil {
+			return err
+		}
+		err := referencedError(
+			"cars", count(d.cars, func(c models.CarPark) bool { return c.ID_Dealership == id }),
+			"employments", count(d.employments, func(e models.Employment) bool { return e.ID_Dealership == id }),
+			"orders", count(d.orders, func(o models.Order) bool { return o.ID_Dealership == id }),
+			"appointments", count(d.appointments, func(a models.Appointment) bool { return a.ID_Dealership == id }),
+		)
+		if err != nil {
+			return err
+		}
+
+		delete(d.dealerships, id)
+		maps.DeleteFunc(d.hours, func(_ int, h models.OpeningHours) bool { return h.ID_Dealership == id })
+		maps.DeleteFunc(d.closures, func(_ int, c models.Closure) bool { return c.ID_Dealership == id })
+		return nil
+	})
+}
+
+//-----Opening Hours & Closure Methods-----
+
+func (m *MemoryStore) ListOpeningHours(ctx context.Context, dealershipID int) ([]*models.OpeningHours, error) {
+	hours := []*models.OpeningHours{}
+	err := m.read(ctx, func(d *memoryData) error {
+		for _, id := range sortedKeys(d.hours) {
+			if h := d.hours[id]; h.ID_Dealership == dealershipID {
+				hours = append(hours, &h)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(hours, func(i, j int) bool {
+		if hours[i].Weekday != hours[j].Weekday {
+			return hours[i].Weekday < hours[j].Weekday
+		}
+		return hours[i].OpensAt < hours[j].OpensAt
+	})
+	return hours, nil
+}
+
+// checkOpeningHours enforces the foreign key and check constraints of opening_hours
+func (d *memoryData) checkOpeningHours(hours *models.OpeningHours) error {
+	if _, ok := d.dealerships[hours.ID_Dealership]; !ok {
+		return foreignKeyViolation("opening_hours", "id_dealership")
+	}
+	if hours.Weekday < 1 || hours.Weekday > 7 {
+		return checkViolation("opening_hours", "weekday BETWEEN 1 AND 7")
+	}
+	if hours.OpensAt >= hours.ClosesAt {
+		return checkViolation("opening_hours", "opens_at < closes_at")
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateOpeningHours(ctx context.Context, hours *models.OpeningHours) (int, error) {
+	var newID int
+	err := m.write(ctx, func(d *memoryData) error {
+		if err := d.checkOpeningHours(hours); err != nil {
+			return err
+		}
+		newID = d.nextID("opening_hours")
+		row := *hours
+		row.ID_Hours = newID
+		d.hours[newID] = row
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	hours.ID_Hours = newID
+	return newID, nil
+}
+
+func (m *MemoryStore) UpdateOpeningHours(ctx context.Context, dealershipID, id int, hours *models.OpeningHours) error {
+	return m.write(ctx, func(d *memoryData) error {
+		if current, ok := d.hours[id]; !ok || current.ID_Dealership != dealershipID {
+			return ErrNotFound
+		}
+		hours.ID_Hours = id
+		hours.ID_Dealership = dealershipID
+		if err := d.checkOpeningHours(hours); err != nil {
+			return err
+		}
+		d.hours[id] = *hours
+		return nil
+	})
+}
+
+func (m *MemoryStore) DeleteOpeningHours(ctx context.Context, dealershipID, id int) error {
+	return m.write(ctx, func(d *memoryData) error {
+		if current, ok := d.hours[id]; !ok || current.ID_Dealership != dealershipID {
+			return ErrNotFound
+		}
+		delete(d.hours, id)
+		return nil
+	})
+}
+
+func (m *MemoryStore) ListClosures(ctx context.Context, dealershipID int) ([]*models.Closure, error) {
+	closures := []*models.Closure{}
+	err := m.read(ctx, func(d *memoryData) error {
+		for _, id := range sortedKeys(d.closures) {
+			if c := d.closures[id]; c.ID_Dealership == dealershipID {
+				closures = append(closures, &c)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(closures, func(i, j int) bool {
+		return closures[i].StartDate.Before(closures[j].StartDate)
+	})
+	return closures, nil
+}
+
+// checkClosure enforces the foreign key and check constraints of dealership_closure
+func (d *memoryData) checkClosure(closure *models.Closure) error {
+	if _, ok := d.dealerships[closure.ID_Dealership]; !ok {
+		return foreignKeyViolation("dealership_closure", "id_dealership")
+	}
+	if closure.EndDate.Before(closure.StartDate) {
+		return checkViolation("dealership_closure", "startdate <= enddate")
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateClosure(ctx context.Context, closure *models.Closure) (int, error) {
+	var newID int
+	err := m.write(ctx, func(d *memoryData) error {
+		if err := d.checkClosure(closure); err != nil {
+			return err
+		}
+		newID = d.nextID("dealership_closure")
+		row := *closure
+		row.ID_Closure = newID
+		d.closures[newID] = row
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	closure.ID_Closure = newID
+	return newID, nil
+}
+
+func (m *MemoryStore) UpdateClosure(ctx context.Context, dealershipID, id int, closure *models.Closure) error {
+	return m.write(ctx, func(d *memoryData) error {
+		if current, ok := d.closures[id]; !ok || current.ID_Dealership != dealershipID {
+			return ErrNotFound
+		}
+		closure.ID_Closure = id
+		closure.ID_Dealership = dealershipID
+		if err := d.checkClosure(closure); err != nil {
+			return err
+		}
+		d.closures[id] = *closure
+		return nil
+	})
+}
+
+func (m *MemoryStore) DeleteClosure(ctx context.Context, dealershipID, id int) error {
+	return m.write(ctx, func(d *memoryData) error {
+		if current, ok := d.closures[id]; !ok || current.ID_Dealership != dealershipID {
+			return ErrNotFound
+		}
+		delete(d.closures, id)
+		return nil
+	})
+}
+
+//-----Employee Methods-----
+
+// liveEmployee reports whether an employee exists and is not deleted, as a new reference to it requires
+func (d *memoryData) liveEmployee(id int) bool {
+	employee, ok := d.employees[id]
+	return ok && !employee.DeletedAt.Valid
+}
+
+// checkEmployee enforces the unique TIN of an employee among those not deleted
+func (d *memoryData) checkEmployee(employee *models.Employee) error {
+	for id, other := range d.employees {
+		if id != employee.ID_Employee && !other.DeletedAt.Valid && other.TIN == employee.TIN {
+			return uniqueViolation("employee", "tin")
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateEmployee(ctx context.Context, employee *models.Employee) (int, error) {
+	err := m.write(ctx, func(d *memoryData) error {
+		if employee.Role == "" {
+			employee.Role = models.RoleAssistant
+		}
+		employee.ID_Employee = 0
+		if err := d.checkEmployee(employee); err != nil {
+			return err
+		}
+		employee.Version = 1
+		employee.DeletedAt = gorm.DeletedAt{}
+		employee.ID_Employee = d.nextID("employee")
+		d.employees[employee.ID_Employee] = *employee
+		return nil
+	})
+	if err != nil {
+		employee.ID_Employee = 0
+		return 0, err
+	}
+	return employee.ID_Employee, nil
+}
+
+func (m *MemoryStore) ListEmployees(ctx context.Context, query *ListQuery) (page *Page[*models.Employee], err error) {
+	err = m.read(ctx, func(d *memoryData) error {
+		page, err = listMemory(d.employees, query, EmployeeFields, nil)
+		return err
+	})
+	return page, err
+}
+
+func (m *MemoryStore) GetEmployeeByID(ctx context.Context, id int) (*models.Employee, error) {
+	var employee models.Employee
+	err := m.read(ctx, func(d *memoryData) error {
+		row, ok := d.employees[id]
+		if !ok || row.DeletedAt.Valid {
+			return ErrNotFound
+		}
+		employee = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &employee, nil
+}
+
+func (m *MemoryStore) UpdateEmployee(ctx context.Context, id int, employee *models.Employee) error {
+	employee.ID_Employee = id
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.employees[id]
+		if !ok || current.DeletedAt.Valid {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, employee.Version); err != nil {
+			return err
+		}
+		if err := d.checkEmployee(employee); err != nil {
+			return err
+		}
+		employee.DeletedAt = gorm.DeletedAt{}
+		employee.Version = current.Version + 1
+		d.employees[id] = *employee
+		return nil
+	})
+}
+
+// DeleteEmployee soft-deletes an employee; the credential and the order history entries of the
+// employee are kept for a restore
+func (m *MemoryStore) DeleteEmployee(ctx context.Context, id, version int) error {
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.employees[id]
+		if !ok || current.DeletedAt.Valid {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, version); err != nil {
+			return err
+		}
+		active := count(d.employments, func(e models.Employment) bool { return e.ID_Employee == id && e.EndDate == nil })
+		if err := referencedError("employments", active); err != nil {
+			return err
+		}
+
+		softDelete(&current.DeletedAt)
+		current.Version++
+		d.employees[id] = current
+		return nil
+	})
+}
+
+func (m *MemoryStore) RestoreEmployee(ctx context.Context, id int) (*models.Employee, error) {
+	var employee models.Employee
+	err := m.write(ctx, func(d *memoryData) error {
+		var ok bool
+		if employee, ok = d.employees[id]; !ok {
+			return ErrNotFound
+		}
+		if !employee.DeletedAt.Valid {
+			return fmt.Errorf("%w: employee %d", ErrNotDeleted, id)
+		}
+		employee.DeletedAt = gorm.DeletedAt{}
+		if err := d.checkEmployee(&employee); err != nil {
+			return err
+		}
+		employee.Version++
+		d.employees[id] = employee
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &employee, nil
+}
+
+//-----Credential Methods-----
+
+func (m *MemoryStore) SetEmployeeCredential(ctx context.Context, credential *models.EmployeeCredential) error {
+	return m.write(ctx, func(d *memoryData) error {
+		if !d.liveEmployee(credential.ID_Employee) {
+			return foreignKeyViolation("employee_credential", "id_employee")
+		}
+		for id, other := range d.credentials {
+			if id != credential.ID_Employee && other.Username == credential.Username {
+				return uniqueViolation("employee_credential", "username")
+			}
+		}
+		row := *credential
+		row.LastUpdate = time.Now()
+		d.credentials[credential.ID_Employee] = row
+		return nil
+	})
+}
+
+func (m *MemoryStore) GetEmployeeCredentialByUsername(ctx context.Context, username string) (*models.EmployeeCredential, error) {
+	var credential models.EmployeeCredential
+	err := m.read(ctx, func(d *memoryData) error {
+		for _, row := range d.credentials {
+			if row.Username == username && d.liveEmployee(row.ID_Employee) {
+				credential = row
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (m *MemoryStore) GetEmployeeCredentialByEmployeeID(ctx context.Context, employeeID int) (*models.EmployeeCredential, error) {
+	var credential models.EmployeeCredential
+	err := m.read(ctx, func(d *memoryData) error {
+		var ok bool
+		if credential, ok = d.credentials[employeeID]; !ok {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+//-----Employment Methods-----
+
+// checkEmployment enforces the foreign keys of an employment
+func (d *memoryData) checkEmployment(employment *models.Employment) error {
+	if !d.liveEmployee(employment.ID_Employee) {
+		return foreignKeyViolation("employment", "id_employee")
+	}
+	if _, ok := d.dealerships[employment.ID_Dealership]; !ok {
+		return foreignKeyViolation("employment", "id_dealership")
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateEmployment(ctx context.Context, employment *models.Employment) (int, error) {
+	err := m.write(ctx, func(d *memoryData) error {
+		if err := d.checkEmployment(employment); err != nil {
+			return err
+		}
+		employment.Version = 1
+		employment.ID_Employment = d.nextID("employment")
+		d.employments[employment.ID_Employment] = *employment
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return employment.ID_Employment, nil
+}
+
+func (m *MemoryStore) ListEmployments(ctx context.Context, query *ListQuery) (page *Page[*models.Employment], err error) {
+	computed := map[string]func(*models.Employment) any{
+		"active": func(e *models.Employment) any { return e.EndDate == nil },
+	}
+	err = m.read(ctx, func(d *memoryData) error {
+		page, err = listMemory(d.employments, query, EmploymentFields, computed)
+		return err
+	})
+	return page, err
+}
+
+func (m *MemoryStore) GetEmploymentByID(ctx context.Context, id int) (*models.Employment, error) {
+	var employment models.Employment
+	err := m.read(ctx, func(d *memoryData) error {
+		row, ok := d.employments[id]
+		if !ok {
+			return ErrNotFound
+		}
+		employment = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &employment, nil
+}
+
+func (m *MemoryStore) UpdateEmployment(ctx context.Context, id int, employment *models.Employment) error {
+	employment.ID_Employment = id
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.employments[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, employment.Version); err != nil {
+			return err
+		}
+		if err := d.checkEmployment(employment); err != nil {
+			return err
+		}
+		employment.Version = current.Version + 1
+		d.employments[id] = *employment
+		return nil
+	})
+}
+
+func (m *MemoryStore) DeleteEmployment(ctx context.Context, id, version int) error {
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.employments[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, version); err != nil {
+			return err
+		}
+		delete(d.employments, id)
+		return nil
+	})
+}
+
+func (m *MemoryStore) GetActiveDealershipIDs(ctx context.Context, employeeID int) ([]int, error) {
+	ids := []int{}
+	err := m.read(ctx, func(d *memoryData) error {
+		seen := map[int]bool{}
+		for _, e := range d.employments {
+			if e.ID_Employee == employeeID && e.EndDate == nil && !seen[e.ID_Dealership] {
+				seen[e.ID_Dealership] = true
+				ids = append(ids, e.ID_Dealership)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+//-----Client Methods-----
+
+// liveClient reports whether a client exists and is not deleted, as a new reference to it requires
+func (d *memoryData) liveClient(id int) bool {
+	client, ok := d.clients[id]
+	return ok && !client.DeletedAt.Valid
+}
+
+// checkClient enforces the unique e-mail and TIN/VAT number of a client among those not deleted
+func (d *memoryData) checkClient(client *models.Client) error {
+	for id, other := range d.clients {
+		if id == client.ID_Client || other.DeletedAt.Valid {
+			continue
+		}
+		if other.TIN_VAT == client.TIN_VAT {
+			return uniqueViolation("client", "tin_vat")
+		}
+		if client.Email != nil && other.Email != nil && *other.Email == *client.Email {
+			return uniqueViolation("client", "email")
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateClient(ctx context.Context, client *models.Client) (int, error) {
+	err := m.write(ctx, func(d *memoryData) error {
+		client.ID_Client = 0
+		if err := d.checkClient(client); err != nil {
+			return err
+		}
+		client.Version = 1
+		client.DeletedAt = gorm.DeletedAt{}
+		client.ID_Client = d.nextID("client")
+		d.clients[client.ID_Client] = *client
+		return nil
+	})
+	if err != nil {
+		client.ID_Client = 0
+		return 0, err
+	}
+	return client.ID_Client, nil
+}
+
+func (m *MemoryStore) ListClients(ctx context.Context, query *ListQuery) (page *Page[*models.Client], err error) {
+	err = m.read(ctx, func(d *memoryData) error {
+		page, err = listMemory(d.clients, query, ClientFields, nil)
+		return err
+	})
+	return page, err
+}
+
+func (m *MemoryStore) GetClientByID(ctx context.Context, id int) (*models.Client, error) {
+	var client models.Client
+	err := m.read(ctx, func(d *memoryData) error {
+		row, ok := d.clients[id]
+		if !ok || row.DeletedAt.Valid {
+			return ErrNotFound
+		}
+		client = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (m *MemoryStore) UpdateClient(ctx context.Context, id int, client *models.Client) error {
+	client.ID_Client = id
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.clients[id]
+		if !ok || current.DeletedAt.Valid {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, client.Version); err != nil {
+			return err
+		}
+		if err := d.checkClient(client); err != nil {
+			return err
+		}
+		client.DeletedAt = gorm.DeletedAt{}
+		client.Version = current.Version + 1
+		d.clients[id] = *client
+		return nil
+	})
+}
+
+func (m *MemoryStore) DeleteClient(ctx context.Context, id, version int) error {
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.clients[id]
+		if !ok || current.DeletedAt.Valid {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, version); err != nil {
+			return err
+		}
+		softDelete(&current.DeletedAt)
+		current.Version++
+		d.clients[id] = current
+		return nil
+	})
+}
+
+func (m *MemoryStore) RestoreClient(ctx context.Context, id int) (*models.Client, error) {
+	var client models.Client
+	err := m.write(ctx, func(d *memoryData) error {
+		var ok bool
+		if client, ok = d.clients[id]; !ok {
+			return ErrNotFound
+		}
+		if !client.DeletedAt.Valid {
+			return fmt.Errorf("%w: client %d", ErrNotDeleted, id)
+		}
+		client.DeletedAt = gorm.DeletedAt{}
+		if err := d.checkClient(&client); err != nil {
+			return err
+		}
+		client.Version++
+		d.clients[id] = client
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+//-----CarPark Methods-----
+
+// carByVIN returns the car with the given VIN that is not deleted
+func (d *memoryData) carByVIN(vin string) (models.CarPark, bool) {
+	for _, car := range d.cars {
+		if car.VIN != nil && *car.VIN == vin && !car.DeletedAt.Valid {
+			return car, true
+		}
+	}
+	return models.CarPark{}, false
+}
+
+// vinReferences counts the orders and appointments that refer to a VIN
+func (d *memoryData) vinReferences(vin string) (orders, appointments int) {
+	orders = count(d.orders, func(o models.Order) bool { return o.VIN == vin })
+	appointments = count(d.appointments, func(a models.Appointment) bool { return a.VIN != nil && *a.VIN == vin })
+	return orders, appointments
+}
+
+// checkCar enforces the unique keys among the cars not deleted, the foreign key and check constraints
+// of a car, and refuses to change the VIN of a car that orders or appointments refer to
+func (d *memoryData) checkCar(car *models.CarPark) error {
+	if _, ok := d.dealerships[car.ID_Dealership]; !ok {
+		return foreignKeyViolation("car_park", "id_dealership")
+	}
+	if car.Year <= 1900 || car.Year > time.Now().Year()+1 {
+		return checkViolation("car_park", `"year" > 1900 AND "year" <= next year`)
+	}
+	for id, other := range d.cars {
+		if id == car.ID_Car {
+			if other.VIN != nil && (car.VIN == nil || *car.VIN != *other.VIN) {
+				orders, appointments := d.vinReferences(*other.VIN)
+				if err := referencedError("orders", orders, "appointments", appointments); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if other.DeletedAt.Valid {
+			continue
+		}
+		if other.Plate == car.Plate {
+			return uniqueViolation("car_park", "plate")
+		}
+		if car.VIN != nil && other.VIN != nil && *other.VIN == *car.VIN {
+			return uniqueViolation("car_park", "vin")
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateCar(ctx context.Context, car *models.CarPark) (int, error) {
+	err := m.write(ctx, func(d *memoryData) error {
+		if car.Status == "" {
+			car.Status = models.CarStatusInStock
+		}
+		if car.Condition == "" {
+			car.Condition = models.CondTypeNew
+		}
+		if car.KM == "" {
+			car.KM = "0"
+		}
+		car.ID_Car = 0
+		if err := d.checkCar(car); err != nil {
+			return err
+		}
+		car.Version = 1
+		car.DeletedAt = gorm.DeletedAt{}
+		car.ID_Car = d.nextID("car_park")
+		d.cars[car.ID_Car] = *car
+		return nil
+	})
+	if err != nil {
+		car.ID_Car = 0
+		return 0, err
+	}
+	return car.ID_Car, nil
+}
+
+func (m *MemoryStore) ListCars(ctx context.Context, query *ListQuery) (page *Page[*models.CarPark], err error) {
+	err = m.read(ctx, func(d *memoryData) error {
+		computed := map[string]func(*models.CarPark) any{
+			"city": func(c *models.CarPark) any {
+				if dealership, ok := d.dealerships[c.ID_Dealership]; ok {
+					return dealership.City
+				}
+				return nil
+			},
+		}
+		page, err = listMemory(d.cars, query, CarFields, computed)
+		return err
+	})
+	return page, err
+}
+
+func (m *MemoryStore) GetCarByID(ctx context.Context, id int) (*models.CarPark, error) {
+	var car models.CarPark
+	err := m.read(ctx, func(d *memoryData) error {
+		row, ok := d.cars[id]
+		if !ok || row.DeletedAt.Valid {
+			return ErrNotFound
+		}
+		car = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &car, nil
+}
+
+// UpdateCar replaces every field of a car except its status, which only changes through TransitionCarStatus
+func (m *MemoryStore) UpdateCar(ctx context.Context, id int, car *models.CarPark) error {
+	car.ID_Car = id
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.cars[id]
+		if !ok || current.DeletedAt.Valid {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, car.Version); err != nil {
+			return err
+		}
+		car.DeletedAt = gorm.DeletedAt{}
+		row := *car
+		row.Status = current.Status
+		if err := d.checkCar(&row); err != nil {
+			return err
+		}
+		car.Version = current.Version + 1
+		row.Version = car.Version
+		d.cars[id] = row
+		return nil
+	})
+}
+
+// TransitionCarStatus moves a car to a new lifecycle status, rejecting moves not allowed by the transition graph
+func (m *MemoryStore) TransitionCarStatus(ctx context.Context, id int, status models.CarStatus) (*models.CarPark, error) {
+	var car models.CarPark
+	err := m.write(ctx, func(d *memoryData) error {
+		var ok bool
+		if car, ok = d.cars[id]; !ok || car.DeletedAt.Valid {
+			return ErrNotFound
+		}
+
+		if !car.Status.CanTransitionTo(status) {
+			return fmt.Errorf("%w: car %d cannot move from %s to %s", ErrInvalidTransition, id, car.Status, status)
+		}
+
+		// While an order holds the car, its status follows the order
+		if car.VIN != nil {
+			active := count(d.orders, func(o models.Order) bool { return o.VIN == *car.VIN && o.Status.IsActive() })
+			if active > 0 {
+				return fmt.Errorf("%w: car %d has an active order, change the order instead", ErrCarUnavailable, id)
+			}
+		}
+
+		car.Status = status
+		car.Version++
+		d.cars[id] = car
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &car, nil
+}
+
+// moveCar moves the car with the given VIN to status, failing with ErrCarUnavailable
+// if the car does not exist or the lifecycle graph forbids the move
+func (d *memoryData) moveCar(vin string, status models.CarStatus) error {
+	car, ok := d.carByVIN(vin)
+	if !ok {
+		return fmt.Errorf("%w: no car with VIN %s", ErrCarUnavailable, vin)
+	}
+	if !car.Status.CanTransitionTo(status) {
+		return fmt.Errorf("%w: car %s is %s and cannot become %s", ErrCarUnavailable, vin, car.Status, status)
+	}
+	car.Status = status
+	car.Version++
+	d.cars[car.ID_Car] = car
+	return nil
+}
+
+// checkCarDealership fails with ErrCarElsewhere unless the car with the given VIN belongs to dealershipID;
+// a missing car is left to moveCar
+func (d *memoryData) checkCarDealership(vin string, dealershipID int) error {
+	if car, ok := d.carByVIN(vin); ok && car.ID_Dealership != dealershipID {
+		return fmt.Errorf("%w: car %s belongs to dealership %d, not %d", ErrCarElsewhere, vin, car.ID_Dealership, dealershipID)
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteCar(ctx context.Context, id, version int) error {
+	return m.write(ctx, func(d *memoryData) error {
+		car, ok := d.cars[id]
+		if !ok || car.DeletedAt.Valid {
+			return ErrNotFound
+		}
+		if err := checkVersion(car.Version, version); err != nil {
+			return err
+		}
+
+		if !car.Status.IsDeletable() {
+			return fmt.Errorf("%w: car %d is %s and cannot be deleted", ErrCarUnavailable, id, car.Status)
+		}
+
+		softDelete(&car.DeletedAt)
+		car.Version++
+		d.cars[id] = car
+		return nil
+	})
+}
+
+func (m *MemoryStore) RestoreCar(ctx context.Context, id int) (*models.CarPark, error) {
+	var car models.CarPark
+	err := m.write(ctx, func(d *memoryData) error {
+		var ok bool
+		if car, ok = d.cars[id]; !ok {
+			return ErrNotFound
+		}
+		if !car.DeletedAt.Valid {
+			return fmt.Errorf("%w: car_park %d", ErrNotDeleted, id)
+		}
+		car.DeletedAt = gorm.DeletedAt{}
+		if err := d.checkCar(&car); err != nil {
+			return err
+		}
+		car.Version++
+		d.cars[id] = car
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &car, nil
+}
+
+//-----Order Methods-----
+
+// checkOrder enforces the foreign keys of an order other than its VIN, which moveCar checks
+func (d *memoryData) checkOrder(order *models.Order) error {
+	if !d.liveClient(order.ID_Client) {
+		return foreignKeyViolation("order", "id_client")
+	}
+	if !d.liveEmployee(order.ID_Employee) {
+		return foreignKeyViolation("order", "id_employee")
+	}
+	if _, ok := d.dealerships[order.ID_Dealership]; !ok {
+		return foreignKeyViolation("order", "id_dealership")
+	}
+	if _, ok := d.carByVIN(order.VIN); !ok {
+		return foreignKeyViolation("order", "vin")
+	}
+	return nil
+}
+
+// recordOrderStatus appends the current status of order to its history
+func (d *memoryData) recordOrderStatus(order *models.Order, from *models.OrderStatus, actorID int) error {
+	change := models.OrderStatusChange{
+		ID_Change:  d.nextID("order_status_history"),
+		ID_Order:   order.ID_Order,
+		FromStatus: from,
+		ToStatus:   order.Status,
+		Reason:     order.StatusReason,
+		ChangedAt:  order.LastUpdate,
+	}
+	if actorID != 0 {
+		if _, ok := d.employees[actorID]; !ok {
+			return foreignKeyViolation("order_status_history", "id_employee")
+		}
+		change.ID_Employee = &actorID
+	}
+	if change.ChangedAt.IsZero() {
+		change.ChangedAt = time.Now()
+	}
+	d.history[change.ID_Change] = change
+	return nil
+}
+
+// CreateOrder inserts a pending order, reserves its car and opens the order history
+func (m *MemoryStore) CreateOrder(ctx context.Context, order *models.Order, actorID int) (int, error) {
+	err := m.write(ctx, func(d *memoryData) error {
+		if err := d.checkCarDealership(order.VIN, order.ID_Dealership); err != nil {
+			return err
+		}
+		if err := d.moveCar(order.VIN, models.CarStatusReserved); err != nil {
+			return err
+		}
+		if order.Status == "" {
+			order.Status = models.OrderStatusPending
+		}
+		if order.LastUpdate.IsZero() {
+			order.LastUpdate = time.Now()
+		}
+		if err := d.checkOrder(order); err != nil {
+			return err
+		}
+		order.Version = 1
+		order.ID_Order = d.nextID("order")
+		row := *order
+		row.StatusReason = nil
+		d.orders[order.ID_Order] = row
+		return d.recordOrderStatus(order, nil, actorID)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return order.ID_Order, nil
+}
+
+func (m *MemoryStore) ListOrders(ctx context.Context, query *ListQuery) (page *Page[*models.Order], err error) {
+	err = m.read(ctx, func(d *memoryData) error {
+		page, err = listMemory(d.orders, query, OrderFields, nil)
+		return err
+	})
+	return page, err
+}
+
+func (m *MemoryStore) GetOrderByID(ctx context.Context, id int) (*models.Order, error) {
+	var order models.Order
+	err := m.read(ctx, func(d *memoryData) error {
+		row, ok := d.orders[id]
+		if !ok {
+			return ErrNotFound
+		}
+		order = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// UpdateOrder replaces an order, enforcing the order state machine and keeping its car in step
+// exactly like PostgresStore.UpdateOrder
+func (m *MemoryStore) UpdateOrder(ctx context.Context, id int, order *models.Order, actorID int) error {
+	order.ID_Order = id
+	order.LastUpdate = time.Now()
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.orders[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, order.Version); err != nil {
+			return err
+		}
+
+		if current.Status != order.Status && !current.Status.CanTransitionTo(order.Status) {
+			return fmt.Errorf("%w: order %d cannot move from %s to %s", ErrInvalidTransition, id, current.Status, order.Status)
+		}
+
+		if current.VIN != order.VIN {
+			if !current.Status.IsActive() {
+				return fmt.Errorf("%w: the car of a %s order cannot be changed", ErrInvalidTransition, current.Status)
+			}
+			if err := d.checkCarDealership(order.VIN, order.ID_Dealership); err != nil {
+				return err
+			}
+			if err := d.moveCar(current.VIN, models.CarStatusInStock); err != nil {
+				return err
+			}
+			if err := d.moveCar(order.VIN, models.CarStatusReserved); err != nil {
+				return err
+			}
+		} else if current.ID_Dealership != order.ID_Dealership {
+			if err := d.checkCarDealership(order.VIN, order.ID_Dealership); err != nil {
+				return err
+			}
+		}
+
+		if current.Status != order.Status {
+			switch order.Status {
+			case models.OrderStatusCompleted:
+				if err := d.moveCar(order.VIN, models.CarStatusSold); err != nil {
+					return err
+				}
+			case models.OrderStatusCancelled:
+				if err := d.moveCar(order.VIN, models.CarStatusInStock); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := d.checkOrder(order); err != nil {
+			return err
+		}
+		order.Version = current.Version + 1
+		row := *order
+		row.StatusReason = nil
+		d.orders[id] = row
+
+		if current.Status != order.Status {
+			return d.recordOrderStatus(order, &current.Status, actorID)
+		}
+		return nil
+	})
+}
+
+func (m *MemoryStore) ListOrderHistory(ctx context.Context, orderID int) ([]*models.OrderStatusChange, error) {
+	var history []*models.OrderStatusChange
+	err := m.read(ctx, func(d *memoryData) error {
+		for _, id := range sortedKeys(d.history) {
+			if change := d.history[id]; change.ID_Order == orderID {
+				history = append(history, &change)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].ChangedAt.Before(history[j].ChangedAt)
+	})
+	return history, nil
+}
+
+// DeleteOrder removes an order and its history, releasing its car if the order was still active
+func (m *MemoryStore) DeleteOrder(ctx context.Context, id, version int) error {
+	return m.write(ctx, func(d *memoryData) error {
+		order, ok := d.orders[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := checkVersion(order.Version, version); err != nil {
+			return err
+		}
+
+		if order.Status.IsActive() {
+			if err := d.moveCar(order.VIN, models.CarStatusInStock); err != nil {
+				return err
+			}
+		}
+
+		delete(d.orders, id)
+		maps.DeleteFunc(d.history, func(_ int, c models.OrderStatusChange) bool { return c.ID_Order == id })
+		return nil
+	})
+}
+
+//-----Appointment Methods-----
+
+// checkAppointment enforces the foreign keys, check constraint and overlap exclusion constraints of an appointment
+func (d *memoryData) checkAppointment(appointment *models.Appointment) error {
+	if !d.liveClient(appointment.ID_Client) {
+		return foreignKeyViolation("appointment", "id_client")
+	}
+	if !d.liveEmployee(appointment.ID_Employee) {
+		return foreignKeyViolation("appointment", "id_employee")
+	}
+	if _, ok := d.dealerships[appointment.ID_Dealership]; !ok {
+		return foreignKeyViolation("appointment", "id_dealership")
+	}
+	if appointment.VIN != nil {
+		if _, ok := d.carByVIN(*appointment.VIN); !ok {
+			return foreignKeyViolation("appointment", "vin")
+		}
+	}
+	if appointment.DurationMinutes < models.MinAppointmentMinutes || appointment.DurationMinutes > models.MaxAppointmentMinutes {
+		return checkViolation("appointment", "duration_minutes BETWEEN 5 AND 480")
+	}
+
+	for id, other := range d.appointments {
+		if id == appointment.ID_Appointment {
+			continue
+		}
+		if !appointment.Date.Before(other.End()) || !other.Date.Before(appointment.End()) {
+			continue
+		}
+		if other.ID_Employee == appointment.ID_Employee {
+			return slotTakenError(constraintEmployeeOverlap, appointment)
+		}
+		if appointment.VIN != nil && other.VIN != nil && *other.VIN == *appointment.VIN {
+			return slotTakenError(constraintVehicleOverlap, appointment)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateAppointment(ctx context.Context, appointment *models.Appointment) (int, error) {
+	if appointment.DurationMinutes == 0 {
+		appointment.DurationMinutes = models.DefaultAppointmentMinutes
+	}
+	err := m.write(ctx, func(d *memoryData) error {
+		appointment.ID_Appointment = 0
+		if err := d.checkAppointment(appointment); err != nil {
+			return err
+		}
+		appointment.Version = 1
+		appointment.ID_Appointment = d.nextID("appointment")
+		d.appointments[appointment.ID_Appointment] = *appointment
+		return nil
+	})
+	if err != nil {
+		appointment.ID_Appointment = 0
+		return 0, err
+	}
+	return appointment.ID_Appointment, nil
+}
+
+func (m *MemoryStore) ListAppointments(ctx context.Context, query *ListQuery) (page *Page[*models.Appointment], err error) {
+	err = m.read(ctx, func(d *memoryData) error {
+		page, err = listMemory(d.appointments, query, AppointmentFields, nil)
+		return err
+	})
+	return page, err
+}
+
+func (m *MemoryStore) GetAppointmentByID(ctx context.Context, id int) (*models.Appointment, error) {
+	var appointment models.Appointment
+	err := m.read(ctx, func(d *memoryData) error {
+		row, ok := d.appointments[id]
+		if !ok {
+			return ErrNotFound
+		}
+		appointment = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &appointment, nil
+}
+
+func (m *MemoryStore) UpdateAppointment(ctx context.Context, id int, appointment *models.Appointment) error {
+	appointment.ID_Appointment = id
+	if appointment.DurationMinutes == 0 {
+		appointment.DurationMinutes = models.DefaultAppointmentMinutes
+	}
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.appointments[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, appointment.Version); err != nil {
+			return err
+		}
+		if err := d.checkAppointment(appointment); err != nil {
+			return err
+		}
+		appointment.Version = current.Version + 1
+		d.appointments[id] = *appointment
+		return nil
+	})
+}
+
+func (m *MemoryStore) DeleteAppointment(ctx context.Context, id, version int) error {
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.appointments[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, version); err != nil {
+			return err
+		}
+		delete(d.appointments, id)
+		return nil
+	})
+}
+
+//-----Audit Log Methods-----
+
+func (m *MemoryStore) CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	return m.write(ctx, func(d *memoryData) error {
+		entry.ID_Audit = d.nextID("audit_log")
+		if entry.ChangedAt.IsZero() {
+			entry.ChangedAt = time.Now()
+		}
+		d.audit[entry.ID_Audit] = *entry
+		return nil
+	})
+}
+
+func (m *MemoryStore) ListAuditEntries(ctx context.Context, query *ListQuery) (page *Page[*models.AuditEntry], err error) {
+	err = m.read(ctx, func(d *memoryData) error {
+		page, err = listMemory(d.audit, query, AuditFields, nil)
+		return err
+	})
+	return page, err
+}
+
+//-----Outbox Methods-----
+
+func (m *MemoryStore) CreateOutboxEvent(ctx context.Context, event *models.OutboxEvent) error {
+	return m.write(ctx, func(d *memoryData) error {
+		now := time.Now()
+		event.ID_Event = d.nextID("outbox_event")
+		event.Status, event.Attempts, event.NextAttemptAt, event.CreatedAt = models.EventPending, 0, now, now
+		d.outbox[event.ID_Event] = *event
+
+		for _, webhookID := range sortedKeys(d.webhooks) {
+			if webhook := d.webhooks[webhookID]; webhook.Subscribes(event.EventType) {
+				d.queueDelivery(webhookID, event.ID_Event, event.EventType)
+			}
+		}
+		return nil
+	})
+}
+
+func (m *MemoryStore) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	events := []*models.OutboxEvent{}
+	err := m.write(ctx, func(d *memoryData) error {
+		ids := make([]int, 0, len(d.outbox))
+		for id := range d.outbox {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+
+		now := time.Now()
+		for _, id := range ids {
+			event := d.outbox[id]
+			if len(events) == limit {
+				break
+			}
+			if event.Status != models.EventPending || event.NextAttemptAt.After(now) {
+				continue
+			}
+			event.Attempts++
+			event.NextAttemptAt = now.Add(lease)
+			d.outbox[id] = event
+			events = append(events, &event)
+		}
+		return nil
+	})
+	return events, err
+}
+
+// updateOutboxEvent applies fn to a stored event
+func (m *MemoryStore) updateOutboxEvent(ctx context.Context, id int, fn func(event *models.OutboxEvent) error) (*models.OutboxEvent, error) {
+	var updated models.OutboxEvent
+	err := m.write(ctx, func(d *memoryData) error {
+		event, ok := d.outbox[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+		d.outbox[id] = event
+		updated = event
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (m *MemoryStore) MarkOutboxEventDelivered(ctx context.Context, id int) error {
+	_, err := m.updateOutboxEvent(ctx, id, func(event *models.OutboxEvent) error {
+		now := time.Now()
+		event.Status, event.DeliveredAt, event.LastError = models.EventDelivered, &now, nil
+		return nil
+	})
+	return err
+}
+
+func (m *MemoryStore) RetryOutboxEvent(ctx context.Context, id int, lastError string, delay time.Duration) error {
+	_, err := m.updateOutboxEvent(ctx, id, func(event *models.OutboxEvent) error {
+		event.LastError, event.NextAttemptAt = &lastError, time.Now().Add(delay)
+		return nil
+	})
+	return err
+}
+
+func (m *MemoryStore) DeadLetterOutboxEvent(ctx context.Context, id int, lastError string) error {
+	_, err := m.updateOutboxEvent(ctx, id, func(event *models.OutboxEvent) error {
+		event.Status, event.LastError = models.EventDead, &lastError
+		return nil
+	})
+	return err
+}
+
+func (m *MemoryStore) RequeueOutboxEvent(ctx context.Context, id int) (*models.OutboxEvent, error) {
+	return m.updateOutboxEvent(ctx, id, func(event *models.OutboxEvent) error {
+		if event.Status != models.EventDead {
+			return fmt.Errorf("%w: event %d is %s, only dead events can be requeued", ErrInvalidTransition, id, event.Status)
+		}
+		event.Status, event.Attempts, event.NextAttemptAt = models.EventPending, 0, time.Now()
+		return nil
+	})
+}
+
+func (m *MemoryStore) ListOutboxEvents(ctx context.Context, query *ListQuery) (page *Page[*models.OutboxEvent], err error) {
+	err = m.read(ctx, func(d *memoryData) error {
+		page, err = listMemory(d.outbox, query, OutboxFields, nil)
+		return err
+	})
+	return page, err
+}
+
+// OutboxWatermark is the last event ID handed out, as transactions hold the write lock until they commit
+func (m *MemoryStore) OutboxWatermark(ctx context.Context) (int, error) {
+	var id int
+	err := m.read(ctx, func(d *memoryData) error {
+		id = d.seq["outbox_event"]
+		return nil
+	})
+	return id, err
+}
+
+func (m *MemoryStore) GetOutboxEventByID(ctx context.Context, id int) (*models.OutboxEvent, error) {
+	var event models.OutboxEvent
+	err := m.read(ctx, func(d *memoryData) error {
+		row, ok := d.outbox[id]
+		if !ok {
+			return ErrNotFound
+		}
+		event = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+//-----Webhook Methods-----
+
+func (m *MemoryStore) CreateWebhook(ctx context.Context, webhook *models.Webhook) (int, error) {
+	var newID int
+	err := m.write(ctx, func(d *memoryData) error {
+		newID = d.nextID("webhook")
+		webhook.Version = 1
+		webhook.CreatedAt = time.Now()
+		row := *webhook
+		row.ID_Webhook = newID
+		d.webhooks[newID] = row
+		return nil
+	})
+	return newID, err
+}
+
+func (m *MemoryStore) ListWebhooks(ctx context.Context, query *ListQuery) (page *Page[*models.Webhook], err error) {
+	err = m.read(ctx, func(d *memoryData) error {
+		page, err = listMemory(d.webhooks, query, WebhookFields, nil)
+		return err
+	})
+	return page, err
+}
+
+func (m *MemoryStore) GetWebhookByID(ctx context.Context, id int) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := m.read(ctx, func(d *memoryData) error {
+		row, ok := d.webhooks[id]
+		if !ok {
+			return ErrNotFound
+		}
+		webhook = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (m *MemoryStore) UpdateWebhook(ctx context.Context, id int, webhook *models.Webhook) error {
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.webhooks[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, webhook.Version); err != nil {
+			return err
+		}
+		webhook.ID_Webhook = id
+		webhook.Secret, webhook.CreatedAt = current.Secret, current.CreatedAt
+		webhook.Version = current.Version + 1
+		d.webhooks[id] = *webhook
+		return nil
+	})
+}
+
+func (m *MemoryStore) DeleteWebhook(ctx context.Context, id, version int) error {
+	return m.write(ctx, func(d *memoryData) error {
+		current, ok := d.webhooks[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := checkVersion(current.Version, version); err != nil {
+			return err
+		}
+		delete(d.webhooks, id)
+		maps.DeleteFunc(d.deliveries, func(_ int, delivery models.WebhookDelivery) bool { return delivery.ID_Webhook == id })
+		return nil
+	})
+}
+
+func (m *MemoryStore) ListWebhookDeliveries(ctx context.Context, query *ListQuery) (page *Page[*models.WebhookDelivery], err error) {
+	err = m.read(ctx, func(d *memoryData) error {
+		page, err = listMemory(d.deliveries, query, WebhookDeliveryFields, nil)
+		return err
+	})
+	return page, err
+}
+
+// queueDelivery stores a pending delivery of an event to a webhook
+func (d *memoryData) queueDelivery(webhookID, eventID int, eventType models.EventType) models.WebhookDelivery {
+	now := time.Now()
+	delivery := models.WebhookDelivery{
+		ID_Delivery:   d.nextID("webhook_delivery"),
+		ID_Webhook:    webhookID,
+		ID_Event:      eventID,
+		EventType:     eventType,
+		Status:        models.EventPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	d.deliveries[delivery.ID_Delivery] = delivery
+	return delivery
+}
+
+func (m *MemoryStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	deliveries := []*models.WebhookDelivery{}
+	err := m.write(ctx, func(d *memoryData) error {
+		now := time.Now()
+		for _, id := range sortedKeys(d.deliveries) {
+			delivery := d.deliveries[id]
+			if len(deliveries) == limit {
+				break
+			}
+			if delivery.Status != models.EventPending || delivery.NextAttemptAt.After(now) || d.webhooks[delivery.ID_Webhook].Paused {
+				continue
+			}
+			delivery.Attempts++
+			delivery.NextAttemptAt = now.Add(lease)
+			d.deliveries[id] = delivery
+			deliveries = append(deliveries, &delivery)
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+// updateWebhookDelivery applies fn to a stored delivery
+func (m *MemoryStore) updateWebhookDelivery(ctx context.Context, id int, fn func(delivery *models.WebhookDelivery)) error {
+	return m.write(ctx, func(d *memoryData) error {
+		delivery, ok := d.deliveries[id]
+		if !ok {
+			return ErrNotFound
+		}
+		fn(&delivery)
+		d.deliveries[id] = delivery
+		return nil
+	})
+}
+
+func (m *MemoryStore) MarkWebhookDeliveryDelivered(ctx context.Context, id, responseStatus int) error {
+	return m.updateWebhookDelivery(ctx, id, func(delivery *models.WebhookDelivery) {
+		now := time.Now()
+		delivery.Status, delivery.DeliveredAt, delivery.ResponseStatus, delivery.LastError = models.EventDelivered, &now, &responseStatus, nil
+	})
+}
+
+func (m *MemoryStore) RetryWebhookDelivery(ctx context.Context, id int, responseStatus *int, lastError string, delay time.Duration) error {
+	return m.updateWebhookDelivery(ctx, id, func(delivery *models.WebhookDelivery) {
+		delivery.ResponseStatus, delivery.LastError, delivery.NextAttemptAt = responseStatus, &lastError, time.Now().Add(delay)
+	})
+}
+
+func (m *MemoryStore) DeadLetterWebhookDelivery(ctx context.Context, id int, responseStatus *int, lastError string) error {
+	return m.updateWebhookDelivery(ctx, id, func(delivery *models.WebhookDelivery) {
+		delivery.Status, delivery.ResponseStatus, delivery.LastError = models.EventDead, responseStatus, &lastError
+	})
+}
+
+func (m *MemoryStore) RedeliverWebhookDelivery(ctx context.Context, webhookID, id int) (*models.WebhookDelivery, error) {
+	var redelivery models.WebhookDelivery
+	err := m.write(ctx, func(d *memoryData) error {
+		delivery, ok := d.deliveries[id]
+		if !ok || delivery.ID_Webhook != webhookID {
+			return ErrNotFound
+		}
+		redelivery = d.queueDelivery(webhookID, delivery.ID_Event, delivery.EventType)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &redelivery, nil
+}
+
+//-----Idempotency Key Methods-----
+
+func (m *MemoryStore) ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey, ttl time.Duration) (*models.IdempotencyKey, error) {
+	var stored *models.IdempotencyKey
+	err := m.write(ctx, func(d *memoryData) error {
+		id := idempotencyID{key.Key, key.Route, key.ID_Employee}
+		if current, ok := d.idempotency[id]; ok && time.Since(current.Created) <= ttl {
+			stored = &current
+			return nil
+		}
+		key.StatusCode, key.ContentType, key.Body = nil, nil, nil
+		key.Created = time.Now()
+		d.idempotency[id] = *key
+		return nil
+	})
+	return stored, err
+}
+
+func (m *MemoryStore) CompleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	return m.write(ctx, func(d *memoryData) error {
+		id := idempotencyID{key.Key, key.Route, key.ID_Employee}
+		current, ok := d.idempotency[id]
+		if !ok {
+			return ErrNotFound
+		}
+		current.StatusCode, current.ContentType, current.Body = key.StatusCode, key.ContentType, key.Body
+		d.idempotency[id] = current
+		return nil
+	})
+}
+
+func (m *MemoryStore) ReleaseIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	return m.write(ctx, func(d *memoryData) error {
+		id := idempotencyID{key.Key, key.Route, key.ID_Employee}
+		if current, ok := d.idempotency[id]; ok && current.StatusCode == nil {
+			delete(d.idempotency, id)
+		}
+		return nil
+	})
+}
+
+func (m *MemoryStore) DeleteExpiredIdempotencyKeys(ctx context.Context, ttl time.Duration) (int64, error) {
+	var deleted int64
+	err := m.write(ctx, func(d *memoryData) error {
+		for id, key := range d.idempotency {
+			if time.Since(key.Created) > ttl {
+				delete(d.idempotency, id)
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
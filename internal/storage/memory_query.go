@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// listMemory is the in-memory counterpart of listGorm: it filters, sorts and pages rows with the
+// same field whitelist and returns copies of the matching rows. computed supplies the value of
+// fields that are defined by a SQL Predicate rather than a column. Soft-deleted rows are skipped
+// unless the query includes them.
+func listMemory[T any](rows map[int]T, q *ListQuery, fields FieldSet, computed map[string]func(*T) any) (*Page[*T], error) {
+	// Rendering the SQL validates filter fields and operators exactly like the database paths
+	if _, _, err := q.whereClauses(fields); err != nil {
+		return nil, err
+	}
+	if _, err := q.orderBy(fields); err != nil {
+		return nil, err
+	}
+
+	value := func(row *T, name string) any {
+		if fn, ok := computed[name]; ok {
+			return fn(row)
+		}
+		return columnValue(row, fields.Fields[name].Column)
+	}
+
+	matched := []*T{}
+	for _, id := range sortedKeys(rows) {
+		row := rows[id]
+		if isDeleted(&row) && !q.IncludeDeleted {
+			continue
+		}
+		if matchesFilters(&row, q, value) {
+			matched = append(matched, &row)
+		}
+	}
+
+	sorts := q.Sort
+	keyed := false
+	for _, srt := range sorts {
+		if srt.Field == fields.DefaultKey {
+			keyed = true
+		}
+	}
+	if !keyed {
+		sorts = append(append([]Sort{}, sorts...), Sort{Field: fields.DefaultKey})
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		for _, srt := range sorts {
+			c := compareForSort(value(matched[i], srt.Field), value(matched[j], srt.Field))
+			if srt.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	page := &Page[*T]{Total: int64(len(matched))}
+	if q.Offset < len(matched) {
+		matched = matched[q.Offset:]
+	} else {
+		matched = nil
+	}
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+	page.Items = append([]*T{}, matched...)
+	return page, nil
+}
+
+// matchesFilters reports whether row satisfies every filter and the dealership scope of q
+func matchesFilters[T any](row *T, q *ListQuery, value func(*T, string) any) bool {
+	for _, f := range q.Filters {
+		v := value(row, f.Field)
+		switch f.Op {
+		case OpIn:
+			values, _ := f.Value.([]any)
+			found := false
+			for _, candidate := range values {
+				if c, ok := compareValues(v, candidate); ok && c == 0 {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		default:
+			c, ok := compareValues(v, f.Value)
+			if !ok {
+				return false
+			}
+			switch f.Op {
+			case OpEq:
+				ok = c == 0
+			case OpGte:
+				ok = c >= 0
+			case OpLte:
+				ok = c <= 0
+			case OpLt:
+				ok = c < 0
+			}
+			if !ok {
+				return false
+			}
+		}
+	}
+
+	if q.Scope != nil {
+		id, _ := normalizeValue(columnValue(row, "id_dealership")).(int64)
+		if !q.Scope.Allows(int(id)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isDeleted reports whether row is a model with a deleted_at column that is set
+func isDeleted(row any) bool {
+	deletedAt, ok := columnValue(row, "deleted_at").(gorm.DeletedAt)
+	return ok && deletedAt.Valid
+}
+
+// columnValue returns the field of a model struct stored in the given column, using the same
+// naming as GORM: the "column:" tag, or the lower-cased field name for untagged primary keys
+func columnValue(row any, column string) any {
+	v := reflect.Indirect(reflect.ValueOf(row))
+	field, ok := columnField(v, column)
+	if !ok {
+		return nil
+	}
+	return field.Interface()
+}
+
+// columnField finds the field of struct value v stored in column
+func columnField(v reflect.Value, column string) (reflect.Value, bool) {
+	column = strings.Trim(column, `"`)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if columnName(t.Field(i)) == column {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// columnName is the column a struct field is stored in, or "" for fields GORM ignores
+func columnName(f reflect.StructField) string {
+	tag := f.Tag.Get("gorm")
+	if tag == "-" {
+		return ""
+	}
+	for _, part := range strings.Split(tag, ";") {
+		if name, ok := strings.CutPrefix(part, "column:"); ok {
+			return name
+		}
+	}
+	return strings.ToLower(f.Name)
+}
+
+// normalizeValue dereferences pointers and reduces named types to string, int64, bool or time.Time.
+// A nil pointer becomes nil, which like SQL NULL matches no comparison.
+func normalizeValue(x any) any {
+	if x == nil {
+		return nil
+	}
+	if t, ok := x.(time.Time); ok {
+		return t
+	}
+	v := reflect.ValueOf(x)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Bool:
+		return v.Bool()
+	}
+	return v.Interface()
+}
+
+// compareValues compares two values of the same kind; ok is false when either is nil or the kinds differ
+func compareValues(a, b any) (c int, ok bool) {
+	a, b = normalizeValue(a), normalizeValue(b)
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case int64:
+		if y, ok := b.(int64); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			if x == y {
+				return 0, true
+			}
+			if !x {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+// compareForSort orders values like Postgres: NULL sorts after every value in ascending order
+func compareForSort(a, b any) int {
+	a, b = normalizeValue(a), normalizeValue(b)
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	c, _ := compareValues(a, b)
+	return c
+}
+
+// sortedKeys returns the keys of m in ascending order
+func sortedKeys[T any](m map[int]T) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,54 @@
+package storage_test
+
+import (
+	"context"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"keeper/internal/storage/storetest"
+	"sync"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		return storage.NewMemoryStore()
+	})
+}
+
+// Auditing must not change what a store does
+func TestAuditedStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		return storage.NewAuditedStore(storage.NewMemoryStore())
+	})
+}
+
+// TestMemoryStoreConcurrency hammers the store from several goroutines; run with -race
+func TestMemoryStoreConcurrency(t *testing.T) {
+	store := storage.NewMemoryStore()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				if _, err := store.CreateDealership(ctx, &models.Dealership{PostalCode: "73100", City: "Lecce", Address: "Via Roma", Phone: "0832"}); err != nil {
+					t.Errorf("CreateDealership: %v", err)
+				}
+				if _, err := store.ListDealerships(ctx, &storage.ListQuery{Limit: 10}); err != nil {
+					t.Errorf("ListDealerships: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	page, err := store.ListDealerships(ctx, &storage.ListQuery{})
+	if err != nil {
+		t.Fatalf("ListDealerships: %v", err)
+	}
+	if page.Total != 200 {
+		t.Errorf("got %d dealerships, want 200", page.Total)
+	}
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"keeper/internal/models"
+	"slices"
+	"time"
+)
+
+// The outbox uses database/sql: claiming events is a single UPDATE over a SKIP LOCKED subquery, so that
+// several dispatchers never deliver the same event at once. Like idempotency keys, due times are computed
+// with the database clock.
+
+const outboxColumns = `id_event, event_type, entity, entity_id, id_dealership, payload, status, attempts, next_attempt_at, last_error, created_at, delivered_at`
+
+func scanOutboxEvent(row interface{ Scan(dest ...any) error }) (*models.OutboxEvent, error) {
+	e := &models.OutboxEvent{}
+	err := row.Scan(&e.ID_Event, &e.EventType, &e.Entity, &e.EntityID, &e.ID_Dealership, &e.Payload, &e.Status, &e.Attempts,
+		&e.NextAttemptAt, &e.LastError, &e.CreatedAt, &e.DeliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// CreateOutboxEvent stores an event and queues its webhook deliveries. A sequence hands out IDs when
+// rows are inserted, not when they commit, so concurrent transactions can make event N+1 visible before
+// event N. The event records its horizon, so that OutboxWatermark can tell when N can no longer appear.
+// Each step is its own statement, as in read committed a statement sees the database as it was when it started:
+//  1. the transaction takes its ID, if it has none yet, before the event takes its own;
+//  2. the event takes its ID;
+//  3. the insert records as horizon the next transaction ID to be assigned, which is above the ID of
+//     every transaction that took an event ID before step 2.
+func (s *PostgresStore) CreateOutboxEvent(ctx context.Context, event *models.OutboxEvent) error {
+	return s.inTx(ctx, func(tx *PostgresStore) error {
+		if _, err := tx.conn().ExecContext(ctx, `SELECT pg_current_xact_id()`); err != nil {
+			return err
+		}
+		var id int
+		if err := tx.conn().QueryRowContext(ctx, `SELECT nextval(pg_get_serial_sequence('outbox_event', 'id_event'))`).Scan(&id); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO outbox_event (id_event, event_type, entity, entity_id, id_dealership, payload, horizon)
+				  VALUES ($1, $2, $3, $4, $5, $6, pg_snapshot_xmax(pg_current_snapshot())::text::bigint)
+				  RETURNING ` + outboxColumns + `, horizon`
+		row := tx.conn().QueryRowContext(ctx, query, id, event.EventType, event.Entity, event.EntityID, event.ID_Dealership, event.Payload)
+		err := row.Scan(&event.ID_Event, &event.EventType, &event.Entity, &event.EntityID, &event.ID_Dealership, &event.Payload,
+			&event.Status, &event.Attempts, &event.NextAttemptAt, &event.LastError, &event.CreatedAt, &event.DeliveredAt, &event.Horizon)
+		if err != nil {
+			return err
+		}
+
+		query = `INSERT INTO webhook_delivery (id_webhook, id_event, event_type)
+				 SELECT id_webhook, $1, $2::text FROM webhook
+				 WHERE event_types @> jsonb_build_array($2::text)`
+		_, err = tx.conn().ExecContext(ctx, query, event.ID_Event, event.EventType)
+		return err
+	})
+}
+
+// OutboxWatermark returns the newest event whose horizon is below every open transaction. Any event
+// with a smaller ID was taken by a transaction that has ended since, so it is visible or will never be;
+// the ID is 0 if no event qualifies. It waits for every open transaction, not only those writing events,
+// so a long transaction holds the event stream back until it ends.
+func (s *PostgresStore) OutboxWatermark(ctx context.Context) (int, error) {
+	query := `SELECT COALESCE(MAX(id_event), 0) FROM outbox_event
+			  WHERE horizon <= pg_snapshot_xmin(pg_current_snapshot())::text::bigint`
+
+	var id int
+	if err := s.conn().QueryRowContext(ctx, query).Scan(&id); err != nil {
+		return 0, translateError(err)
+	}
+	return id, nil
+}
+
+func (s *PostgresStore) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	query := `UPDATE outbox_event
+			  SET attempts = attempts + 1, next_attempt_at = CURRENT_TIMESTAMP + $2::float8 * INTERVAL '1 second'
+			  WHERE id_event IN (
+				  SELECT id_event FROM outbox_event
+				  WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+				  ORDER BY id_event
+				  LIMIT $1
+				  FOR UPDATE SKIP LOCKED)
+			  RETURNING ` + outboxColumns
+
+	rows, err := s.conn().QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	events := []*models.OutboxEvent{}
+	for rows.Next() {
+		event, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, translateError(err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	// RETURNING does not keep the order of the subquery
+	slices.SortFunc(events, func(a, b *models.OutboxEvent) int { return a.ID_Event - b.ID_Event })
+	return events, nil
+}
+
+func (s *PostgresStore) MarkOutboxEventDelivered(ctx context.Context, id int) error {
+	query := `UPDATE outbox_event
+			  SET status = 'delivered', delivered_at = CURRENT_TIMESTAMP, last_error = NULL
+			  WHERE id_event = $1`
+
+	result, err := s.conn().ExecContext(ctx, query, id)
+	if err != nil {
+		return translateError(err)
+	}
+	return translateError(checkRowsAffected(result))
+}
+
+func (s *PostgresStore) RetryOutboxEvent(ctx context.Context, id int, lastError string, delay time.Duration) error {
+	query := `UPDATE outbox_event
+			  SET last_error = $2, next_attempt_at = CURRENT_TIMESTAMP + $3::float8 * INTERVAL '1 second'
+			  WHERE id_event = $1`
+
+	result, err := s.conn().ExecContext(ctx, query, id, lastError, delay.Seconds())
+	if err != nil {
+		return translateError(err)
+	}
+	return translateError(checkRowsAffected(result))
+}
+
+func (s *PostgresStore) DeadLetterOutboxEvent(ctx context.Context, id int, lastError string) error {
+	query := `UPDATE outbox_event SET status = 'dead', last_error = $2 WHERE id_event = $1`
+
+	result, err := s.conn().ExecContext(ctx, query, id, lastError)
+	if err != nil {
+		return translateError(err)
+	}
+	return translateError(checkRowsAffected(result))
+}
+
+func (s *PostgresStore) RequeueOutboxEvent(ctx context.Context, id int) (*models.OutboxEvent, error) {
+	query := `UPDATE outbox_event
+			  SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+			  WHERE id_event = $1 AND status = 'dead'
+			  RETURNING ` + outboxColumns
+
+	event, err := scanOutboxEvent(s.conn().QueryRowContext(ctx, query, id))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return event, translateError(err)
+	}
+
+	var status models.EventStatus
+	err = s.conn().QueryRowContext(ctx, `SELECT status FROM outbox_event WHERE id_event = $1`, id).Scan(&status)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return nil, fmt.Errorf("%w: event %d is %s, only dead events can be requeued", ErrInvalidTransition, id, status)
+}
+
+func (s *PostgresStore) ListOutboxEvents(ctx context.Context, query *ListQuery) (*Page[*models.OutboxEvent], error) {
+	page := &Page[*models.OutboxEvent]{}
+	total, err := listGorm(s.GormDB.WithContext(ctx), &models.OutboxEvent{}, &page.Items, query, OutboxFields)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	page.Total = total
+	return page, nil
+}
+
+func (s *PostgresStore) GetOutboxEventByID(ctx context.Context, id int) (*models.OutboxEvent, error) {
+	query := `SELECT ` + outboxColumns + ` FROM outbox_event WHERE id_event = $1`
+
+	event, err := scanOutboxEvent(s.conn().QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return event, nil
+}
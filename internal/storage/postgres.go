@@ -2,14 +2,18 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"keeper/internal/models"
 	"log"
-	"strings"
+	"sort"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
@@ -17,6 +21,8 @@ import (
 type PostgresStore struct {
 	Db     *sql.DB
 	GormDB *gorm.DB
+
+	tx *sql.Tx // Set on the copies handed out by WithTx
 }
 
 type dependencyCheck struct {
@@ -24,52 +30,153 @@ type dependencyCheck struct {
 	fieldName string
 }
 
-func (s *PostgresStore) checkDependencies(parentID int, checks map[string]dependencyCheck) error {
-	var errorMessages []string
+// checkDependencies counts the records referring to parentID and returns a *ReferencedError if there are any.
+// Soft-deleted records are counted too, as they keep their references.
+func (s *PostgresStore) checkDependencies(ctx context.Context, parentID any, checks map[string]dependencyCheck) error {
+	var references []Reference
 
 	for parentName, check := range checks {
 		var count int64
 		query := fmt.Sprintf("%s = ?", check.fieldName)
 		
-		s.GormDB.Model(check.model).Where(query, parentID).Count(&count)
+		if err := s.GormDB.WithContext(ctx).Unscoped().Model(check.model).Where(query, parentID).Count(&count).Error; err != nil {
+			return translateError(err)
+		}
 		
 		if count > 0 {
-			errorMessages = append(errorMessages, fmt.Sprintf("referenced by %d %s records", count, parentName))
+			references = append(references, Reference{Resource: parentName, Count: count})
 		}
 	}
 
-	if len(errorMessages) > 0 {
-		return fmt.Errorf("cannot delete: %s", strings.Join(errorMessages, ", "))
+	if len(references) > 0 {
+		sort.Slice(references, func(i, j int) bool { return references[i].Resource < references[j].Resource })
+		return &ReferencedError{References: references}
 	}
 
 	return nil
 }
 
+// lockRow locks the row of model with the given primary key until the end of the transaction of db,
+// so that rows referring to it cannot be inserted meanwhile
+func lockRow(db *gorm.DB, model interface{}, id int) error {
+	return db.Clauses(clause.Locking{Strength: "UPDATE"}).First(model, id).Error
+}
+
 func checkResult(result *gorm.DB) error {
 	if result.Error != nil {
 		return result.Error
 	}
 
 	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// returningVersion reads back the version column, which a trigger bumps on every update
+var returningVersion = clause.Returning{Columns: []clause.Column{{Name: "version"}}}
+
+// saveVersioned replaces the row of model, whose primary key is id, with every column selected like Save.
+// When expected is not 0 the row is only written while it is still at that version. The new version
+// is read back into model.
+func saveVersioned(db *gorm.DB, model any, id, expected int, omit ...string) error {
+	query := db.Clauses(returningVersion).Select("*")
+	if len(omit) > 0 {
+		query = query.Omit(omit...)
+	}
+	if expected != 0 {
+		query = query.Where("version = ?", expected)
+	}
+	result := query.Save(model)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return staleVersion(db, model, id, expected)
+	}
+	return nil
+}
+
+// deleteVersioned deletes the row of model with the given primary key, if it is still at the expected version
+func deleteVersioned(db *gorm.DB, model any, id, expected int) error {
+	query := db
+	if expected != 0 {
+		query = db.Where("version = ?", expected)
+	}
+	result := query.Delete(model, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return staleVersion(db, model, id, expected)
+	}
+	return nil
+}
+
+// staleVersion explains why a write guarded by a version matched no row: either the row
+// does not exist, or it exists at another version
+func staleVersion(db *gorm.DB, model any, id, expected int) error {
+	if expected == 0 {
+		return ErrNotFound
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+
+	query := db.Session(&gorm.Session{NewDB: true}).Table(stmt.Table).
+		Where(stmt.Schema.PrioritizedPrimaryField.DBName+" = ?", id)
+	if _, ok := stmt.Schema.FieldsByDBName["deleted_at"]; ok {
+		query = query.Where("deleted_at IS NULL")
+	}
+	var versions []int
+	err := query.Pluck("version", &versions).Error
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return ErrNotFound
 	}
+	return checkVersion(versions[0], expected)
+}
 
+// restoreRow clears deleted_at on the soft-deleted row of model with the given primary key and reads the
+// restored row back into model. A row that is not deleted fails with ErrNotDeleted, and one whose unique
+// values have been taken by another row meanwhile with a unique violation.
+func restoreRow(db *gorm.DB, model any, id int) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	result := db.Unscoped().Model(model).Clauses(clause.Returning{}).
+		Where(stmt.Schema.PrioritizedPrimaryField.DBName+" = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := db.First(model, id).Error; err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s %d", ErrNotDeleted, stmt.Table, id)
+	}
 	return nil
 }
 
 func NewPostgresStore(connString string) (*PostgresStore, error) {
 	gormDB, err := gorm.Open(postgres.Open(connString), &gorm.Config{})
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	sqlDB, err := gormDB.DB()
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	if err := sqlDB.Ping(); err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	log.Println("Database connected successfully (GORM & standard SQL)")
@@ -77,36 +184,56 @@ func NewPostgresStore(connString string) (*PostgresStore, error) {
 	return &PostgresStore{Db: sqlDB, GormDB: gormDB}, nil
 }
 
-func (s *PostgresStore) CreateDealership(dealership *models.Dealership) (int, error) {
-	query := `INSERT INTO dealership (postalcode, city, address, phone) 
-			  VALUES ($1, $2, $3, $4) 
-			  RETURNING id_dealership`
+func (s *PostgresStore) CreateDealership(ctx context.Context, dealership *models.Dealership) (int, error) {
+	query := `INSERT INTO dealership (postalcode, city, address, phone, time_zone) 
+			  VALUES ($1, $2, $3, $4, $5) 
+			  RETURNING id_dealership, version`
 
 	var newID int
-	err := s.Db.QueryRow(
+	err := s.conn().QueryRowContext(
+		ctx,
 		query,
 		dealership.PostalCode,
 		dealership.City,
 		dealership.Address,
 		dealership.Phone,
-	).Scan(&newID)
+		dealership.TimeZone,
+	).Scan(&newID, &dealership.Version)
 
 	if err != nil {
-		return 0, err
+		return 0, translateError(err)
 	}
 
 	return newID, nil
 }
 
-func (s *PostgresStore) GetDealerships() ([]*models.Dealership, error) {
-	query := `SELECT id_dealership, postalcode, city, address, phone FROM dealership`
-	rows, err := s.Db.Query(query)
+func (s *PostgresStore) ListDealerships(ctx context.Context, query *ListQuery) (*Page[*models.Dealership], error) {
+	where, args, err := sqlWhere(query, DealershipFields)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	order, err := query.orderBy(DealershipFields)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	page := &Page[*models.Dealership]{}
+	if err := s.conn().QueryRowContext(ctx, `SELECT COUNT(*) FROM dealership`+where, args...).Scan(&page.Total); err != nil {
+		return nil, translateError(err)
+	}
+
+	selectQuery := `SELECT id_dealership, postalcode, city, address, phone, time_zone, version FROM dealership` + where +
+		` ORDER BY ` + order + fmt.Sprintf(` OFFSET %d`, query.Offset)
+	if query.Limit > 0 {
+		selectQuery += fmt.Sprintf(` LIMIT %d`, query.Limit)
+	}
+
+	rows, err := s.conn().QueryContext(ctx, selectQuery, args...)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 	defer rows.Close()
 
-	var dealerships []*models.Dealership
 	for rows.Next() {
 		dealership := new(models.Dealership)
 		err := rows.Scan(
@@ -115,252 +242,651 @@ func (s *PostgresStore) GetDealerships() ([]*models.Dealership, error) {
 			&dealership.City,
 			&dealership.Address,
 			&dealership.Phone,
+			&dealership.TimeZone,
+			&dealership.Version,
 		)
 		if err != nil {
-			return nil, err
+			return nil, translateError(err)
 		}
-		dealerships = append(dealerships, dealership)
+		page.Items = append(page.Items, dealership)
+	}
+	return page, translateError(rows.Err())
+}
+
+func (s *PostgresStore) GetDealershipByID(ctx context.Context, id int) (*models.Dealership, error) {
+	query := `SELECT id_dealership, postalcode, city, address, phone, time_zone, version FROM dealership WHERE id_dealership = $1`
+
+	dealership := new(models.Dealership)
+	err := s.conn().QueryRowContext(ctx, query, id).Scan(
+		&dealership.ID_Dealership,
+		&dealership.PostalCode,
+		&dealership.City,
+		&dealership.Address,
+		&dealership.Phone,
+		&dealership.TimeZone,
+		&dealership.Version,
+	)
+	if err != nil {
+		return nil, translateError(err)
 	}
-	return dealerships, nil
+	return dealership, nil
 }
 
-func (s *PostgresStore) UpdateDealership(id int, dealership *models.Dealership) error {
+func (s *PostgresStore) UpdateDealership(ctx context.Context, id int, dealership *models.Dealership) error {
 	query := `UPDATE dealership 
-			  SET postalcode = $1, city = $2, address = $3, phone = $4 
-			  WHERE id_dealership = $5`
+			  SET postalcode = $1, city = $2, address = $3, phone = $4, time_zone = $5 
+			  WHERE id_dealership = $6 AND ($7 = 0 OR version = $7)
+			  RETURNING version`
 
-	result, err := s.Db.Exec(
+	err := s.conn().QueryRowContext(
+		ctx,
 		query,
 		dealership.PostalCode,
 		dealership.City,
 		dealership.Address,
 		dealership.Phone,
+		dealership.TimeZone,
 		id,
-	)
-	if err != nil {
-		return err
+		dealership.Version,
+	).Scan(&dealership.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return staleVersion(s.GormDB.WithContext(ctx), &models.Dealership{}, id, dealership.Version)
 	}
-
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("no dealership found with id %d", id)
+		return translateError(err)
 	}
 
+	dealership.ID_Dealership = id
 	return nil
 }
 
-func (s *PostgresStore) DeleteDealership(id int) error {
+// DeleteDealership removes a dealership that nothing refers to. The row is locked before the dependency
+// check, so a record inserted concurrently for this dealership waits for the delete and then fails.
+func (s *PostgresStore) DeleteDealership(ctx context.Context, id, version int) error {
 	checks := map[string]dependencyCheck{
 		"cars":         {&models.CarPark{}, "id_dealership"},
 		"employments":  {&models.Employment{}, "id_dealership"},
 		"orders":       {&models.Order{}, "id_dealership"},
 		"appointments": {&models.Appointment{}, "id_dealership"},
 	}
-	
-	if err := s.checkDependencies(id, checks); err != nil {
-		return err
-	}
 
-	query := `DELETE FROM dealership WHERE id_dealership = $1`
-	result, err := s.Db.Exec(query, id)
-	if err != nil {
-		return err
-	}
+	return s.inTx(ctx, func(tx *PostgresStore) error {
+		var stored int
+		err := tx.conn().QueryRowContext(ctx, `SELECT version FROM dealership WHERE id_dealership = $1 FOR UPDATE`, id).Scan(&stored)
+		if err != nil {
+			return translateError(err)
+		}
+		if err := checkVersion(stored, version); err != nil {
+			return err
+		}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
+		if err := tx.checkDependencies(ctx, id, checks); err != nil {
+			return translateError(err)
+		}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
+		query := `DELETE FROM dealership WHERE id_dealership = $1`
+		result, err := tx.conn().ExecContext(ctx, query, id)
+		if err != nil {
+			return translateError(err)
+		}
 
-	return nil
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return translateError(err)
+		}
+
+		if rowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	})
 }
 
-func (s *PostgresStore) CreateEmployee(employee *models.Employee) (int, error) {
-	result := s.GormDB.Create(employee)
+func (s *PostgresStore) CreateEmployee(ctx context.Context, employee *models.Employee) (int, error) {
+	employee.Version = 1
+	result := s.GormDB.WithContext(ctx).Create(employee)
 	if result.Error != nil {
-		return 0, result.Error  
+		return 0, translateError(result.Error)
 	}
 	return employee.ID_Employee, nil
 }
 
-func (s *PostgresStore) GetEmployees() ([]*models.Employee, error) {
-	var employees []*models.Employee 
-	result := s.GormDB.Find(&employees)
-	return employees, result.Error
+func (s *PostgresStore) ListEmployees(ctx context.Context, query *ListQuery) (*Page[*models.Employee], error) {
+	page := &Page[*models.Employee]{}
+	total, err := listGorm(s.GormDB.WithContext(ctx), &models.Employee{}, &page.Items, query, EmployeeFields)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	page.Total = total
+	return page, nil
+}
+
+func (s *PostgresStore) GetEmployeeByID(ctx context.Context, id int) (*models.Employee, error) {
+	var employee models.Employee
+	if err := s.GormDB.WithContext(ctx).First(&employee, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &employee, nil
 }
 
-func (s *PostgresStore) UpdateEmployee(id int, employee *models.Employee) error {
+func (s *PostgresStore) UpdateEmployee(ctx context.Context, id int, employee *models.Employee) error {
 	employee.ID_Employee = id
-	result := s.GormDB.Save(employee)
-	return checkResult(result)
+	employee.DeletedAt = gorm.DeletedAt{}
+	return translateError(saveVersioned(s.GormDB.WithContext(ctx), employee, id, employee.Version, "deleted_at"))
 }
 
-func (s *PostgresStore) DeleteEmployee(id int) error {
-	checks := map[string]dependencyCheck{
-		"orders":       {&models.Order{}, "id_employee"},
-		"appointments": {&models.Appointment{}, "id_employee"},
-		"employments":  {&models.Employment{}, "id_employee"},
+// DeleteEmployee soft-deletes an employee who no longer works at any dealership. The orders and
+// appointments of the employee keep referring to the deleted row.
+func (s *PostgresStore) DeleteEmployee(ctx context.Context, id, version int) error {
+	return s.inTx(ctx, func(tx *PostgresStore) error {
+		var employee models.Employee
+		if err := lockRow(tx.GormDB.WithContext(ctx), &employee, id); err != nil {
+			return translateError(err)
+		}
+		if err := checkVersion(employee.Version, version); err != nil {
+			return err
+		}
+
+		var employments int64
+		if err := tx.GormDB.WithContext(ctx).Model(&models.Employment{}).Where("id_employee = ? AND enddate IS NULL", id).Count(&employments).Error; err != nil {
+			return translateError(err)
+		}
+		if employments > 0 {
+			return &ReferencedError{References: []Reference{{Resource: "employments", Count: employments}}}
+		}
+
+		result := tx.GormDB.WithContext(ctx).Delete(&models.Employee{}, id)
+		return checkResult(result)
+	})
+}
+
+func (s *PostgresStore) RestoreEmployee(ctx context.Context, id int) (*models.Employee, error) {
+	var employee models.Employee
+	if err := restoreRow(s.GormDB.WithContext(ctx), &employee, id); err != nil {
+		return nil, translateError(err)
 	}
-	
-	if err := s.checkDependencies(id, checks); err != nil {
-		return err
+	return &employee, nil
+}
+
+func (s *PostgresStore) SetEmployeeCredential(ctx context.Context, credential *models.EmployeeCredential) error {
+	query := `INSERT INTO employee_credential (id_employee, username, password_hash, last_update)
+			  VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+			  ON CONFLICT (id_employee)
+			  DO UPDATE SET username = EXCLUDED.username, password_hash = EXCLUDED.password_hash, last_update = CURRENT_TIMESTAMP`
+
+	_, err := s.conn().ExecContext(ctx, query, credential.ID_Employee, credential.Username, credential.PasswordHash)
+	return translateError(err)
+}
+
+// GetEmployeeCredentialByUsername finds the credential of an employee who is not deleted, so that a deleted
+// employee cannot log in; restoring the employee brings the credential back
+func (s *PostgresStore) GetEmployeeCredentialByUsername(ctx context.Context, username string) (*models.EmployeeCredential, error) {
+	var credential models.EmployeeCredential
+	db := s.GormDB.WithContext(ctx)
+	employees := db.Model(&models.Employee{}).Select("id_employee")
+	if err := db.Where("username = ? AND id_employee IN (?)", username, employees).First(&credential).Error; err != nil {
+		return nil, translateError(err)
 	}
+	return &credential, nil
+}
 
-	result := s.GormDB.Delete(&models.Employee{}, id)
-	return checkResult(result)
+func (s *PostgresStore) GetEmployeeCredentialByEmployeeID(ctx context.Context, employeeID int) (*models.EmployeeCredential, error) {
+	var credential models.EmployeeCredential
+	if err := s.GormDB.WithContext(ctx).First(&credential, employeeID).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &credential, nil
 }
 
-func (s *PostgresStore) CreateEmployment(employment *models.Employment) (int, error) {
-	result := s.GormDB.Create(employment)
+func (s *PostgresStore) CreateEmployment(ctx context.Context, employment *models.Employment) (int, error) {
+	employment.Version = 1
+	result := s.GormDB.WithContext(ctx).Create(employment)
 	if result.Error != nil {
-		return 0, result.Error
+		return 0, translateError(result.Error)
 	}
 	return employment.ID_Employment, nil
 }
 
-func (s *PostgresStore) GetEmployments() ([]*models.Employment, error) {
-	var employments []*models.Employment
-	result := s.GormDB.Find(&employments)
-	return employments, result.Error
+func (s *PostgresStore) ListEmployments(ctx context.Context, query *ListQuery) (*Page[*models.Employment], error) {
+	page := &Page[*models.Employment]{}
+	total, err := listGorm(s.GormDB.WithContext(ctx), &models.Employment{}, &page.Items, query, EmploymentFields)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	page.Total = total
+	return page, nil
+}
+
+func (s *PostgresStore) GetEmploymentByID(ctx context.Context, id int) (*models.Employment, error) {
+	var employment models.Employment
+	if err := s.GormDB.WithContext(ctx).First(&employment, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &employment, nil
 }
 
-func (s *PostgresStore) UpdateEmployment(id int, employment *models.Employment) error {
+func (s *PostgresStore) UpdateEmployment(ctx context.Context, id int, employment *models.Employment) error {
 	employment.ID_Employment = id
-	result := s.GormDB.Save(employment)
-	return checkResult(result)
+	return translateError(saveVersioned(s.GormDB.WithContext(ctx), employment, id, employment.Version))
 }
 
-func (s *PostgresStore) DeleteEmployment(id int) error {
-	result := s.GormDB.Delete(&models.Employment{}, id)
-	return checkResult(result)
+func (s *PostgresStore) DeleteEmployment(ctx context.Context, id, version int) error {
+	return translateError(deleteVersioned(s.GormDB.WithContext(ctx), &models.Employment{}, id, version))
 }
 
-func (s *PostgresStore) CreateClient(client *models.Client) (int, error) {
-	result := s.GormDB.Create(client)
+func (s *PostgresStore) GetActiveDealershipIDs(ctx context.Context, employeeID int) ([]int, error) {
+	ids := []int{}
+	result := s.GormDB.WithContext(ctx).Model(&models.Employment{}).
+		Where("id_employee = ? AND enddate IS NULL", employeeID).
+		Distinct().
+		Pluck("id_dealership", &ids)
+	return ids, translateError(result.Error)
+}
+
+func (s *PostgresStore) CreateClient(ctx context.Context, client *models.Client) (int, error) {
+	client.Version = 1
+	result := s.GormDB.WithContext(ctx).Create(client)
 	if result.Error != nil {
-		return 0, result.Error
+		return 0, translateError(result.Error)
 	}
 	return client.ID_Client, nil
 }
 
-func (s *PostgresStore) GetClients() ([]*models.Client, error) {
-	var clients []*models.Client
-	result := s.GormDB.Find(&clients)
-	return clients, result.Error
+func (s *PostgresStore) ListClients(ctx context.Context, query *ListQuery) (*Page[*models.Client], error) {
+	page := &Page[*models.Client]{}
+	total, err := listGorm(s.GormDB.WithContext(ctx), &models.Client{}, &page.Items, query, ClientFields)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	page.Total = total
+	return page, nil
+}
+
+func (s *PostgresStore) GetClientByID(ctx context.Context, id int) (*models.Client, error) {
+	var client models.Client
+	if err := s.GormDB.WithContext(ctx).First(&client, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &client, nil
 }
 
-func (s *PostgresStore) UpdateClient(id int, client *models.Client) error {
+func (s *PostgresStore) UpdateClient(ctx context.Context, id int, client *models.Client) error {
 	client.ID_Client = id
-	result := s.GormDB.Save(client)
-	return checkResult(result)
+	client.DeletedAt = gorm.DeletedAt{}
+	return translateError(saveVersioned(s.GormDB.WithContext(ctx), client, id, client.Version, "deleted_at"))
 }
 
-func (s *PostgresStore) DeleteClient(id int) error {
-	checks := map[string]dependencyCheck{
-		"orders":       {&models.Order{}, "id_client"},
-		"appointments": {&models.Appointment{}, "id_client"},
-	}
-	
-	if err := s.checkDependencies(id, checks); err != nil {
-		return err
-	}
+// DeleteClient soft-deletes a client, whose orders and appointments keep referring to the deleted row
+func (s *PostgresStore) DeleteClient(ctx context.Context, id, version int) error {
+	return s.inTx(ctx, func(tx *PostgresStore) error {
+		var client models.Client
+		if err := lockRow(tx.GormDB.WithContext(ctx), &client, id); err != nil {
+			return translateError(err)
+		}
+		if err := checkVersion(client.Version, version); err != nil {
+			return err
+		}
 
-	result := s.GormDB.Delete(&models.Client{}, id)
-	return checkResult(result)
+		result := tx.GormDB.WithContext(ctx).Delete(&models.Client{}, id)
+		return checkResult(result)
+	})
 }
 
-func (s *PostgresStore) CreateCar(car *models.CarPark) (int, error) {
-	result := s.GormDB.Create(car)
+func (s *PostgresStore) RestoreClient(ctx context.Context, id int) (*models.Client, error) {
+	var client models.Client
+	if err := restoreRow(s.GormDB.WithContext(ctx), &client, id); err != nil {
+		return nil, translateError(err)
+	}
+	return &client, nil
+}
+
+func (s *PostgresStore) CreateCar(ctx context.Context, car *models.CarPark) (int, error) {
+	car.Version = 1
+	result := s.GormDB.WithContext(ctx).Create(car)
 	if result.Error != nil {
-		return 0, result.Error
+		return 0, translateError(result.Error)
 	}
 	return car.ID_Car, nil
 }
 
-func (s *PostgresStore) GetCars() ([]*models.CarPark, error) {
-	var carParks []*models.CarPark
-	result := s.GormDB.Find(&carParks)
-	return carParks, result.Error
+func (s *PostgresStore) ListCars(ctx context.Context, query *ListQuery) (*Page[*models.CarPark], error) {
+	page := &Page[*models.CarPark]{}
+	total, err := listGorm(s.GormDB.WithContext(ctx), &models.CarPark{}, &page.Items, query, CarFields)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	page.Total = total
+	return page, nil
+}
+
+func (s *PostgresStore) GetCarByID(ctx context.Context, id int) (*models.CarPark, error) {
+	var car models.CarPark
+	if err := s.GormDB.WithContext(ctx).First(&car, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &car, nil
 }
 
-func (s *PostgresStore) PatchCar(id int, updates map[string]interface{}) error {
-	result := s.GormDB.Model(&models.CarPark{}).Where("id_car = ?", id).Updates(updates)
-	return checkResult(result)
+// UpdateCar replaces every field of a car except its status, which only changes through TransitionCarStatus
+func (s *PostgresStore) UpdateCar(ctx context.Context, id int, car *models.CarPark) error {
+	car.ID_Car = id
+	car.DeletedAt = gorm.DeletedAt{}
+	return translateError(saveVersioned(s.GormDB.WithContext(ctx), car, id, car.Version, "status", "deleted_at"))
 }
 
-func (s *PostgresStore) DeleteCar(id int) error {
+// TransitionCarStatus moves a car to a new lifecycle status, rejecting moves not allowed by the transition graph.
+// The row is locked for the duration of the check so concurrent transitions cannot both succeed.
+func (s *PostgresStore) TransitionCarStatus(ctx context.Context, id int, status models.CarStatus) (*models.CarPark, error) {
 	var car models.CarPark
-	if err := s.GormDB.First(&car, id).Error; err != nil {
-		return err
+	err := s.inTx(ctx, func(tx *PostgresStore) error {
+		db := tx.GormDB
+
+		if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&car, id).Error; err != nil {
+			return translateError(err)
+		}
+
+		if !car.Status.CanTransitionTo(status) {
+			return fmt.Errorf("%w: car %d cannot move from %s to %s", ErrInvalidTransition, id, car.Status, status)
+		}
+
+		// While an order holds the car, its status follows the order
+		if car.VIN != nil {
+			var active int64
+			err := db.Model(&models.Order{}).
+				Where("vin = ? AND status IN ?", *car.VIN, []models.OrderStatus{models.OrderStatusPending, models.OrderStatusInProgress}).
+				Count(&active).Error
+			if err != nil {
+				return translateError(err)
+			}
+			if active > 0 {
+				return fmt.Errorf("%w: car %d has an active order, change the order instead", ErrCarUnavailable, id)
+			}
+		}
+
+		car.Status = status
+		car.Version++ // The row is locked, so the trigger moves it to exactly the next version
+		return db.Model(&models.CarPark{}).Where("id_car = ?", id).Update("status", status).Error
+	})
+	if err != nil {
+		return nil, translateError(err)
 	}
-	
-	if car.VIN != nil {
-		var count int64
-		s.GormDB.Model(&models.Order{}).Where("vin = ?", *car.VIN).Count(&count)
-		
-		if count > 0 {
-			return fmt.Errorf("cannot delete car: referenced by %d order records", count)
+	return &car, nil
+}
+
+// moveCar locks the car with the given VIN and moves it to status, failing with ErrCarUnavailable
+// if the car does not exist or the lifecycle graph forbids the move
+func moveCar(tx *gorm.DB, vin string, status models.CarStatus) error {
+	var car models.CarPark
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("vin = ?", vin).First(&car).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: no car with VIN %s", ErrCarUnavailable, vin)
 		}
+		return translateError(err)
+	}
+	if !car.Status.CanTransitionTo(status) {
+		return fmt.Errorf("%w: car %s is %s and cannot become %s", ErrCarUnavailable, vin, car.Status, status)
 	}
-	
-	result := s.GormDB.Delete(&models.CarPark{}, id)
-	return checkResult(result)
+	return tx.Model(&models.CarPark{}).Where("id_car = ?", car.ID_Car).Update("status", status).Error
 }
 
-func (s *PostgresStore) CreateOrder(order *models.Order) (int, error) {
-	result := s.GormDB.Create(order)
-	if result.Error != nil {
-		return 0, result.Error
+// checkCarDealership locks the car with the given VIN and fails with ErrCarElsewhere unless it belongs to
+// dealershipID, so that an order cannot sell a car of another branch. A missing car is left to moveCar.
+func checkCarDealership(tx *gorm.DB, vin string, dealershipID int) error {
+	var car models.CarPark
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("vin = ?", vin).First(&car).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return translateError(err)
+	}
+	if car.ID_Dealership != dealershipID {
+		return fmt.Errorf("%w: car %s belongs to dealership %d, not %d", ErrCarElsewhere, vin, car.ID_Dealership, dealershipID)
+	}
+	return nil
+}
+
+// DeleteCar soft-deletes a car that is not held by a sale. The orders and appointments of the car keep
+// referring to the deleted row. The car is locked first, so it cannot be reserved while its status is checked.
+func (s *PostgresStore) DeleteCar(ctx context.Context, id, version int) error {
+	return s.inTx(ctx, func(tx *PostgresStore) error {
+		db := tx.GormDB.WithContext(ctx)
+
+		var car models.CarPark
+		if err := lockRow(db, &car, id); err != nil {
+			return translateError(err)
+		}
+		if err := checkVersion(car.Version, version); err != nil {
+			return err
+		}
+
+		if !car.Status.IsDeletable() {
+			return fmt.Errorf("%w: car %d is %s and cannot be deleted", ErrCarUnavailable, id, car.Status)
+		}
+
+		result := db.Delete(&models.CarPark{}, id)
+		return checkResult(result)
+	})
+}
+
+func (s *PostgresStore) RestoreCar(ctx context.Context, id int) (*models.CarPark, error) {
+	var car models.CarPark
+	if err := restoreRow(s.GormDB.WithContext(ctx), &car, id); err != nil {
+		return nil, translateError(err)
+	}
+	return &car, nil
+}
+
+// CreateOrder inserts a pending order, reserves its car and opens the order history in the same transaction
+func (s *PostgresStore) CreateOrder(ctx context.Context, order *models.Order, actorID int) (int, error) {
+	err := s.inTx(ctx, func(tx *PostgresStore) error {
+		db := tx.GormDB
+
+		if err := checkCarDealership(db, order.VIN, order.ID_Dealership); err != nil {
+			return err
+		}
+		if err := moveCar(db, order.VIN, models.CarStatusReserved); err != nil {
+			return translateError(err)
+		}
+		order.Version = 1
+		if err := db.Create(order).Error; err != nil {
+			return translateError(err)
+		}
+		return recordOrderStatus(db, order, nil, actorID)
+	})
+	if err != nil {
+		return 0, translateError(err)
 	}
 	return order.ID_Order, nil
 }
 
-func (s *PostgresStore) GetOrders() ([]*models.Order, error) {
-	var orders []*models.Order
-	result := s.GormDB.Find(&orders)
-	return orders, result.Error
+func (s *PostgresStore) ListOrders(ctx context.Context, query *ListQuery) (*Page[*models.Order], error) {
+	page := &Page[*models.Order]{}
+	total, err := listGorm(s.GormDB.WithContext(ctx), &models.Order{}, &page.Items, query, OrderFields)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	page.Total = total
+	return page, nil
+}
+
+func (s *PostgresStore) GetOrderByID(ctx context.Context, id int) (*models.Order, error) {
+	var order models.Order
+	if err := s.GormDB.WithContext(ctx).First(&order, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &order, nil
 }
 
-func (s *PostgresStore) UpdateOrder(id int, order *models.Order) error {
+// UpdateOrder replaces an order, enforcing the order state machine and keeping its car in step:
+// changing the car of an active order releases the old car and reserves the new one, which must belong
+// to the dealership of the order, completing
+// the order marks the car sold and cancelling it releases the car, all in one transaction.
+// Every status change is appended to the order history.
+func (s *PostgresStore) UpdateOrder(ctx context.Context, id int, order *models.Order, actorID int) error {
 	order.ID_Order = id
-	result := s.GormDB.Save(order)
-	return checkResult(result)
+	order.LastUpdate = time.Now()
+	return s.inTx(ctx, func(tx *PostgresStore) error {
+		db := tx.GormDB
+
+		var current models.Order
+		if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, id).Error; err != nil {
+			return translateError(err)
+		}
+		if err := checkVersion(current.Version, order.Version); err != nil {
+			return err
+		}
+
+		if current.Status != order.Status && !current.Status.CanTransitionTo(order.Status) {
+			return fmt.Errorf("%w: order %d cannot move from %s to %s", ErrInvalidTransition, id, current.Status, order.Status)
+		}
+
+		if current.VIN != order.VIN {
+			if !current.Status.IsActive() {
+				return fmt.Errorf("%w: the car of a %s order cannot be changed", ErrInvalidTransition, current.Status)
+			}
+			if err := checkCarDealership(db, order.VIN, order.ID_Dealership); err != nil {
+				return err
+			}
+			if err := moveCar(db, current.VIN, models.CarStatusInStock); err != nil {
+				return translateError(err)
+			}
+			if err := moveCar(db, order.VIN, models.CarStatusReserved); err != nil {
+				return translateError(err)
+			}
+		} else if current.ID_Dealership != order.ID_Dealership {
+			if err := checkCarDealership(db, order.VIN, order.ID_Dealership); err != nil {
+				return err
+			}
+		}
+
+		if current.Status != order.Status {
+			switch order.Status {
+			case models.OrderStatusCompleted:
+				if err := moveCar(db, order.VIN, models.CarStatusSold); err != nil {
+					return translateError(err)
+				}
+			case models.OrderStatusCancelled:
+				if err := moveCar(db, order.VIN, models.CarStatusInStock); err != nil {
+					return translateError(err)
+				}
+			}
+		}
+
+		if err := saveVersioned(db, order, id, 0); err != nil {
+			return translateError(err)
+		}
+
+		if current.Status != order.Status {
+			return recordOrderStatus(db, order, &current.Status, actorID)
+		}
+		return nil
+	})
+}
+
+func (s *PostgresStore) ListOrderHistory(ctx context.Context, orderID int) ([]*models.OrderStatusChange, error) {
+	var history []*models.OrderStatusChange
+	err := s.GormDB.WithContext(ctx).Where("id_order = ?", orderID).Order("changed_at ASC, id_change ASC").Find(&history).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return history, nil
+}
+
+func (s *PostgresStore) CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	return translateError(s.GormDB.WithContext(ctx).Create(entry).Error)
 }
 
-func (s *PostgresStore) DeleteOrder(id int) error {
-	result := s.GormDB.Delete(&models.Order{}, id)
-	return checkResult(result)
+func (s *PostgresStore) ListAuditEntries(ctx context.Context, query *ListQuery) (*Page[*models.AuditEntry], error) {
+	page := &Page[*models.AuditEntry]{}
+	total, err := listGorm(s.GormDB.WithContext(ctx), &models.AuditEntry{}, &page.Items, query, AuditFields)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	page.Total = total
+	return page, nil
+}
+
+// recordOrderStatus appends the current status of order to its history
+func recordOrderStatus(tx *gorm.DB, order *models.Order, from *models.OrderStatus, actorID int) error {
+	change := &models.OrderStatusChange{
+		ID_Order:   order.ID_Order,
+		FromStatus: from,
+		ToStatus:   order.Status,
+		Reason:     order.StatusReason,
+		ChangedAt:  order.LastUpdate,
+	}
+	if actorID != 0 {
+		change.ID_Employee = &actorID
+	}
+	if change.ChangedAt.IsZero() {
+		change.ChangedAt = time.Now()
+	}
+	return tx.Create(change).Error
 }
 
-func (s *PostgresStore) CreateAppointment(appointment *models.Appointment) (int, error) {
-	result := s.GormDB.Create(appointment)
+// DeleteOrder removes an order, releasing its car if the order was still active
+func (s *PostgresStore) DeleteOrder(ctx context.Context, id, version int) error {
+	return s.inTx(ctx, func(tx *PostgresStore) error {
+		db := tx.GormDB
+
+		var order models.Order
+		if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, id).Error; err != nil {
+			return translateError(err)
+		}
+		if err := checkVersion(order.Version, version); err != nil {
+			return err
+		}
+
+		if order.Status.IsActive() {
+			if err := moveCar(db, order.VIN, models.CarStatusInStock); err != nil {
+				return translateError(err)
+			}
+		}
+
+		return checkResult(db.Delete(&models.Order{}, id))
+	})
+}
+
+func (s *PostgresStore) CreateAppointment(ctx context.Context, appointment *models.Appointment) (int, error) {
+	if appointment.DurationMinutes == 0 {
+		appointment.DurationMinutes = models.DefaultAppointmentMinutes
+	}
+	appointment.Version = 1
+	result := s.GormDB.WithContext(ctx).Create(appointment)
 	if result.Error != nil {
-		return 0, result.Error
+		return 0, translateAppointmentError(result.Error, appointment)
 	}
 	return appointment.ID_Appointment, nil
 }
 
-func (s *PostgresStore) GetAppointments() ([]*models.Appointment, error) {
-	var appointments []*models.Appointment
-	result := s.GormDB.Find(&appointments)
-	return appointments, result.Error
+func (s *PostgresStore) ListAppointments(ctx context.Context, query *ListQuery) (*Page[*models.Appointment], error) {
+	page := &Page[*models.Appointment]{}
+	total, err := listGorm(s.GormDB.WithContext(ctx), &models.Appointment{}, &page.Items, query, AppointmentFields)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	page.Total = total
+	return page, nil
+}
+
+func (s *PostgresStore) GetAppointmentByID(ctx context.Context, id int) (*models.Appointment, error) {
+	var appointment models.Appointment
+	if err := s.GormDB.WithContext(ctx).First(&appointment, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &appointment, nil
 }
 
-func (s *PostgresStore) UpdateAppointment(id int, appointment *models.Appointment) error {
+func (s *PostgresStore) UpdateAppointment(ctx context.Context, id int, appointment *models.Appointment) error {
 	appointment.ID_Appointment = id
-	result := s.GormDB.Save(appointment)
-	return checkResult(result)
+	if appointment.DurationMinutes == 0 {
+		appointment.DurationMinutes = models.DefaultAppointmentMinutes
+	}
+	err := saveVersioned(s.GormDB.WithContext(ctx), appointment, id, appointment.Version)
+	return translateAppointmentError(err, appointment)
 }
 
-func (s *PostgresStore) DeleteAppointment(id int) error {
-	result := s.GormDB.Delete(&models.Appointment{}, id)
-	return checkResult(result)
+func (s *PostgresStore) DeleteAppointment(ctx context.Context, id, version int) error {
+	return translateError(deleteVersioned(s.GormDB.WithContext(ctx), &models.Appointment{}, id, version))
 }
@@ -0,0 +1,39 @@
+package storage_test
+
+import (
+	"context"
+	"keeper/internal/migrate"
+	"keeper/internal/storage"
+	"keeper/internal/storage/storetest"
+	"os"
+	"testing"
+)
+
+// TestPostgresStore runs the conformance suite against the database in TEST_DATABASE_URL.
+// The schema is migrated to the latest version and every table is truncated before each test.
+func TestPostgresStore(t *testing.T) {
+	connString := os.Getenv("TEST_DATABASE_URL")
+	if connString == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping integration test")
+	}
+
+	store, err := storage.NewPostgresStore(connString)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %s", err)
+	}
+	m, err := migrate.New(store.Db)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %s", err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate test database: %s", err)
+	}
+
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		_, err := store.Db.Exec(`TRUNCATE TABLE dealership, employee, employment, car_park, client, appointment, "order", idempotency_key, audit_log, outbox_event, webhook, webhook_delivery RESTART IDENTITY CASCADE;`)
+		if err != nil {
+			t.Fatalf("failed to clean test database: %s", err)
+		}
+		return store
+	})
+}
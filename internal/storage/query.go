@@ -0,0 +1,375 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// FieldKind determines how a filter value is parsed and which operators a field supports
+type FieldKind int
+
+const (
+	KindString FieldKind = iota // equality or comma-separated IN
+	KindInt                     // equality, IN, <field>_min and <field>_max
+	KindTime                    // <field>_from and <field>_to
+	KindBool                    // equality against a boolean expression
+)
+
+// Field describes a column that list endpoints may filter and sort on
+type Field struct {
+	Column string    // SQL expression of the column (quoted where needed)
+	Kind   FieldKind // Value type of the field
+	// Predicate optionally replaces "<Column> <op> ?" with a custom SQL
+	// fragment containing exactly one "?" placeholder (equality only).
+	Predicate string
+	// NoSort excludes the field from the sort whitelist
+	NoSort bool
+}
+
+// FieldSet maps public (JSON) field names to their SQL definition
+type FieldSet struct {
+	Fields     map[string]Field
+	DefaultKey string // Field used as default, stable sort order
+}
+
+// Operator is a comparison used by a Filter
+type Operator string
+
+const (
+	OpEq  Operator = "="
+	OpIn  Operator = "IN"
+	OpGte Operator = ">="
+	OpLte Operator = "<="
+	OpLt  Operator = "<"
+)
+
+// Filter is a single condition on a whitelisted field
+type Filter struct {
+	Field string
+	Op    Operator
+	Value any // []any for OpIn
+}
+
+// Sort orders results by a whitelisted field
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// ListQuery carries pagination, sorting, filtering and dealership scope for List methods
+type ListQuery struct {
+	Filters []Filter
+	Sort    []Sort
+	Offset  int
+	Limit   int
+	Scope   *Scope
+	// IncludeDeleted lists soft-deleted clients, cars and employees along with the others
+	IncludeDeleted bool
+}
+
+// Page is one page of a list result together with the total number of matching rows
+type Page[T any] struct {
+	Items []T
+	Total int64
+}
+
+// Field sets of every listable resource
+
+var DealershipFields = FieldSet{
+	DefaultKey: "id_dealership",
+	Fields: map[string]Field{
+		"id_dealership": {Column: "id_dealership", Kind: KindInt},
+		"postalcode":    {Column: "postalcode", Kind: KindString},
+		"city":          {Column: "city", Kind: KindString},
+	},
+}
+
+var EmployeeFields = FieldSet{
+	DefaultKey: "id_employee",
+	Fields: map[string]Field{
+		"id_employee": {Column: "id_employee", Kind: KindInt},
+		"role":        {Column: "role", Kind: KindString},
+		"tin":         {Column: "tin", Kind: KindString},
+		"name":        {Column: "name", Kind: KindString},
+		"surname":     {Column: "surname", Kind: KindString},
+	},
+}
+
+var EmploymentFields = FieldSet{
+	DefaultKey: "id_employment",
+	Fields: map[string]Field{
+		"id_employment": {Column: "id_employment", Kind: KindInt},
+		"id_employee":   {Column: "id_employee", Kind: KindInt},
+		"id_dealership": {Column: "id_dealership", Kind: KindInt},
+		"startdate":     {Column: "startdate", Kind: KindTime},
+		"enddate":       {Column: "enddate", Kind: KindTime},
+		"active":        {Predicate: "(enddate IS NULL) = ?", Kind: KindBool, NoSort: true},
+	},
+}
+
+var ClientFields = FieldSet{
+	DefaultKey: "id_client",
+	Fields: map[string]Field{
+		"id_client":   {Column: "id_client", Kind: KindInt},
+		"type":        {Column: `"type"`, Kind: KindString},
+		"email":       {Column: "email", Kind: KindString},
+		"tin_vat":     {Column: "tin_vat", Kind: KindString},
+		"name":        {Column: "name", Kind: KindString},
+		"surname":     {Column: "surname", Kind: KindString},
+		"companyname": {Column: "companyname", Kind: KindString},
+	},
+}
+
+var CarFields = FieldSet{
+	DefaultKey: "id_car",
+	Fields: map[string]Field{
+		"id_car":        {Column: "id_car", Kind: KindInt},
+		"vin":           {Column: "vin", Kind: KindString},
+		"id_dealership": {Column: "id_dealership", Kind: KindInt},
+		"brand":         {Column: "brand", Kind: KindString},
+		"model":         {Column: "model", Kind: KindString},
+		"condition":     {Column: "condition", Kind: KindString},
+		"year":          {Column: `"year"`, Kind: KindInt},
+		"plate":         {Column: "plate", Kind: KindString},
+		"status":        {Column: "status", Kind: KindString},
+		"city": {
+			Predicate: "id_dealership IN (SELECT id_dealership FROM dealership WHERE city = ?)",
+			Kind:      KindString,
+			NoSort:    true,
+		},
+	},
+}
+
+var OrderFields = FieldSet{
+	DefaultKey: "id_order",
+	Fields: map[string]Field{
+		"id_order":      {Column: "id_order", Kind: KindInt},
+		"status":        {Column: "status", Kind: KindString},
+		"id_client":     {Column: "id_client", Kind: KindInt},
+		"id_employee":   {Column: "id_employee", Kind: KindInt},
+		"vin":           {Column: "vin", Kind: KindString},
+		"id_dealership": {Column: "id_dealership", Kind: KindInt},
+		"last_update":   {Column: "last_update", Kind: KindTime},
+	},
+}
+
+var AppointmentFields = FieldSet{
+	DefaultKey: "id_appointment",
+	Fields: map[string]Field{
+		"id_appointment": {Column: "id_appointment", Kind: KindInt},
+		"id_client":      {Column: "id_client", Kind: KindInt},
+		"id_employee":    {Column: "id_employee", Kind: KindInt},
+		"id_dealership":  {Column: "id_dealership", Kind: KindInt},
+		"date":           {Column: `"date"`, Kind: KindTime},
+		"vin":            {Column: "vin", Kind: KindString},
+	},
+}
+
+var AuditFields = FieldSet{
+	DefaultKey: "id_audit",
+	Fields: map[string]Field{
+		"id_audit":    {Column: "id_audit", Kind: KindInt},
+		"entity":      {Column: "entity", Kind: KindString},
+		"entity_id":   {Column: "entity_id", Kind: KindInt},
+		"action":      {Column: "action", Kind: KindString},
+		"id_employee": {Column: "id_employee", Kind: KindInt},
+		"request_id":  {Column: "request_id", Kind: KindString},
+		"changed_at":  {Column: "changed_at", Kind: KindTime},
+	},
+}
+
+var OutboxFields = FieldSet{
+	DefaultKey: "id_event",
+	Fields: map[string]Field{
+		"id_event":      {Column: "id_event", Kind: KindInt},
+		"event_type":    {Column: "event_type", Kind: KindString},
+		"entity":        {Column: "entity", Kind: KindString},
+		"entity_id":     {Column: "entity_id", Kind: KindInt},
+		"id_dealership": {Column: "id_dealership", Kind: KindInt},
+		"status":        {Column: "status", Kind: KindString},
+		"attempts":      {Column: "attempts", Kind: KindInt},
+		"created_at":    {Column: "created_at", Kind: KindTime},
+	},
+}
+
+var WebhookFields = FieldSet{
+	DefaultKey: "id_webhook",
+	Fields: map[string]Field{
+		"id_webhook": {Column: "id_webhook", Kind: KindInt},
+		"url":        {Column: "url", Kind: KindString},
+		"paused":     {Column: "paused", Kind: KindBool},
+		"created_at": {Column: "created_at", Kind: KindTime},
+	},
+}
+
+var WebhookDeliveryFields = FieldSet{
+	DefaultKey: "id_delivery",
+	Fields: map[string]Field{
+		"id_delivery":     {Column: "id_delivery", Kind: KindInt},
+		"id_webhook":      {Column: "id_webhook", Kind: KindInt},
+		"id_event":        {Column: "id_event", Kind: KindInt},
+		"event_type":      {Column: "event_type", Kind: KindString},
+		"status":          {Column: "status", Kind: KindString},
+		"attempts":        {Column: "attempts", Kind: KindInt},
+		"response_status": {Column: "response_status", Kind: KindInt},
+		"created_at":      {Column: "created_at", Kind: KindTime},
+	},
+}
+
+// whereClauses renders the filters and scope of q as SQL fragments with "?" placeholders
+func (q *ListQuery) whereClauses(fields FieldSet) ([]string, [][]any, error) {
+	var clauses []string
+	var args [][]any
+
+	for _, f := range q.Filters {
+		field, ok := fields.Fields[f.Field]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown filter field %q", f.Field)
+		}
+
+		switch {
+		case field.Predicate != "":
+			if f.Op != OpEq {
+				return nil, nil, fmt.Errorf("field %q only supports equality", f.Field)
+			}
+			clauses = append(clauses, field.Predicate)
+			args = append(args, []any{f.Value})
+		case f.Op == OpIn:
+			values, _ := f.Value.([]any)
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+			clauses = append(clauses, fmt.Sprintf("%s IN (%s)", field.Column, placeholders))
+			args = append(args, values)
+		default:
+			clauses = append(clauses, fmt.Sprintf("%s %s ?", field.Column, f.Op))
+			args = append(args, []any{f.Value})
+		}
+	}
+
+	if q.Scope != nil {
+		if len(q.Scope.DealershipIDs) == 0 {
+			clauses = append(clauses, "FALSE")
+			args = append(args, nil)
+		} else {
+			values := make([]any, len(q.Scope.DealershipIDs))
+			for i, id := range q.Scope.DealershipIDs {
+				values[i] = id
+			}
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+			clauses = append(clauses, fmt.Sprintf("id_dealership IN (%s)", placeholders))
+			args = append(args, values)
+		}
+	}
+
+	return clauses, args, nil
+}
+
+// orderBy renders the ORDER BY expression of q, always ending with the default key for stable paging
+func (q *ListQuery) orderBy(fields FieldSet) (string, error) {
+	var parts []string
+	keyed := false
+
+	for _, srt := range q.Sort {
+		field, ok := fields.Fields[srt.Field]
+		if !ok || field.NoSort || field.Column == "" {
+			return "", fmt.Errorf("cannot sort by %q", srt.Field)
+		}
+		direction := "ASC"
+		if srt.Desc {
+			direction = "DESC"
+		}
+		parts = append(parts, field.Column+" "+direction)
+		if srt.Field == fields.DefaultKey {
+			keyed = true
+		}
+	}
+
+	if !keyed {
+		parts = append(parts, fields.Fields[fields.DefaultKey].Column+" ASC")
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// applyFilters adds the WHERE conditions of q to a GORM query
+func applyFilters(db *gorm.DB, q *ListQuery, fields FieldSet) (*gorm.DB, error) {
+	clauses, args, err := q.whereClauses(fields)
+	if err != nil {
+		return nil, err
+	}
+	for i, clause := range clauses {
+		db = db.Where(clause, args[i]...)
+	}
+	return db, nil
+}
+
+// listGorm runs a paginated, filtered and sorted query for model into dest and returns the total row count
+func listGorm(db *gorm.DB, model any, dest any, q *ListQuery, fields FieldSet) (int64, error) {
+	if q.IncludeDeleted {
+		db = db.Unscoped()
+	}
+	filtered, err := applyFilters(db.Model(model), q, fields)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	if err := filtered.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return 0, err
+	}
+
+	order, err := q.orderBy(fields)
+	if err != nil {
+		return 0, err
+	}
+
+	paged := filtered.Session(&gorm.Session{}).Order(order).Offset(q.Offset)
+	if q.Limit > 0 {
+		paged = paged.Limit(q.Limit)
+	}
+	return total, paged.Find(dest).Error
+}
+
+// GetIncludingDeleted reads the record whose key field equals id through list, whether or not it is
+// soft-deleted, and fails with ErrNotFound if there is none
+func GetIncludingDeleted[T any](ctx context.Context, list func(context.Context, *ListQuery) (*Page[*T], error), key string, id int) (*T, error) {
+	page, err := list(ctx, &ListQuery{IncludeDeleted: true, Filters: []Filter{{Field: key, Op: OpEq, Value: id}}})
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Items) == 0 {
+		return nil, ErrNotFound
+	}
+	return page.Items[0], nil
+}
+
+// sqlWhere renders the filters of q as a WHERE clause with numbered ($n) placeholders for database/sql
+func sqlWhere(q *ListQuery, fields FieldSet) (string, []any, error) {
+	clauses, args, err := q.whereClauses(fields)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(clauses) == 0 {
+		return "", nil, nil
+	}
+
+	var flat []any
+	rendered := make([]string, len(clauses))
+	for i, clause := range clauses {
+		var b strings.Builder
+		n := 0
+		for _, ch := range clause {
+			if ch == '?' {
+				flat = append(flat, args[i][n])
+				fmt.Fprintf(&b, "$%d", len(flat))
+				n++
+				continue
+			}
+			b.WriteRune(ch)
+		}
+		rendered[i] = b.String()
+	}
+
+	return " WHERE " + strings.Join(rendered, " AND "), flat, nil
+}
@@ -0,0 +1,20 @@
+package storage
+
+// Scope restricts branch-bound records (cars, orders, appointments) to a set of dealerships.
+// A nil *Scope means unrestricted access; an empty DealershipIDs slice matches nothing.
+type Scope struct {
+	DealershipIDs []int
+}
+
+// Allows reports whether a record belonging to dealershipID is visible within the scope
+func (sc *Scope) Allows(dealershipID int) bool {
+	if sc == nil {
+		return true
+	}
+	for _, id := range sc.DealershipIDs {
+		if id == dealershipID {
+			return true
+		}
+	}
+	return false
+}
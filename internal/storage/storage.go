@@ -1,48 +1,152 @@
 // internal/storage/storage.go
 package storage
 
-import "keeper/internal/models"
+import (
+	"context"
+	"keeper/internal/models"
+	"time"
+)
 
+// Store is the persistence layer used by the API.
+// Every method takes the request context, so a cancelled request or an expired deadline aborts the query.
+//
+// The main resources carry a version that every update increments. Update methods write the record
+// only while it is still at the Version of the model passed in and then set Version to the new value;
+// Delete methods take the expected version as an argument. Either fails with ErrVersionMismatch when
+// the record has moved on, and a version of 0 skips the check.
+//
+// Employees, clients and cars are soft-deleted: their Delete methods set DeletedAt, after which the
+// record is missing from every read except a list with IncludeDeleted, and its unique values may be
+// taken by a new record. Restore methods bring such a record back.
 type Store interface {
+	// WithTx runs fn in a transaction; every call made through tx commits or rolls back together.
+	// Keep transactions short: the event stream waits for every open transaction before sending later events.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+
 	//-----Dealership Methods-----
-	CreateDealership(dealership *models.Dealership) (int, error)
-	GetDealerships() ([]*models.Dealership, error)
-	UpdateDealership(id int, dealership *models.Dealership) error
-	DeleteDealership(id int) error
+	CreateDealership(ctx context.Context, dealership *models.Dealership) (int, error)
+	ListDealerships(ctx context.Context, query *ListQuery) (*Page[*models.Dealership], error)
+	GetDealershipByID(ctx context.Context, id int) (*models.Dealership, error)
+	UpdateDealership(ctx context.Context, id int, dealership *models.Dealership) error
+	DeleteDealership(ctx context.Context, id, version int) error
+
+	//-----Opening Hours & Closure Methods-----
+	ListOpeningHours(ctx context.Context, dealershipID int) ([]*models.OpeningHours, error)
+	CreateOpeningHours(ctx context.Context, hours *models.OpeningHours) (int, error)
+	UpdateOpeningHours(ctx context.Context, dealershipID, id int, hours *models.OpeningHours) error
+	DeleteOpeningHours(ctx context.Context, dealershipID, id int) error
+	ListClosures(ctx context.Context, dealershipID int) ([]*models.Closure, error)
+	CreateClosure(ctx context.Context, closure *models.Closure) (int, error)
+	UpdateClosure(ctx context.Context, dealershipID, id int, closure *models.Closure) error
+	DeleteClosure(ctx context.Context, dealershipID, id int) error
 
 	//-----Employee Methods-----
-	CreateEmployee(employee *models.Employee) (int, error)
-	GetEmployees() ([]*models.Employee, error)
-	UpdateEmployee(id int, employee *models.Employee) error
-	DeleteEmployee(id int) error
+	CreateEmployee(ctx context.Context, employee *models.Employee) (int, error)
+	ListEmployees(ctx context.Context, query *ListQuery) (*Page[*models.Employee], error)
+	GetEmployeeByID(ctx context.Context, id int) (*models.Employee, error)
+	UpdateEmployee(ctx context.Context, id int, employee *models.Employee) error
+	DeleteEmployee(ctx context.Context, id, version int) error
+	RestoreEmployee(ctx context.Context, id int) (*models.Employee, error)
+
+	//-----Credential Methods-----
+	SetEmployeeCredential(ctx context.Context, credential *models.EmployeeCredential) error
+	GetEmployeeCredentialByUsername(ctx context.Context, username string) (*models.EmployeeCredential, error)
+	GetEmployeeCredentialByEmployeeID(ctx context.Context, employeeID int) (*models.EmployeeCredential, error)
 
 	//-----Employment Methods-----
-	CreateEmployment(employment *models.Employment) (int, error)
-	GetEmployments() ([]*models.Employment, error)
-	UpdateEmployment(id int, employment *models.Employment) error
-	DeleteEmployment(id int) error
+	CreateEmployment(ctx context.Context, employment *models.Employment) (int, error)
+	ListEmployments(ctx context.Context, query *ListQuery) (*Page[*models.Employment], error)
+	GetEmploymentByID(ctx context.Context, id int) (*models.Employment, error)
+	UpdateEmployment(ctx context.Context, id int, employment *models.Employment) error
+	DeleteEmployment(ctx context.Context, id, version int) error
+	GetActiveDealershipIDs(ctx context.Context, employeeID int) ([]int, error)
 
 	//-----Client Methods-----
-	CreateClient(client *models.Client) (int, error)
-	GetClients() ([]*models.Client, error)
-	UpdateClient(id int, client *models.Client) error
-	DeleteClient(id int) error
+	CreateClient(ctx context.Context, client *models.Client) (int, error)
+	ListClients(ctx context.Context, query *ListQuery) (*Page[*models.Client], error)
+	GetClientByID(ctx context.Context, id int) (*models.Client, error)
+	UpdateClient(ctx context.Context, id int, client *models.Client) error
+	DeleteClient(ctx context.Context, id, version int) error
+	RestoreClient(ctx context.Context, id int) (*models.Client, error)
 
 	//-----CarPark Methods-----
-    CreateCar(car *models.CarPark) (int, error)
-    GetCars() ([]*models.CarPark, error)
-    PatchCar(id int, updates map[string]interface{}) error
-    DeleteCar(id int) error
+    CreateCar(ctx context.Context, car *models.CarPark) (int, error)
+    ListCars(ctx context.Context, query *ListQuery) (*Page[*models.CarPark], error)
+    GetCarByID(ctx context.Context, id int) (*models.CarPark, error)
+    UpdateCar(ctx context.Context, id int, car *models.CarPark) error
+    TransitionCarStatus(ctx context.Context, id int, status models.CarStatus) (*models.CarPark, error)
+    DeleteCar(ctx context.Context, id, version int) error
+    RestoreCar(ctx context.Context, id int) (*models.CarPark, error)
 
 	//-----Order Methods-----
-	CreateOrder(order *models.Order) (int, error)
-	GetOrders() ([]*models.Order, error)
-	UpdateOrder(id int, order *models.Order) error
-	DeleteOrder(id int) error
+	// actorID is the employee recorded in the order status history (0 if unknown)
+	CreateOrder(ctx context.Context, order *models.Order, actorID int) (int, error)
+	ListOrders(ctx context.Context, query *ListQuery) (*Page[*models.Order], error)
+	GetOrderByID(ctx context.Context, id int) (*models.Order, error)
+	UpdateOrder(ctx context.Context, id int, order *models.Order, actorID int) error
+	DeleteOrder(ctx context.Context, id, version int) error
+	ListOrderHistory(ctx context.Context, orderID int) ([]*models.OrderStatusChange, error)
 
 	//-----Appointment Methods-----
-	CreateAppointment(appointment *models.Appointment) (int, error)
-	GetAppointments() ([]*models.Appointment, error)
-	UpdateAppointment(id int, appointment *models.Appointment) error
-	DeleteAppointment(id int) error
+	CreateAppointment(ctx context.Context, appointment *models.Appointment) (int, error)
+	ListAppointments(ctx context.Context, query *ListQuery) (*Page[*models.Appointment], error)
+	GetAppointmentByID(ctx context.Context, id int) (*models.Appointment, error)
+	UpdateAppointment(ctx context.Context, id int, appointment *models.Appointment) error
+	DeleteAppointment(ctx context.Context, id, version int) error
+
+	//-----Audit Log Methods-----
+	// CreateAuditEntry appends an entry to the audit log; AuditedStore calls it for every change
+	CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+	ListAuditEntries(ctx context.Context, query *ListQuery) (*Page[*models.AuditEntry], error)
+
+	//-----Outbox Methods-----
+	// CreateOutboxEvent stores a pending event and queues a delivery for each webhook subscribed to
+	// its type; OutboxStore calls it in the transaction of the change
+	CreateOutboxEvent(ctx context.Context, event *models.OutboxEvent) error
+	// ClaimOutboxEvents returns up to limit pending events that are due, oldest first, counting an attempt
+	// for each and hiding them from other claims for lease, so that concurrent dispatchers skip them
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error)
+	MarkOutboxEventDelivered(ctx context.Context, id int) error
+	// RetryOutboxEvent records a failed attempt and makes the event due again after delay
+	RetryOutboxEvent(ctx context.Context, id int, lastError string, delay time.Duration) error
+	// DeadLetterOutboxEvent records a failed attempt and gives up on the event
+	DeadLetterOutboxEvent(ctx context.Context, id int, lastError string) error
+	// RequeueOutboxEvent makes a dead event pending again with no attempts; other events are an ErrInvalidTransition
+	RequeueOutboxEvent(ctx context.Context, id int) (*models.OutboxEvent, error)
+	ListOutboxEvents(ctx context.Context, query *ListQuery) (*Page[*models.OutboxEvent], error)
+	// OutboxWatermark returns the ID up to which events are final: no event with a smaller or equal ID
+	// can still be committed, however transactions interleave, so a reader may safely move past it
+	OutboxWatermark(ctx context.Context) (int, error)
+	GetOutboxEventByID(ctx context.Context, id int) (*models.OutboxEvent, error)
+
+	//-----Webhook Methods-----
+	// CreateWebhook stores a subscription; the events written from then on are queued for it
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) (int, error)
+	ListWebhooks(ctx context.Context, query *ListQuery) (*Page[*models.Webhook], error)
+	GetWebhookByID(ctx context.Context, id int) (*models.Webhook, error)
+	// UpdateWebhook replaces a subscription but keeps its secret and creation time
+	UpdateWebhook(ctx context.Context, id int, webhook *models.Webhook) error
+	// DeleteWebhook deletes a subscription with its deliveries
+	DeleteWebhook(ctx context.Context, id, version int) error
+	ListWebhookDeliveries(ctx context.Context, query *ListQuery) (*Page[*models.WebhookDelivery], error)
+	// ClaimWebhookDeliveries is ClaimOutboxEvents for the pending deliveries of webhooks that are not paused
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error)
+	MarkWebhookDeliveryDelivered(ctx context.Context, id, responseStatus int) error
+	// RetryWebhookDelivery records a failed attempt, with the status of the response if there was one,
+	// and makes the delivery due again after delay
+	RetryWebhookDelivery(ctx context.Context, id int, responseStatus *int, lastError string, delay time.Duration) error
+	DeadLetterWebhookDelivery(ctx context.Context, id int, responseStatus *int, lastError string) error
+	// RedeliverWebhookDelivery queues the event of a delivery of the webhook again, as a new delivery
+	RedeliverWebhookDelivery(ctx context.Context, webhookID, id int) (*models.WebhookDelivery, error)
+
+	//-----Idempotency Key Methods-----
+	// ReserveIdempotencyKey stores key as in progress and returns nil, unless the same key, route and employee
+	// was stored less than ttl ago: then it returns the stored key and leaves it untouched
+	ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey, ttl time.Duration) (*models.IdempotencyKey, error)
+	// CompleteIdempotencyKey records the response of a reserved key
+	CompleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+	// ReleaseIdempotencyKey deletes a key still in progress, so that its request can be retried
+	ReleaseIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+	// DeleteExpiredIdempotencyKeys deletes the keys stored more than ttl ago and returns how many there were
+	DeleteExpiredIdempotencyKeys(ctx context.Context, ttl time.Duration) (int64, error)
 }
@@ -0,0 +1,1263 @@
+// Package storetest is a conformance suite for storage.Store implementations.
+// Every implementation must pass it, so that code tested against one store behaves the same on the others.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"keeper/internal/models"
+	"keeper/internal/storage"
+	"testing"
+	"time"
+)
+
+// Run runs the conformance suite. newStore must return an empty store for each call.
+func Run(t *testing.T, newStore func(t *testing.T) storage.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Store)
+	}{
+		{"NotFound", testNotFound},
+		{"Dealerships", testDealerships},
+		{"UniqueKeys", testUniqueKeys},
+		{"ForeignKeys", testForeignKeys},
+		{"DeleteRestrict", testDeleteRestrict},
+		{"DeleteCascade", testDeleteCascade},
+		{"SoftDelete", testSoftDelete},
+		{"ListQuery", testListQuery},
+		{"CarLifecycle", testCarLifecycle},
+		{"Orders", testOrders},
+		{"OrderDealership", testOrderDealership},
+		{"Versions", testVersions},
+		{"AppointmentOverlap", testAppointmentOverlap},
+		{"IdempotencyKeys", testIdempotencyKeys},
+		{"Outbox", testOutbox},
+		{"Webhooks", testWebhooks},
+		{"Transactions", testTransactions},
+		{"CancelledContext", testCancelledContext},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newStore(t))
+		})
+	}
+}
+
+// fixture is a minimal set of related records most tests start from
+type fixture struct {
+	dealership int
+	employee   int
+	client     int
+	car        int
+	vin        string
+}
+
+var day = time.Date(2030, 3, 14, 0, 0, 0, 0, time.UTC)
+
+func newFixture(t *testing.T, s storage.Store) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	f := &fixture{vin: "WVWZZZ1JZXW000001"}
+
+	var err error
+	if f.dealership, err = s.CreateDealership(ctx, &models.Dealership{PostalCode: "73100", City: "Lecce", Address: "Via Roma 1", Phone: "0832000000"}); err != nil {
+		t.Fatalf("CreateDealership: %v", err)
+	}
+	if f.employee, err = s.CreateEmployee(ctx, &models.Employee{Role: models.RoleSalesperson, TIN: "RSSMRA80A01E506X", Name: "Mario", Surname: "Rossi", Phone: "3330000000"}); err != nil {
+		t.Fatalf("CreateEmployee: %v", err)
+	}
+	if f.client, err = s.CreateClient(ctx, &models.Client{Type: models.ClientTypePrivate, TIN_VAT: "VRDLGU90B02E506Y", Name: "Luigi"}); err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	if f.car, err = s.CreateCar(ctx, newCar(f.dealership, f.vin, "AB123CD")); err != nil {
+		t.Fatalf("CreateCar: %v", err)
+	}
+	return f
+}
+
+func newCar(dealershipID int, vin, plate string) *models.CarPark {
+	return &models.CarPark{
+		VIN:           &vin,
+		ID_Dealership: dealershipID,
+		Brand:         "Fiat",
+		Model:         "Panda",
+		Condition:     models.CondTypeNew,
+		Year:          2024,
+		KM:            "0",
+		Plate:         plate,
+	}
+}
+
+func (f *fixture) appointment(at time.Time, minutes int) *models.Appointment {
+	return &models.Appointment{
+		ID_Client:       f.client,
+		ID_Employee:     f.employee,
+		ID_Dealership:   f.dealership,
+		Date:            at,
+		DurationMinutes: minutes,
+		Reason:          "Test drive",
+	}
+}
+
+func (f *fixture) order() *models.Order {
+	return &models.Order{
+		Status:        models.OrderStatusPending,
+		ID_Client:     f.client,
+		ID_Employee:   f.employee,
+		VIN:           f.vin,
+		ID_Dealership: f.dealership,
+	}
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, storage.ErrNotFound)
+}
+
+// wantUnique fails the test unless err is a unique violation on field
+func wantUnique(t *testing.T, op string, err error, field string) {
+	t.Helper()
+	var unique *storage.UniqueViolationError
+	if !errors.As(err, &unique) {
+		t.Errorf("%s: got %v, want a unique violation on %s", op, err, field)
+	} else if unique.Field != field {
+		t.Errorf("%s: unique violation on %q, want %q", op, unique.Field, field)
+	}
+}
+
+// wantForeignKey fails the test unless err is a foreign key violation on field
+func wantForeignKey(t *testing.T, op string, err error, field string) {
+	t.Helper()
+	var fk *storage.ForeignKeyViolationError
+	if !errors.As(err, &fk) {
+		t.Errorf("%s: got %v, want a foreign key violation on %s", op, err, field)
+	} else if fk.Field != field {
+		t.Errorf("%s: foreign key violation on %q, want %q", op, fk.Field, field)
+	}
+}
+
+// wantReferenced fails the test unless err is a *storage.ReferencedError naming resource
+func wantReferenced(t *testing.T, op string, err error, resource string) {
+	t.Helper()
+	var referenced *storage.ReferencedError
+	if !errors.As(err, &referenced) {
+		t.Errorf("%s: got %v, want a reference error", op, err)
+		return
+	}
+	for _, ref := range referenced.References {
+		if ref.Resource == resource {
+			return
+		}
+	}
+	t.Errorf("%s: %v does not mention %s", op, err, resource)
+}
+
+func testNotFound(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	const missing = 4242
+
+	checks := map[string]error{}
+	_, checks["GetDealershipByID"] = s.GetDealershipByID(ctx, missing)
+	checks["UpdateDealership"] = s.UpdateDealership(ctx, missing, &models.Dealership{PostalCode: "1", City: "x", Address: "x", Phone: "x"})
+	checks["DeleteDealership"] = s.DeleteDealership(ctx, missing, 0)
+	checks["DeleteOpeningHours"] = s.DeleteOpeningHours(ctx, missing, missing)
+	checks["DeleteClosure"] = s.DeleteClosure(ctx, missing, missing)
+	_, checks["GetEmployeeByID"] = s.GetEmployeeByID(ctx, missing)
+	checks["DeleteEmployee"] = s.DeleteEmployee(ctx, missing, 0)
+	_, checks["GetEmployeeCredentialByUsername"] = s.GetEmployeeCredentialByUsername(ctx, "nobody")
+	_, checks["GetEmploymentByID"] = s.GetEmploymentByID(ctx, missing)
+	checks["DeleteEmployment"] = s.DeleteEmployment(ctx, missing, 0)
+	_, checks["GetClientByID"] = s.GetClientByID(ctx, missing)
+	checks["DeleteClient"] = s.DeleteClient(ctx, missing, 0)
+	_, checks["GetCarByID"] = s.GetCarByID(ctx, missing)
+	_, checks["TransitionCarStatus"] = s.TransitionCarStatus(ctx, missing, models.CarStatusInTransit)
+	checks["DeleteCar"] = s.DeleteCar(ctx, missing, 0)
+	_, checks["GetOrderByID"] = s.GetOrderByID(ctx, missing)
+	checks["DeleteOrder"] = s.DeleteOrder(ctx, missing, 0)
+	_, checks["GetAppointmentByID"] = s.GetAppointmentByID(ctx, missing)
+	checks["DeleteAppointment"] = s.DeleteAppointment(ctx, missing, 0)
+
+	for name, err := range checks {
+		if !isNotFound(err) {
+			t.Errorf("%s: got %v, want a not-found error", name, err)
+		}
+	}
+}
+
+func testDealerships(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+
+	id, err := s.CreateDealership(ctx, &models.Dealership{PostalCode: "73100", City: "Lecce", Address: "Via Roma 1", Phone: "0832"})
+	if err != nil {
+		t.Fatalf("CreateDealership: %v", err)
+	}
+
+	if err := s.UpdateDealership(ctx, id, &models.Dealership{PostalCode: "70121", City: "Bari", Address: "Via Sparano 2", Phone: "080"}); err != nil {
+		t.Fatalf("UpdateDealership: %v", err)
+	}
+
+	got, err := s.GetDealershipByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetDealershipByID: %v", err)
+	}
+	if got.ID_Dealership != id || got.City != "Bari" || got.PostalCode != "70121" {
+		t.Errorf("GetDealershipByID returned %+v after update", got)
+	}
+
+	if err := s.DeleteDealership(ctx, id, 0); err != nil {
+		t.Fatalf("DeleteDealership: %v", err)
+	}
+	if _, err := s.GetDealershipByID(ctx, id); !isNotFound(err) {
+		t.Errorf("GetDealershipByID after delete: got %v, want not found", err)
+	}
+}
+
+func testUniqueKeys(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+
+	_, err := s.CreateEmployee(ctx, &models.Employee{Role: models.RoleMechanic, TIN: "RSSMRA80A01E506X", Name: "A", Surname: "B", Phone: "1"})
+	wantUnique(t, "CreateEmployee with a duplicate TIN", err, "tin")
+	_, err = s.CreateClient(ctx, &models.Client{Type: models.ClientTypeCompany, TIN_VAT: "VRDLGU90B02E506Y", Name: "ACME"})
+	wantUnique(t, "CreateClient with a duplicate TIN/VAT number", err, "tin_vat")
+	_, err = s.CreateCar(ctx, newCar(f.dealership, f.vin, "ZZ999ZZ"))
+	wantUnique(t, "CreateCar with a duplicate VIN", err, "vin")
+	_, err = s.CreateCar(ctx, newCar(f.dealership, "WVWZZZ1JZXW000002", "AB123CD"))
+	wantUnique(t, "CreateCar with a duplicate plate", err, "plate")
+
+	// Updating a record keeps its own keys
+	car, err := s.GetCarByID(ctx, f.car)
+	if err != nil {
+		t.Fatalf("GetCarByID: %v", err)
+	}
+	car.KM = "1500"
+	if err := s.UpdateCar(ctx, f.car, car); err != nil {
+		t.Errorf("UpdateCar with unchanged keys: %v", err)
+	}
+
+	other, err := s.CreateEmployee(ctx, &models.Employee{Role: models.RoleMechanic, TIN: "BNCGNN85C03E506Z", Name: "Gianni", Surname: "Bianchi", Phone: "2"})
+	if err != nil {
+		t.Fatalf("CreateEmployee: %v", err)
+	}
+	if err := s.SetEmployeeCredential(ctx, &models.EmployeeCredential{ID_Employee: f.employee, Username: "mario", PasswordHash: "x"}); err != nil {
+		t.Fatalf("SetEmployeeCredential: %v", err)
+	}
+	err = s.SetEmployeeCredential(ctx, &models.EmployeeCredential{ID_Employee: other, Username: "mario", PasswordHash: "y"})
+	wantUnique(t, "SetEmployeeCredential with a username already in use", err, "username")
+	// Setting the credentials again replaces them
+	if err := s.SetEmployeeCredential(ctx, &models.EmployeeCredential{ID_Employee: f.employee, Username: "mario", PasswordHash: "z"}); err != nil {
+		t.Errorf("SetEmployeeCredential update: %v", err)
+	}
+	credential, err := s.GetEmployeeCredentialByUsername(ctx, "mario")
+	if err != nil {
+		t.Fatalf("GetEmployeeCredentialByUsername: %v", err)
+	}
+	if credential.ID_Employee != f.employee || credential.PasswordHash != "z" {
+		t.Errorf("GetEmployeeCredentialByUsername returned %+v", credential)
+	}
+}
+
+func testForeignKeys(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	const missing = 4242
+
+	_, err := s.CreateCar(ctx, newCar(missing, "WVWZZZ1JZXW000002", "ZZ999ZZ"))
+	wantForeignKey(t, "CreateCar with an unknown dealership", err, "id_dealership")
+	_, err = s.CreateEmployment(ctx, &models.Employment{ID_Employee: missing, ID_Dealership: f.dealership, StartDate: day})
+	wantForeignKey(t, "CreateEmployment with an unknown employee", err, "id_employee")
+	_, err = s.CreateOpeningHours(ctx, &models.OpeningHours{ID_Dealership: missing, Weekday: 1, OpensAt: "09:00", ClosesAt: "18:00"})
+	wantForeignKey(t, "CreateOpeningHours with an unknown dealership", err, "id_dealership")
+	err = s.SetEmployeeCredential(ctx, &models.EmployeeCredential{ID_Employee: missing, Username: "ghost", PasswordHash: "x"})
+	wantForeignKey(t, "SetEmployeeCredential with an unknown employee", err, "id_employee")
+
+	a := f.appointment(day.Add(10*time.Hour), 30)
+	a.ID_Client = missing
+	_, err = s.CreateAppointment(ctx, a)
+	wantForeignKey(t, "CreateAppointment with an unknown client", err, "id_client")
+
+	o := f.order()
+	o.ID_Client = missing
+	_, err = s.CreateOrder(ctx, o, 0)
+	wantForeignKey(t, "CreateOrder with an unknown client", err, "id_client")
+
+	// Check constraints are reported separately from missing references
+	var check *storage.CheckViolationError
+	_, err = s.CreateOpeningHours(ctx, &models.OpeningHours{ID_Dealership: f.dealership, Weekday: 1, OpensAt: "18:00", ClosesAt: "09:00"})
+	if !errors.As(err, &check) {
+		t.Errorf("CreateOpeningHours closing before opening: got %v, want a check violation", err)
+	}
+	// The failed order must not have reserved the car
+	car, err := s.GetCarByID(ctx, f.car)
+	if err != nil {
+		t.Fatalf("GetCarByID: %v", err)
+	}
+	if car.Status != models.CarStatusInStock {
+		t.Errorf("car is %s after a failed order, want in_stock", car.Status)
+	}
+}
+
+func testDeleteRestrict(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+
+	employmentID, err := s.CreateEmployment(ctx, &models.Employment{ID_Employee: f.employee, ID_Dealership: f.dealership, StartDate: day})
+	if err != nil {
+		t.Fatalf("CreateEmployment: %v", err)
+	}
+	// The client and the employee have a sale at another dealership, and the car a test drive
+	other, err := s.CreateDealership(ctx, &models.Dealership{PostalCode: "70121", City: "Bari", Address: "Via Sparano 1", Phone: "0800000000"})
+	if err != nil {
+		t.Fatalf("CreateDealership: %v", err)
+	}
+	sold, err := s.CreateCar(ctx, newCar(other, "WVWZZZ1JZXW000002", "EF456GH"))
+	if err != nil {
+		t.Fatalf("CreateCar: %v", err)
+	}
+	order := f.order()
+	order.VIN = "WVWZZZ1JZXW000002"
+	order.ID_Dealership = other
+	if _, err := s.CreateOrder(ctx, order, f.employee); err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	appointment := f.appointment(day.Add(10*time.Hour), 30)
+	appointment.VIN = &f.vin
+	if _, err := s.CreateAppointment(ctx, appointment); err != nil {
+		t.Fatalf("CreateAppointment: %v", err)
+	}
+
+	wantReferenced(t, "DeleteDealership of a referenced dealership", s.DeleteDealership(ctx, f.dealership, 0), "employments")
+	wantReferenced(t, "DeleteEmployee of an employee at work", s.DeleteEmployee(ctx, f.employee, 0), "employments")
+	if err := s.DeleteCar(ctx, sold, 0); !errors.Is(err, storage.ErrCarUnavailable) {
+		t.Errorf("DeleteCar of a reserved car: got %v, want ErrCarUnavailable", err)
+	}
+
+	// Orders and appointments do not hold back deletes, as the deleted rows stay in place for them
+	employment, err := s.GetEmploymentByID(ctx, employmentID)
+	if err != nil {
+		t.Fatalf("GetEmploymentByID: %v", err)
+	}
+	employment.EndDate = &day
+	if err := s.UpdateEmployment(ctx, employmentID, employment); err != nil {
+		t.Fatalf("UpdateEmployment: %v", err)
+	}
+	if err := s.DeleteClient(ctx, f.client, 0); err != nil {
+		t.Errorf("DeleteClient of a client with an order and an appointment: %v", err)
+	}
+	if err := s.DeleteEmployee(ctx, f.employee, 0); err != nil {
+		t.Errorf("DeleteEmployee of an employee with an order and an appointment: %v", err)
+	}
+	if err := s.DeleteCar(ctx, f.car, 0); err != nil {
+		t.Errorf("DeleteCar of a car with an appointment: %v", err)
+	}
+	if _, err := s.RestoreClient(ctx, f.client); err != nil {
+		t.Errorf("RestoreClient: %v", err)
+	}
+	if _, err := s.RestoreEmployee(ctx, f.employee); err != nil {
+		t.Errorf("RestoreEmployee: %v", err)
+	}
+	if _, err := s.RestoreCar(ctx, f.car); err != nil {
+		t.Errorf("RestoreCar: %v", err)
+	}
+	if err := s.DeleteCar(ctx, f.car, 0); err != nil {
+		t.Errorf("DeleteCar: %v", err)
+	}
+	// A deleted car can still be restored, so it keeps its dealership
+	wantReferenced(t, "DeleteDealership with a deleted car", s.DeleteDealership(ctx, f.dealership, 0), "cars")
+}
+
+func testDeleteCascade(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+
+	dealershipID, err := s.CreateDealership(ctx, &models.Dealership{PostalCode: "73100", City: "Lecce", Address: "Via Roma 1", Phone: "0832"})
+	if err != nil {
+		t.Fatalf("CreateDealership: %v", err)
+	}
+	if _, err := s.CreateOpeningHours(ctx, &models.OpeningHours{ID_Dealership: dealershipID, Weekday: 1, OpensAt: "09:00", ClosesAt: "13:00"}); err != nil {
+		t.Fatalf("CreateOpeningHours: %v", err)
+	}
+	if _, err := s.CreateClosure(ctx, &models.Closure{ID_Dealership: dealershipID, StartDate: day, EndDate: day}); err != nil {
+		t.Fatalf("CreateClosure: %v", err)
+	}
+
+	if err := s.DeleteDealership(ctx, dealershipID, 0); err != nil {
+		t.Fatalf("DeleteDealership: %v", err)
+	}
+
+	hours, err := s.ListOpeningHours(ctx, dealershipID)
+	if err != nil {
+		t.Fatalf("ListOpeningHours: %v", err)
+	}
+	closures, err := s.ListClosures(ctx, dealershipID)
+	if err != nil {
+		t.Fatalf("ListClosures: %v", err)
+	}
+	if len(hours) != 0 || len(closures) != 0 {
+		t.Errorf("%d opening hours and %d closures left after deleting their dealership", len(hours), len(closures))
+	}
+}
+
+func testSoftDelete(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+
+	if err := s.SetEmployeeCredential(ctx, &models.EmployeeCredential{ID_Employee: f.employee, Username: "mario", PasswordHash: "x"}); err != nil {
+		t.Fatalf("SetEmployeeCredential: %v", err)
+	}
+	if _, err := s.RestoreCar(ctx, f.car); !errors.Is(err, storage.ErrNotDeleted) {
+		t.Errorf("RestoreCar of a live car: got %v, want ErrNotDeleted", err)
+	}
+
+	if err := s.DeleteEmployee(ctx, f.employee, 0); err != nil {
+		t.Fatalf("DeleteEmployee: %v", err)
+	}
+	if err := s.DeleteClient(ctx, f.client, 0); err != nil {
+		t.Fatalf("DeleteClient: %v", err)
+	}
+	if err := s.DeleteCar(ctx, f.car, 0); err != nil {
+		t.Fatalf("DeleteCar: %v", err)
+	}
+
+	// Deleted records are hidden from reads and writes
+	if _, err := s.GetCarByID(ctx, f.car); !isNotFound(err) {
+		t.Errorf("GetCarByID of a deleted car: got %v, want not found", err)
+	}
+	if err := s.DeleteClient(ctx, f.client, 0); !isNotFound(err) {
+		t.Errorf("DeleteClient of a deleted client: got %v, want not found", err)
+	}
+	if _, err := s.GetEmployeeCredentialByUsername(ctx, "mario"); !isNotFound(err) {
+		t.Errorf("GetEmployeeCredentialByUsername of a deleted employee: got %v, want not found", err)
+	}
+	page, err := s.ListCars(ctx, &storage.ListQuery{})
+	if err != nil {
+		t.Fatalf("ListCars: %v", err)
+	}
+	if page.Total != 0 {
+		t.Errorf("ListCars returned %d cars, want the deleted car left out", page.Total)
+	}
+	car, err := storage.GetIncludingDeleted(ctx, s.ListCars, "id_car", f.car)
+	if err != nil {
+		t.Fatalf("GetIncludingDeleted: %v", err)
+	}
+	if !car.DeletedAt.Valid {
+		t.Errorf("GetIncludingDeleted returned %+v, want it marked deleted", car)
+	}
+
+	// New records cannot reference deleted ones
+	_, err = s.CreateAppointment(ctx, f.appointment(day.Add(10*time.Hour), 30))
+	wantForeignKey(t, "CreateAppointment with a deleted client", err, "id_client")
+
+	// Unique values of deleted records can be reused
+	clientID, err := s.CreateClient(ctx, &models.Client{Type: models.ClientTypePrivate, TIN_VAT: "VRDLGU90B02E506Y", Name: "Luigi"})
+	if err != nil {
+		t.Fatalf("CreateClient reusing a deleted TIN/VAT number: %v", err)
+	}
+	if _, err := s.CreateCar(ctx, newCar(f.dealership, f.vin, "ZZ999ZZ")); err != nil {
+		t.Fatalf("CreateCar reusing a deleted VIN: %v", err)
+	}
+
+	// so restoring fails while they are taken
+	_, err = s.RestoreClient(ctx, f.client)
+	wantUnique(t, "RestoreClient with a TIN/VAT number in use", err, "tin_vat")
+	_, err = s.RestoreCar(ctx, f.car)
+	wantUnique(t, "RestoreCar with a VIN in use", err, "vin")
+
+	if err := s.DeleteClient(ctx, clientID, 0); err != nil {
+		t.Fatalf("DeleteClient: %v", err)
+	}
+	client, err := s.RestoreClient(ctx, f.client)
+	if err != nil {
+		t.Fatalf("RestoreClient: %v", err)
+	}
+	if client.ID_Client != f.client || client.DeletedAt.Valid {
+		t.Errorf("RestoreClient returned %+v", client)
+	}
+	if _, err := s.GetClientByID(ctx, f.client); err != nil {
+		t.Errorf("GetClientByID after restore: %v", err)
+	}
+
+	// Restoring an employee brings their login back
+	if _, err := s.RestoreEmployee(ctx, f.employee); err != nil {
+		t.Fatalf("RestoreEmployee: %v", err)
+	}
+	if _, err := s.GetEmployeeCredentialByUsername(ctx, "mario"); err != nil {
+		t.Errorf("GetEmployeeCredentialByUsername after restore: %v", err)
+	}
+	if _, err := s.RestoreEmployee(ctx, 4242); !isNotFound(err) {
+		t.Errorf("RestoreEmployee of an unknown employee: got %v, want not found", err)
+	}
+}
+
+func testListQuery(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+
+	other, err := s.CreateDealership(ctx, &models.Dealership{PostalCode: "70121", City: "Bari", Address: "Via Sparano 2", Phone: "080"})
+	if err != nil {
+		t.Fatalf("CreateDealership: %v", err)
+	}
+	cars := []*models.CarPark{
+		newCar(f.dealership, "WVWZZZ1JZXW000002", "AA000AA"),
+		newCar(other, "WVWZZZ1JZXW000003", "BB000BB"),
+		newCar(other, "WVWZZZ1JZXW000004", "CC000CC"),
+	}
+	cars[0].Year, cars[1].Year, cars[2].Year = 2018, 2020, 2022
+	cars[2].Brand = "Lancia"
+	for _, car := range cars {
+		if _, err := s.CreateCar(ctx, car); err != nil {
+			t.Fatalf("CreateCar: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query storage.ListQuery
+		want  []string // Plates in order
+		total int64
+	}{
+		{"all by default key", storage.ListQuery{}, []string{"AB123CD", "AA000AA", "BB000BB", "CC000CC"}, 4},
+		{"equality", storage.ListQuery{Filters: []storage.Filter{{Field: "brand", Op: storage.OpEq, Value: "Lancia"}}}, []string{"CC000CC"}, 1},
+		{"in", storage.ListQuery{Filters: []storage.Filter{{Field: "plate", Op: storage.OpIn, Value: []any{"AA000AA", "CC000CC"}}}}, []string{"AA000AA", "CC000CC"}, 2},
+		{"range", storage.ListQuery{Filters: []storage.Filter{{Field: "year", Op: storage.OpGte, Value: 2020}, {Field: "year", Op: storage.OpLte, Value: 2022}}}, []string{"BB000BB", "CC000CC"}, 2},
+		{"predicate", storage.ListQuery{Filters: []storage.Filter{{Field: "city", Op: storage.OpEq, Value: "Bari"}}}, []string{"BB000BB", "CC000CC"}, 2},
+		{"sort descending", storage.ListQuery{Sort: []storage.Sort{{Field: "year", Desc: true}}}, []string{"AB123CD", "CC000CC", "BB000BB", "AA000AA"}, 4},
+		{"page", storage.ListQuery{Sort: []storage.Sort{{Field: "plate"}}, Offset: 1, Limit: 2}, []string{"AB123CD", "BB000BB"}, 4},
+		{"scope", storage.ListQuery{Scope: &storage.Scope{DealershipIDs: []int{other}}}, []string{"BB000BB", "CC000CC"}, 2},
+		{"empty scope", storage.ListQuery{Scope: &storage.Scope{}}, nil, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := s.ListCars(ctx, &tc.query)
+			if err != nil {
+				t.Fatalf("ListCars: %v", err)
+			}
+			if page.Total != tc.total {
+				t.Errorf("total: got %d, want %d", page.Total, tc.total)
+			}
+			var plates []string
+			for _, car := range page.Items {
+				plates = append(plates, car.Plate)
+			}
+			if len(plates) != len(tc.want) {
+				t.Fatalf("got plates %v, want %v", plates, tc.want)
+			}
+			for i := range plates {
+				if plates[i] != tc.want[i] {
+					t.Fatalf("got plates %v, want %v", plates, tc.want)
+				}
+			}
+		})
+	}
+
+	if _, err := s.ListCars(ctx, &storage.ListQuery{Filters: []storage.Filter{{Field: "km", Op: storage.OpEq, Value: "0"}}}); err == nil {
+		t.Error("ListCars accepted a filter on a field outside the whitelist")
+	}
+
+	// The active predicate of employments matches employments without an end date
+	if _, err := s.CreateEmployment(ctx, &models.Employment{ID_Employee: f.employee, ID_Dealership: f.dealership, StartDate: day}); err != nil {
+		t.Fatalf("CreateEmployment: %v", err)
+	}
+	end := day.AddDate(1, 0, 0)
+	if _, err := s.CreateEmployment(ctx, &models.Employment{ID_Employee: f.employee, ID_Dealership: other, StartDate: day, EndDate: &end}); err != nil {
+		t.Fatalf("CreateEmployment: %v", err)
+	}
+	active, err := s.ListEmployments(ctx, &storage.ListQuery{Filters: []storage.Filter{{Field: "active", Op: storage.OpEq, Value: true}}})
+	if err != nil {
+		t.Fatalf("ListEmployments: %v", err)
+	}
+	if active.Total != 1 || active.Items[0].ID_Dealership != f.dealership {
+		t.Errorf("active employments: got %d, want only the one at dealership %d", active.Total, f.dealership)
+	}
+	ids, err := s.GetActiveDealershipIDs(ctx, f.employee)
+	if err != nil {
+		t.Fatalf("GetActiveDealershipIDs: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != f.dealership {
+		t.Errorf("GetActiveDealershipIDs: got %v, want [%d]", ids, f.dealership)
+	}
+}
+
+func testCarLifecycle(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+
+	car, err := s.GetCarByID(ctx, f.car)
+	if err != nil {
+		t.Fatalf("GetCarByID: %v", err)
+	}
+	if car.Status != models.CarStatusInStock {
+		t.Errorf("new car is %s, want in_stock", car.Status)
+	}
+
+	if _, err := s.TransitionCarStatus(ctx, f.car, models.CarStatusSold); !errors.Is(err, storage.ErrInvalidTransition) {
+		t.Errorf("in_stock -> sold: got %v, want ErrInvalidTransition", err)
+	}
+	moved, err := s.TransitionCarStatus(ctx, f.car, models.CarStatusReserved)
+	if err != nil {
+		t.Fatalf("in_stock -> reserved: %v", err)
+	}
+	if moved.Status != models.CarStatusReserved {
+		t.Errorf("TransitionCarStatus returned status %s", moved.Status)
+	}
+
+	// UpdateCar never changes the status
+	moved.Status = models.CarStatusInStock
+	if err := s.UpdateCar(ctx, f.car, moved); err != nil {
+		t.Fatalf("UpdateCar: %v", err)
+	}
+	if car, _ = s.GetCarByID(ctx, f.car); car.Status != models.CarStatusReserved {
+		t.Errorf("UpdateCar changed the status to %s", car.Status)
+	}
+
+	if err := s.DeleteCar(ctx, f.car, 0); !errors.Is(err, storage.ErrCarUnavailable) {
+		t.Errorf("DeleteCar of a reserved car: got %v, want ErrCarUnavailable", err)
+	}
+}
+
+func testOrders(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+
+	carStatus := func() models.CarStatus {
+		t.Helper()
+		car, err := s.GetCarByID(ctx, f.car)
+		if err != nil {
+			t.Fatalf("GetCarByID: %v", err)
+		}
+		return car.Status
+	}
+
+	id, err := s.CreateOrder(ctx, f.order(), f.employee)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if status := carStatus(); status != models.CarStatusReserved {
+		t.Errorf("car is %s after CreateOrder, want reserved", status)
+	}
+	if _, err := s.CreateOrder(ctx, f.order(), f.employee); !errors.Is(err, storage.ErrCarUnavailable) {
+		t.Errorf("second order on the same car: got %v, want ErrCarUnavailable", err)
+	}
+	if _, err := s.TransitionCarStatus(ctx, f.car, models.CarStatusInStock); !errors.Is(err, storage.ErrCarUnavailable) {
+		t.Errorf("TransitionCarStatus of an ordered car: got %v, want ErrCarUnavailable", err)
+	}
+
+	order, err := s.GetOrderByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetOrderByID: %v", err)
+	}
+	order.Status = models.OrderStatusCompleted
+	if err := s.UpdateOrder(ctx, id, order, f.employee); !errors.Is(err, storage.ErrInvalidTransition) {
+		t.Errorf("pending -> completed: got %v, want ErrInvalidTransition", err)
+	}
+
+	reason := "Deposit paid"
+	for _, status := range []models.OrderStatus{models.OrderStatusInProgress, models.OrderStatusCompleted} {
+		order.Status = status
+		order.StatusReason = &reason
+		if err := s.UpdateOrder(ctx, id, order, f.employee); err != nil {
+			t.Fatalf("UpdateOrder to %s: %v", status, err)
+		}
+	}
+	if status := carStatus(); status != models.CarStatusSold {
+		t.Errorf("car is %s after completing the order, want sold", status)
+	}
+
+	history, err := s.ListOrderHistory(ctx, id)
+	if err != nil {
+		t.Fatalf("ListOrderHistory: %v", err)
+	}
+	want := []models.OrderStatus{models.OrderStatusPending, models.OrderStatusInProgress, models.OrderStatusCompleted}
+	if len(history) != len(want) {
+		t.Fatalf("history has %d entries, want %d", len(history), len(want))
+	}
+	for i, change := range history {
+		if change.ToStatus != want[i] {
+			t.Errorf("history[%d] is %s, want %s", i, change.ToStatus, want[i])
+		}
+		if change.ID_Employee == nil || *change.ID_Employee != f.employee {
+			t.Errorf("history[%d] has no actor", i)
+		}
+	}
+	if history[0].FromStatus != nil {
+		t.Errorf("first history entry starts from %s, want nothing", *history[0].FromStatus)
+	}
+	if history[1].Reason == nil || *history[1].Reason != reason {
+		t.Errorf("history[1] lost the reason")
+	}
+
+	// Deleting an active order puts its car back in stock
+	second := newCar(f.dealership, "WVWZZZ1JZXW000002", "ZZ999ZZ")
+	if _, err := s.CreateCar(ctx, second); err != nil {
+		t.Fatalf("CreateCar: %v", err)
+	}
+	o := f.order()
+	o.VIN = *second.VIN
+	secondID, err := s.CreateOrder(ctx, o, 0)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if err := s.DeleteOrder(ctx, secondID, 0); err != nil {
+		t.Fatalf("DeleteOrder: %v", err)
+	}
+	car, err := s.GetCarByID(ctx, second.ID_Car)
+	if err != nil {
+		t.Fatalf("GetCarByID: %v", err)
+	}
+	if car.Status != models.CarStatusInStock {
+		t.Errorf("car is %s after deleting its order, want in_stock", car.Status)
+	}
+}
+
+func testOrderDealership(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+
+	bari, err := s.CreateDealership(ctx, &models.Dealership{PostalCode: "70121", City: "Bari", Address: "Via Sparano 1", Phone: "0800000000"})
+	if err != nil {
+		t.Fatalf("CreateDealership: %v", err)
+	}
+	elsewhere := newCar(bari, "WVWZZZ1JZXW000002", "ZZ999ZZ")
+	if _, err := s.CreateCar(ctx, elsewhere); err != nil {
+		t.Fatalf("CreateCar: %v", err)
+	}
+	carStatus := func(id int) models.CarStatus {
+		t.Helper()
+		car, err := s.GetCarByID(ctx, id)
+		if err != nil {
+			t.Fatalf("GetCarByID: %v", err)
+		}
+		return car.Status
+	}
+
+	o := f.order()
+	o.VIN = *elsewhere.VIN
+	if _, err := s.CreateOrder(ctx, o, 0); !errors.Is(err, storage.ErrCarElsewhere) {
+		t.Errorf("ordering a car of another dealership: got %v, want ErrCarElsewhere", err)
+	}
+	if status := carStatus(elsewhere.ID_Car); status != models.CarStatusInStock {
+		t.Errorf("car of another dealership is %s after the rejected order, want in_stock", status)
+	}
+
+	id, err := s.CreateOrder(ctx, f.order(), 0)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	order, err := s.GetOrderByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetOrderByID: %v", err)
+	}
+	order.VIN = *elsewhere.VIN
+	if err := s.UpdateOrder(ctx, id, order, 0); !errors.Is(err, storage.ErrCarElsewhere) {
+		t.Errorf("changing the car to one of another dealership: got %v, want ErrCarElsewhere", err)
+	}
+	order.VIN, order.ID_Dealership = f.vin, bari
+	if err := s.UpdateOrder(ctx, id, order, 0); !errors.Is(err, storage.ErrCarElsewhere) {
+		t.Errorf("moving the order away from its car: got %v, want ErrCarElsewhere", err)
+	}
+	if status := carStatus(f.car); status != models.CarStatusReserved {
+		t.Errorf("car of the order is %s after the rejected updates, want reserved", status)
+	}
+	if status := carStatus(elsewhere.ID_Car); status != models.CarStatusInStock {
+		t.Errorf("car of another dealership is %s after the rejected updates, want in_stock", status)
+	}
+}
+
+func testVersions(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+
+	client, err := s.GetClientByID(ctx, f.client)
+	if err != nil {
+		t.Fatalf("GetClientByID: %v", err)
+	}
+	if client.Version != 1 {
+		t.Errorf("new client is at version %d, want 1", client.Version)
+	}
+
+	client.Name = "Luigia"
+	if err := s.UpdateClient(ctx, f.client, client); err != nil {
+		t.Fatalf("UpdateClient at the current version: %v", err)
+	}
+	if client.Version != 2 {
+		t.Errorf("UpdateClient set version %d, want 2", client.Version)
+	}
+
+	stale := *client
+	stale.Version = 1
+	stale.Name = "Lost update"
+	if err := s.UpdateClient(ctx, f.client, &stale); !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Errorf("UpdateClient at a stale version: got %v, want ErrVersionMismatch", err)
+	}
+	if err := s.DeleteClient(ctx, f.client, 1); !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Errorf("DeleteClient at a stale version: got %v, want ErrVersionMismatch", err)
+	}
+	if got, err := s.GetClientByID(ctx, f.client); err != nil || got.Name != "Luigia" || got.Version != 2 {
+		t.Errorf("client after stale writes = %+v, %v", got, err)
+	}
+
+	// Version 0 skips the check
+	client.Version = 0
+	client.Name = "Luigi"
+	if err := s.UpdateClient(ctx, f.client, client); err != nil || client.Version != 3 {
+		t.Errorf("UpdateClient without a version: version %d, error %v", client.Version, err)
+	}
+
+	if err := s.UpdateDealership(ctx, f.dealership, &models.Dealership{PostalCode: "70121", City: "Bari", Address: "Via Sparano 2", Phone: "080", Version: 5}); !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Errorf("UpdateDealership at a stale version: got %v, want ErrVersionMismatch", err)
+	}
+	if err := s.UpdateDealership(ctx, 999999, &models.Dealership{PostalCode: "70121", City: "Bari", Address: "Via Sparano 2", Phone: "080", Version: 1}); !isNotFound(err) {
+		t.Errorf("UpdateDealership of a missing dealership: got %v, want not found", err)
+	}
+
+	// Status changes count as updates, including those made by an order
+	car, err := s.TransitionCarStatus(ctx, f.car, models.CarStatusInTransit)
+	if err != nil {
+		t.Fatalf("TransitionCarStatus: %v", err)
+	}
+	if car.Version != 2 {
+		t.Errorf("TransitionCarStatus left version %d, want 2", car.Version)
+	}
+	if _, err := s.TransitionCarStatus(ctx, f.car, models.CarStatusInStock); err != nil {
+		t.Fatalf("TransitionCarStatus: %v", err)
+	}
+	if _, err := s.CreateOrder(ctx, f.order(), 0); err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if car, err = s.GetCarByID(ctx, f.car); err != nil || car.Version != 4 {
+		t.Errorf("car ordered at version 3 is now at %d, error %v; want 4", car.Version, err)
+	}
+	if err := s.DeleteCar(ctx, f.car, 3); !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Errorf("DeleteCar at a stale version: got %v, want ErrVersionMismatch", err)
+	}
+}
+
+func testAppointmentOverlap(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	f := newFixture(t, s)
+	ten := day.Add(10 * time.Hour)
+
+	first := f.appointment(ten, 60)
+	first.VIN = &f.vin
+	firstID, err := s.CreateAppointment(ctx, first)
+	if err != nil {
+		t.Fatalf("CreateAppointment: %v", err)
+	}
+
+	if _, err := s.CreateAppointment(ctx, f.appointment(ten.Add(30*time.Minute), 30)); !errors.Is(err, storage.ErrSlotTaken) {
+		t.Errorf("overlapping appointment of the same employee: got %v, want ErrSlotTaken", err)
+	}
+	if _, err := s.CreateAppointment(ctx, f.appointment(ten.Add(time.Hour), 30)); err != nil {
+		t.Errorf("appointment starting when the previous one ends: %v", err)
+	}
+
+	colleague, err := s.CreateEmployee(ctx, &models.Employee{Role: models.RoleSalesperson, TIN: "BNCGNN85C03E506Z", Name: "Gianni", Surname: "Bianchi", Phone: "2"})
+	if err != nil {
+		t.Fatalf("CreateEmployee: %v", err)
+	}
+	sameCar := f.appointment(ten, 30)
+	sameCar.ID_Employee = colleague
+	sameCar.VIN = &f.vin
+	if _, err := s.CreateAppointment(ctx, sameCar); !errors.Is(err, storage.ErrSlotTaken) {
+		t.Errorf("overlapping appointment on the same vehicle: got %v, want ErrSlotTaken", err)
+	}
+	sameCar.VIN = nil
+	if _, err := s.CreateAppointment(ctx, sameCar); err != nil {
+		t.Errorf("parallel appointment of another employee: %v", err)
+	}
+
+	// An appointment does not collide with itself when updated
+	first.Reason = "Test drive, long route"
+	if err := s.UpdateAppointment(ctx, firstID, first); err != nil {
+		t.Errorf("UpdateAppointment in place: %v", err)
+	}
+}
+
+func testIdempotencyKeys(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	newKey := func() *models.IdempotencyKey {
+		return &models.IdempotencyKey{Key: "retry-1", Route: "POST /orders", ID_Employee: 3, RequestHash: "hash"}
+	}
+
+	key := newKey()
+	if stored, err := s.ReserveIdempotencyKey(ctx, key, time.Hour); err != nil || stored != nil {
+		t.Fatalf("ReserveIdempotencyKey of a new key: got %+v, %v; want it reserved", stored, err)
+	}
+	stored, err := s.ReserveIdempotencyKey(ctx, newKey(), time.Hour)
+	if err != nil || stored == nil || stored.StatusCode != nil {
+		t.Fatalf("ReserveIdempotencyKey of a key in progress: got %+v, %v", stored, err)
+	}
+
+	status, contentType, body := 201, "application/json", `{"id":1}`
+	key.StatusCode, key.ContentType, key.Body = &status, &contentType, &body
+	if err := s.CompleteIdempotencyKey(ctx, key); err != nil {
+		t.Fatalf("CompleteIdempotencyKey: %v", err)
+	}
+	// A completed key is not released
+	if err := s.ReleaseIdempotencyKey(ctx, key); err != nil {
+		t.Fatalf("ReleaseIdempotencyKey: %v", err)
+	}
+	stored, err = s.ReserveIdempotencyKey(ctx, newKey(), time.Hour)
+	if err != nil || stored == nil || stored.StatusCode == nil || *stored.StatusCode != status || *stored.Body != body || stored.RequestHash != "hash" {
+		t.Fatalf("ReserveIdempotencyKey of a completed key: got %+v, %v", stored, err)
+	}
+
+	// The same key is distinct on another route or for another employee
+	other := newKey()
+	other.ID_Employee = 4
+	if stored, err := s.ReserveIdempotencyKey(ctx, other, time.Hour); err != nil || stored != nil {
+		t.Errorf("ReserveIdempotencyKey for another employee: got %+v, %v; want it reserved", stored, err)
+	}
+	if err := s.ReleaseIdempotencyKey(ctx, other); err != nil {
+		t.Fatalf("ReleaseIdempotencyKey: %v", err)
+	}
+	if stored, err := s.ReserveIdempotencyKey(ctx, other, time.Hour); err != nil || stored != nil {
+		t.Errorf("ReserveIdempotencyKey of a released key: got %+v, %v; want it reserved", stored, err)
+	}
+
+	// An expired key is taken over and eventually deleted
+	time.Sleep(time.Millisecond)
+	if stored, err := s.ReserveIdempotencyKey(ctx, newKey(), 0); err != nil || stored != nil {
+		t.Errorf("ReserveIdempotencyKey of an expired key: got %+v, %v; want it reserved", stored, err)
+	}
+	time.Sleep(time.Millisecond)
+	if deleted, err := s.DeleteExpiredIdempotencyKeys(ctx, 0); err != nil || deleted != 2 {
+		t.Errorf("DeleteExpiredIdempotencyKeys: deleted %d, error %v; want 2", deleted, err)
+	}
+}
+
+func testOutbox(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	o := storage.NewOutboxStore(s)
+	f := newFixture(t, s)
+
+	events := func(query storage.ListQuery) []*models.OutboxEvent {
+		t.Helper()
+		page, err := s.ListOutboxEvents(ctx, &query)
+		if err != nil {
+			t.Fatalf("ListOutboxEvents: %v", err)
+		}
+		return page.Items
+	}
+
+	// Changes to orders and appointments write their events, and orders those of the cars they move
+	orderID, err := o.CreateOrder(ctx, f.order(), f.employee)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	order, err := o.GetOrderByID(ctx, orderID)
+	if err != nil {
+		t.Fatalf("GetOrderByID: %v", err)
+	}
+	if err := o.UpdateOrder(ctx, orderID, order, f.employee); err != nil {
+		t.Fatalf("UpdateOrder without a status change: %v", err)
+	}
+	order.Status = models.OrderStatusInProgress
+	if err := o.UpdateOrder(ctx, orderID, order, f.employee); err != nil {
+		t.Fatalf("UpdateOrder: %v", err)
+	}
+	appointmentID, err := o.CreateAppointment(ctx, f.appointment(day.Add(10*time.Hour), 30))
+	if err != nil {
+		t.Fatalf("CreateAppointment: %v", err)
+	}
+	appointment, err := o.GetAppointmentByID(ctx, appointmentID)
+	if err != nil {
+		t.Fatalf("GetAppointmentByID: %v", err)
+	}
+	appointment.Reason = "Service"
+	if err := o.UpdateAppointment(ctx, appointmentID, appointment); err != nil {
+		t.Fatalf("UpdateAppointment without moving it: %v", err)
+	}
+	appointment.Date = appointment.Date.Add(time.Hour)
+	if err := o.UpdateAppointment(ctx, appointmentID, appointment); err != nil {
+		t.Fatalf("UpdateAppointment: %v", err)
+	}
+	if err := o.DeleteAppointment(ctx, appointmentID, 0); err != nil {
+		t.Fatalf("DeleteAppointment: %v", err)
+	}
+	// A change that fails writes nothing
+	failed := f.order()
+	failed.ID_Client = 4242
+	if _, err := o.CreateOrder(ctx, failed, f.employee); err == nil {
+		t.Fatalf("CreateOrder with an unknown client succeeded")
+	}
+
+	written := events(storage.ListQuery{})
+	want := []models.EventType{
+		models.EventOrderCreated, models.EventCarStatusChanged, models.EventOrderStatusChanged,
+		models.EventAppointmentBooked, models.EventAppointmentRescheduled, models.EventAppointmentCancelled,
+	}
+	if len(written) != len(want) {
+		t.Fatalf("outbox has %d events, want %d", len(written), len(want))
+	}
+	for i, event := range written {
+		if event.EventType != want[i] || event.Status != models.EventPending || event.Attempts != 0 {
+			t.Errorf("event %d = %+v, want a pending %s", i, event, want[i])
+		}
+	}
+	if reserved := written[1]; reserved.Entity != storage.AuditCar || fmt.Sprint(reserved.Payload["status"]) != "reserved" ||
+		fmt.Sprint(reserved.Payload["previous_status"]) != "in_stock" || fmt.Sprint(reserved.Payload["id_order"]) != fmt.Sprint(orderID) {
+		t.Errorf("reservation event = %+v", reserved)
+	}
+	if changed := written[2]; changed.EntityID != orderID || fmt.Sprint(changed.Payload["previous_status"]) != "pending" || fmt.Sprint(changed.Payload["status"]) != "in_progress" {
+		t.Errorf("status change event = %+v", changed)
+	}
+	// Events record the dealership of their record, which the event stream filters and scopes by
+	for _, event := range written {
+		if event.ID_Dealership == nil || *event.ID_Dealership != f.dealership {
+			t.Errorf("event %d has dealership %v, want %d", event.ID_Event, event.ID_Dealership, f.dealership)
+		}
+	}
+	if other := events(storage.ListQuery{Scope: &storage.Scope{DealershipIDs: []int{f.dealership + 1}}}); len(other) != 0 {
+		t.Errorf("events of another dealership = %+v, want none", other)
+	}
+	// With no transaction open, the watermark covers every committed event
+	if watermark, err := s.OutboxWatermark(ctx); err != nil || watermark < written[len(written)-1].ID_Event {
+		t.Errorf("OutboxWatermark = %d, %v, want at least %d", watermark, err, written[len(written)-1].ID_Event)
+	}
+
+	// Claimed events are hidden from other claims until their lease expires
+	claimed, err := s.ClaimOutboxEvents(ctx, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("ClaimOutboxEvents: %v", err)
+	}
+	if len(claimed) != 2 || claimed[0].ID_Event != written[0].ID_Event || claimed[1].ID_Event != written[1].ID_Event || claimed[0].Attempts != 1 {
+		t.Fatalf("ClaimOutboxEvents returned %+v, want the two oldest events with one attempt", claimed)
+	}
+	rest, err := s.ClaimOutboxEvents(ctx, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("ClaimOutboxEvents: %v", err)
+	}
+	if len(rest) != 4 || rest[0].ID_Event != written[2].ID_Event {
+		t.Fatalf("second claim returned %+v, want the four other events", rest)
+	}
+
+	if err := s.MarkOutboxEventDelivered(ctx, claimed[0].ID_Event); err != nil {
+		t.Fatalf("MarkOutboxEventDelivered: %v", err)
+	}
+	if err := s.RetryOutboxEvent(ctx, claimed[1].ID_Event, "notifier responded 503", 0); err != nil {
+		t.Fatalf("RetryOutboxEvent: %v", err)
+	}
+	if err := s.DeadLetterOutboxEvent(ctx, rest[0].ID_Event, "notifier rejected the event"); err != nil {
+		t.Fatalf("DeadLetterOutboxEvent: %v", err)
+	}
+	if err := s.MarkOutboxEventDelivered(ctx, 4242); !isNotFound(err) {
+		t.Errorf("MarkOutboxEventDelivered of an unknown event: got %v, want not found", err)
+	}
+
+	// The retried event is due again, with its attempt counted
+	retried, err := s.ClaimOutboxEvents(ctx, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("ClaimOutboxEvents: %v", err)
+	}
+	if len(retried) != 1 || retried[0].ID_Event != claimed[1].ID_Event || retried[0].Attempts != 2 ||
+		retried[0].LastError == nil || *retried[0].LastError != "notifier responded 503" {
+		t.Fatalf("claim after a retry returned %+v, want the retried event", retried)
+	}
+
+	dead := events(storage.ListQuery{Filters: []storage.Filter{{Field: "status", Op: storage.OpEq, Value: "dead"}}})
+	if len(dead) != 1 || dead[0].ID_Event != rest[0].ID_Event {
+		t.Fatalf("dead events = %+v, want the dead-lettered one", dead)
+	}
+	requeued, err := s.RequeueOutboxEvent(ctx, dead[0].ID_Event)
+	if err != nil {
+		t.Fatalf("RequeueOutboxEvent: %v", err)
+	}
+	if requeued.Status != models.EventPending || requeued.Attempts != 0 {
+		t.Errorf("RequeueOutboxEvent returned %+v, want a pending event with no attempts", requeued)
+	}
+	if _, err := s.RequeueOutboxEvent(ctx, claimed[0].ID_Event); !errors.Is(err, storage.ErrInvalidTransition) {
+		t.Errorf("RequeueOutboxEvent of a delivered event: got %v, want ErrInvalidTransition", err)
+	}
+	if _, err := s.RequeueOutboxEvent(ctx, 4242); !isNotFound(err) {
+		t.Errorf("RequeueOutboxEvent of an unknown event: got %v, want not found", err)
+	}
+}
+
+func testWebhooks(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	o := storage.NewOutboxStore(s)
+
+	inventory := &models.Webhook{URL: "https://example.com/inventory", Secret: "whsec_inventory",
+		EventTypes: models.EventTypes{models.EventCarCreated, models.EventOrderCompleted}}
+	inventoryID, err := s.CreateWebhook(ctx, inventory)
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	paused := &models.Webhook{URL: "https://example.com/sales", Secret: "whsec_sales",
+		EventTypes: models.EventTypes{models.EventOrderCreated}, Paused: true}
+	pausedID, err := s.CreateWebhook(ctx, paused)
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	stored, err := s.GetWebhookByID(ctx, inventoryID)
+	if err != nil {
+		t.Fatalf("GetWebhookByID: %v", err)
+	}
+	if stored.Secret != "whsec_inventory" || len(stored.EventTypes) != 2 || stored.Version != 1 {
+		t.Errorf("GetWebhookByID = %+v", stored)
+	}
+
+	deliveries := func(webhookID int) []*models.WebhookDelivery {
+		t.Helper()
+		page, err := s.ListWebhookDeliveries(ctx, &storage.ListQuery{Filters: []storage.Filter{{Field: "id_webhook", Op: storage.OpEq, Value: webhookID}}})
+		if err != nil {
+			t.Fatalf("ListWebhookDeliveries: %v", err)
+		}
+		return page.Items
+	}
+
+	// Each event is queued for the webhooks subscribed to its type, paused or not
+	f := newFixture(t, o)
+	orderID, err := o.CreateOrder(ctx, f.order(), f.employee)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	for _, status := range []models.OrderStatus{models.OrderStatusInProgress, models.OrderStatusCompleted} {
+		order, err := o.GetOrderByID(ctx, orderID)
+		if err != nil {
+			t.Fatalf("GetOrderByID: %v", err)
+		}
+		order.Status = status
+		if err := o.UpdateOrder(ctx, orderID, order, f.employee); err != nil {
+			t.Fatalf("UpdateOrder to %s: %v", status, err)
+		}
+	}
+	queued := deliveries(inventoryID)
+	if len(queued) != 2 || queued[0].EventType != models.EventCarCreated || queued[1].EventType != models.EventOrderCompleted {
+		t.Fatalf("deliveries of the inventory webhook = %+v, want car.created and order.completed", queued)
+	}
+	if held := deliveries(pausedID); len(held) != 1 || held[0].EventType != models.EventOrderCreated || held[0].Status != models.EventPending {
+		t.Fatalf("deliveries of the paused webhook = %+v, want a pending order.created", held)
+	}
+	event, err := s.GetOutboxEventByID(ctx, queued[1].ID_Event)
+	if err != nil || event.EventType != models.EventOrderCompleted || event.EntityID != orderID {
+		t.Errorf("GetOutboxEventByID = %+v, %v, want the order.completed event", event, err)
+	}
+
+	// Deliveries of paused webhooks are not claimed
+	claimed, err := s.ClaimWebhookDeliveries(ctx, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("ClaimWebhookDeliveries: %v", err)
+	}
+	if len(claimed) != 2 || claimed[0].ID_Delivery != queued[0].ID_Delivery || claimed[0].Attempts != 1 {
+		t.Fatalf("ClaimWebhookDeliveries = %+v, want the two deliveries of the inventory webhook", claimed)
+	}
+	if again, err := s.ClaimWebhookDeliveries(ctx, 10, time.Hour); err != nil || len(again) != 0 {
+		t.Errorf("second claim = %+v, %v, want nothing while leased", again, err)
+	}
+
+	if err := s.MarkWebhookDeliveryDelivered(ctx, claimed[0].ID_Delivery, 200); err != nil {
+		t.Fatalf("MarkWebhookDeliveryDelivered: %v", err)
+	}
+	gone := 410
+	if err := s.DeadLetterWebhookDelivery(ctx, claimed[1].ID_Delivery, &gone, "webhook rejected the event with 410 Gone"); err != nil {
+		t.Fatalf("DeadLetterWebhookDelivery: %v", err)
+	}
+	if err := s.RetryWebhookDelivery(ctx, 4242, nil, "timeout", 0); !isNotFound(err) {
+		t.Errorf("RetryWebhookDelivery of an unknown delivery: got %v, want not found", err)
+	}
+	history := deliveries(inventoryID)
+	if history[0].Status != models.EventDelivered || history[0].DeliveredAt == nil || *history[0].ResponseStatus != 200 {
+		t.Errorf("delivered = %+v", history[0])
+	}
+	if history[1].Status != models.EventDead || *history[1].ResponseStatus != 410 || history[1].LastError == nil {
+		t.Errorf("dead = %+v", history[1])
+	}
+
+	// Redelivering queues the same event again and keeps the history
+	redelivery, err := s.RedeliverWebhookDelivery(ctx, inventoryID, claimed[1].ID_Delivery)
+	if err != nil {
+		t.Fatalf("RedeliverWebhookDelivery: %v", err)
+	}
+	if redelivery.ID_Delivery == claimed[1].ID_Delivery || redelivery.ID_Event != claimed[1].ID_Event || redelivery.Status != models.EventPending || redelivery.Attempts != 0 {
+		t.Errorf("RedeliverWebhookDelivery = %+v, want a new pending delivery of event %d", redelivery, claimed[1].ID_Event)
+	}
+	if _, err := s.RedeliverWebhookDelivery(ctx, pausedID, claimed[1].ID_Delivery); !isNotFound(err) {
+		t.Errorf("RedeliverWebhookDelivery through another webhook: got %v, want not found", err)
+	}
+	if len(deliveries(inventoryID)) != 3 {
+		t.Errorf("inventory webhook has %d deliveries, want 3", len(deliveries(inventoryID)))
+	}
+
+	// Updates keep the secret and are versioned
+	stored.URL, stored.Secret = "https://example.com/v2/inventory", ""
+	if err := s.UpdateWebhook(ctx, inventoryID, stored); err != nil {
+		t.Fatalf("UpdateWebhook: %v", err)
+	}
+	if updated, err := s.GetWebhookByID(ctx, inventoryID); err != nil || updated.URL != "https://example.com/v2/inventory" || updated.Secret != "whsec_inventory" || updated.Version != 2 {
+		t.Errorf("webhook after update = %+v, %v", updated, err)
+	}
+	stored.Version = 1
+	if err := s.UpdateWebhook(ctx, inventoryID, stored); !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Errorf("UpdateWebhook at a stale version: got %v, want ErrVersionMismatch", err)
+	}
+
+	// Deleting a webhook deletes its deliveries
+	if err := s.DeleteWebhook(ctx, inventoryID, 0); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+	if _, err := s.GetWebhookByID(ctx, inventoryID); !isNotFound(err) {
+		t.Errorf("GetWebhookByID after delete: got %v, want not found", err)
+	}
+	if left := deliveries(inventoryID); len(left) != 0 {
+		t.Errorf("deliveries after delete = %+v, want none", left)
+	}
+}
+
+func testTransactions(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	errRollback := errors.New("rollback")
+
+	var rolledBack int
+	err := s.WithTx(ctx, func(tx storage.Store) error {
+		var err error
+		rolledBack, err = tx.CreateDealership(ctx, &models.Dealership{PostalCode: "1", City: "Gone", Address: "x", Phone: "x"})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.CreateEmployee(ctx, &models.Employee{Role: models.RoleAdmin, TIN: "GONE", Name: "x", Surname: "x", Phone: "x"}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx returned %v, want the callback error", err)
+	}
+	if _, err := s.GetDealershipByID(ctx, rolledBack); !isNotFound(err) {
+		t.Errorf("dealership of a rolled back transaction: got %v, want not found", err)
+	}
+	if employees, err := s.ListEmployees(ctx, &storage.ListQuery{}); err != nil || employees.Total != 0 {
+		t.Errorf("employees after rollback: total %v, error %v", employees, err)
+	}
+
+	var committed int
+	err = s.WithTx(ctx, func(tx storage.Store) error {
+		var err error
+		committed, err = tx.CreateDealership(ctx, &models.Dealership{PostalCode: "1", City: "Kept", Address: "x", Phone: "x"})
+		if err != nil {
+			return err
+		}
+		// Reads inside the transaction see its own writes
+		_, err = tx.GetDealershipByID(ctx, committed)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if _, err := s.GetDealershipByID(ctx, committed); err != nil {
+		t.Errorf("dealership of a committed transaction: %v", err)
+	}
+}
+
+func testCancelledContext(t *testing.T, s storage.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.ListDealerships(ctx, &storage.ListQuery{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListDealerships with a cancelled context: got %v, want context.Canceled", err)
+	}
+	if _, err := s.CreateEmployee(ctx, &models.Employee{Role: models.RoleAdmin, TIN: "X", Name: "x", Surname: "x", Phone: "x"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("CreateEmployee with a cancelled context: got %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// sqlConn is the part of *sql.DB and *sql.Tx used by the database/sql half of PostgresStore
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the transaction the store is bound to, or the connection pool outside of one
+func (s *PostgresStore) conn() sqlConn {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.Db
+}
+
+// WithTx runs fn in a database transaction. The Store passed to fn is bound to that transaction
+// for both its database/sql and GORM methods; the transaction commits if fn returns nil and rolls
+// back otherwise. Calling WithTx on a store already in a transaction opens a savepoint.
+func (s *PostgresStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return s.inTx(ctx, func(tx *PostgresStore) error {
+		return fn(tx)
+	})
+}
+
+// inTx is WithTx for the store's own methods, which also need the GORM handle of the transaction
+func (s *PostgresStore) inTx(ctx context.Context, fn func(tx *PostgresStore) error) error {
+	err := s.GormDB.WithContext(ctx).Transaction(func(gtx *gorm.DB) error {
+		sqlTx, ok := gtx.Statement.ConnPool.(*sql.Tx)
+		if !ok {
+			return fmt.Errorf("unexpected transaction type %T", gtx.Statement.ConnPool)
+		}
+		return fn(&PostgresStore{Db: s.Db, GormDB: gtx, tx: sqlTx})
+	})
+	return translateError(err)
+}
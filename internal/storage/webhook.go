@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"keeper/internal/models"
+	"slices"
+	"time"
+)
+
+// Webhooks are stored with GORM like the other resources, while their deliveries follow the outbox:
+// CreateOutboxEvent queues them and they are claimed with SKIP LOCKED, on the database clock.
+
+const deliveryColumns = `id_delivery, id_webhook, id_event, event_type, status, attempts, next_attempt_at, response_status, last_error, created_at, delivered_at`
+
+func scanWebhookDelivery(row interface{ Scan(dest ...any) error }) (*models.WebhookDelivery, error) {
+	d := &models.WebhookDelivery{}
+	err := row.Scan(&d.ID_Delivery, &d.ID_Webhook, &d.ID_Event, &d.EventType, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.ResponseStatus, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *PostgresStore) CreateWebhook(ctx context.Context, webhook *models.Webhook) (int, error) {
+	webhook.Version = 1
+	if err := s.GormDB.WithContext(ctx).Create(webhook).Error; err != nil {
+		return 0, translateError(err)
+	}
+	return webhook.ID_Webhook, nil
+}
+
+func (s *PostgresStore) ListWebhooks(ctx context.Context, query *ListQuery) (*Page[*models.Webhook], error) {
+	page := &Page[*models.Webhook]{}
+	total, err := listGorm(s.GormDB.WithContext(ctx), &models.Webhook{}, &page.Items, query, WebhookFields)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	page.Total = total
+	return page, nil
+}
+
+func (s *PostgresStore) GetWebhookByID(ctx context.Context, id int) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := s.GormDB.WithContext(ctx).First(&webhook, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &webhook, nil
+}
+
+func (s *PostgresStore) UpdateWebhook(ctx context.Context, id int, webhook *models.Webhook) error {
+	webhook.ID_Webhook = id
+	return translateError(saveVersioned(s.GormDB.WithContext(ctx), webhook, id, webhook.Version, "secret", "created_at"))
+}
+
+func (s *PostgresStore) DeleteWebhook(ctx context.Context, id, version int) error {
+	return translateError(deleteVersioned(s.GormDB.WithContext(ctx), &models.Webhook{}, id, version))
+}
+
+func (s *PostgresStore) ListWebhookDeliveries(ctx context.Context, query *ListQuery) (*Page[*models.WebhookDelivery], error) {
+	page := &Page[*models.WebhookDelivery]{}
+	total, err := listGorm(s.GormDB.WithContext(ctx), &models.WebhookDelivery{}, &page.Items, query, WebhookDeliveryFields)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	page.Total = total
+	return page, nil
+}
+
+func (s *PostgresStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	query := `UPDATE webhook_delivery
+			  SET attempts = attempts + 1, next_attempt_at = CURRENT_TIMESTAMP + $2::float8 * INTERVAL '1 second'
+			  WHERE id_delivery IN (
+				  SELECT d.id_delivery FROM webhook_delivery d
+				  JOIN webhook w ON w.id_webhook = d.id_webhook
+				  WHERE d.status = 'pending' AND d.next_attempt_at <= CURRENT_TIMESTAMP AND NOT w.paused
+				  ORDER BY d.id_delivery
+				  LIMIT $1
+				  FOR UPDATE OF d SKIP LOCKED)
+			  RETURNING ` + deliveryColumns
+
+	rows, err := s.conn().QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, translateError(err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	slices.SortFunc(deliveries, func(a, b *models.WebhookDelivery) int { return a.ID_Delivery - b.ID_Delivery })
+	return deliveries, nil
+}
+
+func (s *PostgresStore) MarkWebhookDeliveryDelivered(ctx context.Context, id, responseStatus int) error {
+	query := `UPDATE webhook_delivery
+			  SET status = 'delivered', delivered_at = CURRENT_TIMESTAMP, response_status = $2, last_error = NULL
+			  WHERE id_delivery = $1`
+
+	result, err := s.conn().ExecContext(ctx, query, id, responseStatus)
+	if err != nil {
+		return translateError(err)
+	}
+	return translateError(checkRowsAffected(result))
+}
+
+func (s *PostgresStore) RetryWebhookDelivery(ctx context.Context, id int, responseStatus *int, lastError string, delay time.Duration) error {
+	query := `UPDATE webhook_delivery
+			  SET response_status = $2, last_error = $3, next_attempt_at = CURRENT_TIMESTAMP + $4::float8 * INTERVAL '1 second'
+			  WHERE id_delivery = $1`
+
+	result, err := s.conn().ExecContext(ctx, query, id, responseStatus, lastError, delay.Seconds())
+	if err != nil {
+		return translateError(err)
+	}
+	return translateError(checkRowsAffected(result))
+}
+
+func (s *PostgresStore) DeadLetterWebhookDelivery(ctx context.Context, id int, responseStatus *int, lastError string) error {
+	query := `UPDATE webhook_delivery SET status = 'dead', response_status = $2, last_error = $3 WHERE id_delivery = $1`
+
+	result, err := s.conn().ExecContext(ctx, query, id, responseStatus, lastError)
+	if err != nil {
+		return translateError(err)
+	}
+	return translateError(checkRowsAffected(result))
+}
+
+func (s *PostgresStore) RedeliverWebhookDelivery(ctx context.Context, webhookID, id int) (*models.WebhookDelivery, error) {
+	query := `INSERT INTO webhook_delivery (id_webhook, id_event, event_type)
+			  SELECT id_webhook, id_event, event_type FROM webhook_delivery
+			  WHERE id_delivery = $1 AND id_webhook = $2
+			  RETURNING ` + deliveryColumns
+
+	delivery, err := scanWebhookDelivery(s.conn().QueryRowContext(ctx, query, id, webhookID))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return delivery, nil
+}